@@ -0,0 +1,74 @@
+// Package autoruns 提供自启动位置（持久化位置）目录及扫描功能，数据来自 reg、svc 和 task。
+package autoruns
+
+// Source 是自启动位置的数据来源。
+type Source int
+
+const (
+	// SourceRegistry 注册表值，由Location的Root、Path、Value描述
+	SourceRegistry Source = iota
+	// SourceServices 服务列表（svc.List）
+	SourceServices
+	// SourceTasks 计划任务列表（task.List）
+	SourceTasks
+)
+
+// Location 是一个自启动位置的声明。
+type Location struct {
+	// Category 分类，如 Logon、Winlogon、Image Hijacks
+	Category string
+	// Source 数据来源
+	Source Source
+	// Root 根键，HKLM 或 HKCU
+	Root string
+	// Path 相对根键的键路径，"*" 匹配任意一级子键（如 Image File Execution Options\*）
+	Path string
+	// Value 值名称，"*" 表示键下的全部值，空字符串为默认值
+	Value string
+	// Separator 一个值中包含多个条目时的分隔字符，如 Userinit 的 ","
+	Separator string
+	// DefaultDir 映像只有文件名时所在的目录，可包含环境变量
+	DefaultDir string
+	// DefaultExt 映像没有扩展名时追加的扩展名
+	DefaultExt string
+}
+
+const (
+	system32   = `%SystemRoot%\System32`
+	currentVer = `SOFTWARE\Microsoft\Windows\CurrentVersion`
+	currentNT  = `SOFTWARE\Microsoft\Windows NT\CurrentVersion`
+	wowVer     = `SOFTWARE\Wow6432Node\Microsoft\Windows\CurrentVersion`
+	wowNT      = `SOFTWARE\Wow6432Node\Microsoft\Windows NT\CurrentVersion`
+	userVer    = `Software\Microsoft\Windows\CurrentVersion`
+	userNT     = `Software\Microsoft\Windows NT\CurrentVersion`
+)
+
+// Catalog 返回默认的自启动位置目录，每次调用返回新的切片，调用方可以增删后传给Scanner。
+//   返回 - 位置列表
+func Catalog() []Location {
+	return []Location{
+		{Category: "Logon", Root: "HKLM", Path: currentVer + `\Run`, Value: "*"},
+		{Category: "Logon", Root: "HKLM", Path: currentVer + `\RunOnce`, Value: "*"},
+		{Category: "Logon", Root: "HKLM", Path: currentVer + `\Policies\Explorer\Run`, Value: "*"},
+		{Category: "Logon", Root: "HKLM", Path: wowVer + `\Run`, Value: "*"},
+		{Category: "Logon", Root: "HKLM", Path: wowVer + `\RunOnce`, Value: "*"},
+		{Category: "Logon", Root: "HKCU", Path: userVer + `\Run`, Value: "*"},
+		{Category: "Logon", Root: "HKCU", Path: userVer + `\RunOnce`, Value: "*"},
+		{Category: "Logon", Root: "HKCU", Path: userVer + `\Policies\Explorer\Run`, Value: "*"},
+		{Category: "Winlogon", Root: "HKLM", Path: currentNT + `\Winlogon`, Value: "Shell", Separator: ",", DefaultDir: `%SystemRoot%`},
+		{Category: "Winlogon", Root: "HKLM", Path: currentNT + `\Winlogon`, Value: "Userinit", Separator: ",", DefaultDir: system32},
+		{Category: "Winlogon", Root: "HKCU", Path: userNT + `\Winlogon`, Value: "Shell", Separator: ",", DefaultDir: `%SystemRoot%`},
+		{Category: "Image Hijacks", Root: "HKLM", Path: currentNT + `\Image File Execution Options\*`, Value: "Debugger"},
+		{Category: "Image Hijacks", Root: "HKLM", Path: wowNT + `\Image File Execution Options\*`, Value: "Debugger"},
+		{Category: "AppInit", Root: "HKLM", Path: currentNT + `\Windows`, Value: "AppInit_DLLs", Separator: ", ", DefaultDir: system32},
+		{Category: "AppInit", Root: "HKLM", Path: wowNT + `\Windows`, Value: "AppInit_DLLs", Separator: ", ", DefaultDir: `%SystemRoot%\SysWOW64`},
+		{Category: "LSA Providers", Root: "HKLM", Path: `SYSTEM\CurrentControlSet\Control\Lsa`, Value: "Authentication Packages", DefaultDir: system32, DefaultExt: ".dll"},
+		{Category: "LSA Providers", Root: "HKLM", Path: `SYSTEM\CurrentControlSet\Control\Lsa`, Value: "Notification Packages", DefaultDir: system32, DefaultExt: ".dll"},
+		{Category: "LSA Providers", Root: "HKLM", Path: `SYSTEM\CurrentControlSet\Control\Lsa`, Value: "Security Packages", DefaultDir: system32, DefaultExt: ".dll"},
+		{Category: "Active Setup", Root: "HKLM", Path: `SOFTWARE\Microsoft\Active Setup\Installed Components\*`, Value: "StubPath"},
+		{Category: "COM Hijacks", Root: "HKCU", Path: `Software\Classes\CLSID\*\InprocServer32`, Value: ""},
+		{Category: "COM Hijacks", Root: "HKCU", Path: `Software\Classes\CLSID\*\LocalServer32`, Value: ""},
+		{Category: "Services", Source: SourceServices, Root: "HKLM", Path: `SYSTEM\CurrentControlSet\Services`},
+		{Category: "Scheduled Tasks", Source: SourceTasks},
+	}
+}
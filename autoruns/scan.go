@@ -0,0 +1,386 @@
+package autoruns
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kitsch-9527/wcorefx/reg"
+	"github.com/kitsch-9527/wcorefx/svc"
+	"github.com/kitsch-9527/wcorefx/task"
+)
+
+// AutorunEntry 是一个规范化的自启动条目。
+type AutorunEntry struct {
+	// Category 所属位置的分类
+	Category string
+	// Location 来源位置：注册表键的完整路径（如 HKLM\...\Run）或计划任务文件路径
+	Location string
+	// Name 条目名称：值名称、通配子键名称（如 IFEO 的映像名、CLSID）、服务名或任务名
+	Name string
+	// Command 原始命令行或值数据
+	Command string
+	// ImagePath 解析后的映像路径，已展开环境变量
+	ImagePath string
+	// Arguments 命令行参数
+	Arguments string
+	// Enabled 条目是否生效，禁用的服务和计划任务为false
+	Enabled bool
+	// LastWrite 注册表键的最后写入时间，其他来源为零值
+	LastWrite time.Time
+}
+
+// Scanner 按目录扫描自启动位置。HKLM需在同一根键下包含SOFTWARE和
+// SYSTEM\CurrentControlSet，如本机注册表或导入.reg文件的内存树；
+// 单独的离线hive文件不会被合并，也不解析Select\Current。
+type Scanner struct {
+	// Catalog 要扫描的位置，为nil时使用Catalog()
+	Catalog []Location
+	// HKLM 包含SOFTWARE、SYSTEM子键的根键，为nil时跳过HKLM位置
+	HKLM reg.Key
+	// HKCU 用户根键，为nil时跳过HKCU位置
+	HKCU reg.Key
+	// Services 服务列表，通常来自svc.List
+	Services []svc.ServiceInfo
+	// Tasks 计划任务列表，通常来自task.List或task.ListFrom
+	Tasks []task.TaskInfo
+	// Env 展开映像路径中环境变量的变量表（名称不区分大小写），为nil时使用当前进程的环境变量
+	Env map[string]string
+}
+
+// Scan 扫描目录中的全部位置，不存在的键和值被跳过。
+// 某个位置读取失败时继续扫描其他位置，错误合并后返回。
+//   返回1 - 按目录顺序排列的自启动条目
+//   返回2 - 读取失败的位置的错误，全部成功时为nil
+func (s *Scanner) Scan() ([]AutorunEntry, error) {
+	catalog := s.Catalog
+	if catalog == nil {
+		catalog = Catalog()
+	}
+	var entries []AutorunEntry
+	var errs []error
+	for _, loc := range catalog {
+		switch loc.Source {
+		case SourceServices:
+			entries = append(entries, s.scanServices(loc)...)
+		case SourceTasks:
+			entries = append(entries, s.scanTasks(loc)...)
+		default:
+			found, err := s.scanRegistry(loc)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("autoruns: %s\\%s: %w", loc.Root, loc.Path, err))
+			}
+			entries = append(entries, found...)
+		}
+	}
+	return entries, errors.Join(errs...)
+}
+
+// root 返回位置对应的根键。
+func (s *Scanner) root(name string) reg.Key {
+	switch strings.ToUpper(name) {
+	case "HKLM", "HKEY_LOCAL_MACHINE":
+		return s.HKLM
+	case "HKCU", "HKEY_CURRENT_USER":
+		return s.HKCU
+	}
+	return nil
+}
+
+func (s *Scanner) scanRegistry(loc Location) ([]AutorunEntry, error) {
+	root := s.root(loc.Root)
+	if root == nil {
+		return nil, nil
+	}
+	var entries []AutorunEntry
+	err := walkPattern(root, loc.Root, strings.Split(loc.Path, `\`), "", func(k reg.Key, path, item string) error {
+		var values []reg.Value
+		if loc.Value == "*" {
+			var err error
+			if values, err = k.Values(); err != nil {
+				return err
+			}
+		} else {
+			v, err := k.Value(loc.Value)
+			if errors.Is(err, reg.ErrValueNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			values = []reg.Value{v}
+		}
+		for _, v := range values {
+			name := v.Name
+			if loc.Value != "*" && item != "" {
+				name = item
+			}
+			for _, cmd := range commands(v, loc.Separator) {
+				e := AutorunEntry{
+					Category:  loc.Category,
+					Location:  path,
+					Name:      name,
+					Command:   cmd,
+					Enabled:   true,
+					LastWrite: k.LastWrite(),
+				}
+				e.ImagePath, e.Arguments = s.resolve(cmd, loc)
+				entries = append(entries, e)
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// walkPattern 对pattern匹配的每个键调用fn，"*" 匹配任意一级子键，不存在的键被跳过。
+//   path - k的完整路径
+//   item - 最近一个 "*" 匹配的子键名称
+func walkPattern(k reg.Key, path string, pattern []string, item string, fn func(k reg.Key, path, item string) error) error {
+	if len(pattern) == 0 {
+		return fn(k, path, item)
+	}
+	i := 0
+	for i < len(pattern) && pattern[i] != "*" {
+		i++
+	}
+	var names []string
+	if i > 0 {
+		names = []string{strings.Join(pattern[:i], `\`)}
+	} else {
+		var err error
+		if names, err = k.SubKeyNames(); err != nil {
+			return err
+		}
+		i = 1
+	}
+	for _, name := range names {
+		sub, err := k.OpenSubKey(name)
+		if errors.Is(err, reg.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		next := item
+		if pattern[0] == "*" {
+			next = name
+		}
+		err = walkPattern(sub, path+`\`+name, pattern[i:], next, fn)
+		sub.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commands 从值数据中取出命令：REG_MULTI_SZ 的每一项，或按sep拆分的字符串，非字符串值被忽略。
+func commands(v reg.Value, sep string) []string {
+	var items []string
+	if v.Type == reg.REG_MULTI_SZ {
+		items, _ = v.AsStrings()
+	} else if s, err := v.AsString(); err == nil {
+		items = []string{s}
+	}
+	var cmds []string
+	for _, item := range items {
+		parts := []string{item}
+		if sep != "" {
+			parts = strings.FieldsFunc(item, func(r rune) bool { return strings.ContainsRune(sep, r) })
+		}
+		for _, p := range parts {
+			// LSA的包列表用 "" 表示空列表
+			if p = strings.TrimSpace(p); p != "" && p != `""` {
+				cmds = append(cmds, p)
+			}
+		}
+	}
+	return cmds
+}
+
+func (s *Scanner) scanServices(loc Location) []AutorunEntry {
+	var entries []AutorunEntry
+	for _, si := range s.Services {
+		// 手动启动的服务不是自启动项
+		if si.ImagePath == "" || si.StartType == "Manual" {
+			continue
+		}
+		e := AutorunEntry{
+			Category: loc.Category,
+			Location: loc.Root + `\` + loc.Path + `\` + si.Name,
+			Name:     si.Name,
+			Command:  si.ImagePath,
+			Enabled:  si.StartType != "Disabled",
+		}
+		e.ImagePath, e.Arguments = s.resolve(si.ImagePath, loc)
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func (s *Scanner) scanTasks(loc Location) []AutorunEntry {
+	var entries []AutorunEntry
+	for _, t := range s.Tasks {
+		e := AutorunEntry{
+			Category: loc.Category,
+			Location: t.Path,
+			Name:     t.Name,
+			Enabled:  t.Enabled,
+		}
+		switch {
+		case t.ComHandler:
+			e.Command = t.Clsid
+			e.ImagePath = s.normalizeImage(s.comServer(t.Clsid), loc)
+		case t.Command != "":
+			e.Command = strings.TrimSpace(t.Command + " " + t.Arguments)
+			e.ImagePath = s.normalizeImage(strings.Trim(t.Command, `"`), loc)
+			e.Arguments = t.Arguments
+		default:
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// comServer 返回CLSID注册的进程内服务器，HKCU的注册优先于HKLM。
+func (s *Scanner) comServer(clsid string) string {
+	for _, root := range []reg.Key{s.HKCU, s.HKLM} {
+		if root == nil {
+			continue
+		}
+		k, err := root.OpenSubKey(`Software\Classes\CLSID\` + clsid + `\InprocServer32`)
+		if err != nil {
+			continue
+		}
+		v, err := k.Value("")
+		k.Close()
+		if err != nil {
+			continue
+		}
+		if dll, err := v.AsString(); err == nil && dll != "" {
+			return dll
+		}
+	}
+	return ""
+}
+
+// resolve 将命令行拆分为映像路径和参数，并规范化映像路径。
+func (s *Scanner) resolve(cmd string, loc Location) (image, args string) {
+	image, args = splitCommand(cmd)
+	return s.normalizeImage(image, loc), args
+}
+
+// execExts 是判断未加引号的命令行中映像路径结束位置时使用的扩展名。
+var execExts = []string{
+	".exe", ".com", ".bat", ".cmd", ".scr", ".pif", ".dll", ".sys", ".cpl", ".ocx",
+	".ps1", ".vbs", ".vbe", ".js", ".jse", ".wsf", ".hta", ".msi",
+}
+
+func hasExecExt(p string) bool {
+	p = strings.ToLower(p)
+	for _, ext := range execExts {
+		if strings.HasSuffix(p, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitCommand 按CreateProcess的规则拆分命令行：带引号时取引号内的部分，
+// 否则取第一个以可执行扩展名结尾的前缀，使 C:\Program Files\a.exe -x 这类未加引号的路径也能正确拆分。
+func splitCommand(cmd string) (image, args string) {
+	cmd = strings.TrimSpace(cmd)
+	if strings.HasPrefix(cmd, `"`) {
+		if i := strings.IndexByte(cmd[1:], '"'); i >= 0 {
+			return cmd[1 : i+1], strings.TrimSpace(cmd[i+2:])
+		}
+		return strings.Trim(cmd, `"`), ""
+	}
+	for i := 0; i < len(cmd); i++ {
+		if cmd[i] == ' ' && hasExecExt(cmd[:i]) {
+			return cmd[:i], strings.TrimSpace(cmd[i+1:])
+		}
+	}
+	if hasExecExt(cmd) {
+		return cmd, ""
+	}
+	if i := strings.IndexByte(cmd, ' '); i >= 0 {
+		return cmd[:i], strings.TrimSpace(cmd[i+1:])
+	}
+	return cmd, ""
+}
+
+// normalizeImage 将内核和驱动形式的路径转换为Win32路径，展开环境变量，
+// 并为只有文件名的映像补全位置的默认目录和扩展名。
+func (s *Scanner) normalizeImage(image string, loc Location) string {
+	if image == "" {
+		return ""
+	}
+	switch {
+	case hasPrefixFold(image, `\SystemRoot\`):
+		image = `%SystemRoot%\` + image[len(`\SystemRoot\`):]
+	case strings.HasPrefix(image, `\??\`):
+		image = image[len(`\??\`):]
+	case hasPrefixFold(image, `System32\`), hasPrefixFold(image, `SysWOW64\`):
+		// 驱动的ImagePath相对于系统目录
+		image = `%SystemRoot%\` + image
+	}
+	image = s.expand(image)
+	if loc.DefaultDir != "" && !strings.ContainsAny(image, `\/`) {
+		image = s.expand(loc.DefaultDir) + `\` + image
+	}
+	if loc.DefaultExt != "" && !strings.Contains(image[strings.LastIndexAny(image, `\/`)+1:], ".") {
+		image += loc.DefaultExt
+	}
+	return image
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// expand 展开 %NAME% 形式的环境变量，未定义的变量保持原样。
+func (s *Scanner) expand(str string) string {
+	var sb strings.Builder
+	for {
+		i := strings.IndexByte(str, '%')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(str[i+1:], '%')
+		if j < 0 {
+			break
+		}
+		end := i + 1 + j
+		if v, ok := s.lookupEnv(str[i+1 : end]); ok {
+			sb.WriteString(str[:i])
+			sb.WriteString(v)
+			str = str[end+1:]
+		} else {
+			// 结尾的 % 可能是下一个变量的开头
+			sb.WriteString(str[:end])
+			str = str[end:]
+		}
+	}
+	sb.WriteString(str)
+	return sb.String()
+}
+
+func (s *Scanner) lookupEnv(name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	if s.Env == nil {
+		return os.LookupEnv(name)
+	}
+	for k, v := range s.Env {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,37 @@
+//go:build windows
+
+package autoruns
+
+import (
+	"fmt"
+
+	"github.com/kitsch-9527/wcorefx/reg"
+	"github.com/kitsch-9527/wcorefx/svc"
+	"github.com/kitsch-9527/wcorefx/task"
+)
+
+// Scan 使用默认目录扫描本机：HKLM和当前用户的HKCU、svc.List返回的服务、task.List返回的计划任务。
+//   返回1 - 自启动条目
+//   返回2 - 打开根键或枚举服务、任务失败时的错误；个别位置读取失败时同时返回已扫描到的条目
+func Scan() ([]AutorunEntry, error) {
+	hklm, err := reg.OpenLiveKey("HKLM")
+	if err != nil {
+		return nil, err
+	}
+	defer hklm.Close()
+	hkcu, err := reg.OpenLiveKey("HKCU")
+	if err != nil {
+		return nil, err
+	}
+	defer hkcu.Close()
+	services, err := svc.List()
+	if err != nil {
+		return nil, fmt.Errorf("list services failed: %w", err)
+	}
+	tasks, err := task.List()
+	if err != nil {
+		return nil, fmt.Errorf("list tasks failed: %w", err)
+	}
+	s := &Scanner{HKLM: hklm, HKCU: hkcu, Services: services, Tasks: tasks}
+	return s.Scan()
+}
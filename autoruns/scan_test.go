@@ -0,0 +1,192 @@
+package autoruns
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kitsch-9527/wcorefx/reg"
+	"github.com/kitsch-9527/wcorefx/svc"
+	"github.com/kitsch-9527/wcorefx/task"
+)
+
+const comTaskXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Task xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <Actions>
+    <ComHandler>
+      <Clsid>{11111111-2222-3333-4444-555555555555}</Clsid>
+    </ComHandler>
+  </Actions>
+</Task>`
+
+const execTaskXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Task xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <Settings>
+    <Enabled>false</Enabled>
+  </Settings>
+  <Actions>
+    <Exec>
+      <Command>"%ProgramData%\upd\upd.exe"</Command>
+      <Arguments>/silent</Arguments>
+    </Exec>
+  </Actions>
+</Task>`
+
+var testTime = time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+func str(name, s string) reg.Value { return reg.NewValue(name, reg.StringValue(s)) }
+
+// testSources 构造包含各类自启动位置的内存注册表和任务目录。
+func testSources(t *testing.T) *Scanner {
+	hklm := reg.NewMemKey("")
+	run := hklm.CreateKey(currentVer + `\Run`)
+	run.SetLastWrite(testTime)
+	run.SetValue(str("Updater", `C:\Program Files\Upd\upd.exe -background`))
+	run.SetValue(reg.NewValue("Helper", reg.ExpandStringValue(`"%ProgramFiles%\Helper\helper.exe" /min`)))
+	run.SetValue(reg.NewValue("Flag", reg.DWordValue(1)))
+	winlogon := hklm.CreateKey(currentNT + `\Winlogon`)
+	winlogon.SetValue(str("Shell", "explorer.exe"))
+	winlogon.SetValue(str("Userinit", `C:\Windows\system32\userinit.exe,C:\evil.exe,`))
+	hklm.CreateKey(currentNT + `\Image File Execution Options\sethc.exe`).SetValue(str("Debugger", `cmd.exe`))
+	hklm.CreateKey(currentNT + `\Image File Execution Options\notepad.exe`)
+	hklm.CreateKey(currentNT + `\Windows`).SetValue(str("AppInit_DLLs", `C:\a.dll C:\b.dll`))
+	hklm.CreateKey(`SYSTEM\CurrentControlSet\Control\Lsa`).SetValue(reg.NewValue("Security Packages", reg.MultiStringValue{`""`, "kerberos", "evilssp"}))
+	hklm.CreateKey(`SOFTWARE\Classes\CLSID\{11111111-2222-3333-4444-555555555555}\InprocServer32`).SetValue(str("", `C:\Windows\System32\good.dll`))
+
+	hkcu := reg.NewMemKey("")
+	hkcu.CreateKey(userVer + `\RunOnce`).SetValue(str("Once", `%LOCALAPPDATA%\setup.cmd`))
+	hkcu.CreateKey(`Software\Classes\CLSID\{11111111-2222-3333-4444-555555555555}\InprocServer32`).SetValue(str("", `%APPDATA%\hijack.dll`))
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "Vendor"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{`Vendor/Com`: comTaskXML, `Updater`: execTaskXML} {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tasks, err := task.ListFrom(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Scanner{
+		HKLM: hklm,
+		HKCU: hkcu,
+		Services: []svc.ServiceInfo{
+			{Name: "Evil", StartType: "Auto", ImagePath: `"C:\Program Files\Evil\svc.exe" -k run`},
+			{Name: "Drv", StartType: "Disabled", ImagePath: `\SystemRoot\System32\drivers\drv.sys`},
+			{Name: "Beep", StartType: "System", ImagePath: `System32\drivers\beep.sys`},
+			{Name: "Manual", StartType: "Manual", ImagePath: `C:\manual.exe`},
+		},
+		Tasks: tasks,
+		Env: map[string]string{
+			"SystemRoot":   `C:\Windows`,
+			"ProgramFiles": `C:\Program Files`,
+			"ProgramData":  `C:\ProgramData`,
+			"APPDATA":      `C:\Users\u\AppData\Roaming`,
+		},
+	}
+}
+
+func TestScan(t *testing.T) {
+	s := testSources(t)
+	entries, err := s.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type row struct{ Category, Location, Name, ImagePath, Arguments string }
+	var got []row
+	for _, e := range entries {
+		got = append(got, row{e.Category, e.Location, e.Name, e.ImagePath, e.Arguments})
+	}
+	hklmRun := `HKLM\` + currentVer + `\Run`
+	want := []row{
+		{"Logon", hklmRun, "Updater", `C:\Program Files\Upd\upd.exe`, "-background"},
+		{"Logon", hklmRun, "Helper", `C:\Program Files\Helper\helper.exe`, "/min"},
+		{"Logon", `HKCU\` + userVer + `\RunOnce`, "Once", `%LOCALAPPDATA%\setup.cmd`, ""},
+		{"Winlogon", `HKLM\` + currentNT + `\Winlogon`, "Shell", `C:\Windows\explorer.exe`, ""},
+		{"Winlogon", `HKLM\` + currentNT + `\Winlogon`, "Userinit", `C:\Windows\system32\userinit.exe`, ""},
+		{"Winlogon", `HKLM\` + currentNT + `\Winlogon`, "Userinit", `C:\evil.exe`, ""},
+		{"Image Hijacks", `HKLM\` + currentNT + `\Image File Execution Options\sethc.exe`, "sethc.exe", "cmd.exe", ""},
+		{"AppInit", `HKLM\` + currentNT + `\Windows`, "AppInit_DLLs", `C:\a.dll`, ""},
+		{"AppInit", `HKLM\` + currentNT + `\Windows`, "AppInit_DLLs", `C:\b.dll`, ""},
+		{"LSA Providers", `HKLM\SYSTEM\CurrentControlSet\Control\Lsa`, "Security Packages", `C:\Windows\System32\kerberos.dll`, ""},
+		{"LSA Providers", `HKLM\SYSTEM\CurrentControlSet\Control\Lsa`, "Security Packages", `C:\Windows\System32\evilssp.dll`, ""},
+		{"COM Hijacks", `HKCU\Software\Classes\CLSID\{11111111-2222-3333-4444-555555555555}\InprocServer32`, "{11111111-2222-3333-4444-555555555555}", `C:\Users\u\AppData\Roaming\hijack.dll`, ""},
+		{"Services", `HKLM\SYSTEM\CurrentControlSet\Services\Evil`, "Evil", `C:\Program Files\Evil\svc.exe`, "-k run"},
+		{"Services", `HKLM\SYSTEM\CurrentControlSet\Services\Drv`, "Drv", `C:\Windows\System32\drivers\drv.sys`, ""},
+		{"Services", `HKLM\SYSTEM\CurrentControlSet\Services\Beep`, "Beep", `C:\Windows\System32\drivers\beep.sys`, ""},
+		{"Scheduled Tasks", s.Tasks[0].Path, `\Updater`, `C:\ProgramData\upd\upd.exe`, "/silent"},
+		{"Scheduled Tasks", s.Tasks[1].Path, `\Vendor\Com`, `C:\Users\u\AppData\Roaming\hijack.dll`, ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		for i := range got {
+			t.Logf("%d: %+v", i, got[i])
+		}
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+
+	if !entries[0].LastWrite.Equal(testTime) || !entries[0].Enabled {
+		t.Errorf("Run entry = %+v", entries[0])
+	}
+	if entries[13].Enabled || !entries[14].Enabled || entries[15].Enabled {
+		t.Errorf("Enabled = %v %v %v", entries[13].Enabled, entries[14].Enabled, entries[15].Enabled)
+	}
+	if entries[15].Command != `"%ProgramData%\upd\upd.exe" /silent` || entries[16].Command != "{11111111-2222-3333-4444-555555555555}" {
+		t.Errorf("task commands = %q, %q", entries[15].Command, entries[16].Command)
+	}
+}
+
+func TestScanCatalog(t *testing.T) {
+	s := testSources(t)
+	s.Catalog = []Location{{Category: "Custom", Root: "HKLM", Path: currentNT + `\Image File Execution Options\*`, Value: "Debugger"}}
+	s.HKCU = nil
+	entries, err := s.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Category != "Custom" || entries[0].Name != "sethc.exe" {
+		t.Errorf("entries = %+v", entries)
+	}
+
+	s.Catalog = []Location{{Category: "Logon", Root: "HKCU", Path: userVer + `\RunOnce`, Value: "*"}}
+	if entries, err := s.Scan(); err != nil || len(entries) != 0 {
+		t.Errorf("nil HKCU: %+v, %v", entries, err)
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	for _, c := range []struct{ cmd, image, args string }{
+		{`"C:\Program Files\a.exe" -x "y z"`, `C:\Program Files\a.exe`, `-x "y z"`},
+		{`C:\Program Files\a.exe -x`, `C:\Program Files\a.exe`, `-x`},
+		{`rundll32.exe shell32.dll,Control_RunDLL`, `rundll32.exe`, `shell32.dll,Control_RunDLL`},
+		{`autochk *`, `autochk`, `*`},
+		{`"unterminated`, `unterminated`, ``},
+		{`  C:\a.dll  `, `C:\a.dll`, ``},
+	} {
+		image, args := splitCommand(c.cmd)
+		if image != c.image || args != c.args {
+			t.Errorf("splitCommand(%q) = %q, %q; want %q, %q", c.cmd, image, args, c.image, c.args)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	s := &Scanner{Env: map[string]string{"SYSTEMROOT": `C:\Windows`}}
+	for in, want := range map[string]string{
+		`%SystemRoot%\x`:          `C:\Windows\x`,
+		`50%%systemroot%\x`:       `50%C:\Windows\x`,
+		`%unknown%\%SystemRoot%`:  `%unknown%\C:\Windows`,
+		`%SystemRoot`:             `%SystemRoot`,
+		`\??\C:\Windows\evil.sys`: `\??\C:\Windows\evil.sys`,
+	} {
+		if got := s.expand(in); got != want {
+			t.Errorf("expand(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
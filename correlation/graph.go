@@ -0,0 +1,511 @@
+// Package correlation 提供基于 Security 日志的登录会话与进程谱系关联，纯 Go 实现，可由 evtx.Reader 或离线解析器输入事件。
+package correlation
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kitsch-9527/wcorefx/evtx"
+)
+
+// 关联使用的Security事件ID。
+const (
+	EventLogon             = 4624
+	EventLogoff            = 4634
+	EventUserLogoff        = 4647
+	EventSpecialPrivileges = 4672
+	EventProcessCreate     = 4688
+	EventProcessExit       = 4689
+)
+
+// privilegeWindow 是4672与对应4624之间允许的时间差，二者通常在同一时刻以任意顺序写入。
+const privilegeWindow = 2 * time.Second
+
+// Session 是一次登录会话（4624到4634/4647）。
+type Session struct {
+	// Computer 计算机名称，登录ID只在同一台计算机内唯一。
+	Computer string
+	// LogonID 登录ID，规范化为小写十六进制，如 0x3e7。
+	LogonID string
+	// LinkedLogonID 关联的登录ID（UAC拆分令牌的另一半），没有时为空。
+	LinkedLogonID string
+	// UserSID 登录用户的SID。
+	UserSID string
+	// UserName 登录用户名。
+	UserName string
+	// Domain 登录用户所在域。
+	Domain string
+	// LogonType 登录类型，如 2 交互式、3 网络、10 远程交互式。
+	LogonType int
+	// SourceIP 来源地址，本地登录时为空。
+	SourceIP string
+	// Workstation 来源工作站名称。
+	Workstation string
+	// AuthPackage 身份验证包，如 Kerberos、NTLM、Negotiate。
+	AuthPackage string
+	// Start 登录时间，只收到4672时为4672的时间。
+	Start time.Time
+	// End 注销时间，会话未结束时为零值。
+	End time.Time
+	// Privileges 4672分配的特殊权限，如 SeDebugPrivilege。
+	Privileges []string
+	// RecordID 4624事件的记录编号，只收到4672时为0。
+	RecordID uint64
+}
+
+// Active 判断会话在t时刻是否处于登录状态。
+//   t - 时间点
+//   返回 - 会话在t时刻已开始且未结束时为true
+func (s *Session) Active(t time.Time) bool {
+	return !t.Before(s.Start) && (s.End.IsZero() || !t.After(s.End))
+}
+
+// Process 是一个进程（4688到4689）。
+type Process struct {
+	// Computer 计算机名称。
+	Computer string
+	// PID 进程ID。
+	PID uint64
+	// Image 可执行文件路径。
+	Image string
+	// CommandLine 命令行，未启用命令行审核时为空。
+	CommandLine string
+	// ParentPID 创建者进程ID。
+	ParentPID uint64
+	// ParentImage 创建者可执行文件路径（4688版本2及以上）。
+	ParentImage string
+	// LogonID 进程令牌所属的登录ID：4688带TargetLogonId时使用该值，否则为创建者的SubjectLogonId。
+	LogonID string
+	// UserSID 进程所属用户的SID。
+	UserSID string
+	// Start 创建时间。
+	Start time.Time
+	// End 退出时间，未收到4689时为零值。
+	End time.Time
+	// ExitStatus 退出码，如 0x0。
+	ExitStatus string
+	// RecordID 4688事件的记录编号。
+	RecordID uint64
+}
+
+// Alive 判断进程在t时刻是否存在。
+//   t - 时间点
+//   返回 - 进程在t时刻已创建且未退出时为true
+func (p *Process) Alive(t time.Time) bool {
+	return !t.Before(p.Start) && (p.End.IsZero() || !t.After(p.End))
+}
+
+type hostKey struct {
+	computer string
+	id       string
+}
+
+type pidKey struct {
+	computer string
+	pid      uint64
+}
+
+// Graph 保存登录会话与进程的内存关联图，可并发使用。
+// 同一登录ID或PID可能被重复使用，查询时按时间选择对应的会话或进程，因此登录、特权与进程创建事件可以乱序输入；
+// 注销与进程退出事件需在对应的4624/4688之后输入，否则被忽略。
+type Graph struct {
+	mu        sync.RWMutex
+	sessions  map[hostKey][]*Session
+	processes map[pidKey][]*Process
+}
+
+// New 创建空的关联图。
+//   返回 - 关联图
+func New() *Graph {
+	return &Graph{
+		sessions:  map[hostKey][]*Session{},
+		processes: map[pidKey][]*Process{},
+	}
+}
+
+// Add 将一个事件加入关联图，只处理Security通道的4624、4634、4647、4672、4688与4689。
+//   e - 事件
+//   返回1 - 事件被关联图使用时为true
+//   返回2 - 事件字段无效（如进程ID不是数字）时的错误，成功或忽略时为nil
+func (g *Graph) Add(e *evtx.Event) (bool, error) {
+	if e.Channel != "" && !strings.EqualFold(e.Channel, "Security") {
+		return false, nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var err error
+	switch e.EventIdentifier.ID {
+	case EventLogon:
+		err = g.logon(e)
+	case EventLogoff, EventUserLogoff:
+		g.logoff(e)
+	case EventSpecialPrivileges:
+		g.privileges(e)
+	case EventProcessCreate:
+		err = g.processCreate(e)
+	case EventProcessExit:
+		err = g.processExit(e)
+	default:
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("record %d event %d: %w", e.RecordID, e.EventIdentifier.ID, err)
+	}
+	return true, nil
+}
+
+// AddRecords 批量加入Reader.Read或File.Records返回的记录，无效事件跳过。
+//   records - 事件记录
+//   返回 - 被关联图使用的记录数
+func (g *Graph) AddRecords(records []evtx.Record) int {
+	n := 0
+	for i := range records {
+		if ok, _ := g.Add(&records[i].Event); ok {
+			n++
+		}
+	}
+	return n
+}
+
+func (g *Graph) logon(e *evtx.Event) error {
+	d := dataMap(e)
+	id := normalizeLogonID(d["TargetLogonId"])
+	if id == "" {
+		return fmt.Errorf("invalid TargetLogonId %q", d["TargetLogonId"])
+	}
+	t := e.TimeCreated.SystemTime
+	k := hostKey{e.Computer, id}
+	var s *Session
+	// 先写入的4672已创建占位会话时补全它。
+	for _, c := range g.sessions[k] {
+		if c.RecordID == 0 && absDuration(c.Start.Sub(t)) <= privilegeWindow {
+			s = c
+			break
+		}
+	}
+	if s == nil {
+		s = &Session{Computer: e.Computer, LogonID: id}
+		g.sessions[k] = insertSession(g.sessions[k], s, t)
+	}
+	s.Start = t
+	s.RecordID = e.RecordID
+	s.UserSID = d["TargetUserSid"]
+	s.UserName = d["TargetUserName"]
+	s.Domain = d["TargetDomainName"]
+	s.LogonType, _ = strconv.Atoi(d["LogonType"])
+	s.SourceIP = cleanField(d["IpAddress"])
+	s.Workstation = cleanField(d["WorkstationName"])
+	s.AuthPackage = d["AuthenticationPackageName"]
+	if linked := normalizeLogonID(d["TargetLinkedLogonId"]); linked != "0x0" {
+		s.LinkedLogonID = linked
+	}
+	sortSessions(g.sessions[k])
+	return nil
+}
+
+func (g *Graph) logoff(e *evtx.Event) {
+	d := dataMap(e)
+	t := e.TimeCreated.SystemTime
+	if s := g.sessionAt(e.Computer, normalizeLogonID(d["TargetLogonId"]), t); s != nil {
+		s.End = t
+	}
+}
+
+func (g *Graph) privileges(e *evtx.Event) {
+	d := dataMap(e)
+	id := normalizeLogonID(d["SubjectLogonId"])
+	if id == "" {
+		return
+	}
+	t := e.TimeCreated.SystemTime
+	k := hostKey{e.Computer, id}
+	var s *Session
+	for _, c := range g.sessions[k] {
+		if absDuration(c.Start.Sub(t)) <= privilegeWindow || c.Active(t) {
+			s = c
+		}
+	}
+	if s == nil {
+		s = &Session{Computer: e.Computer, LogonID: id, Start: t, UserSID: d["SubjectUserSid"],
+			UserName: d["SubjectUserName"], Domain: d["SubjectDomainName"]}
+		g.sessions[k] = insertSession(g.sessions[k], s, t)
+	}
+	s.Privileges = strings.Fields(d["PrivilegeList"])
+}
+
+func (g *Graph) processCreate(e *evtx.Event) error {
+	d := dataMap(e)
+	pid, err := parsePID(d["NewProcessId"])
+	if err != nil {
+		return fmt.Errorf("NewProcessId: %w", err)
+	}
+	ppid, err := parsePID(d["ProcessId"])
+	if err != nil {
+		return fmt.Errorf("ProcessId: %w", err)
+	}
+	p := &Process{
+		Computer:    e.Computer,
+		PID:         pid,
+		Image:       d["NewProcessName"],
+		CommandLine: d["CommandLine"],
+		ParentPID:   ppid,
+		ParentImage: d["ParentProcessName"],
+		LogonID:     normalizeLogonID(d["SubjectLogonId"]),
+		UserSID:     d["SubjectUserSid"],
+		Start:       e.TimeCreated.SystemTime,
+		RecordID:    e.RecordID,
+	}
+	if target := normalizeLogonID(d["TargetLogonId"]); target != "" && target != "0x0" {
+		p.LogonID = target
+		p.UserSID = d["TargetUserSid"]
+	}
+	k := pidKey{e.Computer, pid}
+	list := append(g.processes[k], p)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Start.Before(list[j].Start) })
+	g.processes[k] = list
+	return nil
+}
+
+func (g *Graph) processExit(e *evtx.Event) error {
+	d := dataMap(e)
+	pid, err := parsePID(d["ProcessId"])
+	if err != nil {
+		return fmt.Errorf("ProcessId: %w", err)
+	}
+	t := e.TimeCreated.SystemTime
+	if p := g.processAt(e.Computer, pid, t); p != nil && p.End.IsZero() {
+		p.End = t
+		p.ExitStatus = d["Status"]
+	}
+	return nil
+}
+
+// Session 返回t时刻使用该登录ID的会话。
+//   computer - 计算机名称
+//   logonID - 登录ID，如 0x3E7 或 999
+//   t - 时间点
+//   返回 - 会话，没有时为nil
+func (g *Graph) Session(computer, logonID string, t time.Time) *Session {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.sessionAt(computer, normalizeLogonID(logonID), t)
+}
+
+// sessionAt 返回t时刻或之前最近开始的会话，已结束的会话只在结束前匹配。
+func (g *Graph) sessionAt(computer, id string, t time.Time) *Session {
+	list := g.sessions[hostKey{computer, id}]
+	for i := len(list) - 1; i >= 0; i-- {
+		if s := list[i]; s.Active(t) {
+			return s
+		}
+	}
+	return nil
+}
+
+// Process 返回t时刻使用该PID的进程，用于区分被重复使用的PID。
+//   computer - 计算机名称
+//   pid - 进程ID
+//   t - 时间点
+//   返回 - 进程，没有时为nil
+func (g *Graph) Process(computer string, pid uint64, t time.Time) *Process {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.processAt(computer, pid, t)
+}
+
+func (g *Graph) processAt(computer string, pid uint64, t time.Time) *Process {
+	list := g.processes[pidKey{computer, pid}]
+	for i := len(list) - 1; i >= 0; i-- {
+		if p := list[i]; p.Alive(t) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Parent 返回创建该进程的父进程：创建时刻仍存在的、PID为ParentPID的进程。
+//   p - 进程
+//   返回 - 父进程，不在关联图中时为nil
+func (g *Graph) Parent(p *Process) *Process {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.parent(p)
+}
+
+func (g *Graph) parent(p *Process) *Process {
+	parent := g.processAt(p.Computer, p.ParentPID, p.Start)
+	if parent == p {
+		return nil
+	}
+	return parent
+}
+
+// Children 返回该进程创建的子进程，按创建时间排序。
+//   p - 进程
+//   返回 - 子进程列表
+func (g *Graph) Children(p *Process) []*Process {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var out []*Process
+	for k, list := range g.processes {
+		if k.computer != p.Computer {
+			continue
+		}
+		for _, c := range list {
+			if c.ParentPID == p.PID && c != p && g.parent(c) == p {
+				out = append(out, c)
+			}
+		}
+	}
+	sortProcesses(out)
+	return out
+}
+
+// Ancestors 返回进程的祖先链，从父进程开始直到关联图中最早的祖先。
+//   p - 进程
+//   返回 - 祖先进程列表
+func (g *Graph) Ancestors(p *Process) []*Process {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var out []*Process
+	seen := map[*Process]bool{p: true}
+	for cur := g.parent(p); cur != nil && !seen[cur]; cur = g.parent(cur) {
+		seen[cur] = true
+		out = append(out, cur)
+	}
+	return out
+}
+
+// LogonOf 返回创建该进程的登录会话，即进程令牌所属登录ID在进程创建时刻对应的会话。
+//   p - 进程
+//   返回 - 登录会话，对应的4624不在关联图中时为nil
+func (g *Graph) LogonOf(p *Process) *Session {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.sessionAt(p.Computer, p.LogonID, p.Start)
+}
+
+// SessionProcesses 返回会话期间以该登录ID创建的全部进程，按创建时间排序。
+//   s - 登录会话
+//   返回 - 进程列表
+func (g *Graph) SessionProcesses(s *Session) []*Process {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var out []*Process
+	for k, list := range g.processes {
+		if k.computer != s.Computer {
+			continue
+		}
+		for _, p := range list {
+			if p.LogonID == s.LogonID && g.sessionAt(p.Computer, p.LogonID, p.Start) == s {
+				out = append(out, p)
+			}
+		}
+	}
+	sortProcesses(out)
+	return out
+}
+
+// Sessions 返回全部会话，按开始时间排序。
+//   返回 - 会话列表
+func (g *Graph) Sessions() []*Session {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var out []*Session
+	for _, list := range g.sessions {
+		out = append(out, list...)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].Start.Equal(out[j].Start) {
+			return out[i].Start.Before(out[j].Start)
+		}
+		return out[i].LogonID < out[j].LogonID
+	})
+	return out
+}
+
+// Processes 返回全部进程，按创建时间排序。
+//   返回 - 进程列表
+func (g *Graph) Processes() []*Process {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var out []*Process
+	for _, list := range g.processes {
+		out = append(out, list...)
+	}
+	sortProcesses(out)
+	return out
+}
+
+func sortProcesses(ps []*Process) {
+	sort.SliceStable(ps, func(i, j int) bool {
+		if !ps[i].Start.Equal(ps[j].Start) {
+			return ps[i].Start.Before(ps[j].Start)
+		}
+		return ps[i].PID < ps[j].PID
+	})
+}
+
+func sortSessions(ss []*Session) {
+	sort.SliceStable(ss, func(i, j int) bool { return ss[i].Start.Before(ss[j].Start) })
+}
+
+func insertSession(list []*Session, s *Session, t time.Time) []*Session {
+	s.Start = t
+	list = append(list, s)
+	sortSessions(list)
+	return list
+}
+
+// dataMap 将EventData转为字段名到值的映射。
+func dataMap(e *evtx.Event) map[string]string {
+	m := make(map[string]string, len(e.EventData.Pairs))
+	for _, p := range e.EventData.Pairs {
+		m[p.Key] = p.Value
+	}
+	return m
+}
+
+// normalizeLogonID 将 0x3E7、999 等形式统一为小写十六进制，无法解析时返回空串。
+func normalizeLogonID(s string) string {
+	v, err := parseUint(s)
+	if err != nil {
+		return ""
+	}
+	return "0x" + strconv.FormatUint(v, 16)
+}
+
+func parsePID(s string) (uint64, error) {
+	v, err := parseUint(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid process id %q", s)
+	}
+	return v, nil
+}
+
+func parseUint(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return strconv.ParseUint(s[2:], 16, 64)
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// cleanField 去掉Security日志中表示空值的 "-"。
+func cleanField(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,188 @@
+package correlation
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kitsch-9527/wcorefx/evtx"
+)
+
+var base = time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+// secEvent 构造Security事件，kv为交替的字段名与值。
+func secEvent(id uint32, record uint64, offset time.Duration, kv ...string) *evtx.Event {
+	e := &evtx.Event{
+		EventIdentifier: evtx.EventIdentifier{ID: id},
+		RecordID:        record,
+		Channel:         "Security",
+		Computer:        "WS01",
+		TimeCreated:     evtx.TimeCreated{SystemTime: base.Add(offset)},
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		e.EventData.Pairs = append(e.EventData.Pairs, evtx.KeyValue{Key: kv[i], Value: kv[i+1]})
+	}
+	return e
+}
+
+func logon(record uint64, at time.Duration, id, user, logonType string) *evtx.Event {
+	return secEvent(4624, record, at, "TargetUserSid", "S-1-5-21-1-1001", "TargetUserName", user, "TargetDomainName", "CORP",
+		"TargetLogonId", id, "LogonType", logonType, "IpAddress", "-", "WorkstationName", "WS01",
+		"AuthenticationPackageName", "Negotiate", "TargetLinkedLogonId", "0x0")
+}
+
+func create(record uint64, at time.Duration, pid, ppid, image, logonID string) *evtx.Event {
+	return secEvent(4688, record, at, "SubjectUserSid", "S-1-5-21-1-1001", "SubjectLogonId", logonID,
+		"NewProcessId", pid, "NewProcessName", image, "ProcessId", ppid, "CommandLine", image+" /x", "TargetLogonId", "0x0")
+}
+
+func exit(record uint64, at time.Duration, pid string) *evtx.Event {
+	return secEvent(4689, record, at, "ProcessId", pid, "Status", "0x0")
+}
+
+func mustAdd(t *testing.T, g *Graph, events ...*evtx.Event) {
+	t.Helper()
+	for _, e := range events {
+		if ok, err := g.Add(e); !ok || err != nil {
+			t.Fatalf("Add(record %d) = %v, %v", e.RecordID, ok, err)
+		}
+	}
+}
+
+func images(ps []*Process) []string {
+	out := []string{}
+	for _, p := range ps {
+		out = append(out, p.Image)
+	}
+	return out
+}
+
+func TestSessionAndLineage(t *testing.T) {
+	g := New()
+	// 4672先于4624写入：应合并为同一个会话。
+	mustAdd(t, g,
+		secEvent(4672, 1, 0, "SubjectUserSid", "S-1-5-21-1-1001", "SubjectUserName", "alice", "SubjectLogonId", "0x1A2B3",
+			"PrivilegeList", "SeDebugPrivilege\r\n\t\t\tSeBackupPrivilege"),
+		logon(2, 0, "0x1A2B3", "alice", "10"),
+		create(3, time.Second, "0x100", "0x4", `C:\Windows\explorer.exe`, "0x1a2b3"),
+		create(4, 2*time.Second, "0x200", "0x100", `C:\Windows\System32\cmd.exe`, "0x1a2b3"),
+		create(5, 3*time.Second, "0x300", "0x200", `C:\Windows\System32\whoami.exe`, "0x1a2b3"),
+		exit(6, 4*time.Second, "0x300"),
+	)
+
+	ss := g.Sessions()
+	if len(ss) != 1 {
+		t.Fatalf("Sessions = %d, want 1", len(ss))
+	}
+	s := ss[0]
+	if s.LogonID != "0x1a2b3" || s.UserName != "alice" || s.LogonType != 10 || s.SourceIP != "" || s.RecordID != 2 ||
+		!reflect.DeepEqual(s.Privileges, []string{"SeDebugPrivilege", "SeBackupPrivilege"}) {
+		t.Errorf("session = %+v", s)
+	}
+
+	whoami := g.Process("WS01", 0x300, base.Add(3*time.Second))
+	if whoami == nil || whoami.ExitStatus != "0x0" || !whoami.End.Equal(base.Add(4*time.Second)) {
+		t.Fatalf("whoami = %+v", whoami)
+	}
+	if got := images(g.Ancestors(whoami)); !reflect.DeepEqual(got, []string{`C:\Windows\System32\cmd.exe`, `C:\Windows\explorer.exe`}) {
+		t.Errorf("Ancestors = %v", got)
+	}
+	if got := g.LogonOf(whoami); got != s {
+		t.Errorf("LogonOf = %+v, want session 0x1a2b3", got)
+	}
+	if got := g.Session("WS01", "107187", base.Add(time.Minute)); got != s {
+		t.Errorf("Session(decimal id) = %+v", got)
+	}
+	cmd := g.Parent(whoami)
+	if got := images(g.Children(cmd)); !reflect.DeepEqual(got, []string{`C:\Windows\System32\whoami.exe`}) {
+		t.Errorf("Children(cmd) = %v", got)
+	}
+	if got := len(g.SessionProcesses(s)); got != 3 {
+		t.Errorf("SessionProcesses = %d, want 3", got)
+	}
+
+	mustAdd(t, g, secEvent(4634, 7, time.Hour, "TargetLogonId", "0x1a2b3"))
+	if !s.End.Equal(base.Add(time.Hour)) || g.Session("WS01", "0x1a2b3", base.Add(2*time.Hour)) != nil {
+		t.Errorf("logoff not applied: end %v", s.End)
+	}
+}
+
+func TestPIDReuse(t *testing.T) {
+	g := New()
+	mustAdd(t, g,
+		logon(1, 0, "0x10", "alice", "2"),
+		logon(2, 0, "0x20", "bob", "3"),
+		create(3, time.Second, "0x500", "0x4", `C:\a\first.exe`, "0x10"),
+		exit(4, 2*time.Second, "0x500"),
+		create(5, 3*time.Second, "0x500", "0x4", `C:\b\second.exe`, "0x20"),
+		create(6, 1500*time.Millisecond, "0x600", "0x500", `C:\a\child1.exe`, "0x10"),
+		create(7, 4*time.Second, "0x700", "0x500", `C:\b\child2.exe`, "0x20"),
+	)
+	c1 := g.Process("WS01", 0x600, base.Add(5*time.Second))
+	c2 := g.Process("WS01", 0x700, base.Add(5*time.Second))
+	if p := g.Parent(c1); p == nil || p.Image != `C:\a\first.exe` {
+		t.Errorf("Parent(child1) = %+v", p)
+	}
+	if p := g.Parent(c2); p == nil || p.Image != `C:\b\second.exe` {
+		t.Errorf("Parent(child2) = %+v", p)
+	}
+	if s := g.LogonOf(c2); s == nil || s.UserName != "bob" {
+		t.Errorf("LogonOf(child2) = %+v", s)
+	}
+	if p := g.Process("WS01", 0x500, base.Add(2500*time.Millisecond)); p != nil {
+		t.Errorf("Process between lifetimes = %+v, want nil", p)
+	}
+	if got := images(g.Processes()); !reflect.DeepEqual(got, []string{`C:\a\first.exe`, `C:\a\child1.exe`, `C:\b\second.exe`, `C:\b\child2.exe`}) {
+		t.Errorf("Processes = %v", got)
+	}
+}
+
+func TestTargetLogonAndFiltering(t *testing.T) {
+	g := New()
+	runas := create(2, time.Second, "0x900", "0x100", `C:\Windows\System32\cmd.exe`, "0x10")
+	runas.EventData.Pairs[len(runas.EventData.Pairs)-1].Value = "0x30"
+	runas.EventData.Pairs = append(runas.EventData.Pairs, evtx.KeyValue{Key: "TargetUserSid", Value: "S-1-5-21-1-500"})
+	mustAdd(t, g, logon(1, 0, "0x30", "admin", "2"), runas)
+	p := g.Process("WS01", 0x900, base.Add(time.Second))
+	if p.LogonID != "0x30" || p.UserSID != "S-1-5-21-1-500" || g.LogonOf(p).UserName != "admin" {
+		t.Errorf("runas process = %+v", p)
+	}
+
+	sysmon := secEvent(4688, 3, 0)
+	sysmon.Channel = "Microsoft-Windows-Sysmon/Operational"
+	if ok, err := g.Add(sysmon); ok || err != nil {
+		t.Errorf("Add(non-Security) = %v, %v", ok, err)
+	}
+	if ok, err := g.Add(secEvent(4625, 4, 0)); ok || err != nil {
+		t.Errorf("Add(4625) = %v, %v", ok, err)
+	}
+	if _, err := g.Add(create(5, 0, "bogus", "0x4", "x", "0x10")); err == nil {
+		t.Error("Add accepted invalid NewProcessId")
+	}
+	n := g.AddRecords([]evtx.Record{{Event: *exit(6, 2*time.Second, "0x900")}, {Event: *secEvent(1102, 7, 0)}})
+	if n != 1 || p.End.IsZero() {
+		t.Errorf("AddRecords = %d, end %v", n, p.End)
+	}
+}
+
+func TestConcurrentAdd(t *testing.T) {
+	g := New()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				pid := uint64(i*100 + j + 1)
+				g.Add(create(pid, time.Duration(pid)*time.Millisecond, "0x"+strconv.FormatUint(pid, 16), "0x4", "x.exe", "0x3e7"))
+				g.Processes()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := len(g.Processes()); n != 400 {
+		t.Errorf("Processes = %d, want 400", n)
+	}
+}
@@ -0,0 +1,935 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// BinXML 令牌类型，低4位为类型，0x40表示"更多数据"标志。
+const (
+	tokenEOF               = 0x00
+	tokenOpenStartElement  = 0x01
+	tokenCloseStartElement = 0x02
+	tokenCloseEmptyElement = 0x03
+	tokenEndElement        = 0x04
+	tokenValue             = 0x05
+	tokenAttribute         = 0x06
+	tokenCDATA             = 0x07
+	tokenCharRef           = 0x08
+	tokenEntityRef         = 0x09
+	tokenPITarget          = 0x0a
+	tokenPIData            = 0x0b
+	tokenTemplateInstance  = 0x0c
+	tokenNormalSubst       = 0x0d
+	tokenOptionalSubst     = 0x0e
+	tokenFragmentHeader    = 0x0f
+
+	tokenMoreFlag = 0x40
+)
+
+// BinXML 替换值类型。
+const (
+	valueNull       = 0x00
+	valueString     = 0x01
+	valueAnsiString = 0x02
+	valueInt8       = 0x03
+	valueUInt8      = 0x04
+	valueInt16      = 0x05
+	valueUInt16     = 0x06
+	valueInt32      = 0x07
+	valueUInt32     = 0x08
+	valueInt64      = 0x09
+	valueUInt64     = 0x0a
+	valueReal32     = 0x0b
+	valueReal64     = 0x0c
+	valueBool       = 0x0d
+	valueBinary     = 0x0e
+	valueGUID       = 0x0f
+	valueSizeT      = 0x10
+	valueFileTime   = 0x11
+	valueSystemTime = 0x12
+	valueSID        = 0x13
+	valueHexInt32   = 0x14
+	valueHexInt64   = 0x15
+	valueEvtHandle  = 0x20
+	valueBinXML     = 0x21
+	valueEvtXML     = 0x23
+
+	valueArrayFlag = 0x80
+)
+
+// bxKind 标识BinXML内容节点的类型。
+type bxKind int
+
+const (
+	bxText bxKind = iota
+	bxElement
+	bxSubstitution
+	bxCDATA
+	bxCharRef
+	bxEntityRef
+	bxPI
+	bxInstance
+)
+
+// bxNode 是解析后的BinXML内容节点。
+type bxNode struct {
+	kind     bxKind
+	text     string
+	elem     *bxElem
+	index    int
+	optional bool
+	tmpl     *bxTemplateInstance
+}
+
+// bxElem 是一个BinXML元素及其属性和子节点。
+type bxElem struct {
+	name     string
+	attrs    []bxAttr
+	children []bxNode
+	empty    bool
+}
+
+// bxAttr 是一个BinXML属性，其值可由多个内容节点组成。
+type bxAttr struct {
+	name  string
+	value []bxNode
+}
+
+// bxTemplate 是模板定义中已解析的元素树。
+type bxTemplate struct {
+	offset int
+	nodes  []bxNode
+}
+
+// bxValue 是模板实例中的一个替换值，offset为数据在缓冲区中的偏移。
+type bxValue struct {
+	typ    byte
+	offset int
+	data   []byte
+}
+
+// bxTemplateInstance 是模板定义与其替换值数组的组合。
+type bxTemplateInstance struct {
+	def    *bxTemplate
+	values []bxValue
+}
+
+// binXMLParser 解析BinXML数据。名称与模板以相对buf起始的偏移引用，
+// 因此buf对于事件记录而言是整个块的数据。
+type binXMLParser struct {
+	buf []byte
+	pos int
+	// templates 按定义偏移缓存已解析的模板，生命周期与buf所属的块相同。
+	templates map[int]*bxTemplate
+	// depth 当前嵌套BinXML的深度，用于拒绝恶意的递归数据。
+	depth int
+	// parsing 正在解析的模板定义偏移，用于拒绝直接或间接引用自身的模板。
+	parsing map[int]bool
+	// emitted 本次渲染已写出的估计字节数，用于限制模板的重复展开。
+	emitted int
+}
+
+// maxBinXMLDepth 限制替换值中嵌套BinXML的层数。
+const maxBinXMLDepth = 16
+
+// maxBinXMLOutput 限制单次渲染的输出大小。模板可以多次实例化另一个模板，
+// 逐层嵌套时输出随层数指数增长，而正常事件的XML远小于此值。
+const maxBinXMLOutput = 4 << 20
+
+// DecodeBinXML 将独立的BinXML片段（如事件记录数据或嵌套的BinXml替换值）渲染为XML。
+// 片段中的名称与模板偏移均相对data起始。
+//   data - BinXML字节数据
+//   返回1 - 与EvtRender(EvtRenderEventXml)等价的XML
+//   返回2 - 解析过程中的错误，成功时为nil
+func DecodeBinXML(data []byte) ([]byte, error) {
+	p := &binXMLParser{buf: data, templates: map[int]*bxTemplate{}}
+	return p.render(0, len(data))
+}
+
+// DecodeBinXMLEvent 将独立的BinXML片段渲染为XML并解析为Event。
+//   data - BinXML字节数据
+//   返回1 - 解析后的事件对象
+//   返回2 - 解析过程中的错误，成功时为nil
+func DecodeBinXMLEvent(data []byte) (Event, error) {
+	xmlData, err := DecodeBinXML(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return UnmarshalXML(xmlData)
+}
+
+// render 解析[start,end)区间的BinXML片段并渲染为XML。
+func (p *binXMLParser) render(start, end int) ([]byte, error) {
+	nodes, err := p.parseFragment(start, end)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := p.writeNodes(&out, nodes, nil); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// parseFragment 解析一个以EOF结束的BinXML片段。
+func (p *binXMLParser) parseFragment(start, end int) ([]bxNode, error) {
+	if start < 0 || end > len(p.buf) || start > end {
+		return nil, fmt.Errorf("fragment range [%d,%d) out of bounds", start, end)
+	}
+	saved := p.pos
+	p.pos = start
+	defer func() { p.pos = saved }()
+	return p.parseContent(end, false)
+}
+
+// parseContent 解析内容节点直到EOF，或在inElement时直到EndElement。
+func (p *binXMLParser) parseContent(end int, inElement bool) ([]bxNode, error) {
+	var nodes []bxNode
+	for p.pos < end {
+		tok := p.buf[p.pos]
+		switch tok &^ tokenMoreFlag {
+		case tokenEOF:
+			p.pos++
+			if inElement {
+				return nil, fmt.Errorf("unexpected EOF inside element at 0x%x", p.pos-1)
+			}
+			return nodes, nil
+		case tokenFragmentHeader:
+			p.pos += 4
+		case tokenEndElement:
+			p.pos++
+			if !inElement {
+				return nil, fmt.Errorf("unexpected end element at 0x%x", p.pos-1)
+			}
+			return nodes, nil
+		case tokenOpenStartElement:
+			elem, err := p.parseElement(end)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, bxNode{kind: bxElement, elem: elem})
+		case tokenTemplateInstance:
+			ti, err := p.parseTemplateInstance(end)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, bxNode{kind: bxInstance, tmpl: ti})
+		case tokenPITarget:
+			n, err := p.parsePI(end)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		default:
+			n, err := p.parseValueNode(end)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		}
+	}
+	if inElement {
+		return nil, fmt.Errorf("element not closed before 0x%x", end)
+	}
+	return nodes, nil
+}
+
+// parseValueNode 解析可出现在元素内容或属性值中的单个节点。
+func (p *binXMLParser) parseValueNode(end int) (bxNode, error) {
+	start := p.pos
+	tok := p.buf[p.pos] &^ tokenMoreFlag
+	p.pos++
+	switch tok {
+	case tokenValue:
+		if err := p.need(1+2, end); err != nil {
+			return bxNode{}, err
+		}
+		typ := p.buf[p.pos]
+		p.pos++
+		if typ != valueString {
+			return bxNode{}, fmt.Errorf("unsupported value text type 0x%02x at 0x%x", typ, start)
+		}
+		s, err := p.readPrefixedString(end)
+		if err != nil {
+			return bxNode{}, err
+		}
+		return bxNode{kind: bxText, text: s}, nil
+	case tokenCDATA:
+		s, err := p.readPrefixedString(end)
+		if err != nil {
+			return bxNode{}, err
+		}
+		return bxNode{kind: bxCDATA, text: s}, nil
+	case tokenCharRef:
+		if err := p.need(2, end); err != nil {
+			return bxNode{}, err
+		}
+		v := binary.LittleEndian.Uint16(p.buf[p.pos:])
+		p.pos += 2
+		return bxNode{kind: bxCharRef, text: strconv.Itoa(int(v))}, nil
+	case tokenEntityRef:
+		name, err := p.readNameRef(end)
+		if err != nil {
+			return bxNode{}, err
+		}
+		return bxNode{kind: bxEntityRef, text: name}, nil
+	case tokenNormalSubst, tokenOptionalSubst:
+		if err := p.need(3, end); err != nil {
+			return bxNode{}, err
+		}
+		idx := binary.LittleEndian.Uint16(p.buf[p.pos:])
+		p.pos += 3 // 替换序号(2) + 值类型(1)
+		return bxNode{kind: bxSubstitution, index: int(idx), optional: tok == tokenOptionalSubst}, nil
+	default:
+		return bxNode{}, fmt.Errorf("unexpected token 0x%02x at 0x%x", p.buf[start], start)
+	}
+}
+
+// parseElement 解析OpenStartElement及其属性、子节点。
+func (p *binXMLParser) parseElement(end int) (*bxElem, error) {
+	start := p.pos
+	hasAttrs := p.buf[p.pos]&tokenMoreFlag != 0
+	// 令牌(1) + 依赖标识符(2) + 数据大小(4)
+	if err := p.need(7, end); err != nil {
+		return nil, err
+	}
+	p.pos += 7
+	nameOff, err := p.readUint32(end)
+	if err != nil {
+		return nil, err
+	}
+	if hasAttrs {
+		if err := p.need(4, end); err != nil {
+			return nil, err
+		}
+		p.pos += 4 // 属性列表大小
+	}
+	name, err := p.resolveName(nameOff, end)
+	if err != nil {
+		return nil, err
+	}
+	elem := &bxElem{name: name}
+
+	for hasAttrs {
+		if err := p.need(1, end); err != nil {
+			return nil, err
+		}
+		tok := p.buf[p.pos]
+		if tok&^tokenMoreFlag != tokenAttribute {
+			break
+		}
+		p.pos++
+		attrName, err := p.readNameRef(end)
+		if err != nil {
+			return nil, err
+		}
+		attr := bxAttr{name: attrName}
+		for p.pos < end {
+			t := p.buf[p.pos] &^ tokenMoreFlag
+			if t == tokenAttribute || t == tokenCloseStartElement || t == tokenCloseEmptyElement {
+				break
+			}
+			n, err := p.parseValueNode(end)
+			if err != nil {
+				return nil, err
+			}
+			attr.value = append(attr.value, n)
+		}
+		elem.attrs = append(elem.attrs, attr)
+	}
+
+	if err := p.need(1, end); err != nil {
+		return nil, err
+	}
+	switch p.buf[p.pos] {
+	case tokenCloseEmptyElement:
+		p.pos++
+		elem.empty = true
+	case tokenCloseStartElement:
+		p.pos++
+		elem.children, err = p.parseContent(end, true)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("element %q at 0x%x: unexpected token 0x%02x", name, start, p.buf[p.pos])
+	}
+	return elem, nil
+}
+
+// parsePI 解析处理指令的目标与数据。
+func (p *binXMLParser) parsePI(end int) (bxNode, error) {
+	p.pos++
+	target, err := p.readNameRef(end)
+	if err != nil {
+		return bxNode{}, err
+	}
+	text := target
+	if p.pos < end && p.buf[p.pos] == tokenPIData {
+		p.pos++
+		data, err := p.readPrefixedString(end)
+		if err != nil {
+			return bxNode{}, err
+		}
+		text += " " + data
+	}
+	return bxNode{kind: bxPI, text: text}, nil
+}
+
+// parseTemplateInstance 解析模板实例令牌、模板定义（如内联）及替换值数组。
+func (p *binXMLParser) parseTemplateInstance(end int) (*bxTemplateInstance, error) {
+	// 令牌(1) + 未知(1) + 模板ID(4)
+	if err := p.need(6, end); err != nil {
+		return nil, err
+	}
+	p.pos += 6
+	defOff, err := p.readUint32(end)
+	if err != nil {
+		return nil, err
+	}
+	def, err := p.template(int(defOff))
+	if err != nil {
+		return nil, err
+	}
+	if int(defOff) == p.pos {
+		// 模板定义内联于此：下一模板偏移(4) + GUID(16) + 数据大小(4) + 数据
+		size := binary.LittleEndian.Uint32(p.buf[p.pos+20:])
+		p.pos += 24 + int(size)
+	}
+	values, err := p.readSubstitutions(end)
+	if err != nil {
+		return nil, err
+	}
+	return &bxTemplateInstance{def: def, values: values}, nil
+}
+
+// template 返回位于off处的模板定义，同一块内的模板只解析一次。
+func (p *binXMLParser) template(off int) (*bxTemplate, error) {
+	if t, ok := p.templates[off]; ok {
+		return t, nil
+	}
+	if off < 0 || off+24 > len(p.buf) {
+		return nil, fmt.Errorf("template definition offset 0x%x out of bounds", off)
+	}
+	size := int(binary.LittleEndian.Uint32(p.buf[off+20:]))
+	start := off + 24
+	if start+size > len(p.buf) {
+		return nil, fmt.Errorf("template at 0x%x: data size %d out of bounds", off, size)
+	}
+	if p.parsing[off] {
+		return nil, fmt.Errorf("template at 0x%x references itself", off)
+	}
+	if p.parsing == nil {
+		p.parsing = map[int]bool{}
+	}
+	p.parsing[off] = true
+	nodes, err := p.parseFragment(start, start+size)
+	delete(p.parsing, off)
+	if err != nil {
+		return nil, fmt.Errorf("template at 0x%x: %w", off, err)
+	}
+	t := &bxTemplate{offset: off, nodes: nodes}
+	if p.templates != nil {
+		p.templates[off] = t
+	}
+	return t, nil
+}
+
+// readSubstitutions 读取模板实例后的替换值描述符数组和值数据。
+func (p *binXMLParser) readSubstitutions(end int) ([]bxValue, error) {
+	count, err := p.readUint32(end)
+	if err != nil {
+		return nil, err
+	}
+	if int(count) > (end-p.pos)/4 {
+		return nil, fmt.Errorf("substitution count %d exceeds data", count)
+	}
+	values := make([]bxValue, count)
+	sizes := make([]int, count)
+	for i := range values {
+		sizes[i] = int(binary.LittleEndian.Uint16(p.buf[p.pos:]))
+		values[i].typ = p.buf[p.pos+2]
+		p.pos += 4
+	}
+	for i := range values {
+		if err := p.need(sizes[i], end); err != nil {
+			return nil, fmt.Errorf("substitution %d: %w", i, err)
+		}
+		values[i].offset = p.pos
+		values[i].data = p.buf[p.pos : p.pos+sizes[i]]
+		p.pos += sizes[i]
+	}
+	return values, nil
+}
+
+// readNameRef 读取名称偏移，名称内联时跳过其数据。
+func (p *binXMLParser) readNameRef(end int) (string, error) {
+	off, err := p.readUint32(end)
+	if err != nil {
+		return "", err
+	}
+	return p.resolveName(off, end)
+}
+
+// resolveName 读取off处的名称结构：下一偏移(4) + 哈希(2) + 字符数(2) + UTF-16 + NUL。
+func (p *binXMLParser) resolveName(off uint32, end int) (string, error) {
+	o := int(off)
+	if o < 0 || o+8 > len(p.buf) {
+		return "", fmt.Errorf("name offset 0x%x out of bounds", off)
+	}
+	n := int(binary.LittleEndian.Uint16(p.buf[o+6:]))
+	if o+8+2*n > len(p.buf) {
+		return "", fmt.Errorf("name at 0x%x: length %d out of bounds", off, n)
+	}
+	name := decodeUTF16(p.buf[o+8 : o+8+2*n])
+	if o == p.pos {
+		p.pos += 8 + 2*n + 2
+		if p.pos > end {
+			return "", fmt.Errorf("name at 0x%x overruns fragment", off)
+		}
+	}
+	return name, nil
+}
+
+// readPrefixedString 读取以字符数(2)为前缀的UTF-16字符串。
+func (p *binXMLParser) readPrefixedString(end int) (string, error) {
+	if err := p.need(2, end); err != nil {
+		return "", err
+	}
+	n := int(binary.LittleEndian.Uint16(p.buf[p.pos:]))
+	p.pos += 2
+	if err := p.need(2*n, end); err != nil {
+		return "", err
+	}
+	s := decodeUTF16(p.buf[p.pos : p.pos+2*n])
+	p.pos += 2 * n
+	return s, nil
+}
+
+func (p *binXMLParser) readUint32(end int) (uint32, error) {
+	if err := p.need(4, end); err != nil {
+		return 0, err
+	}
+	v := binary.LittleEndian.Uint32(p.buf[p.pos:])
+	p.pos += 4
+	return v, nil
+}
+
+func (p *binXMLParser) need(n, end int) error {
+	if n < 0 || p.pos+n > end {
+		return fmt.Errorf("truncated binxml at 0x%x: need %d bytes", p.pos, n)
+	}
+	return nil
+}
+
+// writeNodes 将节点渲染为XML，values为当前模板实例的替换值。
+func (p *binXMLParser) writeNodes(out *bytes.Buffer, nodes []bxNode, values []bxValue) error {
+	for _, n := range nodes {
+		if err := p.writeNode(out, n, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *binXMLParser) writeNode(out *bytes.Buffer, n bxNode, values []bxValue) error {
+	if p.emitted += nodeCost(n, values); p.emitted > maxBinXMLOutput {
+		return fmt.Errorf("binxml expands beyond %d bytes", maxBinXMLOutput)
+	}
+	switch n.kind {
+	case bxText:
+		xmlEscape(out, n.text, false)
+	case bxCDATA:
+		out.WriteString("<![CDATA[")
+		out.WriteString(n.text)
+		out.WriteString("]]>")
+	case bxCharRef:
+		out.WriteString("&#" + n.text + ";")
+	case bxEntityRef:
+		out.WriteString("&" + n.text + ";")
+	case bxPI:
+		out.WriteString("<?" + n.text + "?>")
+	case bxInstance:
+		return p.writeNodes(out, n.tmpl.def.nodes, n.tmpl.values)
+	case bxSubstitution:
+		if n.index >= len(values) {
+			return fmt.Errorf("substitution index %d out of range (%d values)", n.index, len(values))
+		}
+		v := values[n.index]
+		if v.typ == valueBinXML || v.typ == valueEvtXML {
+			if err := p.writeEmbedded(out, v); err != nil {
+				return fmt.Errorf("substitution %d: %w", n.index, err)
+			}
+			return nil
+		}
+		s, err := p.formatValue(v)
+		if err != nil {
+			return fmt.Errorf("substitution %d: %w", n.index, err)
+		}
+		xmlEscape(out, s, false)
+	case bxElement:
+		return p.writeElement(out, n.elem, values)
+	}
+	return nil
+}
+
+func (p *binXMLParser) writeElement(out *bytes.Buffer, e *bxElem, values []bxValue) error {
+	out.WriteByte('<')
+	out.WriteString(e.name)
+	for _, a := range e.attrs {
+		if omitAttr(a, values) {
+			continue
+		}
+		var val bytes.Buffer
+		for _, n := range a.value {
+			if n.kind == bxSubstitution {
+				if n.index >= len(values) {
+					return fmt.Errorf("substitution index %d out of range (%d values)", n.index, len(values))
+				}
+				s, err := p.formatValue(values[n.index])
+				if err != nil {
+					return fmt.Errorf("attribute %s: %w", a.name, err)
+				}
+				xmlEscape(&val, s, true)
+				continue
+			}
+			if n.kind == bxText {
+				xmlEscape(&val, n.text, true)
+				continue
+			}
+			if err := p.writeNode(&val, n, values); err != nil {
+				return err
+			}
+		}
+		out.WriteString(" " + a.name + "='")
+		out.Write(val.Bytes())
+		out.WriteByte('\'')
+	}
+	if e.empty {
+		out.WriteString("/>")
+		return nil
+	}
+	out.WriteByte('>')
+	if err := p.writeNodes(out, e.children, values); err != nil {
+		return err
+	}
+	out.WriteString("</" + e.name + ">")
+	return nil
+}
+
+// nodeCost 估算节点自身（不含子节点）写出的字节数，属性计入所属元素。
+func nodeCost(n bxNode, values []bxValue) int {
+	cost := 1 + len(n.text)
+	switch n.kind {
+	case bxSubstitution:
+		if n.index < len(values) {
+			cost += len(values[n.index].data)
+		}
+	case bxElement:
+		cost += 2 * len(n.elem.name)
+		for _, a := range n.elem.attrs {
+			cost += len(a.name)
+			for _, v := range a.value {
+				cost += nodeCost(v, values)
+			}
+		}
+	}
+	return cost
+}
+
+// omitAttr 判断属性值是否只由为空的可选替换组成，与Windows渲染一致地省略该属性。
+func omitAttr(a bxAttr, values []bxValue) bool {
+	if len(a.value) == 0 {
+		return false
+	}
+	for _, n := range a.value {
+		if n.kind != bxSubstitution || !n.optional {
+			return false
+		}
+		if n.index < len(values) && !values[n.index].isEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+func (v bxValue) isEmpty() bool {
+	return v.typ == valueNull || len(v.data) == 0
+}
+
+// writeEmbedded 将BinXml或EvtXml类型的替换值作为XML子树直接写出。
+func (p *binXMLParser) writeEmbedded(out *bytes.Buffer, v bxValue) error {
+	if v.isEmpty() {
+		return nil
+	}
+	if v.typ == valueEvtXML {
+		out.WriteString(strings.TrimRight(decodeUTF16(v.data), "\x00"))
+		return nil
+	}
+	if p.depth >= maxBinXMLDepth {
+		return fmt.Errorf("nested binxml deeper than %d levels", maxBinXMLDepth)
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	nodes, err := p.parseFragment(v.offset, v.offset+len(v.data))
+	if err != nil {
+		return fmt.Errorf("nested binxml: %w", err)
+	}
+	return p.writeNodes(out, nodes, nil)
+}
+
+// formatValue 按Windows渲染XML时的格式将替换值转换为文本，数组元素以逗号分隔。
+func (p *binXMLParser) formatValue(v bxValue) (string, error) {
+	if v.isEmpty() {
+		return "", nil
+	}
+	if v.typ&valueArrayFlag == 0 {
+		return formatScalar(v.typ, v.data)
+	}
+	items, err := splitArray(v.typ&^valueArrayFlag, v.data)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		if parts[i], err = formatScalar(v.typ&^valueArrayFlag, item); err != nil {
+			return "", fmt.Errorf("array item %d: %w", i, err)
+		}
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// valueSize 返回定长值类型的字节数，变长类型返回0。
+func valueSize(typ byte) int {
+	switch typ {
+	case valueInt8, valueUInt8:
+		return 1
+	case valueInt16, valueUInt16:
+		return 2
+	case valueInt32, valueUInt32, valueHexInt32, valueReal32, valueBool:
+		return 4
+	case valueInt64, valueUInt64, valueHexInt64, valueReal64, valueFileTime:
+		return 8
+	case valueGUID, valueSystemTime:
+		return 16
+	}
+	return 0
+}
+
+// splitArray 将数组替换值拆分为各元素的原始字节。
+func splitArray(typ byte, d []byte) ([][]byte, error) {
+	var items [][]byte
+	switch typ {
+	case valueString:
+		for len(d) >= 2 {
+			i := 0
+			for i+1 < len(d) && (d[i] != 0 || d[i+1] != 0) {
+				i += 2
+			}
+			items = append(items, d[:i])
+			if i+2 > len(d) {
+				break
+			}
+			d = d[i+2:]
+		}
+		return items, nil
+	case valueAnsiString:
+		for _, s := range bytes.Split(bytes.TrimRight(d, "\x00"), []byte{0}) {
+			items = append(items, s)
+		}
+		return items, nil
+	case valueSID:
+		for len(d) > 0 {
+			if len(d) < 8 {
+				return nil, fmt.Errorf("sid array truncated")
+			}
+			n := 8 + 4*int(d[1])
+			if n > len(d) {
+				return nil, fmt.Errorf("sid array truncated")
+			}
+			items = append(items, d[:n])
+			d = d[n:]
+		}
+		return items, nil
+	}
+	size := valueSize(typ)
+	if typ == valueSizeT || typ == valueEvtHandle {
+		size = 8
+		if len(d)%8 != 0 {
+			size = 4
+		}
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("unsupported array type 0x%02x", typ)
+	}
+	if len(d)%size != 0 {
+		return nil, fmt.Errorf("array of type 0x%02x: %d bytes is not a multiple of %d", typ, len(d), size)
+	}
+	for i := 0; i < len(d); i += size {
+		items = append(items, d[i:i+size])
+	}
+	return items, nil
+}
+
+// formatScalar 格式化单个替换值。
+func formatScalar(typ byte, d []byte) (string, error) {
+	if n := valueSize(typ); n > 0 && len(d) < n {
+		return "", fmt.Errorf("value type 0x%02x: need %d bytes, have %d", typ, n, len(d))
+	}
+	switch typ {
+	case valueNull:
+		return "", nil
+	case valueString:
+		return strings.TrimRight(decodeUTF16(d), "\x00"), nil
+	case valueAnsiString:
+		return strings.TrimRight(string(d), "\x00"), nil
+	case valueInt8:
+		return strconv.Itoa(int(int8(d[0]))), nil
+	case valueUInt8:
+		return strconv.Itoa(int(d[0])), nil
+	case valueInt16:
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(d)))), nil
+	case valueUInt16:
+		return strconv.Itoa(int(binary.LittleEndian.Uint16(d))), nil
+	case valueInt32:
+		return strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(d))), 10), nil
+	case valueUInt32:
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(d)), 10), nil
+	case valueHexInt32:
+		return "0x" + strconv.FormatUint(uint64(binary.LittleEndian.Uint32(d)), 16), nil
+	case valueInt64:
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(d)), 10), nil
+	case valueUInt64:
+		return strconv.FormatUint(binary.LittleEndian.Uint64(d), 10), nil
+	case valueHexInt64:
+		return "0x" + strconv.FormatUint(binary.LittleEndian.Uint64(d), 16), nil
+	case valueReal32:
+		f := math.Float32frombits(binary.LittleEndian.Uint32(d))
+		return strconv.FormatFloat(float64(f), 'g', -1, 32), nil
+	case valueReal64:
+		f := math.Float64frombits(binary.LittleEndian.Uint64(d))
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+	case valueBool:
+		if binary.LittleEndian.Uint32(d) != 0 {
+			return "true", nil
+		}
+		return "false", nil
+	case valueBinary:
+		return fmt.Sprintf("%X", d), nil
+	case valueGUID:
+		return formatGUID(d), nil
+	case valueSizeT, valueEvtHandle:
+		var u uint64
+		switch len(d) {
+		case 4:
+			u = uint64(binary.LittleEndian.Uint32(d))
+		case 8:
+			u = binary.LittleEndian.Uint64(d)
+		default:
+			return "", fmt.Errorf("value type 0x%02x: invalid size %d", typ, len(d))
+		}
+		return "0x" + strconv.FormatUint(u, 16), nil
+	case valueFileTime:
+		return formatSystemTime(filetimeToTime(binary.LittleEndian.Uint64(d))), nil
+	case valueSystemTime:
+		t, err := parseSystemTime(d)
+		if err != nil {
+			return "", err
+		}
+		return formatSystemTime(t), nil
+	case valueSID:
+		return formatSID(d)
+	}
+	return "", fmt.Errorf("unsupported value type 0x%02x", typ)
+}
+
+// parseSystemTime 解析16字节的SYSTEMTIME结构。
+func parseSystemTime(d []byte) (time.Time, error) {
+	f := func(i int) int { return int(binary.LittleEndian.Uint16(d[2*i:])) }
+	year, month, day := f(0), f(1), f(3)
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, fmt.Errorf("invalid SYSTEMTIME %04d-%02d-%02d", year, month, day)
+	}
+	return time.Date(year, time.Month(month), day, f(4), f(5), f(6), f(7)*int(time.Millisecond), time.UTC), nil
+}
+
+// formatGUID 将16字节GUID格式化为 {XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX}。
+func formatGUID(b []byte) string {
+	return fmt.Sprintf("{%08X-%04X-%04X-%02X%02X-%02X%02X%02X%02X%02X%02X}",
+		binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint16(b[4:]), binary.LittleEndian.Uint16(b[6:]),
+		b[8], b[9], b[10], b[11], b[12], b[13], b[14], b[15])
+}
+
+// formatSID 将二进制SID格式化为 S-1-... 字符串。
+func formatSID(b []byte) (string, error) {
+	if len(b) < 8 {
+		return "", fmt.Errorf("sid too short: %d bytes", len(b))
+	}
+	n := int(b[1])
+	if len(b) < 8+4*n {
+		return "", fmt.Errorf("sid with %d sub-authorities truncated", n)
+	}
+	var auth uint64
+	for _, c := range b[2:8] {
+		auth = auth<<8 | uint64(c)
+	}
+	var sb strings.Builder
+	sb.WriteString("S-")
+	sb.WriteString(strconv.Itoa(int(b[0])))
+	sb.WriteString("-")
+	sb.WriteString(strconv.FormatUint(auth, 10))
+	for i := 0; i < n; i++ {
+		sb.WriteString("-")
+		sb.WriteString(strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b[8+4*i:])), 10))
+	}
+	return sb.String(), nil
+}
+
+// formatSystemTime 以Windows渲染SystemTime属性的格式（7位小数）输出UTC时间。
+func formatSystemTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.0000000Z")
+}
+
+// decodeUTF16 将小端UTF-16字节解码为字符串。
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// xmlEscape 转义XML特殊字符；attr为true时同时转义引号。
+func xmlEscape(out *bytes.Buffer, s string, attr bool) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			out.WriteString("&amp;")
+		case '<':
+			out.WriteString("&lt;")
+		case '>':
+			out.WriteString("&gt;")
+		case '\'':
+			if attr {
+				out.WriteString("&apos;")
+			} else {
+				out.WriteRune(r)
+			}
+		case '"':
+			if attr {
+				out.WriteString("&quot;")
+			} else {
+				out.WriteRune(r)
+			}
+		default:
+			out.WriteRune(r)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata golden files")
+
+// checkGolden 将输出与testdata/<name>比较（name不带扩展名时为<name>.xml），-update时重写该文件。
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	if filepath.Ext(name) == "" {
+		name += ".xml"
+	}
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, append(got, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, bytes.TrimRight(want, "\n")) {
+		t.Errorf("%s mismatch\n got: %s\nwant: %s", name, got, want)
+	}
+}
+
+// fragment 构造以片段头开始、EOF结束的独立BinXML数据。
+func fragment(body func(c *chunkBuilder)) []byte {
+	c := newFragmentBuilder(0)
+	c.b = append(c.b, tokenFragmentHeader, 1, 1, 0)
+	body(c)
+	c.u8(tokenEOF)
+	return c.b
+}
+
+func TestDecodeBinXMLSecurity(t *testing.T) {
+	e := testEvent{recordID: 42, eventID: 4624, time: testBase, target: "bob & <eve>", logonType: 10}
+	data := fragment(func(c *chunkBuilder) {
+		c.templateInstance("security", securityTemplate(), e.values())
+	})
+	out, err := DecodeBinXML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "security_4624", out)
+}
+
+func valueTypesTemplate() tnode {
+	names := []string{"Int8", "Int16", "Int32", "Int64", "UInt64", "Real32", "Real64", "BoolTrue", "BoolFalse",
+		"Binary", "SizeT", "HexInt32", "Ansi", "SystemTime", "FileTime", "Guid", "Sid"}
+	types := []byte{valueInt8, valueInt16, valueInt32, valueInt64, valueUInt64, valueReal32, valueReal64, valueBool, valueBool,
+		valueBinary, valueSizeT, valueHexInt32, valueAnsiString, valueSystemTime, valueFileTime, valueGUID, valueSID}
+	var data []tnode
+	for i, n := range names {
+		data = append(data, el("Data", attrs(attr("Name", txt(n))), sub(i, types[i])))
+	}
+	return el("Event", nil, el("EventData", nil, data...))
+}
+
+func TestDecodeBinXMLValueTypes(t *testing.T) {
+	le := binary.LittleEndian
+	st := make([]byte, 16)
+	for i, v := range []uint16{2024, 2, 4, 29, 23, 59, 58, 999} {
+		le.PutUint16(st[2*i:], v)
+	}
+	values := []bxValue{
+		sval(valueInt8, []byte{0xfe}),
+		sval(valueInt16, le.AppendUint16(nil, 0x8000)),
+		sval(valueInt32, le.AppendUint32(nil, 0xffffffff)),
+		u64Val(valueInt64, 1<<63),
+		u64Val(valueUInt64, math.MaxUint64),
+		sval(valueReal32, le.AppendUint32(nil, math.Float32bits(1.5))),
+		u64Val(valueReal64, math.Float64bits(-0.25)),
+		sval(valueBool, le.AppendUint32(nil, 1)),
+		sval(valueBool, le.AppendUint32(nil, 0)),
+		sval(valueBinary, []byte{0xde, 0xad, 0xbe, 0xef}),
+		u64Val(valueSizeT, 0x7ff6a000),
+		sval(valueHexInt32, le.AppendUint32(nil, 0xc000006d)),
+		sval(valueAnsiString, []byte("ansi\x00")),
+		sval(valueSystemTime, st),
+		fileTimeVal(testBase),
+		guidVal(providerGUID),
+		sidVal(5, 21, 1004336348, 1177238915, 682003330, 512),
+	}
+	data := fragment(func(c *chunkBuilder) {
+		c.templateInstance("types", valueTypesTemplate(), values)
+	})
+	out, err := DecodeBinXML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "value_types", out)
+}
+
+func TestDecodeBinXMLArrays(t *testing.T) {
+	le := binary.LittleEndian
+	var strs []byte
+	for _, s := range []string{"a", "", "ccc"} {
+		strs = append(strs, utf16Bytes(s+"\x00")...)
+	}
+	var sids []byte
+	sids = append(sids, sidVal(5, 18).data...)
+	sids = append(sids, sidVal(5, 32, 544).data...)
+	tree := el("Event", nil, el("EventData", nil,
+		el("Data", attrs(attr("Name", txt("Strings"))), sub(0, valueString|valueArrayFlag)),
+		el("Data", attrs(attr("Name", txt("UInt16s"))), sub(1, valueUInt16|valueArrayFlag)),
+		el("Data", attrs(attr("Name", txt("Sids"))), sub(2, valueSID|valueArrayFlag)),
+		el("Data", attrs(attr("Name", txt("Hex64s"))), sub(3, valueHexInt64|valueArrayFlag)),
+	))
+	values := []bxValue{
+		sval(valueString|valueArrayFlag, strs),
+		sval(valueUInt16|valueArrayFlag, le.AppendUint16(le.AppendUint16(nil, 1), 65535)),
+		sval(valueSID|valueArrayFlag, sids),
+		sval(valueHexInt64|valueArrayFlag, le.AppendUint64(le.AppendUint64(nil, 0x10), 0xff)),
+	}
+	data := fragment(func(c *chunkBuilder) {
+		c.templateInstance("arrays", tree, values)
+	})
+	out, err := DecodeBinXML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "arrays", out)
+}
+
+// logClearedTemplate 模拟1102事件：UserData部分以嵌套BinXML替换值给出。
+func logClearedTemplate() tnode {
+	return el("Event", attrs(attr("xmlns", txt("http://schemas.microsoft.com/win/2004/08/events/event"))),
+		el("System", nil,
+			el("Provider", attrs(attr("Name", sub(0, valueString)))),
+			el("EventID", nil, sub(1, valueUInt16)),
+			el("Channel", nil, optSub(2, valueString)),
+		),
+		el("UserData", nil, sub(3, valueBinXML)),
+	)
+}
+
+func logClearedFragment(c *chunkBuilder) {
+	c.b = append(c.b, tokenFragmentHeader, 1, 1, 0)
+	tree := el("LogFileCleared", attrs(attr("xmlns", txt("http://manifests.microsoft.com/win/2004/08/windows/eventlog"))),
+		el("SubjectUserSid", nil, sub(0, valueSID)),
+		el("SubjectUserName", nil, sub(1, valueString)),
+	)
+	c.templateInstance("userdata", tree, []bxValue{sidVal(5, 21, 1, 2, 3, 500), strVal("Administrator")})
+	c.u8(tokenEOF)
+}
+
+func TestDecodeBinXMLNested(t *testing.T) {
+	values := []bxValue{
+		strVal("Microsoft-Windows-Eventlog"),
+		u16Val(1102),
+		strVal("Security"),
+		{typ: valueBinXML},
+	}
+	data := fragment(func(c *chunkBuilder) {
+		c.templateInstance("cleared", logClearedTemplate(), values, logClearedFragment)
+	})
+	out, err := DecodeBinXML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "nested_userdata", out)
+
+	e, err := DecodeBinXMLEvent(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.EventIdentifier.ID != 1102 || e.Channel != "Security" {
+		t.Errorf("System = %d/%q", e.EventIdentifier.ID, e.Channel)
+	}
+	if e.UserData.Name.Local != "LogFileCleared" {
+		t.Errorf("UserData.Name = %q, want LogFileCleared", e.UserData.Name.Local)
+	}
+	want := []KeyValue{{"SubjectUserSid", "S-1-5-21-1-2-3-500"}, {"SubjectUserName", "Administrator"}}
+	if len(e.UserData.Pairs) != len(want) {
+		t.Fatalf("UserData = %v, want %v", e.UserData.Pairs, want)
+	}
+	for i := range want {
+		if e.UserData.Pairs[i] != want[i] {
+			t.Errorf("UserData[%d] = %v, want %v", i, e.UserData.Pairs[i], want[i])
+		}
+	}
+}
+
+func TestDecodeBinXMLEmptyOptional(t *testing.T) {
+	tree := el("Event", nil,
+		el("Correlation", attrs(attr("ActivityID", optSub(0, valueGUID)), attr("RelatedActivityID", optSub(1, valueGUID)))),
+		el("Data", nil, optSub(2, valueString)),
+	)
+	data := fragment(func(c *chunkBuilder) {
+		c.templateInstance("opt", tree, []bxValue{guidVal(providerGUID), nullVal(), nullVal()})
+	})
+	out, err := DecodeBinXML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<Event><Correlation ActivityID='{54544F85-5A96-494B-A5BA-3E3B0328C30D}'/><Data></Data></Event>"
+	if string(out) != want {
+		t.Errorf("got  %s\nwant %s", out, want)
+	}
+}
+
+func TestChunkTemplateCache(t *testing.T) {
+	c := newChunkBuilder()
+	for i := 0; i < 3; i++ {
+		c.addEvent(testEvent{recordID: uint64(i + 1), eventID: 4625, time: testBase, target: "x", logonType: 2})
+	}
+	c.record(4, testBase, func() {
+		c.templateInstance("opt", el("Event", nil, el("Data", nil, sub(0, valueString))), []bxValue{strVal("y")})
+	})
+	chunk, err := parseChunk(0, c.finish())
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := chunk.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want 4", len(records))
+	}
+	if len(chunk.templates) != 2 {
+		t.Errorf("cached %d templates, want 2", len(chunk.templates))
+	}
+}
+
+func TestDecodeBinXMLErrors(t *testing.T) {
+	tree := el("Event", nil, el("Data", nil, sub(0, valueUInt32)))
+	good := fragment(func(c *chunkBuilder) {
+		c.templateInstance("t", tree, []bxValue{u32Val(1)})
+	})
+	if _, err := DecodeBinXML(good); err != nil {
+		t.Fatalf("good fragment: %v", err)
+	}
+	cases := map[string][]byte{
+		"truncated":   good[:len(good)-3],
+		"short value": fragment(func(c *chunkBuilder) { c.templateInstance("t", tree, []bxValue{sval(valueUInt32, []byte{1})}) }),
+		"bad token":   {tokenFragmentHeader, 1, 1, 0, 0x3f},
+		"bad array": fragment(func(c *chunkBuilder) {
+			c.templateInstance("t", tree, []bxValue{sval(valueUInt32|valueArrayFlag, []byte{1, 2, 3})})
+		}),
+	}
+	for name, data := range cases {
+		if _, err := DecodeBinXML(data); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestDecodeBinXMLDepthLimit(t *testing.T) {
+	tree := el("N", nil, sub(0, valueBinXML))
+	var nest func(c *chunkBuilder, depth int)
+	nest = func(c *chunkBuilder, depth int) {
+		c.b = append(c.b, tokenFragmentHeader, 1, 1, 0)
+		key := "n" + strings.Repeat("x", depth)
+		if depth == 0 {
+			c.templateInstance(key, el("Leaf", nil), nil)
+		} else {
+			c.templateInstance(key, tree, []bxValue{{typ: valueBinXML}}, func(c *chunkBuilder) { nest(c, depth-1) })
+		}
+		c.u8(tokenEOF)
+	}
+	build := func(depth int) []byte {
+		c := newFragmentBuilder(0)
+		nest(c, depth)
+		return c.b
+	}
+	out, err := DecodeBinXML(build(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "<N><N><N><Leaf/></N></N></N>" {
+		t.Errorf("got %s", out)
+	}
+	if _, err := DecodeBinXML(build(maxBinXMLDepth + 1)); err == nil {
+		t.Error("expected depth limit error")
+	}
+}
+
+// selfTemplate 返回一个模板实例，其内联定义的内容又是引用同一定义的模板实例。
+func selfTemplate() []byte {
+	const defOff = 10
+	inner := []byte{tokenTemplateInstance, 1, 0, 0, 0, 0}
+	inner = binary.LittleEndian.AppendUint32(inner, defOff)
+	inner = append(inner, 0, 0, 0, 0, tokenEOF)
+	b := []byte{tokenTemplateInstance, 1, 0, 0, 0, 0}
+	b = binary.LittleEndian.AppendUint32(b, defOff)
+	b = append(b, make([]byte, 20)...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(inner)))
+	b = append(b, inner...)
+	return append(b, 0, 0, 0, 0, tokenEOF)
+}
+
+func TestDecodeBinXMLTemplateCycle(t *testing.T) {
+	_, err := DecodeBinXML(selfTemplate())
+	if err == nil || !strings.Contains(err.Error(), "references itself") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// appendTemplateChain 追加一个内联定义的模板实例。第N层模板包含两个第N-1层实例，
+// 第二个按偏移引用第一个的定义，第0层模板只有一个文本节点，展开后的节点数为2^N。
+func appendTemplateChain(b []byte, level int) []byte {
+	defOff := len(b) + 10
+	b = append(b, tokenTemplateInstance, 1, 0, 0, 0, 0)
+	b = binary.LittleEndian.AppendUint32(b, uint32(defOff))
+	b = append(b, make([]byte, 24)...)
+	start := len(b)
+	if level == 0 {
+		b = append(b, tokenValue, valueString, 4, 0, 'A', 0, 'A', 0, 'A', 0, 'A', 0)
+	} else {
+		b = appendTemplateChain(b, level-1)
+		b = append(b, tokenTemplateInstance, 1, 0, 0, 0, 0)
+		b = binary.LittleEndian.AppendUint32(b, uint32(start+10))
+		b = append(b, 0, 0, 0, 0)
+	}
+	b = append(b, tokenEOF)
+	binary.LittleEndian.PutUint32(b[start-4:], uint32(len(b)-start))
+	return append(b, 0, 0, 0, 0)
+}
+
+func TestDecodeBinXMLTemplateExpansion(t *testing.T) {
+	xml, err := DecodeBinXML(append(appendTemplateChain(nil, 3), tokenEOF))
+	if err != nil || string(xml) != strings.Repeat("AAAA", 8) {
+		t.Fatalf("3 levels = %q, %v", xml, err)
+	}
+	// 40层约2KB的输入会展开为2^40个文本节点。
+	_, err = DecodeBinXML(append(appendTemplateChain(nil, 40), tokenEOF))
+	if err == nil || !strings.Contains(err.Error(), "expands beyond") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestFormatScalarSystemTimeInvalid(t *testing.T) {
+	if _, err := formatScalar(valueSystemTime, make([]byte, 16)); err == nil {
+		t.Error("expected error for zero SYSTEMTIME")
+	}
+	if got, _ := formatScalar(valueFileTime, binary.LittleEndian.AppendUint64(nil, timeToFiletime(time.Unix(0, 0)))); got != "1970-01-01T00:00:00.0000000Z" {
+		t.Errorf("FileTime = %s", got)
+	}
+}
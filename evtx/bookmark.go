@@ -0,0 +1,177 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BookmarkList 是事件日志书签的纯Go表示，对应EvtRender(EvtRenderBookmark)输出的
+// <BookmarkList><Bookmark Channel='' RecordId='' IsCurrent='true'/></BookmarkList> 格式，
+// 一个书签可以同时记录多个通道的位置。
+type BookmarkList struct {
+	// Direction 反向查询时为 "backward"，正向时为空。
+	Direction string
+	// Bookmarks 各通道的位置，顺序与XML中一致。
+	Bookmarks []BookmarkEntry
+}
+
+// BookmarkEntry 是书签中一个通道的位置。
+type BookmarkEntry struct {
+	// Channel 通道名称或日志文件路径。
+	Channel string
+	// RecordID 该通道最后处理的记录编号。
+	RecordID uint64
+	// IsCurrent 是否为最近更新的通道，一个书签中最多一个。
+	IsCurrent bool
+}
+
+type bookmarkListXML struct {
+	XMLName   xml.Name `xml:"BookmarkList"`
+	Direction string   `xml:"Direction,attr"`
+	Bookmarks []struct {
+		Channel   string `xml:"Channel,attr"`
+		RecordID  string `xml:"RecordId,attr"`
+		IsCurrent string `xml:"IsCurrent,attr"`
+	} `xml:"Bookmark"`
+}
+
+// ParseBookmarkList 解析<BookmarkList>书签XML。
+//   data - 书签XML，如EvtRender(EvtRenderBookmark)的输出
+//   返回1 - 解析后的书签
+//   返回2 - XML格式错误或属性无效时的错误，成功时为nil
+func ParseBookmarkList(data string) (BookmarkList, error) {
+	var raw bookmarkListXML
+	if err := xml.Unmarshal([]byte(data), &raw); err != nil {
+		return BookmarkList{}, fmt.Errorf("parse bookmark list: %w", err)
+	}
+	l := BookmarkList{Direction: raw.Direction}
+	for i, b := range raw.Bookmarks {
+		if b.Channel == "" {
+			return BookmarkList{}, fmt.Errorf("bookmark %d: missing Channel", i)
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(b.RecordID), 10, 64)
+		if err != nil {
+			return BookmarkList{}, fmt.Errorf("bookmark %s: invalid RecordId %q", b.Channel, b.RecordID)
+		}
+		current, err := strconv.ParseBool(strings.TrimSpace(b.IsCurrent))
+		if err != nil && b.IsCurrent != "" {
+			return BookmarkList{}, fmt.Errorf("bookmark %s: invalid IsCurrent %q", b.Channel, b.IsCurrent)
+		}
+		l.Bookmarks = append(l.Bookmarks, BookmarkEntry{Channel: b.Channel, RecordID: id, IsCurrent: current})
+	}
+	return l, nil
+}
+
+// bookmarkListFromPositions 由各通道进度构造书签，通道按名称排序，第一个标记为当前。
+func bookmarkListFromPositions(positions map[string]uint64) BookmarkList {
+	names := make([]string, 0, len(positions))
+	for name := range positions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var l BookmarkList
+	for i, name := range names {
+		l.Bookmarks = append(l.Bookmarks, BookmarkEntry{Channel: name, RecordID: positions[name], IsCurrent: i == 0})
+	}
+	return l
+}
+
+// XML 按Windows的格式输出书签XML，可直接传给EvtCreateBookmark。
+//   返回 - 书签XML字符串
+func (l BookmarkList) XML() string {
+	var b bytes.Buffer
+	b.WriteString("<BookmarkList")
+	if l.Direction != "" {
+		b.WriteString(" Direction='")
+		xmlEscape(&b, l.Direction, true)
+		b.WriteString("'")
+	}
+	b.WriteString(">\r\n")
+	for _, e := range l.Bookmarks {
+		b.WriteString("  <Bookmark Channel='")
+		xmlEscape(&b, e.Channel, true)
+		b.WriteString("' RecordId='")
+		b.WriteString(strconv.FormatUint(e.RecordID, 10))
+		b.WriteString("'")
+		if e.IsCurrent {
+			b.WriteString(" IsCurrent='true'")
+		}
+		b.WriteString("/>\r\n")
+	}
+	b.WriteString("</BookmarkList>")
+	return b.String()
+}
+
+// RecordID 返回指定通道的记录编号。
+//   channel - 通道名称
+//   返回1 - 记录编号
+//   返回2 - 书签中是否包含该通道
+func (l BookmarkList) RecordID(channel string) (uint64, bool) {
+	for _, e := range l.Bookmarks {
+		if e.Channel == channel {
+			return e.RecordID, true
+		}
+	}
+	return 0, false
+}
+
+// Channels 返回书签中的全部通道名称。
+func (l BookmarkList) Channels() []string {
+	out := make([]string, len(l.Bookmarks))
+	for i, e := range l.Bookmarks {
+		out[i] = e.Channel
+	}
+	return out
+}
+
+// Set 更新或添加通道位置，并将该通道标记为当前，与EvtUpdateBookmark的行为一致。
+//   channel - 通道名称
+//   recordID - 记录编号
+func (l *BookmarkList) Set(channel string, recordID uint64) {
+	found := false
+	for i := range l.Bookmarks {
+		e := &l.Bookmarks[i]
+		e.IsCurrent = e.Channel == channel
+		if e.IsCurrent {
+			e.RecordID = recordID
+			found = true
+		}
+	}
+	if !found {
+		l.Bookmarks = append(l.Bookmarks, BookmarkEntry{Channel: channel, RecordID: recordID, IsCurrent: true})
+	}
+}
+
+// Merge 合并两个书签，同一通道取较大的记录编号，当前通道优先沿用l中的标记。
+//   other - 要合并的书签
+//   返回 - 合并后的新书签
+func (l BookmarkList) Merge(other BookmarkList) BookmarkList {
+	out := BookmarkList{Direction: l.Direction}
+	out.Bookmarks = append(out.Bookmarks, l.Bookmarks...)
+	hasCurrent := false
+	for _, e := range out.Bookmarks {
+		hasCurrent = hasCurrent || e.IsCurrent
+	}
+	for _, e := range other.Bookmarks {
+		merged := false
+		for i := range out.Bookmarks {
+			if out.Bookmarks[i].Channel == e.Channel {
+				if e.RecordID > out.Bookmarks[i].RecordID {
+					out.Bookmarks[i].RecordID = e.RecordID
+				}
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			e.IsCurrent = e.IsCurrent && !hasCurrent
+			hasCurrent = hasCurrent || e.IsCurrent
+			out.Bookmarks = append(out.Bookmarks, e)
+		}
+	}
+	return out
+}
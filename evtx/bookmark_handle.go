@@ -0,0 +1,46 @@
+//go:build windows
+
+package evtx
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Handle 通过EvtCreateBookmark创建与书签内容对应的句柄，使用完毕后需调用Close。
+//   返回1 - 书签句柄
+//   返回2 - 创建过程中的错误，成功时为nil
+func (l BookmarkList) Handle() (EvtHandle, error) {
+	return CreateBookmarkFromXML(l.XML())
+}
+
+// BookmarkListFromHandle 使用EvtRender(EvtRenderBookmark)读取书签句柄的内容。
+//   h - 书签句柄
+//   返回1 - 解析后的书签
+//   返回2 - 渲染或解析过程中的错误，成功时为nil
+func BookmarkListFromHandle(h EvtHandle) (BookmarkList, error) {
+	var bufferUsed, propertyCount uint32
+	err := evtRender(0, h, EvtRenderBookmark, 0, nil, &bufferUsed, &propertyCount)
+	if err != nil && err != ERROR_INSUFFICIENT_BUFFER {
+		return BookmarkList{}, fmt.Errorf("evtrender bookmark: %w", err)
+	}
+	if bufferUsed == 0 {
+		return BookmarkList{}, fmt.Errorf("evtrender bookmark: empty result")
+	}
+	buf := make([]uint16, (bufferUsed+1)/2)
+	err = evtRender(0, h, EvtRenderBookmark, uint32(len(buf)*2),
+		(*byte)(unsafe.Pointer(&buf[0])), &bufferUsed, &propertyCount)
+	if err != nil {
+		return BookmarkList{}, fmt.Errorf("evtrender bookmark: %w", err)
+	}
+	return ParseBookmarkList(windows.UTF16ToString(buf))
+}
+
+// List 读取书签句柄的内容。
+//   返回1 - 解析后的书签
+//   返回2 - 渲染或解析过程中的错误，成功时为nil
+func (b Bookmark) List() (BookmarkList, error) {
+	return BookmarkListFromHandle(EvtHandle(b))
+}
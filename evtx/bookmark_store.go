@@ -0,0 +1,127 @@
+package evtx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// BookmarkStore 持久化各通道（或.evtx文件）已读取到的最新记录编号，供Reader重启后续读。
+type BookmarkStore interface {
+	// Load 返回通道上次保存的记录编号，ok为false表示尚无进度。
+	Load(channel string) (recordID uint64, ok bool, err error)
+	// Save 保存通道最新已处理的记录编号。
+	Save(channel string, recordID uint64) error
+}
+
+// FileBookmarkStore 是以JSON文件保存进度的BookmarkStore，可同时记录多个通道。
+// 每次保存都先写入同目录下的临时文件再重命名覆盖，进程崩溃时不会留下半个文件。
+type FileBookmarkStore struct {
+	path    string
+	mu      sync.Mutex
+	records map[string]uint64
+}
+
+// NewFileBookmarkStore 打开或创建进度文件，文件不存在时从空进度开始。
+//   path - 进度文件路径
+//   返回1 - 进度存储对象
+//   返回2 - 读取或解析已有文件时的错误，成功时为nil
+func NewFileBookmarkStore(path string) (*FileBookmarkStore, error) {
+	s := &FileBookmarkStore{path: path, records: map[string]uint64{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read bookmark store: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.records); err != nil {
+			return nil, fmt.Errorf("parse bookmark store %s: %w", path, err)
+		}
+	}
+	return s, nil
+}
+
+// Load 返回通道上次保存的记录编号。
+//   channel - 通道名称或.evtx文件路径
+//   返回1 - 记录编号
+//   返回2 - 是否存在已保存的进度
+//   返回3 - 始终为nil
+func (s *FileBookmarkStore) Load(channel string) (uint64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.records[channel]
+	return id, ok, nil
+}
+
+// Save 更新通道进度并原子地写回文件。
+//   channel - 通道名称或.evtx文件路径
+//   recordID - 最新已处理的记录编号
+//   返回 - 写入文件时的错误，成功时为nil
+func (s *FileBookmarkStore) Save(channel string, recordID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, had := s.records[channel]
+	s.records[channel] = recordID
+	if err := s.flush(); err != nil {
+		if had {
+			s.records[channel] = old
+		} else {
+			delete(s.records, channel)
+		}
+		return err
+	}
+	return nil
+}
+
+// Channels 返回已保存进度的通道名称，按字母顺序排列。
+func (s *FileBookmarkStore) Channels() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.records))
+	for name := range s.records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flush 将进度写入临时文件后重命名为目标文件。
+func (s *FileBookmarkStore) flush() error {
+	data, err := json.MarshalIndent(s.records, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir, base := filepath.Split(s.path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, base+".tmp*")
+	if err != nil {
+		return fmt.Errorf("create temp bookmark file: %w", err)
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("write bookmark file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("sync bookmark file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("close bookmark file: %w", err)
+	}
+	if err := os.Rename(tmpName, s.path); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("replace bookmark file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package evtx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileBookmarkStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bookmarks.json")
+	s, err := NewFileBookmarkStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.Load("Security"); ok {
+		t.Error("empty store reported a bookmark")
+	}
+	if err := s.Save("Security", 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save("System", 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save("Security", 150); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileBookmarkStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ch, want := range map[string]uint64{"Security": 150, "System": 7} {
+		got, ok, err := reopened.Load(ch)
+		if err != nil || !ok || got != want {
+			t.Errorf("Load(%s) = %d, %v, %v; want %d", ch, got, ok, err, want)
+		}
+	}
+	if got := reopened.Channels(); strings.Join(got, ",") != "Security,System" {
+		t.Errorf("Channels = %v", got)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, temp files left behind", len(entries))
+	}
+}
+
+func TestFileBookmarkStoreErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bookmarks.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileBookmarkStore(path); err == nil {
+		t.Error("expected error for corrupt store")
+	}
+
+	s, err := NewFileBookmarkStore(filepath.Join(dir, "missing", "bookmarks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save("Security", 1); err == nil {
+		t.Error("expected error saving into missing directory")
+	}
+	if _, ok, _ := s.Load("Security"); ok {
+		t.Error("failed Save left the bookmark in memory")
+	}
+}
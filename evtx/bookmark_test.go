@@ -0,0 +1,115 @@
+package evtx
+
+import (
+	"strings"
+	"testing"
+)
+
+const windowsBookmark = "<BookmarkList>\r\n" +
+	"  <Bookmark Channel='Application' RecordId='1234' IsCurrent='true'/>\r\n" +
+	"  <Bookmark Channel='Microsoft-Windows-Sysmon/Operational' RecordId='98765'/>\r\n" +
+	"</BookmarkList>"
+
+func TestParseBookmarkList(t *testing.T) {
+	l, err := ParseBookmarkList(windowsBookmark)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BookmarkEntry{
+		{Channel: "Application", RecordID: 1234, IsCurrent: true},
+		{Channel: "Microsoft-Windows-Sysmon/Operational", RecordID: 98765},
+	}
+	if len(l.Bookmarks) != len(want) {
+		t.Fatalf("Bookmarks = %+v", l.Bookmarks)
+	}
+	for i := range want {
+		if l.Bookmarks[i] != want[i] {
+			t.Errorf("Bookmarks[%d] = %+v, want %+v", i, l.Bookmarks[i], want[i])
+		}
+	}
+	if got := l.XML(); got != windowsBookmark {
+		t.Errorf("XML round trip:\n%q\nwant\n%q", got, windowsBookmark)
+	}
+	if id, ok := l.RecordID("Microsoft-Windows-Sysmon/Operational"); !ok || id != 98765 {
+		t.Errorf("RecordID = %d, %v", id, ok)
+	}
+	if _, ok := l.RecordID("Security"); ok {
+		t.Error("RecordID(Security) found")
+	}
+}
+
+func TestBookmarkListEscaping(t *testing.T) {
+	l := BookmarkList{Direction: "backward"}
+	l.Set(`C:\logs\O'Brien & <co>.evtx`, 5)
+	data := l.XML()
+	if !strings.HasPrefix(data, "<BookmarkList Direction='backward'>") ||
+		!strings.Contains(data, "Channel='C:\\logs\\O&apos;Brien &amp; &lt;co&gt;.evtx'") {
+		t.Errorf("unexpected XML: %s", data)
+	}
+	back, err := ParseBookmarkList(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Direction != "backward" || len(back.Bookmarks) != 1 || back.Bookmarks[0] != l.Bookmarks[0] {
+		t.Errorf("round trip = %+v, want %+v", back, l)
+	}
+}
+
+func TestBookmarkListSetMerge(t *testing.T) {
+	var a BookmarkList
+	a.Set("Security", 10)
+	a.Set("System", 3)
+	if a.Bookmarks[0].IsCurrent || !a.Bookmarks[1].IsCurrent {
+		t.Errorf("current after Set = %+v", a.Bookmarks)
+	}
+	a.Set("Security", 12)
+	if id, _ := a.RecordID("Security"); id != 12 || !a.Bookmarks[0].IsCurrent {
+		t.Errorf("Set update = %+v", a.Bookmarks)
+	}
+
+	b := BookmarkList{Bookmarks: []BookmarkEntry{
+		{Channel: "Security", RecordID: 8, IsCurrent: true},
+		{Channel: "Application", RecordID: 40, IsCurrent: false},
+	}}
+	m := a.Merge(b)
+	if got := strings.Join(m.Channels(), ","); got != "Security,System,Application" {
+		t.Errorf("Channels = %s", got)
+	}
+	if id, _ := m.RecordID("Security"); id != 12 {
+		t.Errorf("merged Security = %d, want 12", id)
+	}
+	current := 0
+	for _, e := range m.Bookmarks {
+		if e.IsCurrent {
+			current++
+		}
+	}
+	if current != 1 || !m.Bookmarks[0].IsCurrent {
+		t.Errorf("merged current flags = %+v", m.Bookmarks)
+	}
+}
+
+func TestParseBookmarkListErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"<Bookmarks/>",
+		"<BookmarkList><Bookmark RecordId='1'/></BookmarkList>",
+		"<BookmarkList><Bookmark Channel='A' RecordId='x'/></BookmarkList>",
+		"<BookmarkList><Bookmark Channel='A' RecordId='1' IsCurrent='maybe'/></BookmarkList>",
+	} {
+		if _, err := ParseBookmarkList(data); err == nil {
+			t.Errorf("ParseBookmarkList(%q): expected error", data)
+		}
+	}
+}
+
+func TestBookmarkListFromPositions(t *testing.T) {
+	l := bookmarkListFromPositions(map[string]uint64{"System": 7, "Security": 150})
+	want := "<BookmarkList>\r\n" +
+		"  <Bookmark Channel='Security' RecordId='150' IsCurrent='true'/>\r\n" +
+		"  <Bookmark Channel='System' RecordId='7'/>\r\n" +
+		"</BookmarkList>"
+	if got := l.XML(); got != want {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package evtx
+
+import (
+	"bytes"
+	"log"
+)
+
+// recordKey 以记录标识符和写入时间识别同一条记录的多个副本。
+type recordKey struct {
+	id      uint64
+	written int64
+}
+
+func keyOf(r Record) recordKey {
+	return recordKey{id: r.RecordID, written: r.TimeCreated.SystemTime.UnixNano()}
+}
+
+// CarveRecords 解析文件中的正常记录，并扫描全部物理块恢复已删除的记录。
+// 扫描范围包括在用块空闲空间偏移之后的区域、文件头登记范围之外的块以及校验失败的块，
+// 以 "**" 记录签名定位候选记录，校验记录大小与尾部大小副本并能完整解析BinXML后才视为有效。
+// 恢复出的记录Carved为true，排在全部正常记录之后；与正常记录标识符和写入时间相同的副本会被丢弃。
+//   返回1 - 正常记录与恢复记录组成的切片
+//   返回2 - 读取过程中的错误，成功时为nil
+func (f *File) CarveRecords() ([]Record, error) {
+	var records, carved []Record
+	seen := map[recordKey]bool{}
+	for i := 0; i < f.PhysicalChunks(); i++ {
+		data, err := f.readChunk(i)
+		if err != nil {
+			return records, err
+		}
+		c, err := parseChunk(i, data)
+		if err != nil {
+			log.Printf("warn: chunk %d: %v, carving whole chunk", i, err)
+			c = &Chunk{Index: i, data: data, templates: map[int]*bxTemplate{}}
+			carved = append(carved, c.carve(chunkHeaderSize, len(data))...)
+			continue
+		}
+		if i >= int(f.Header.ChunkCount) {
+			carved = append(carved, c.carve(chunkHeaderSize, len(data))...)
+			continue
+		}
+		recs, stop, err := c.walk()
+		if err != nil {
+			log.Printf("warn: chunk %d records: %v", i, err)
+			carved = append(carved, c.carve(stop, int(c.Header.FreeSpaceOffset))...)
+		}
+		for _, r := range recs {
+			seen[keyOf(r)] = true
+		}
+		records = append(records, recs...)
+		carved = append(carved, c.CarveSlack()...)
+	}
+	for _, r := range carved {
+		if k := keyOf(r); !seen[k] {
+			seen[k] = true
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// CarveSlack 扫描块内空闲空间偏移之后的区域，恢复残留的已删除记录。
+//   返回 - 恢复出的记录，Carved为true
+func (c *Chunk) CarveSlack() []Record {
+	return c.carve(int(c.Header.FreeSpaceOffset), len(c.data))
+}
+
+// carve 在[start,end)区间内搜索记录签名并解析通过校验的候选记录。
+// 模板偏移相对块起始，因此残留记录引用的模板定义只要未被覆盖即可正常渲染。
+func (c *Chunk) carve(start, end int) []Record {
+	var records []Record
+	if end > len(c.data) {
+		end = len(c.data)
+	}
+	off := start
+	for off+recordMinSize <= end {
+		i := bytes.Index(c.data[off:end], recordSignature)
+		if i < 0 {
+			break
+		}
+		off += i
+		rec, err := parseRecordHeader(c.data[:end], off)
+		if err != nil {
+			off++
+			continue
+		}
+		r, err := c.decodeRecord(rec)
+		if err != nil {
+			off++
+			continue
+		}
+		r.Carved = true
+		records = append(records, r)
+		off += int(rec.size)
+	}
+	return records
+}
@@ -0,0 +1,176 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+// resealChunk 将空闲空间偏移回退到free，模拟记录被删除后残留在空闲区，并重新计算校验值。
+func resealChunk(data []byte, free int) {
+	binary.LittleEndian.PutUint32(data[48:], uint32(free))
+	binary.LittleEndian.PutUint32(data[52:], crc32.ChecksumIEEE(data[chunkHeaderSize:free]))
+	sum := crc32.ChecksumIEEE(data[:120])
+	sum = crc32.Update(sum, crc32.IEEETable, data[128:chunkHeaderSize])
+	binary.LittleEndian.PutUint32(data[124:], sum)
+}
+
+func carvedIDs(records []Record) (normal, carved []uint64) {
+	for _, r := range records {
+		if r.Carved {
+			carved = append(carved, r.RecordID)
+		} else {
+			normal = append(normal, r.RecordID)
+		}
+	}
+	return normal, carved
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCarveSlack(t *testing.T) {
+	c := newChunkBuilder()
+	for i := 0; i < 4; i++ {
+		c.addEvent(testEvent{recordID: uint64(i + 1), eventID: 4624, time: testBase.Add(time.Duration(i) * time.Second), target: "alice", logonType: 3})
+	}
+	data := c.finish()
+	resealChunk(data, c.records[2])
+
+	chunk, err := parseChunk(0, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := chunk.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d normal records, want 2", len(records))
+	}
+	slack := chunk.CarveSlack()
+	if len(slack) != 2 || slack[0].RecordID != 3 || slack[1].RecordID != 4 {
+		t.Fatalf("CarveSlack = %v, want records 3 and 4", slack)
+	}
+	for _, r := range slack {
+		if !r.Carved || r.EventIdentifier.ID != 4624 || r.EventData.Pairs[0].Value != "alice" {
+			t.Errorf("carved record %d = %+v", r.RecordID, r.Event)
+		}
+	}
+}
+
+func TestCarveRecords(t *testing.T) {
+	// 块0：记录1-3在用，记录4残留在空闲区
+	c0 := newChunkBuilder()
+	for i := 0; i < 4; i++ {
+		c0.addEvent(testEvent{recordID: uint64(i + 1), eventID: 4624, time: testBase.Add(time.Duration(i) * time.Second), target: "alice", logonType: 3})
+	}
+	chunk0 := c0.finish()
+	resealChunk(chunk0, c0.records[3])
+
+	// 块1：块头损坏，但记录仍可雕复
+	chunk1 := sampleChunk(20, 2)
+	chunk1[200]++
+
+	// 块2：超出文件头登记的块数，其中一条与块0的记录重复
+	c2 := newChunkBuilder()
+	c2.addEvent(testEvent{recordID: 1, eventID: 4624, time: testBase, target: "alice", logonType: 3})
+	c2.addEvent(testEvent{recordID: 30, eventID: 1102, time: testBase.Add(time.Hour), target: "bob", logonType: 2})
+	chunk2 := c2.finish()
+
+	data := buildFile(2, chunk0, chunk1, chunk2)
+	f, err := NewFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := f.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if normal, carved := carvedIDs(plain); !equalIDs(normal, []uint64{1, 2, 3}) || len(carved) != 0 {
+		t.Errorf("Records = %v/%v, want [1 2 3]/[]", normal, carved)
+	}
+
+	records, err := f.CarveRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	normal, carved := carvedIDs(records)
+	if !equalIDs(normal, []uint64{1, 2, 3}) {
+		t.Errorf("normal = %v, want [1 2 3]", normal)
+	}
+	if !equalIDs(carved, []uint64{4, 20, 21, 30}) {
+		t.Errorf("carved = %v, want [4 20 21 30]", carved)
+	}
+}
+
+func TestCarveSkipsInvalidCandidates(t *testing.T) {
+	c := newChunkBuilder()
+	c.addEvent(testEvent{recordID: 1, eventID: 4624, time: testBase, target: "alice", logonType: 3})
+	c.addEvent(testEvent{recordID: 2, eventID: 4624, time: testBase, target: "alice", logonType: 3})
+	// 伪造的签名：大小超出块范围
+	c.b = append(c.b, recordSignature...)
+	c.u32(0xfffff)
+	// 伪造的签名：尾部大小副本不一致
+	c.b = append(c.b, recordSignature...)
+	c.u32(40)
+	c.b = append(c.b, make([]byte, 40)...)
+	data := c.finish()
+	resealChunk(data, c.records[1])
+
+	chunk, err := parseChunk(0, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slack := chunk.CarveSlack()
+	if len(slack) != 1 || slack[0].RecordID != 2 {
+		t.Errorf("CarveSlack = %d records, want only record 2", len(slack))
+	}
+}
+
+func TestCarveSkipsSelfReferencingTemplate(t *testing.T) {
+	c := newChunkBuilder()
+	c.addEvent(testEvent{recordID: 1, eventID: 4624, time: testBase, target: "alice", logonType: 3})
+	c.addEvent(testEvent{recordID: 2, eventID: 4624, time: testBase, target: "alice", logonType: 3})
+	// 模板定义的内容又引用该定义本身
+	c.record(3, testBase, func() {
+		c.u8(tokenTemplateInstance)
+		c.u8(1)
+		c.u32(0)
+		defOff := uint32(c.at() + 4)
+		c.u32(defOff)
+		c.b = append(c.b, make([]byte, 20)...)
+		c.u32(15)
+		c.u8(tokenTemplateInstance)
+		c.u8(1)
+		c.u32(0)
+		c.u32(defOff)
+		c.u32(0)
+		c.u8(tokenEOF)
+		c.u32(0)
+	})
+	c.addEvent(testEvent{recordID: 4, eventID: 4624, time: testBase, target: "alice", logonType: 3})
+	data := c.finish()
+	resealChunk(data, c.records[1])
+
+	chunk, err := parseChunk(0, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, carved := carvedIDs(chunk.CarveSlack())
+	if !equalIDs(carved, []uint64{2, 4}) {
+		t.Errorf("carved = %v, want [2 4]", carved)
+	}
+}
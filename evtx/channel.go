@@ -0,0 +1,272 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ChannelType 是通道类型，对应EVT_CHANNEL_TYPE。
+type ChannelType uint32
+
+const (
+	ChannelAdmin ChannelType = iota
+	ChannelOperational
+	ChannelAnalytic
+	ChannelDebug
+)
+
+var channelTypeNames = []string{"Admin", "Operational", "Analytic", "Debug"}
+
+func (t ChannelType) String() string {
+	if int(t) < len(channelTypeNames) {
+		return channelTypeNames[t]
+	}
+	return fmt.Sprintf("ChannelType(%d)", uint32(t))
+}
+
+// ChannelIsolation 是通道隔离方式，对应EVT_CHANNEL_ISOLATION_TYPE。
+type ChannelIsolation uint32
+
+const (
+	IsolationApplication ChannelIsolation = iota
+	IsolationSystem
+	IsolationCustom
+)
+
+var channelIsolationNames = []string{"Application", "System", "Custom"}
+
+func (i ChannelIsolation) String() string {
+	if int(i) < len(channelIsolationNames) {
+		return channelIsolationNames[i]
+	}
+	return fmt.Sprintf("ChannelIsolation(%d)", uint32(i))
+}
+
+// ChannelConfig 是通道的配置，来自EvtGetChannelConfigProperty或 wevtutil gl <通道> /f:xml 的输出。
+type ChannelConfig struct {
+	// Name 通道名称，如 Security、Microsoft-Windows-Sysmon/Operational。
+	Name string
+	// Enabled 通道是否启用。
+	Enabled bool
+	// Type 通道类型。
+	Type ChannelType
+	// Isolation 隔离方式。
+	Isolation ChannelIsolation
+	// Classic 是否为经典事件日志（Application、System、Security等）。
+	Classic bool
+	// OwningPublisher 定义该通道的发布者，经典通道为空。
+	OwningPublisher string
+	// Access 通道访问权限（SDDL）。
+	Access string
+	// LogFilePath 日志文件路径，可能包含 %SystemRoot% 等环境变量。
+	LogFilePath string
+	// MaxSize 日志文件最大字节数。
+	MaxSize uint64
+	// Retention 日志写满时是否保留旧事件（不覆盖）。
+	Retention bool
+	// AutoBackup 日志写满时是否自动归档后新建日志，仅在Retention为true时生效。
+	AutoBackup bool
+	// Level 分析/调试通道的发布级别。
+	Level uint8
+	// Keywords 分析/调试通道的发布关键字。
+	Keywords uint64
+	// FileMax 分析/调试通道保留的日志文件数量。
+	FileMax uint32
+}
+
+// Mode 返回日志写满时的行为：circular（覆盖旧事件）、retain（停止记录）或 autobackup（归档后继续）。
+//   返回 - 日志保留模式
+func (c *ChannelConfig) Mode() string {
+	switch {
+	case !c.Retention:
+		return "circular"
+	case c.AutoBackup:
+		return "autobackup"
+	}
+	return "retain"
+}
+
+// Check 检查通道是否满足审计要求，返回发现的问题，满足要求时为空。
+//   minSize - 日志文件最小字节数，为0时不检查大小
+//   返回 - 问题描述列表
+func (c *ChannelConfig) Check(minSize uint64) []string {
+	var problems []string
+	if !c.Enabled {
+		problems = append(problems, fmt.Sprintf("%s: channel disabled", c.Name))
+	}
+	if minSize > 0 && c.MaxSize < minSize {
+		problems = append(problems, fmt.Sprintf("%s: max size %d bytes below %d", c.Name, c.MaxSize, minSize))
+	}
+	if c.Mode() == "retain" {
+		problems = append(problems, fmt.Sprintf("%s: retention without autoBackup stops logging when full", c.Name))
+	}
+	return problems
+}
+
+type channelXML struct {
+	Name            string `xml:"name,attr"`
+	Enabled         string `xml:"enabled,attr"`
+	Type            string `xml:"type,attr"`
+	Isolation       string `xml:"isolation,attr"`
+	OwningPublisher string `xml:"owningPublisher,attr"`
+	Access          string `xml:"channelAccess,attr"`
+	Logging         struct {
+		LogFileName string `xml:"logFileName"`
+		Retention   string `xml:"retention"`
+		AutoBackup  string `xml:"autoBackup"`
+		MaxSize     string `xml:"maxSize"`
+	} `xml:"logging"`
+	Publishing struct {
+		Level    string `xml:"level"`
+		Keywords string `xml:"keywords"`
+		FileMax  string `xml:"fileMax"`
+	} `xml:"publishing"`
+}
+
+// classicChannels 是经典事件日志通道，wevtutil的XML中没有该属性。
+var classicChannels = map[string]bool{
+	"application": true, "system": true, "security": true,
+	"hardwareevents": true, "internet explorer": true, "key management service": true,
+	"windows powershell": true, "directory service": true, "dns server": true, "dfs replication": true,
+}
+
+// ParseChannelConfig 解析 wevtutil gl <通道> /f:xml 输出的单个通道配置。
+//   data - 通道配置XML
+//   返回1 - 通道配置
+//   返回2 - XML格式错误或属性值无效时的错误，成功时为nil
+func ParseChannelConfig(data []byte) (*ChannelConfig, error) {
+	cs, err := ParseChannelConfigs(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(cs) != 1 {
+		return nil, fmt.Errorf("expected 1 channel, got %d", len(cs))
+	}
+	return cs[0], nil
+}
+
+// ParseChannelConfigs 解析多个依次排列（或包含在任意根元素中）的 <channel> 配置，
+// 如对每个通道执行 wevtutil gl /f:xml 后拼接的输出。
+//   data - 通道配置XML
+//   返回1 - 通道配置列表
+//   返回2 - XML格式错误或属性值无效时的错误，成功时为nil
+func ParseChannelConfigs(data []byte) ([]*ChannelConfig, error) {
+	dec := xml.NewDecoder(bytes.NewReader(utf16ToUTF8(data)))
+	dec.CharsetReader = func(label string, r io.Reader) (io.Reader, error) {
+		if strings.HasPrefix(strings.ToLower(label), "utf-16") {
+			return r, nil
+		}
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+	var out []*ChannelConfig
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse channel config: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "channel" {
+			continue
+		}
+		var raw channelXML
+		if err := dec.DecodeElement(&raw, &start); err != nil {
+			return nil, fmt.Errorf("parse channel config: %w", err)
+		}
+		c, err := raw.config()
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", raw.Name, err)
+		}
+		out = append(out, c)
+	}
+}
+
+func (raw *channelXML) config() (*ChannelConfig, error) {
+	c := &ChannelConfig{
+		Name:            raw.Name,
+		OwningPublisher: raw.OwningPublisher,
+		Access:          raw.Access,
+		LogFilePath:     strings.TrimSpace(raw.Logging.LogFileName),
+		Classic:         classicChannels[strings.ToLower(raw.Name)],
+	}
+	var err error
+	if c.Enabled, err = parseXMLBool(raw.Enabled); err != nil {
+		return nil, fmt.Errorf("enabled: %w", err)
+	}
+	if c.Retention, err = parseXMLBool(raw.Logging.Retention); err != nil {
+		return nil, fmt.Errorf("retention: %w", err)
+	}
+	if c.AutoBackup, err = parseXMLBool(raw.Logging.AutoBackup); err != nil {
+		return nil, fmt.Errorf("autoBackup: %w", err)
+	}
+	typ, err := parseEnumName(raw.Type, channelTypeNames)
+	if err != nil {
+		return nil, fmt.Errorf("type: %w", err)
+	}
+	c.Type = ChannelType(typ)
+	iso, err := parseEnumName(raw.Isolation, channelIsolationNames)
+	if err != nil {
+		return nil, fmt.Errorf("isolation: %w", err)
+	}
+	c.Isolation = ChannelIsolation(iso)
+	if s := strings.TrimSpace(raw.Logging.MaxSize); s != "" {
+		if c.MaxSize, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("maxSize: %w", err)
+		}
+	}
+	if s := strings.TrimSpace(raw.Publishing.Level); s != "" {
+		v, err := strconv.ParseUint(s, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("level: %w", err)
+		}
+		c.Level = uint8(v)
+	}
+	if s := strings.TrimSpace(raw.Publishing.Keywords); s != "" {
+		if c.Keywords, err = strconv.ParseUint(strings.TrimPrefix(strings.ToLower(s), "0x"), 16, 64); err != nil {
+			return nil, fmt.Errorf("keywords: %w", err)
+		}
+	}
+	if s := strings.TrimSpace(raw.Publishing.FileMax); s != "" {
+		v, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("fileMax: %w", err)
+		}
+		c.FileMax = uint32(v)
+	}
+	return c, nil
+}
+
+func parseXMLBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "false", "0":
+		return false, nil
+	case "true", "1":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", s)
+}
+
+// parseEnumName 按名称（不区分大小写）或数字解析枚举值，空串为0。
+func parseEnumName(s string, names []string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	for i, n := range names {
+		if strings.EqualFold(s, n) {
+			return uint32(i), nil
+		}
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unknown value %q", s)
+	}
+	return uint32(v), nil
+}
@@ -0,0 +1,167 @@
+//go:build windows
+
+package evtx
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"github.com/kitsch-9527/wcorefx/internal/winapi"
+)
+
+// EvtChannelConfigPropertyID 标识通道配置属性，对应EVT_CHANNEL_CONFIG_PROPERTY_ID。
+type EvtChannelConfigPropertyID uint32
+
+const (
+	EvtChannelConfigEnabled EvtChannelConfigPropertyID = iota
+	EvtChannelConfigIsolation
+	EvtChannelConfigType
+	EvtChannelConfigOwningPublisher
+	EvtChannelConfigClassicEventlog
+	EvtChannelConfigAccess
+	EvtChannelLoggingConfigRetention
+	EvtChannelLoggingConfigAutoBackup
+	EvtChannelLoggingConfigMaxSize
+	EvtChannelLoggingConfigLogFilePath
+	EvtChannelPublishingConfigLevel
+	EvtChannelPublishingConfigKeywords
+	EvtChannelPublishingConfigControlGuid
+	EvtChannelPublishingConfigBufferSize
+	EvtChannelPublishingConfigMinBuffers
+	EvtChannelPublishingConfigMaxBuffers
+	EvtChannelPublishingConfigLatency
+	EvtChannelPublishingConfigClockType
+	EvtChannelPublishingConfigSidType
+	EvtChannelPublisherList
+	EvtChannelPublishingConfigFileMax
+)
+
+var (
+	procEvtOpenChannelConfig        = winapi.NewProc("wevtapi.dll", "EvtOpenChannelConfig")
+	procEvtGetChannelConfigProperty = winapi.NewProc("wevtapi.dll", "EvtGetChannelConfigProperty")
+)
+
+func evtOpenChannelConfig(session EvtHandle, channelPath *uint16, flags uint32) (EvtHandle, error) {
+	h, err := procEvtOpenChannelConfig.CallRet(
+		uintptr(session),
+		uintptr(unsafe.Pointer(channelPath)),
+		uintptr(flags),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return EvtHandle(h), nil
+}
+
+func evtGetChannelConfigProperty(channelConfig EvtHandle, propertyID EvtChannelConfigPropertyID, flags uint32, bufferSize uint32, variant *EvtVariant, bufferUsed *uint32) error {
+	return procEvtGetChannelConfigProperty.Call(
+		uintptr(channelConfig),
+		uintptr(propertyID),
+		uintptr(flags),
+		uintptr(bufferSize),
+		uintptr(unsafe.Pointer(variant)),
+		uintptr(unsafe.Pointer(bufferUsed)),
+	)
+}
+
+// GetChannelConfig 读取通道配置。
+//   channel - 通道名称，如 Security
+//   返回1 - 通道配置
+//   返回2 - 通道不存在或读取基本属性失败时的错误，成功时为nil；发布设置读取失败时为零值
+func GetChannelConfig(channel string) (*ChannelConfig, error) {
+	p, err := syscall.UTF16PtrFromString(channel)
+	if err != nil {
+		return nil, err
+	}
+	h, err := evtOpenChannelConfig(0, p, 0)
+	if err != nil {
+		return nil, fmt.Errorf("EvtOpenChannelConfig %s: %w", channel, err)
+	}
+	defer h.Close()
+
+	c := &ChannelConfig{Name: channel}
+	buf := make([]byte, 512)
+	get := func(id EvtChannelConfigPropertyID) (any, error) {
+		for {
+			var used uint32
+			err := evtGetChannelConfigProperty(h, id, 0, uint32(len(buf)), (*EvtVariant)(unsafe.Pointer(&buf[0])), &used)
+			if err == ERROR_INSUFFICIENT_BUFFER {
+				buf = make([]byte, used)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("EvtGetChannelConfigProperty %s (%d): %w", channel, id, err)
+			}
+			return EvtVariantData(*(*EvtVariant)(unsafe.Pointer(&buf[0])), buf)
+		}
+	}
+	// Publishing*属性只对分析和调试通道有意义，经典通道等读取失败时保留零值。
+	for _, prop := range []struct {
+		id       EvtChannelConfigPropertyID
+		optional bool
+		set      func(v any)
+	}{
+		{EvtChannelConfigEnabled, false, func(v any) { c.Enabled, _ = v.(bool) }},
+		{EvtChannelConfigIsolation, false, func(v any) { c.Isolation = ChannelIsolation(variantUint(v)) }},
+		{EvtChannelConfigType, false, func(v any) { c.Type = ChannelType(variantUint(v)) }},
+		{EvtChannelConfigOwningPublisher, false, func(v any) { c.OwningPublisher, _ = v.(string) }},
+		{EvtChannelConfigClassicEventlog, false, func(v any) { c.Classic, _ = v.(bool) }},
+		{EvtChannelConfigAccess, false, func(v any) { c.Access, _ = v.(string) }},
+		{EvtChannelLoggingConfigRetention, false, func(v any) { c.Retention, _ = v.(bool) }},
+		{EvtChannelLoggingConfigAutoBackup, false, func(v any) { c.AutoBackup, _ = v.(bool) }},
+		{EvtChannelLoggingConfigMaxSize, false, func(v any) { c.MaxSize = variantUint(v) }},
+		{EvtChannelLoggingConfigLogFilePath, false, func(v any) { c.LogFilePath, _ = v.(string) }},
+		{EvtChannelPublishingConfigLevel, true, func(v any) { c.Level = uint8(variantUint(v)) }},
+		{EvtChannelPublishingConfigKeywords, true, func(v any) { c.Keywords = variantUint(v) }},
+		{EvtChannelPublishingConfigFileMax, true, func(v any) { c.FileMax = uint32(variantUint(v)) }},
+	} {
+		v, err := get(prop.id)
+		if err != nil {
+			if prop.optional {
+				continue
+			}
+			return nil, err
+		}
+		prop.set(v)
+	}
+	return c, nil
+}
+
+// ChannelConfigs 读取所有已注册通道的配置，无法打开的通道被跳过。
+//   返回1 - 通道配置列表，顺序与Channels一致
+//   返回2 - 枚举通道失败时的错误，成功时为nil
+func ChannelConfigs() ([]*ChannelConfig, error) {
+	names, err := Channels()
+	if err != nil {
+		return nil, err
+	}
+	var out []*ChannelConfig
+	for _, name := range names {
+		c, err := GetChannelConfig(name)
+		if err != nil {
+			continue
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// variantUint 将EvtVariantData返回的整数转换为uint64，其他类型返回0。
+func variantUint(v any) uint64 {
+	switch n := v.(type) {
+	case uint8:
+		return uint64(n)
+	case uint16:
+		return uint64(n)
+	case uint32:
+		return uint64(n)
+	case uint64:
+		return n
+	case int32:
+		return uint64(uint32(n))
+	case int64:
+		return uint64(n)
+	}
+	return 0
+}
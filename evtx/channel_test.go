@@ -0,0 +1,109 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func loadChannelConfigs(t *testing.T) []*ChannelConfig {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "channels.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := ParseChannelConfigs(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cs
+}
+
+func TestParseChannelConfigs(t *testing.T) {
+	cs := loadChannelConfigs(t)
+	if len(cs) != 3 {
+		t.Fatalf("channels = %d, want 3", len(cs))
+	}
+	sec := cs[0]
+	if sec.Name != "Security" || !sec.Enabled || !sec.Classic || sec.Type != ChannelAdmin ||
+		sec.Isolation != IsolationCustom || sec.MaxSize != 20971520 || sec.Mode() != "circular" ||
+		sec.LogFilePath != `%SystemRoot%\System32\Winevt\Logs\Security.evtx` || !strings.HasPrefix(sec.Access, "O:BAG:SYD:") {
+		t.Errorf("Security = %+v", sec)
+	}
+	sysmon := cs[1]
+	if sysmon.Enabled || sysmon.Classic || sysmon.OwningPublisher != "Microsoft-Windows-Sysmon" ||
+		sysmon.Type != ChannelOperational || sysmon.Mode() != "retain" {
+		t.Errorf("Sysmon = %+v", sysmon)
+	}
+	kp := cs[2]
+	if kp.Type != ChannelAnalytic || kp.Isolation != IsolationApplication || kp.Mode() != "autobackup" ||
+		kp.Level != 4 || kp.Keywords != 0x8000000000000010 || kp.FileMax != 16 {
+		t.Errorf("Kernel-Process = %+v", kp)
+	}
+	if s := kp.Type.String() + "/" + kp.Isolation.String() + "/" + ChannelType(9).String(); s != "Analytic/Application/ChannelType(9)" {
+		t.Errorf("String = %q", s)
+	}
+}
+
+func TestChannelConfigCheck(t *testing.T) {
+	cs := loadChannelConfigs(t)
+	const minSize = 128 << 20
+	if got := cs[0].Check(minSize); !reflect.DeepEqual(got, []string{"Security: max size 20971520 bytes below 134217728"}) {
+		t.Errorf("Check(Security) = %q", got)
+	}
+	if got := cs[0].Check(0); len(got) != 0 {
+		t.Errorf("Check(Security, 0) = %q", got)
+	}
+	want := []string{
+		"Microsoft-Windows-Sysmon/Operational: channel disabled",
+		"Microsoft-Windows-Sysmon/Operational: max size 1052672 bytes below 134217728",
+		"Microsoft-Windows-Sysmon/Operational: retention without autoBackup stops logging when full",
+	}
+	if got := cs[1].Check(minSize); !reflect.DeepEqual(got, want) {
+		t.Errorf("Check(Sysmon) = %q", got)
+	}
+}
+
+func TestParseChannelConfigUTF16(t *testing.T) {
+	text := `<?xml version="1.0" encoding="UTF-16"?>` + "\r\n" +
+		`<channel name="Application" enabled="true" type="Admin" isolation="Application">` +
+		`<logging><retention>true</retention><autoBackup>true</autoBackup><maxSize>1073741824</maxSize></logging></channel>`
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xFE})
+	for _, u := range utf16.Encode([]rune(text)) {
+		binary.Write(&buf, binary.LittleEndian, u)
+	}
+	c, err := ParseChannelConfig(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "Application" || !c.Classic || c.MaxSize != 1<<30 || c.Mode() != "autobackup" {
+		t.Errorf("Application = %+v", c)
+	}
+}
+
+func TestParseChannelConfigErrors(t *testing.T) {
+	tests := []struct {
+		doc string
+		err string
+	}{
+		{`<channel name="A" enabled="yes"/>`, `enabled: invalid boolean "yes"`},
+		{`<channel name="A" type="Bogus"/>`, `type: unknown value "Bogus"`},
+		{`<channel name="A"><logging><maxSize>big</maxSize></logging></channel>`, "maxSize"},
+		{`<channel name="A"><publishing><keywords>zz</keywords></publishing></channel>`, "keywords"},
+		{`<channels/>`, "expected 1 channel, got 0"},
+		{`<channels><channel name="A"/><channel name="B"/></channels>`, "expected 1 channel, got 2"},
+		{`<channel name="A">`, "parse channel config"},
+	}
+	for _, tt := range tests {
+		_, err := ParseChannelConfig([]byte(tt.doc))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %q", tt.doc, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package evtx
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DuplicatePolicy 决定EventData/UserData中同名数据项的编码方式。
+type DuplicatePolicy int
+
+const (
+	// DuplicateArray 将同名数据项的值合并为数组。
+	DuplicateArray DuplicatePolicy = iota
+	// DuplicateFirst 只保留第一个值。
+	DuplicateFirst
+	// DuplicateLast 只保留最后一个值。
+	DuplicateLast
+	// DuplicateSuffix 为第二个及之后的值追加 _2、_3 等后缀。
+	DuplicateSuffix
+)
+
+// ECSVersion 是EncodeECS输出文档遵循的Elastic Common Schema版本。
+const ECSVersion = "8.11.0"
+
+// EncodeOptions 控制JSON/ECS编码。
+type EncodeOptions struct {
+	// Duplicates 同名数据项的处理方式，默认合并为数组。
+	Duplicates DuplicatePolicy
+	// IncludeXML 为true时附带原始XML（JSON中为xml，ECS中为event.original）。
+	IncludeXML bool
+	// Hints 字段类型提示，命中的字段按类型输出为数字、布尔值或RFC 3339时间，其余为字符串。
+	Hints TypeHints
+}
+
+// JSONDocument 将记录转换为与事件XML结构对应的扁平文档，未设置的字段会被省略。
+// 返回的map由encoding/json按键排序输出，因此同一记录的编码结果稳定。
+//   r - 事件记录
+//   opts - 编码选项
+//   返回 - 可直接json.Marshal的文档
+func JSONDocument(r Record, opts EncodeOptions) map[string]interface{} {
+	doc := map[string]interface{}{
+		"event_id":  r.EventIdentifier.ID,
+		"level":     r.LevelRaw,
+		"task":      r.TaskRaw,
+		"keywords":  "0x" + strconv.FormatUint(uint64(r.KeywordsRaw), 16),
+		"record_id": r.RecordID,
+		"version":   uint8(r.Version),
+	}
+	putString(doc, "channel", r.Channel)
+	putString(doc, "computer", r.Computer)
+	putString(doc, "level_name", r.Level)
+	putString(doc, "task_name", r.Task)
+	putString(doc, "opcode_name", r.Opcode)
+	putString(doc, "message", r.Message)
+	putString(doc, "api", r.API)
+	if r.EventIdentifier.Qualifiers != 0 {
+		doc["qualifiers"] = r.EventIdentifier.Qualifiers
+	}
+	if r.OpcodeRaw != nil {
+		doc["opcode"] = *r.OpcodeRaw
+	}
+	if len(r.Keywords) > 0 {
+		doc["keyword_names"] = r.Keywords
+	}
+	if !r.TimeCreated.SystemTime.IsZero() {
+		doc["time_created"] = formatJSONTime(r.TimeCreated.SystemTime)
+	}
+	if m := compactMap(map[string]interface{}{
+		"name":         r.Provider.Name,
+		"guid":         r.Provider.GUID,
+		"event_source": r.Provider.EventSourceName,
+	}); m != nil {
+		doc["provider"] = m
+	}
+	putString(doc, "activity_id", r.Correlation.ActivityID)
+	putString(doc, "related_activity_id", r.Correlation.RelatedActivityID)
+	if r.Execution.ProcessID != 0 || r.Execution.ThreadID != 0 {
+		doc["execution"] = map[string]interface{}{
+			"process_id": r.Execution.ProcessID,
+			"thread_id":  r.Execution.ThreadID,
+		}
+	}
+	if u := userDocument(r.User); u != nil {
+		doc["user"] = u
+	}
+	if d := pairsDocument(r.EventData.Pairs, opts); d != nil {
+		doc["event_data"] = d
+	}
+	if d := pairsDocument(r.UserData.Pairs, opts); d != nil || r.UserData.Name.Local != "" {
+		if d == nil {
+			d = map[string]interface{}{}
+		}
+		doc["user_data"] = d
+		putString(doc, "user_data_name", r.UserData.Name.Local)
+	}
+	if r.Carved {
+		doc["carved"] = true
+	}
+	if opts.IncludeXML {
+		putString(doc, "xml", r.XML)
+	}
+	return doc
+}
+
+// EncodeJSON 将记录编码为键顺序稳定的JSON。
+//   r - 事件记录
+//   opts - 编码选项
+//   返回1 - JSON字节
+//   返回2 - 编码过程中的错误，成功时为nil
+func EncodeJSON(r Record, opts EncodeOptions) ([]byte, error) {
+	return json.Marshal(JSONDocument(r, opts))
+}
+
+// ECSDocument 将记录转换为Elastic Common Schema文档，Windows特有字段位于winlog下，
+// 字段命名与Winlogbeat一致，如 event.code、winlog.event_data.*、process.pid。
+//   r - 事件记录
+//   opts - 编码选项
+//   返回 - 可直接json.Marshal的文档
+func ECSDocument(r Record, opts EncodeOptions) map[string]interface{} {
+	eventID := strconv.FormatUint(uint64(r.EventIdentifier.ID), 10)
+	event := map[string]interface{}{
+		"code": eventID,
+		"kind": "event",
+	}
+	putString(event, "provider", r.Provider.Name)
+	putString(event, "action", r.Task)
+	if outcome := keywordOutcome(uint64(r.KeywordsRaw)); outcome != "" {
+		event["outcome"] = outcome
+	}
+	if opts.IncludeXML {
+		putString(event, "original", r.XML)
+	}
+
+	winlog := map[string]interface{}{
+		"event_id":  eventID,
+		"record_id": strconv.FormatUint(r.RecordID, 10),
+		"version":   uint8(r.Version),
+	}
+	putString(winlog, "channel", r.Channel)
+	putString(winlog, "computer_name", r.Computer)
+	putString(winlog, "provider_name", r.Provider.Name)
+	putString(winlog, "provider_guid", r.Provider.GUID)
+	putString(winlog, "event_source_name", r.Provider.EventSourceName)
+	putString(winlog, "api", r.API)
+	putString(winlog, "task", r.Task)
+	putString(winlog, "opcode", r.Opcode)
+	putString(winlog, "activity_id", r.Correlation.ActivityID)
+	putString(winlog, "related_activity_id", r.Correlation.RelatedActivityID)
+	if len(r.Keywords) > 0 {
+		winlog["keywords"] = r.Keywords
+	} else if names := keywordNames(uint64(r.KeywordsRaw)); len(names) > 0 {
+		winlog["keywords"] = names
+	}
+	if u := userDocument(r.User); u != nil {
+		winlog["user"] = u
+	}
+	if d := pairsDocument(r.EventData.Pairs, opts); d != nil {
+		winlog["event_data"] = d
+	}
+	if d := pairsDocument(r.UserData.Pairs, opts); d != nil || r.UserData.Name.Local != "" {
+		if d == nil {
+			d = map[string]interface{}{}
+		}
+		winlog["user_data"] = d
+		putString(winlog, "user_data_name", r.UserData.Name.Local)
+	}
+	if r.Carved {
+		winlog["carved"] = true
+	}
+
+	doc := map[string]interface{}{
+		"ecs":    map[string]interface{}{"version": ECSVersion},
+		"event":  event,
+		"winlog": winlog,
+	}
+	if !r.TimeCreated.SystemTime.IsZero() {
+		doc["@timestamp"] = formatJSONTime(r.TimeCreated.SystemTime)
+	}
+	if level := levelName(r.Event); level != "" {
+		doc["log"] = map[string]interface{}{"level": strings.ToLower(level)}
+	}
+	putString(doc, "message", r.Message)
+	if r.Computer != "" {
+		doc["host"] = map[string]interface{}{"name": r.Computer}
+	}
+	if r.Execution.ProcessID != 0 {
+		process := map[string]interface{}{"pid": r.Execution.ProcessID}
+		if r.Execution.ThreadID != 0 {
+			process["thread"] = map[string]interface{}{"id": r.Execution.ThreadID}
+		}
+		doc["process"] = process
+		winlog["process"] = process
+	}
+	if r.User.Identifier != "" {
+		user := map[string]interface{}{"id": r.User.Identifier}
+		putString(user, "name", r.User.Name)
+		putString(user, "domain", r.User.Domain)
+		doc["user"] = user
+	}
+	return doc
+}
+
+// EncodeECS 将记录编码为ECS JSON文档。
+//   r - 事件记录
+//   opts - 编码选项
+//   返回1 - JSON字节
+//   返回2 - 编码过程中的错误，成功时为nil
+func EncodeECS(r Record, opts EncodeOptions) ([]byte, error) {
+	return json.Marshal(ECSDocument(r, opts))
+}
+
+// pairsDocument 将键值对转换为map，无名数据项按位置命名为param1、param2...。
+func pairsDocument(pairs []KeyValue, opts EncodeOptions) map[string]interface{} {
+	if len(pairs) == 0 {
+		return nil
+	}
+	// 先收集全部字段名，DuplicateSuffix生成的名称不会占用之后出现的真实字段。
+	keys := make([]string, len(pairs))
+	literal := map[string]bool{}
+	for i, kv := range pairs {
+		keys[i] = kv.Key
+		if keys[i] == "" {
+			keys[i] = "param" + strconv.Itoa(i+1)
+		}
+		literal[keys[i]] = true
+	}
+	out := map[string]interface{}{}
+	seen := map[string]int{}
+	for i, kv := range pairs {
+		key := keys[i]
+		var value interface{} = kv.Value
+		if opts.Hints != nil {
+			value = typedValue(kv, opts.Hints).Value
+			if t, ok := value.(time.Time); ok {
+				value = formatJSONTime(t)
+			}
+		}
+		seen[key]++
+		n := seen[key]
+		if n == 1 {
+			out[key] = value
+			continue
+		}
+		switch opts.Duplicates {
+		case DuplicateFirst:
+		case DuplicateLast:
+			out[key] = value
+		case DuplicateSuffix:
+			// 后缀可能是其他字段的名称（如同时存在Param与Param_2），顺延到未使用的编号。
+			name := key + "_" + strconv.Itoa(n)
+			for _, taken := out[name]; taken || literal[name]; _, taken = out[name] {
+				n++
+				name = key + "_" + strconv.Itoa(n)
+			}
+			out[name] = value
+		default:
+			if list, ok := out[key].([]interface{}); ok && n > 2 {
+				out[key] = append(list, value)
+			} else {
+				out[key] = []interface{}{out[key], value}
+			}
+		}
+	}
+	return out
+}
+
+func userDocument(u SID) map[string]interface{} {
+	m := compactMap(map[string]interface{}{
+		"identifier": u.Identifier,
+		"name":       u.Name,
+		"domain":     u.Domain,
+	})
+	if m != nil && u.Type != 0 {
+		m["type"] = u.Type.String()
+	}
+	return m
+}
+
+// compactMap 删除空字符串值，全部为空时返回nil。
+func compactMap(m map[string]interface{}) map[string]interface{} {
+	for k, v := range m {
+		if s, ok := v.(string); ok && s == "" {
+			delete(m, k)
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+func putString(m map[string]interface{}, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+func formatJSONTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// levelName 返回渲染后的级别名称，没有时按标准级别映射。
+func levelName(e Event) string {
+	if e.Level != "" {
+		return e.Level
+	}
+	return defaultWinMeta.Levels[e.LevelRaw]
+}
+
+// keywordNames 按标准关键字映射解析关键字掩码。
+func keywordNames(mask uint64) []string {
+	var names []string
+	for bit := uint(48); bit < 56; bit++ {
+		if mask&(1<<bit) == 0 {
+			continue
+		}
+		if name, ok := defaultWinMeta.Keywords[int64(1)<<bit]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// keywordOutcome 由审核成功/失败关键字推导event.outcome。
+func keywordOutcome(mask uint64) string {
+	switch {
+	case mask&0x20000000000000 != 0:
+		return "success"
+	case mask&0x10000000000000 != 0:
+		return "failure"
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package evtx
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeJSON(t *testing.T) {
+	r := filterRecord(t)
+	got, err := EncodeJSON(r, EncodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"api":"file","channel":"Security","computer":"DC01.corp.example",` +
+		`"event_data":{"LogonType":"10","TargetUserName":"alice"},"event_id":4624,` +
+		`"execution":{"process_id":612,"thread_id":1480},"keywords":"0x8020000000000000","level":0,"opcode":0,` +
+		`"provider":{"guid":"{54544F85-5A96-494B-A5BA-3E3B0328C30D}","name":"Microsoft-Windows-Security-Auditing"},` +
+		`"record_id":7,"task":12544,"time_created":"2024-01-15T10:30:00.1234567Z","user":{"identifier":"S-1-5-18"},"version":2}`
+	if string(got) != want {
+		t.Errorf("EncodeJSON\n got: %s\nwant: %s", got, want)
+	}
+	again, _ := EncodeJSON(r, EncodeOptions{})
+	if string(again) != string(got) {
+		t.Error("EncodeJSON output is not stable")
+	}
+}
+
+func TestEncodeECS(t *testing.T) {
+	r := filterRecord(t)
+	got, err := EncodeECS(r, EncodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"@timestamp":"2024-01-15T10:30:00.1234567Z","ecs":{"version":"8.11.0"},` +
+		`"event":{"code":"4624","kind":"event","outcome":"success","provider":"Microsoft-Windows-Security-Auditing"},` +
+		`"host":{"name":"DC01.corp.example"},"log":{"level":"information"},"process":{"pid":612,"thread":{"id":1480}},` +
+		`"user":{"id":"S-1-5-18"},"winlog":{"api":"file","channel":"Security","computer_name":"DC01.corp.example",` +
+		`"event_data":{"LogonType":"10","TargetUserName":"alice"},"event_id":"4624","keywords":["Audit Success"],` +
+		`"process":{"pid":612,"thread":{"id":1480}},"provider_guid":"{54544F85-5A96-494B-A5BA-3E3B0328C30D}",` +
+		`"provider_name":"Microsoft-Windows-Security-Auditing","record_id":"7","user":{"identifier":"S-1-5-18"},"version":2}}`
+	if string(got) != want {
+		t.Errorf("EncodeECS\n got: %s\nwant: %s", got, want)
+	}
+
+	doc := ECSDocument(r, EncodeOptions{IncludeXML: true})
+	if doc["event"].(map[string]interface{})["original"] != r.XML {
+		t.Error("event.original missing with IncludeXML")
+	}
+}
+
+func TestEncodeDuplicates(t *testing.T) {
+	var r Record
+	r.EventData.Pairs = []KeyValue{{"Name", "a"}, {"Name", "b"}, {"", "x"}, {"Name", "c"}}
+	tests := []struct {
+		policy DuplicatePolicy
+		want   map[string]interface{}
+	}{
+		{DuplicateArray, map[string]interface{}{"Name": []interface{}{"a", "b", "c"}, "param3": "x"}},
+		{DuplicateFirst, map[string]interface{}{"Name": "a", "param3": "x"}},
+		{DuplicateLast, map[string]interface{}{"Name": "c", "param3": "x"}},
+		{DuplicateSuffix, map[string]interface{}{"Name": "a", "Name_2": "b", "Name_3": "c", "param3": "x"}},
+	}
+	for _, tt := range tests {
+		data, err := EncodeJSON(r, EncodeOptions{Duplicates: tt.policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc struct {
+			EventData map[string]interface{} `json:"event_data"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(doc.EventData, tt.want) {
+			t.Errorf("policy %d: event_data = %v, want %v", tt.policy, doc.EventData, tt.want)
+		}
+	}
+}
+
+func TestEncodeDuplicateSuffixCollision(t *testing.T) {
+	for _, tt := range []struct {
+		pairs []KeyValue
+		want  map[string]interface{}
+	}{
+		{
+			[]KeyValue{{"Param_2", "x"}, {"Param", "a"}, {"Param", "b"}, {"Param", "c"}},
+			map[string]interface{}{"Param_2": "x", "Param": "a", "Param_3": "b", "Param_4": "c"},
+		},
+		{
+			[]KeyValue{{"Param", "a"}, {"Param", "b"}, {"Param_2", "x"}},
+			map[string]interface{}{"Param": "a", "Param_3": "b", "Param_2": "x"},
+		},
+	} {
+		got := pairsDocument(tt.pairs, EncodeOptions{Duplicates: DuplicateSuffix})
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pairs %v: event_data = %v, want %v", tt.pairs, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeUserData(t *testing.T) {
+	var r Record
+	r.EventIdentifier.ID = 1102
+	r.KeywordsRaw = 0x4010000000000000
+	r.UserData.Name.Local = "LogFileCleared"
+	r.UserData.Pairs = []KeyValue{{"SubjectUserName", "Administrator"}, {"xml_name", "field"}}
+	doc := ECSDocument(r, EncodeOptions{})
+	winlog := doc["winlog"].(map[string]interface{})
+	ud := winlog["user_data"].(map[string]interface{})
+	if winlog["user_data_name"] != "LogFileCleared" || ud["SubjectUserName"] != "Administrator" || ud["xml_name"] != "field" {
+		t.Errorf("winlog.user_data = %v, user_data_name = %v", ud, winlog["user_data_name"])
+	}
+	if doc["event"].(map[string]interface{})["outcome"] != "failure" {
+		t.Errorf("event.outcome = %v", doc["event"])
+	}
+	if _, ok := doc["@timestamp"]; ok {
+		t.Error("@timestamp set for zero time")
+	}
+}
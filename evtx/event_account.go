@@ -0,0 +1,28 @@
+//go:build windows
+
+package evtx
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// PopulateAccount 通过SID查找并填充账户名称和类型。
+//   sid - 待填充的SID对象，包含有效的Identifier
+//   返回 - 查找过程中的错误，成功时为nil；若sid为nil或Identifier为空则直接返回nil
+func PopulateAccount(sid *SID) error {
+	if sid == nil || sid.Identifier == "" {
+		return nil
+	}
+	s, err := windows.StringToSid(sid.Identifier)
+	if err != nil {
+		return err
+	}
+	account, domain, accType, err := s.LookupAccount("")
+	if err != nil {
+		return err
+	}
+	sid.Name = account
+	sid.Domain = domain
+	sid.Type = SIDType(accType)
+	return nil
+}
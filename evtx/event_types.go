@@ -1,5 +1,3 @@
-//go:build windows
-
 package evtx
 
 import (
@@ -8,8 +6,6 @@ import (
 	"strconv"
 	"strings"
 	"time"
-
-	"golang.org/x/sys/windows"
 )
 
 // Event 表示Windows事件日志中的一条事件记录。
@@ -69,6 +65,8 @@ type Record struct {
 	API string
 	// XML 事件的原始XML数据。
 	XML string
+	// Carved 为true表示该记录是从块的空闲空间或未登记、已损坏的块中恢复出的已删除记录。
+	Carved bool
 }
 
 // Provider 标识生成事件的提供程序。
@@ -121,14 +119,14 @@ type TimeCreated struct {
 	SystemTime time.Time
 }
 
-// UnmarshalXML 从XML中解析SystemTime属性。
+// UnmarshalXML 从XML中解析SystemTime属性，只有RawTime（FILETIME）属性时按FILETIME解码。
 //   d - XML解码器
 //   start - XML起始元素
 //   返回 - 解析过程中的错误，成功时为nil
 func (t *TimeCreated) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	attrs := struct {
 		SystemTime string `xml:"SystemTime,attr"`
-		RawTime    uint64 `xml:"RawTime,attr"`
+		RawTime    string `xml:"RawTime,attr"`
 	}{}
 	err := d.DecodeElement(&attrs, &start)
 	if err != nil {
@@ -136,8 +134,12 @@ func (t *TimeCreated) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error
 	}
 	if attrs.SystemTime != "" {
 		t.SystemTime, err = time.Parse(time.RFC3339Nano, attrs.SystemTime)
-	} else if attrs.RawTime != 0 {
-		err = fmt.Errorf("RawTime=%d not supported", attrs.RawTime)
+	} else if attrs.RawTime != "" {
+		ft, perr := strconv.ParseUint(strings.TrimSpace(attrs.RawTime), 0, 64)
+		if perr != nil {
+			return fmt.Errorf("invalid RawTime %q", attrs.RawTime)
+		}
+		t.SystemTime = filetimeToTime(ft)
 	}
 	return err
 }
@@ -160,6 +162,79 @@ type xmlName struct {
 	Local string
 }
 
+// UnmarshalXML 将EventData下的每个Data元素解析为以Name属性为键的键值对。
+//   d - XML解码器
+//   start - EventData起始元素
+//   返回 - 解析过程中的错误，成功时为nil
+func (e *EventData) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	pairs, err := decodePairs(d, start, false)
+	e.Pairs = pairs
+	return err
+}
+
+// UnmarshalXML 解析UserData下的首个子元素，其子元素名和文本作为键值对。
+//   d - XML解码器
+//   start - UserData起始元素
+//   返回 - 解析过程中的错误，成功时为nil
+func (u *UserData) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch elem := t.(type) {
+		case xml.StartElement:
+			if u.Name.Local != "" {
+				if err := d.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			u.Name.Local = elem.Name.Local
+			if u.Pairs, err = decodePairs(d, elem, true); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// decodePairs 将start的子元素解析为键值对，键名取Name属性，
+// 没有Name属性且useElemName为true时取元素名。
+//   d - XML解码器
+//   start - 父元素
+//   useElemName - 是否以元素名作为默认键名
+//   返回1 - 键值对列表
+//   返回2 - 解析过程中的错误，成功时为nil
+func decodePairs(d *xml.Decoder, start xml.StartElement, useElemName bool) ([]KeyValue, error) {
+	var pairs []KeyValue
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return pairs, err
+		}
+		switch elem := t.(type) {
+		case xml.StartElement:
+			var kv KeyValue
+			if useElemName {
+				kv.Key = elem.Name.Local
+			}
+			for _, attr := range elem.Attr {
+				if attr.Name.Local == "Name" {
+					kv.Key = attr.Value
+				}
+			}
+			if err := d.DecodeElement(&kv.Value, &elem); err != nil {
+				return pairs, err
+			}
+			pairs = append(pairs, kv)
+		case xml.EndElement:
+			return pairs, nil
+		}
+	}
+}
+
 // KeyValue 表示事件数据或用户数据中的键值对。
 type KeyValue struct {
 	// Key 键值对的键名。
@@ -174,6 +249,23 @@ type Version uint8
 // HexInt64 表示十六进制64位整数，支持自定义XML反序列化。
 type HexInt64 uint64
 
+// UnmarshalText 解析带0x前缀的十六进制或十进制文本。
+//   text - 元素文本，如 0x8020000000000000
+//   返回 - 解析过程中的错误，成功时为nil
+func (v *HexInt64) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if s == "" {
+		*v = 0
+		return nil
+	}
+	num, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return fmt.Errorf("invalid hex int64 %q: %w", s, err)
+	}
+	*v = HexInt64(num)
+	return nil
+}
+
 // SID 表示Windows安全标识符（Security Identifier）。
 type SID struct {
 	// Identifier SID的字符串标识符。
@@ -295,27 +387,6 @@ var defaultWinMeta = &WinMeta{
 	},
 }
 
-// PopulateAccount 通过SID查找并填充账户名称和类型。
-//   sid - 待填充的SID对象，包含有效的Identifier
-//   返回 - 查找过程中的错误，成功时为nil；若sid为nil或Identifier为空则直接返回nil
-func PopulateAccount(sid *SID) error {
-	if sid == nil || sid.Identifier == "" {
-		return nil
-	}
-	s, err := windows.StringToSid(sid.Identifier)
-	if err != nil {
-		return err
-	}
-	account, domain, accType, err := s.LookupAccount("")
-	if err != nil {
-		return err
-	}
-	sid.Name = account
-	sid.Domain = domain
-	sid.Type = SIDType(accType)
-	return nil
-}
-
 // RemoveWindowsLineEndings 将CRLF替换为LF并去除尾部换行符。
 //   s - 输入的原始字符串
 //   返回 - 处理后的字符串，所有CRLF已替换为LF，尾部换行符已去除
@@ -1,5 +1,3 @@
-//go:build windows
-
 package evtx
 
 import (
@@ -71,7 +69,7 @@ func EnrichRawValuesWithNames(publisherMeta *WinMeta, event *Event) {
 }
 
 // Format 为Record切片添加日志格式化前缀。
-// Deprecated: use direct iteration instead.
+// Deprecated: use EncodeJSON or EncodeECS, which keep every System field and the EventData.
 //   records - 事件记录切片
 //   fn - 可选的过滤函数，返回true时跳过该记录；可为nil
 //   返回 - 格式化后的结果切片，每项包含消息、时间、事件ID、提供程序名称和级别名称
@@ -0,0 +1,157 @@
+//go:build windows
+
+package evtx
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"golang.org/x/sys/windows"
+)
+
+// waitPollInterval 是EventLogSource.Wait检查ctx取消的间隔（毫秒）。
+const waitPollInterval = 250
+
+// EventLogSource 是基于EvtSubscribe的EventSource，新事件到达时由订阅的信号事件唤醒。
+type EventLogSource struct {
+	spec      Query
+	query     string
+	flags     EvtSubscribeFlag
+	signal    windows.Handle
+	handle    EvtHandle
+	renderBuf []byte
+	outputBuf *ByteBuffer
+}
+
+// NewEventLogSource 创建订阅实时事件日志的事件来源。
+//   q - 结构化查询，至少包含一个Select路径
+//   flags - 没有书签时的起始位置，如EvtSubscribeToFutureEvents或EvtSubscribeStartAtOldestRecord
+//   返回1 - 事件来源
+//   返回2 - 查询无效时的错误，成功时为nil
+func NewEventLogSource(q Query, flags EvtSubscribeFlag) (*EventLogSource, error) {
+	if len(q.Selects) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	query, err := q.XML()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+	return &EventLogSource{
+		spec:      q,
+		query:     query,
+		flags:     flags,
+		renderBuf: make([]byte, renderBufferSize),
+		outputBuf: NewByteBuffer(renderBufferSize),
+	}, nil
+}
+
+// Channels 返回查询涉及的全部通道，顺序与Select一致。
+func (s *EventLogSource) Channels() []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, p := range s.spec.Selects {
+		if !seen[p.Path] {
+			seen[p.Path] = true
+			out = append(out, p.Path)
+		}
+	}
+	return out
+}
+
+// Open 创建信号事件并订阅，bookmark非空时从书签之后开始。
+//   bookmark - 起始书签
+//   返回 - 订阅过程中的错误，成功时为nil
+func (s *EventLogSource) Open(bookmark BookmarkList) error {
+	if s.handle != 0 {
+		return fmt.Errorf("event log source already open")
+	}
+	signal, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		return fmt.Errorf("create signal event: %w", err)
+	}
+	var bm EvtHandle
+	flags := s.flags
+	if len(bookmark.Bookmarks) > 0 {
+		if bm, err = bookmark.Handle(); err != nil {
+			windows.CloseHandle(signal)
+			return fmt.Errorf("create bookmark: %w", err)
+		}
+		defer bm.Close()
+		flags = EvtSubscribeStartAfterBookmark
+	}
+	handle, err := Subscribe(0, signal, "", s.query, bm, flags)
+	if err != nil {
+		windows.CloseHandle(signal)
+		return fmt.Errorf("evtsubscribe: %w", err)
+	}
+	s.signal, s.handle = signal, handle
+	return nil
+}
+
+// Next 读取并渲染最多max条事件，连接失效（RPC_S_INVALID_BOUND）时返回ErrSourceReset。
+//   max - 最大记录数
+//   返回1 - 事件记录，暂无新事件时为空
+//   返回2 - 读取过程中的错误，成功时为nil
+func (s *EventLogSource) Next(max int) ([]Record, error) {
+	handles, err := EventHandles(s.handle, max)
+	switch {
+	case err == ERROR_NO_MORE_ITEMS:
+		return nil, nil
+	case err == RPC_S_INVALID_BOUND:
+		return nil, fmt.Errorf("%w: %v", ErrSourceReset, err)
+	case err != nil:
+		return nil, fmt.Errorf("evt handles: %w", err)
+	}
+	defer func() {
+		for _, h := range handles {
+			h.Close()
+		}
+	}()
+
+	records := make([]Record, 0, len(handles))
+	for _, h := range handles {
+		rec, err := renderRecord(h, &s.renderBuf, s.outputBuf)
+		if err != nil {
+			log.Printf("warn: %v", err)
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// Wait 等待订阅的信号事件，ctx取消时返回ctx.Err()。
+//   ctx - 用于取消等待的上下文
+//   返回 - 等待失败或ctx取消时的错误，有新事件时为nil
+func (s *EventLogSource) Wait(ctx context.Context) error {
+	for {
+		ev, err := windows.WaitForSingleObject(s.signal, waitPollInterval)
+		if err != nil {
+			return fmt.Errorf("wait signal event: %w", err)
+		}
+		if ev == windows.WAIT_OBJECT_0 {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// Close 关闭订阅句柄和信号事件，可重复调用。
+//   返回 - 关闭过程中的错误，成功时为nil
+func (s *EventLogSource) Close() error {
+	var err error
+	if s.handle != 0 {
+		err = s.handle.Close()
+		s.handle = 0
+	}
+	if s.signal != 0 {
+		if closeErr := windows.CloseHandle(s.signal); err == nil {
+			err = closeErr
+		}
+		s.signal = 0
+	}
+	return err
+}
@@ -3,6 +3,7 @@
 package evtx
 
 import (
+	"strings"
 	"testing"
 	"unsafe"
 )
@@ -139,6 +140,9 @@ func TestBuildQuery(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if !strings.Contains(q, "EventID=100") || !strings.Contains(q, "timediff(@SystemTime)&lt;=3600000") {
+		t.Errorf("unexpected query: %s", q)
+	}
 	t.Logf("Query with filters: %s", q)
 }
 
@@ -150,3 +154,23 @@ func TestIsFileLog(t *testing.T) {
 		t.Error("isFileLog('Application') should be false")
 	}
 }
+
+func TestReaderChannels(t *testing.T) {
+	r, err := NewReaderWithQuery(Query{Selects: []QueryPath{
+		{Path: "Security", EventIDs: EventIDs(4624)},
+		{Path: "System"},
+		{Path: "Security", EventIDs: EventIDs(4625)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(r.channels(), ","); got != "Security,System" {
+		t.Errorf("channels = %s", got)
+	}
+	if r.target != "" {
+		t.Errorf("target = %q, want empty for multi-channel query", r.target)
+	}
+	if key := r.positionKey(Event{Channel: "System"}); key != "System" {
+		t.Errorf("positionKey = %q, want System", key)
+	}
+}
@@ -0,0 +1,371 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	fileHeaderSize   = 128
+	fileBlockSize    = 4096
+	chunkSize        = 1 << 16 // 64KB
+	chunkHeaderSize  = 512
+	recordHeaderSize = 24
+	recordMinSize    = recordHeaderSize + 4
+)
+
+var (
+	fileSignature   = []byte("ElfFile\x00")
+	chunkSignature  = []byte("ElfChnk\x00")
+	recordSignature = []byte("**\x00\x00")
+)
+
+var (
+	// ErrFileSignature 表示文件头签名不是ElfFile。
+	ErrFileSignature = errors.New("evtx: invalid file header signature")
+	// ErrChunkSignature 表示块头签名不是ElfChnk。
+	ErrChunkSignature = errors.New("evtx: invalid chunk header signature")
+)
+
+// ChecksumError 表示文件头、块头或事件记录区的CRC32校验失败。
+type ChecksumError struct {
+	// Where 校验失败的位置，如 "file header"、"chunk 3 header"。
+	Where string
+	// Stored 文件中记录的校验值。
+	Stored uint32
+	// Computed 根据数据计算出的校验值。
+	Computed uint32
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("evtx: %s checksum mismatch: stored 0x%08x, computed 0x%08x",
+		e.Where, e.Stored, e.Computed)
+}
+
+// FileHeader 对应.evtx文件开头的ElfFile文件头。
+type FileHeader struct {
+	// FirstChunk 第一个块的编号。
+	FirstChunk uint64
+	// LastChunk 最后一个在用块的编号。
+	LastChunk uint64
+	// NextRecordID 下一条要写入记录的标识符。
+	NextRecordID uint64
+	// HeaderSize 文件头大小，通常为128。
+	HeaderSize uint32
+	// MinorVersion 格式副版本号。
+	MinorVersion uint16
+	// MajorVersion 格式主版本号，通常为3。
+	MajorVersion uint16
+	// BlockSize 文件头块大小，通常为4096。
+	BlockSize uint16
+	// ChunkCount 文件头记录的块数量。
+	ChunkCount uint16
+	// Flags 文件标志（0x1 dirty，0x2 full）。
+	Flags uint32
+	// Checksum 文件头前120字节的CRC32。
+	Checksum uint32
+}
+
+// IsDirty 返回文件是否未正常关闭。
+func (h FileHeader) IsDirty() bool { return h.Flags&0x1 != 0 }
+
+// IsFull 返回日志是否已写满。
+func (h FileHeader) IsFull() bool { return h.Flags&0x2 != 0 }
+
+// ChunkHeader 对应每个64KB块开头的ElfChnk块头。
+type ChunkHeader struct {
+	// FirstRecordNumber 块内第一条记录的编号。
+	FirstRecordNumber uint64
+	// LastRecordNumber 块内最后一条记录的编号。
+	LastRecordNumber uint64
+	// FirstRecordID 块内第一条记录的标识符。
+	FirstRecordID uint64
+	// LastRecordID 块内最后一条记录的标识符。
+	LastRecordID uint64
+	// HeaderSize 块头大小，通常为128。
+	HeaderSize uint32
+	// LastRecordOffset 最后一条记录相对块起始的偏移。
+	LastRecordOffset uint32
+	// FreeSpaceOffset 空闲空间相对块起始的偏移。
+	FreeSpaceOffset uint32
+	// RecordsChecksum 事件记录区的CRC32。
+	RecordsChecksum uint32
+	// Flags 块标志。
+	Flags uint32
+	// Checksum 块头的CRC32。
+	Checksum uint32
+}
+
+// File 表示一个以纯Go方式离线解析的.evtx日志文件，不依赖wevtapi。
+type File struct {
+	// Header 已校验的文件头。
+	Header FileHeader
+	r      io.ReaderAt
+	size   int64
+	closer io.Closer
+}
+
+// OpenFile 打开并校验.evtx文件头。
+//   path - .evtx文件路径
+//   返回1 - 文件对象，使用完毕后需调用Close
+//   返回2 - 打开或校验过程中的错误，成功时为nil
+func OpenFile(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ef, err := NewFile(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ef.closer = f
+	return ef, nil
+}
+
+// NewFile 从任意ReaderAt解析.evtx文件头。
+//   r - 文件内容的随机读取接口
+//   size - 文件总字节数
+//   返回1 - 文件对象
+//   返回2 - 解析或校验过程中的错误，成功时为nil
+func NewFile(r io.ReaderAt, size int64) (*File, error) {
+	buf := make([]byte, fileHeaderSize)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return nil, fmt.Errorf("read file header: %w", err)
+	}
+	if !bytes.Equal(buf[:8], fileSignature) {
+		return nil, ErrFileSignature
+	}
+	h := FileHeader{
+		FirstChunk:   binary.LittleEndian.Uint64(buf[8:]),
+		LastChunk:    binary.LittleEndian.Uint64(buf[16:]),
+		NextRecordID: binary.LittleEndian.Uint64(buf[24:]),
+		HeaderSize:   binary.LittleEndian.Uint32(buf[32:]),
+		MinorVersion: binary.LittleEndian.Uint16(buf[36:]),
+		MajorVersion: binary.LittleEndian.Uint16(buf[38:]),
+		BlockSize:    binary.LittleEndian.Uint16(buf[40:]),
+		ChunkCount:   binary.LittleEndian.Uint16(buf[42:]),
+		Flags:        binary.LittleEndian.Uint32(buf[120:]),
+		Checksum:     binary.LittleEndian.Uint32(buf[124:]),
+	}
+	if sum := crc32.ChecksumIEEE(buf[:120]); sum != h.Checksum {
+		return nil, &ChecksumError{Where: "file header", Stored: h.Checksum, Computed: sum}
+	}
+	return &File{Header: h, r: r, size: size}, nil
+}
+
+// Close 关闭由OpenFile打开的底层文件。
+//   返回 - 关闭过程中的错误，成功时为nil
+func (f *File) Close() error {
+	if f.closer != nil {
+		return f.closer.Close()
+	}
+	return nil
+}
+
+// PhysicalChunks 返回文件中实际存在的完整块数量，可能大于Header.ChunkCount。
+func (f *File) PhysicalChunks() int {
+	if f.size <= fileBlockSize {
+		return 0
+	}
+	return int((f.size - fileBlockSize) / chunkSize)
+}
+
+// Chunk 读取并校验指定序号的块。
+//   index - 块序号，从0开始
+//   返回1 - 块对象
+//   返回2 - 读取或校验过程中的错误，成功时为nil
+func (f *File) Chunk(index int) (*Chunk, error) {
+	data, err := f.readChunk(index)
+	if err != nil {
+		return nil, err
+	}
+	return parseChunk(index, data)
+}
+
+func (f *File) readChunk(index int) ([]byte, error) {
+	if index < 0 || index >= f.PhysicalChunks() {
+		return nil, fmt.Errorf("chunk %d out of range", index)
+	}
+	data := make([]byte, chunkSize)
+	off := int64(fileBlockSize) + int64(index)*chunkSize
+	if _, err := f.r.ReadAt(data, off); err != nil {
+		return nil, fmt.Errorf("read chunk %d: %w", index, err)
+	}
+	return data, nil
+}
+
+// Records 依次解析文件头登记的所有块中的事件记录。
+// 校验失败或无法解析的块/记录会记录警告并跳过。
+//   返回1 - 事件记录切片
+//   返回2 - 读取过程中的错误，成功时为nil
+func (f *File) Records() ([]Record, error) {
+	count := int(f.Header.ChunkCount)
+	if n := f.PhysicalChunks(); count > n {
+		count = n
+	}
+	var records []Record
+	for i := 0; i < count; i++ {
+		c, err := f.Chunk(i)
+		if err != nil {
+			log.Printf("warn: chunk %d: %v", i, err)
+			continue
+		}
+		recs, err := c.Records()
+		if err != nil {
+			log.Printf("warn: chunk %d records: %v", i, err)
+		}
+		records = append(records, recs...)
+	}
+	return records, nil
+}
+
+// Chunk 表示.evtx文件中一个已校验的64KB块。
+type Chunk struct {
+	// Index 块在文件中的序号。
+	Index int
+	// Header 已校验的块头。
+	Header    ChunkHeader
+	data      []byte
+	templates map[int]*bxTemplate
+}
+
+func parseChunk(index int, data []byte) (*Chunk, error) {
+	if len(data) < chunkHeaderSize || !bytes.Equal(data[:8], chunkSignature) {
+		return nil, ErrChunkSignature
+	}
+	h := ChunkHeader{
+		FirstRecordNumber: binary.LittleEndian.Uint64(data[8:]),
+		LastRecordNumber:  binary.LittleEndian.Uint64(data[16:]),
+		FirstRecordID:     binary.LittleEndian.Uint64(data[24:]),
+		LastRecordID:      binary.LittleEndian.Uint64(data[32:]),
+		HeaderSize:        binary.LittleEndian.Uint32(data[40:]),
+		LastRecordOffset:  binary.LittleEndian.Uint32(data[44:]),
+		FreeSpaceOffset:   binary.LittleEndian.Uint32(data[48:]),
+		RecordsChecksum:   binary.LittleEndian.Uint32(data[52:]),
+		Flags:             binary.LittleEndian.Uint32(data[120:]),
+		Checksum:          binary.LittleEndian.Uint32(data[124:]),
+	}
+	sum := crc32.ChecksumIEEE(data[:120])
+	sum = crc32.Update(sum, crc32.IEEETable, data[128:chunkHeaderSize])
+	if sum != h.Checksum {
+		return nil, &ChecksumError{Where: fmt.Sprintf("chunk %d header", index), Stored: h.Checksum, Computed: sum}
+	}
+	if h.FreeSpaceOffset < chunkHeaderSize || int(h.FreeSpaceOffset) > len(data) {
+		return nil, fmt.Errorf("chunk %d: free space offset %d out of range", index, h.FreeSpaceOffset)
+	}
+	if sum := crc32.ChecksumIEEE(data[chunkHeaderSize:h.FreeSpaceOffset]); sum != h.RecordsChecksum {
+		return nil, &ChecksumError{Where: fmt.Sprintf("chunk %d records", index), Stored: h.RecordsChecksum, Computed: sum}
+	}
+	return &Chunk{Index: index, Header: h, data: data, templates: map[int]*bxTemplate{}}, nil
+}
+
+// Records 解析块内从块头到空闲空间偏移之间的全部事件记录。
+//   返回1 - 事件记录切片
+//   返回2 - 遇到无法继续遍历的损坏记录时的错误，之前解析的记录仍会返回
+func (c *Chunk) Records() ([]Record, error) {
+	records, _, err := c.walk()
+	return records, err
+}
+
+// walk 顺序遍历记录区，返回解析出的记录以及遍历停止的偏移。
+func (c *Chunk) walk() ([]Record, int, error) {
+	var records []Record
+	off := chunkHeaderSize
+	for off+recordMinSize <= int(c.Header.FreeSpaceOffset) {
+		rec, err := parseRecordHeader(c.data, off)
+		if err != nil {
+			return records, off, fmt.Errorf("record at 0x%x: %w", off, err)
+		}
+		r, err := c.decodeRecord(rec)
+		if err != nil {
+			log.Printf("warn: chunk %d record %d: %v", c.Index, rec.id, err)
+		} else {
+			records = append(records, r)
+		}
+		off += int(rec.size)
+	}
+	return records, off, nil
+}
+
+// eventRecord 是一条事件记录的头部信息，偏移均相对块起始。
+type eventRecord struct {
+	offset  int
+	size    uint32
+	id      uint64
+	written time.Time
+}
+
+// dataRange 返回记录中BinXML数据的起止偏移。
+func (r eventRecord) dataRange() (int, int) {
+	return r.offset + recordHeaderSize, r.offset + int(r.size) - 4
+}
+
+func parseRecordHeader(data []byte, off int) (eventRecord, error) {
+	if off+recordMinSize > len(data) {
+		return eventRecord{}, fmt.Errorf("truncated record header")
+	}
+	if !bytes.Equal(data[off:off+4], recordSignature) {
+		return eventRecord{}, fmt.Errorf("invalid record signature")
+	}
+	rec := eventRecord{
+		offset:  off,
+		size:    binary.LittleEndian.Uint32(data[off+4:]),
+		id:      binary.LittleEndian.Uint64(data[off+8:]),
+		written: filetimeToTime(binary.LittleEndian.Uint64(data[off+16:])),
+	}
+	if rec.size < recordMinSize || off+int(rec.size) > len(data) {
+		return eventRecord{}, fmt.Errorf("invalid record size %d", rec.size)
+	}
+	if tail := binary.LittleEndian.Uint32(data[off+int(rec.size)-4:]); tail != rec.size {
+		return eventRecord{}, fmt.Errorf("record size %d does not match trailing copy %d", rec.size, tail)
+	}
+	return rec, nil
+}
+
+// decodeRecord 将记录中的BinXML渲染为XML并解析为Record。
+func (c *Chunk) decodeRecord(rec eventRecord) (Record, error) {
+	start, end := rec.dataRange()
+	p := &binXMLParser{buf: c.data, templates: c.templates}
+	xmlData, err := p.render(start, end)
+	if err != nil {
+		return Record{}, fmt.Errorf("binxml: %w", err)
+	}
+	evt, err := UnmarshalXML(xmlData)
+	if err != nil {
+		return Record{}, fmt.Errorf("unmarshal xml: %w", err)
+	}
+	if evt.RecordID == 0 {
+		evt.RecordID = rec.id
+	}
+	if evt.TimeCreated.SystemTime.IsZero() {
+		evt.TimeCreated.SystemTime = rec.written
+	}
+	return Record{
+		Event: evt,
+		API:   "file",
+		XML:   string(xmlData),
+	}, nil
+}
+
+// filetimeToTime 将FILETIME（自1601年起的100纳秒间隔）转换为UTC时间。
+func filetimeToTime(ft uint64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+	const epochDiff = 116444736000000000 // 1601-01-01 到 1970-01-01 的100ns间隔数
+	ticks := int64(ft) - epochDiff
+	return time.Unix(ticks/1e7, ticks%1e7*100).UTC()
+}
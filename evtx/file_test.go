@@ -0,0 +1,545 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// tnode 描述测试用BinXML编码器的元素树。
+type tnode struct {
+	kind     int // 0 元素，1 文本，2 替换，3 可选替换
+	name     string
+	attrs    []tnode
+	children []tnode
+	text     string
+	index    int
+	typ      byte
+}
+
+func el(name string, attrs []tnode, children ...tnode) tnode {
+	return tnode{name: name, attrs: attrs, children: children}
+}
+
+func attr(name string, value tnode) tnode {
+	return tnode{name: name, children: []tnode{value}}
+}
+
+func txt(s string) tnode                 { return tnode{kind: 1, text: s} }
+func sub(index int, typ byte) tnode      { return tnode{kind: 2, index: index, typ: typ} }
+func optSub(index int, typ byte) tnode   { return tnode{kind: 3, index: index, typ: typ} }
+func attrs(a ...tnode) []tnode           { return a }
+func sval(typ byte, data []byte) bxValue { return bxValue{typ: typ, data: data} }
+
+func strVal(s string) bxValue {
+	return sval(valueString, utf16Bytes(s))
+}
+
+func u8Val(v uint8) bxValue { return sval(valueUInt8, []byte{v}) }
+
+func u16Val(v uint16) bxValue {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, v)
+	return sval(valueUInt16, b)
+}
+
+func u32Val(v uint32) bxValue {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return sval(valueUInt32, b)
+}
+
+func u64Val(typ byte, v uint64) bxValue {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return sval(typ, b)
+}
+
+func fileTimeVal(t time.Time) bxValue {
+	return u64Val(valueFileTime, timeToFiletime(t))
+}
+
+func guidVal(b [16]byte) bxValue { return sval(valueGUID, b[:]) }
+
+// sidVal 编码 S-1-5-21-<a>-<b>... 形式的SID。
+func sidVal(authority byte, subs ...uint32) bxValue {
+	b := []byte{1, byte(len(subs)), 0, 0, 0, 0, 0, authority}
+	for _, s := range subs {
+		b = binary.LittleEndian.AppendUint32(b, s)
+	}
+	return sval(valueSID, b)
+}
+
+func nullVal() bxValue { return bxValue{typ: valueNull} }
+
+func timeToFiletime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100 + 116444736000000000)
+}
+
+func utf16Bytes(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+// chunkBuilder 以块内绝对偏移构造测试用块数据。base为b[0]对应的偏移。
+type chunkBuilder struct {
+	b         []byte
+	base      int
+	templates map[string]int
+	records   []int
+	firstID   uint64
+	lastID    uint64
+}
+
+func newChunkBuilder() *chunkBuilder {
+	return &chunkBuilder{b: make([]byte, chunkHeaderSize), templates: map[string]int{}}
+}
+
+// newFragmentBuilder 构造偏移从base开始的独立BinXML片段。
+func newFragmentBuilder(base int) *chunkBuilder {
+	return &chunkBuilder{base: base, templates: map[string]int{}}
+}
+
+func (c *chunkBuilder) at() int      { return c.base + len(c.b) }
+func (c *chunkBuilder) u8(v byte)    { c.b = append(c.b, v) }
+func (c *chunkBuilder) u16(v uint16) { c.b = binary.LittleEndian.AppendUint16(c.b, v) }
+func (c *chunkBuilder) u32(v uint32) { c.b = binary.LittleEndian.AppendUint32(c.b, v) }
+func (c *chunkBuilder) u64(v uint64) { c.b = binary.LittleEndian.AppendUint64(c.b, v) }
+func (c *chunkBuilder) put32(at int, v uint32) {
+	binary.LittleEndian.PutUint32(c.b[at:], v)
+}
+
+func (c *chunkBuilder) nameStruct(s string) {
+	u := utf16.Encode([]rune(s))
+	c.u32(0)
+	c.u16(0)
+	c.u16(uint16(len(u)))
+	for _, r := range u {
+		c.u16(r)
+	}
+	c.u16(0)
+}
+
+func (c *chunkBuilder) nameRef(s string) {
+	c.u32(uint32(c.at() + 4))
+	c.nameStruct(s)
+}
+
+func (c *chunkBuilder) node(n tnode) {
+	switch n.kind {
+	case 1:
+		c.u8(tokenValue)
+		c.u8(valueString)
+		u := utf16.Encode([]rune(n.text))
+		c.u16(uint16(len(u)))
+		for _, r := range u {
+			c.u16(r)
+		}
+	case 2, 3:
+		if n.kind == 2 {
+			c.u8(tokenNormalSubst)
+		} else {
+			c.u8(tokenOptionalSubst)
+		}
+		c.u16(uint16(n.index))
+		c.u8(n.typ)
+	default:
+		c.element(n)
+	}
+}
+
+func (c *chunkBuilder) element(n tnode) {
+	tok := byte(tokenOpenStartElement)
+	if len(n.attrs) > 0 {
+		tok |= tokenMoreFlag
+	}
+	c.u8(tok)
+	c.u16(0)
+	sizePos := len(c.b)
+	c.u32(0)
+	nameAt := c.at() + 4
+	if len(n.attrs) > 0 {
+		nameAt += 4
+	}
+	c.u32(uint32(nameAt))
+	attrSizePos := len(c.b)
+	if len(n.attrs) > 0 {
+		c.u32(0)
+	}
+	c.nameStruct(n.name)
+	attrStart := len(c.b)
+	for i, a := range n.attrs {
+		t := byte(tokenAttribute)
+		if i < len(n.attrs)-1 {
+			t |= tokenMoreFlag
+		}
+		c.u8(t)
+		c.nameRef(a.name)
+		c.node(a.children[0])
+	}
+	if len(n.attrs) > 0 {
+		c.put32(attrSizePos, uint32(len(c.b)-attrStart))
+	}
+	if len(n.children) == 0 {
+		c.u8(tokenCloseEmptyElement)
+	} else {
+		c.u8(tokenCloseStartElement)
+		for _, ch := range n.children {
+			c.node(ch)
+		}
+		c.u8(tokenEndElement)
+	}
+	c.put32(sizePos, uint32(len(c.b)-sizePos-4))
+}
+
+// templateInstance 写入模板实例；同名模板第二次出现时引用已有定义。
+// nested中的替换值以其所在位置为基址编码为嵌套BinXML片段。
+func (c *chunkBuilder) templateInstance(key string, tree tnode, values []bxValue, nested ...func(c *chunkBuilder)) {
+	c.u8(tokenTemplateInstance)
+	c.u8(1)
+	c.u32(uint32(len(key)))
+	if off, ok := c.templates[key]; ok {
+		c.u32(uint32(off))
+	} else {
+		off := c.at() + 4
+		c.templates[key] = off
+		c.u32(uint32(off))
+		c.u32(0)
+		c.b = append(c.b, make([]byte, 16)...)
+		dataSizePos := len(c.b)
+		c.u32(0)
+		dataStart := len(c.b)
+		c.b = append(c.b, tokenFragmentHeader, 1, 1, 0)
+		c.element(tree)
+		c.u8(tokenEOF)
+		c.put32(dataSizePos, uint32(len(c.b)-dataStart))
+	}
+	// 嵌套片段长度与基址无关，先按基址0计算大小，写入时再按实际位置重建
+	build := make(map[int]func(c *chunkBuilder))
+	for i := range values {
+		if values[i].typ == valueBinXML && len(build) < len(nested) {
+			build[i] = nested[len(build)]
+			f := newFragmentBuilder(0)
+			build[i](f)
+			values[i].data = f.b
+		}
+	}
+	c.u32(uint32(len(values)))
+	for _, v := range values {
+		c.u16(uint16(len(v.data)))
+		c.u8(v.typ)
+		c.u8(0)
+	}
+	for i, v := range values {
+		if fn, ok := build[i]; ok {
+			f := newFragmentBuilder(c.at())
+			fn(f)
+			v.data = f.b
+		}
+		c.b = append(c.b, v.data...)
+	}
+}
+
+// record 写入一条事件记录。
+func (c *chunkBuilder) record(id uint64, written time.Time, body func()) {
+	start := len(c.b)
+	c.b = append(c.b, recordSignature...)
+	c.u32(0)
+	c.u64(id)
+	c.u64(timeToFiletime(written))
+	c.b = append(c.b, tokenFragmentHeader, 1, 1, 0)
+	body()
+	c.u8(tokenEOF)
+	size := uint32(len(c.b) - start + 4)
+	c.u32(size)
+	c.put32(start+4, size)
+	c.records = append(c.records, start)
+	if c.firstID == 0 {
+		c.firstID = id
+	}
+	c.lastID = id
+}
+
+// finish 补齐块到64KB并写入块头与校验值。
+func (c *chunkBuilder) finish() []byte {
+	free := len(c.b)
+	data := make([]byte, chunkSize)
+	copy(data, c.b)
+	copy(data, chunkSignature)
+	binary.LittleEndian.PutUint64(data[8:], c.firstID)
+	binary.LittleEndian.PutUint64(data[16:], c.lastID)
+	binary.LittleEndian.PutUint64(data[24:], c.firstID)
+	binary.LittleEndian.PutUint64(data[32:], c.lastID)
+	binary.LittleEndian.PutUint32(data[40:], 128)
+	if n := len(c.records); n > 0 {
+		binary.LittleEndian.PutUint32(data[44:], uint32(c.records[n-1]))
+	}
+	binary.LittleEndian.PutUint32(data[48:], uint32(free))
+	binary.LittleEndian.PutUint32(data[52:], crc32.ChecksumIEEE(data[chunkHeaderSize:free]))
+	sum := crc32.ChecksumIEEE(data[:120])
+	sum = crc32.Update(sum, crc32.IEEETable, data[128:chunkHeaderSize])
+	binary.LittleEndian.PutUint32(data[124:], sum)
+	return data
+}
+
+// buildFile 由若干块数据拼接出完整的.evtx文件。
+func buildFile(headerChunks int, chunks ...[]byte) []byte {
+	hdr := make([]byte, fileBlockSize)
+	copy(hdr, fileSignature)
+	binary.LittleEndian.PutUint64(hdr[16:], uint64(headerChunks-1))
+	binary.LittleEndian.PutUint64(hdr[24:], 100)
+	binary.LittleEndian.PutUint32(hdr[32:], 128)
+	binary.LittleEndian.PutUint16(hdr[36:], 1)
+	binary.LittleEndian.PutUint16(hdr[38:], 3)
+	binary.LittleEndian.PutUint16(hdr[40:], fileBlockSize)
+	binary.LittleEndian.PutUint16(hdr[42:], uint16(headerChunks))
+	binary.LittleEndian.PutUint32(hdr[124:], crc32.ChecksumIEEE(hdr[:120]))
+	out := hdr
+	for _, c := range chunks {
+		out = append(out, c...)
+	}
+	return out
+}
+
+// testEvent 是写入测试块的一条安全日志事件。
+type testEvent struct {
+	recordID  uint64
+	eventID   uint16
+	time      time.Time
+	target    string
+	logonType uint32
+}
+
+var providerGUID = [16]byte{0x85, 0x4f, 0x54, 0x54, 0x96, 0x5a, 0x4b, 0x49, 0xa5, 0xba, 0x3e, 0x3b, 0x03, 0x28, 0xc3, 0x0d}
+
+func securityTemplate() tnode {
+	return el("Event", attrs(attr("xmlns", txt("http://schemas.microsoft.com/win/2004/08/events/event"))),
+		el("System", nil,
+			el("Provider", attrs(attr("Name", sub(0, valueString)), attr("Guid", optSub(1, valueGUID)))),
+			el("EventID", attrs(attr("Qualifiers", optSub(3, valueUInt16))), sub(2, valueUInt16)),
+			el("Version", nil, optSub(4, valueUInt8)),
+			el("Level", nil, optSub(5, valueUInt8)),
+			el("Task", nil, optSub(6, valueUInt16)),
+			el("Opcode", nil, optSub(7, valueUInt8)),
+			el("Keywords", nil, optSub(8, valueHexInt64)),
+			el("TimeCreated", attrs(attr("SystemTime", optSub(9, valueFileTime)))),
+			el("EventRecordID", nil, optSub(10, valueUInt64)),
+			el("Correlation", attrs(attr("ActivityID", optSub(11, valueGUID)))),
+			el("Execution", attrs(attr("ProcessID", optSub(12, valueUInt32)), attr("ThreadID", optSub(13, valueUInt32)))),
+			el("Channel", nil, optSub(14, valueString)),
+			el("Computer", nil, optSub(15, valueString)),
+			el("Security", attrs(attr("UserID", optSub(16, valueSID)))),
+		),
+		el("EventData", nil,
+			el("Data", attrs(attr("Name", txt("TargetUserName"))), optSub(17, valueString)),
+			el("Data", attrs(attr("Name", txt("LogonType"))), optSub(18, valueUInt32)),
+		),
+	)
+}
+
+func (e testEvent) values() []bxValue {
+	return []bxValue{
+		strVal("Microsoft-Windows-Security-Auditing"),
+		guidVal(providerGUID),
+		u16Val(e.eventID),
+		nullVal(),
+		u8Val(2),
+		u8Val(0),
+		u16Val(12544),
+		u8Val(0),
+		u64Val(valueHexInt64, 0x8020000000000000),
+		fileTimeVal(e.time),
+		u64Val(valueUInt64, e.recordID),
+		nullVal(),
+		u32Val(612),
+		u32Val(1480),
+		strVal("Security"),
+		strVal("DC01.corp.example"),
+		sidVal(5, 18),
+		strVal(e.target),
+		u32Val(e.logonType),
+	}
+}
+
+func (c *chunkBuilder) addEvent(e testEvent) {
+	c.record(e.recordID, e.time, func() {
+		c.templateInstance("security", securityTemplate(), e.values())
+	})
+}
+
+var testBase = time.Date(2024, 1, 15, 10, 30, 0, 123456700, time.UTC)
+
+func sampleChunk(firstID uint64, n int) []byte {
+	c := newChunkBuilder()
+	for i := 0; i < n; i++ {
+		c.addEvent(testEvent{
+			recordID:  firstID + uint64(i),
+			eventID:   4624,
+			time:      testBase.Add(time.Duration(i) * time.Minute),
+			target:    "alice",
+			logonType: 3,
+		})
+	}
+	return c.finish()
+}
+
+func TestNewFileRecords(t *testing.T) {
+	data := buildFile(2, sampleChunk(1, 3), sampleChunk(4, 2))
+	f, err := NewFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Header.MajorVersion != 3 || f.Header.ChunkCount != 2 {
+		t.Errorf("Header = %+v", f.Header)
+	}
+	if f.PhysicalChunks() != 2 {
+		t.Errorf("PhysicalChunks = %d, want 2", f.PhysicalChunks())
+	}
+
+	records, err := f.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("got %d records, want 5", len(records))
+	}
+	for i, r := range records {
+		if r.RecordID != uint64(i+1) {
+			t.Errorf("records[%d].RecordID = %d, want %d", i, r.RecordID, i+1)
+		}
+		if r.API != "file" {
+			t.Errorf("records[%d].API = %q, want file", i, r.API)
+		}
+	}
+
+	r := records[0]
+	if r.EventIdentifier.ID != 4624 {
+		t.Errorf("EventID = %d, want 4624", r.EventIdentifier.ID)
+	}
+	if r.Provider.Name != "Microsoft-Windows-Security-Auditing" {
+		t.Errorf("Provider.Name = %q", r.Provider.Name)
+	}
+	if r.Provider.GUID != "{54544F85-5A96-494B-A5BA-3E3B0328C30D}" {
+		t.Errorf("Provider.GUID = %q", r.Provider.GUID)
+	}
+	if r.KeywordsRaw != 0x8020000000000000 {
+		t.Errorf("KeywordsRaw = %#x", uint64(r.KeywordsRaw))
+	}
+	if !r.TimeCreated.SystemTime.Equal(testBase) {
+		t.Errorf("TimeCreated = %v, want %v", r.TimeCreated.SystemTime, testBase)
+	}
+	if r.User.Identifier != "S-1-5-18" {
+		t.Errorf("User.Identifier = %q, want S-1-5-18", r.User.Identifier)
+	}
+	if r.Execution.ProcessID != 612 || r.Execution.ThreadID != 1480 {
+		t.Errorf("Execution = %+v", r.Execution)
+	}
+	if r.Computer != "DC01.corp.example" || r.Channel != "Security" {
+		t.Errorf("Computer/Channel = %q/%q", r.Computer, r.Channel)
+	}
+	want := []KeyValue{{"TargetUserName", "alice"}, {"LogonType", "3"}}
+	if len(r.EventData.Pairs) != len(want) {
+		t.Fatalf("EventData = %v, want %v", r.EventData.Pairs, want)
+	}
+	for i := range want {
+		if r.EventData.Pairs[i] != want[i] {
+			t.Errorf("EventData[%d] = %v, want %v", i, r.EventData.Pairs[i], want[i])
+		}
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Security.evtx")
+	data := buildFile(1, sampleChunk(10, 2))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	c, err := f.Chunk(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Header.FirstRecordID != 10 || c.Header.LastRecordID != 11 {
+		t.Errorf("chunk ids = %d..%d, want 10..11", c.Header.FirstRecordID, c.Header.LastRecordID)
+	}
+	records, err := c.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+}
+
+func TestNewFileBadSignature(t *testing.T) {
+	data := buildFile(1, sampleChunk(1, 1))
+	data[0] = 'X'
+	_, err := NewFile(bytes.NewReader(data), int64(len(data)))
+	if !errors.Is(err, ErrFileSignature) {
+		t.Errorf("err = %v, want ErrFileSignature", err)
+	}
+}
+
+func TestNewFileHeaderChecksum(t *testing.T) {
+	data := buildFile(1, sampleChunk(1, 1))
+	data[24]++
+	_, err := NewFile(bytes.NewReader(data), int64(len(data)))
+	var ce *ChecksumError
+	if !errors.As(err, &ce) || ce.Where != "file header" {
+		t.Errorf("err = %v, want file header ChecksumError", err)
+	}
+}
+
+func TestChunkChecksums(t *testing.T) {
+	good := sampleChunk(1, 2)
+
+	badHeader := append([]byte(nil), good...)
+	badHeader[200]++
+	if _, err := parseChunk(0, badHeader); err == nil {
+		t.Error("expected header checksum error")
+	}
+
+	badRecords := append([]byte(nil), good...)
+	badRecords[chunkHeaderSize+30]++
+	var ce *ChecksumError
+	if _, err := parseChunk(0, badRecords); !errors.As(err, &ce) || ce.Where != "chunk 0 records" {
+		t.Errorf("err = %v, want records ChecksumError", err)
+	}
+
+	// 损坏的块被跳过，其余块仍可读取。
+	data := buildFile(2, badRecords, sampleChunk(3, 1))
+	f, err := NewFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := f.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].RecordID != 3 {
+		t.Errorf("records = %d, want only record 3", len(records))
+	}
+}
+
+func TestFiletimeToTime(t *testing.T) {
+	if !filetimeToTime(0).IsZero() {
+		t.Error("filetimeToTime(0) should be zero")
+	}
+	if got := filetimeToTime(timeToFiletime(testBase)); !got.Equal(testBase) {
+		t.Errorf("round trip = %v, want %v", got, testBase)
+	}
+}
@@ -0,0 +1,180 @@
+package evtx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// 日志维护操作的名称，用于LogOpError.Op。
+const (
+	OpExport  = "export"
+	OpClear   = "clear"
+	OpArchive = "archive"
+)
+
+// LogOpError 是导出、清除或归档日志失败时返回的错误。
+type LogOpError struct {
+	// Op 操作名称：OpExport、OpClear或OpArchive。
+	Op string
+	// Channel 源通道或日志文件路径。
+	Channel string
+	// Path 导出目标或备份文件路径，没有时为空。
+	Path string
+	// DryRun 是否在预演统计记录时出错。
+	DryRun bool
+	// Err 底层错误。
+	Err error
+}
+
+func (e *LogOpError) Error() string {
+	op := e.Op
+	if e.DryRun {
+		op += " (dry run)"
+	}
+	if e.Path != "" {
+		return fmt.Sprintf("evtx: %s %s -> %s: %v", op, e.Channel, e.Path, e.Err)
+	}
+	return fmt.Sprintf("evtx: %s %s: %v", op, e.Channel, e.Err)
+}
+
+func (e *LogOpError) Unwrap() error { return e.Err }
+
+// RecordReader 按批次读取记录，读完时返回空切片，Reader满足该接口。
+// 同时实现io.Closer时，预演结束后会被关闭。
+type RecordReader interface {
+	Read() ([]Record, error)
+}
+
+// LogOptions 是ExportLog、ClearLog和ArchiveExportedLog的配置。
+type LogOptions struct {
+	// DryRun 为true时不修改任何日志或文件，只统计将受影响的记录。
+	DryRun bool
+	// Overwrite 导出目标已存在时覆盖。
+	Overwrite bool
+	// TolerateQueryErrors 导出时忽略查询中无效的路径。
+	TolerateQueryErrors bool
+	// Locale 归档时写入的本地化消息语言（LCID），0为当前用户语言。
+	Locale uint32
+	// Open 预演时按查询打开读取器，为nil时使用NewReaderWithQuery；测试中可以替换。
+	Open func(q Query) (RecordReader, error)
+}
+
+// LogSummary 是一组记录的数量与范围。
+type LogSummary struct {
+	// Count 记录数量。
+	Count int
+	// FirstRecordID 最小的记录编号。
+	FirstRecordID uint64
+	// LastRecordID 最大的记录编号。
+	LastRecordID uint64
+	// First 最早的事件创建时间。
+	First time.Time
+	// Last 最晚的事件创建时间。
+	Last time.Time
+}
+
+// Summarize 读取r中的全部记录，统计数量、记录编号范围与时间范围。
+//   r - 记录读取器
+//   返回1 - 统计结果
+//   返回2 - 读取过程中的错误，成功时为nil
+func Summarize(r RecordReader) (LogSummary, error) {
+	var s LogSummary
+	for {
+		records, err := r.Read()
+		if err != nil {
+			return s, err
+		}
+		if len(records) == 0 {
+			return s, nil
+		}
+		for _, rec := range records {
+			s.add(rec)
+		}
+	}
+}
+
+func (s *LogSummary) add(rec Record) {
+	t := rec.TimeCreated.SystemTime
+	if s.Count == 0 {
+		s.FirstRecordID, s.LastRecordID = rec.RecordID, rec.RecordID
+		s.First, s.Last = t, t
+	}
+	s.Count++
+	if rec.RecordID < s.FirstRecordID {
+		s.FirstRecordID = rec.RecordID
+	}
+	if rec.RecordID > s.LastRecordID {
+		s.LastRecordID = rec.RecordID
+	}
+	if t.Before(s.First) {
+		s.First = t
+	}
+	if t.After(s.Last) {
+		s.Last = t
+	}
+}
+
+// channelQuery 将查询限定在channel上：未指定Path的路径使用channel，q为nil时选择通道中的全部事件。
+func channelQuery(channel string, q *Query) (Query, error) {
+	if channel == "" {
+		return Query{}, errors.New("empty channel")
+	}
+	if q == nil {
+		return Query{Selects: []QueryPath{{Path: channel}}}, nil
+	}
+	if len(q.Selects) == 0 {
+		return Query{}, ErrEmptyQuery
+	}
+	scope := func(paths []QueryPath) ([]QueryPath, error) {
+		out := make([]QueryPath, len(paths))
+		for i, p := range paths {
+			if p.Path == "" {
+				p.Path = channel
+			}
+			if p.Path != channel {
+				return nil, fmt.Errorf("query path %q does not match %q", p.Path, channel)
+			}
+			out[i] = p
+		}
+		return out, nil
+	}
+	var out Query
+	var err error
+	if out.Selects, err = scope(q.Selects); err != nil {
+		return Query{}, err
+	}
+	if out.Suppresses, err = scope(q.Suppresses); err != nil {
+		return Query{}, err
+	}
+	return out, nil
+}
+
+// runLogOp 预演时通过opts.Open统计q匹配的记录，否则执行do；错误统一包装为*LogOpError。
+func runLogOp(op, channel, path string, q Query, opts LogOptions, do func() error) (LogSummary, error) {
+	fail := func(err error) (LogSummary, error) {
+		return LogSummary{}, &LogOpError{Op: op, Channel: channel, Path: path, DryRun: opts.DryRun, Err: err}
+	}
+	if !opts.DryRun {
+		if err := do(); err != nil {
+			return fail(err)
+		}
+		return LogSummary{}, nil
+	}
+	if opts.Open == nil {
+		return fail(errors.New("no reader for dry run"))
+	}
+	r, err := opts.Open(q)
+	if err != nil {
+		return fail(err)
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	s, err := Summarize(r)
+	if err != nil {
+		return fail(err)
+	}
+	return s, nil
+}
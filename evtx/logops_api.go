@@ -0,0 +1,111 @@
+//go:build windows
+
+package evtx
+
+import "syscall"
+
+// ExportLog 将通道或.evtx文件中匹配查询的事件导出到新的.evtx文件。
+//   channel - 通道名称或.evtx文件路径
+//   q - 结构化查询，为nil时导出全部事件；未指定Path的路径使用channel
+//   dest - 导出目标文件路径
+//   opts - 导出配置，DryRun时只统计将导出的记录
+//   返回1 - 预演时为将导出记录的统计，否则为零值
+//   返回2 - 失败时的*LogOpError，成功时为nil
+func ExportLog(channel string, q *Query, dest string, opts LogOptions) (LogSummary, error) {
+	query, err := channelQuery(channel, q)
+	if err != nil {
+		return LogSummary{}, &LogOpError{Op: OpExport, Channel: channel, Path: dest, DryRun: opts.DryRun, Err: err}
+	}
+	return runLogOp(OpExport, channel, dest, query, withDefaultOpen(opts), func() error {
+		xml, err := query.XML()
+		if err != nil {
+			return err
+		}
+		flags := EvtExportLogChannelPath
+		if isFileLog(channel) {
+			flags = EvtExportLogFilePath
+		}
+		if opts.Overwrite {
+			flags |= EvtExportLogOverwrite
+		}
+		if opts.TolerateQueryErrors {
+			flags |= EvtExportLogTolerateQueryErrors
+		}
+		path, err := syscall.UTF16PtrFromString(channel)
+		if err != nil {
+			return err
+		}
+		target, err := syscall.UTF16PtrFromString(dest)
+		if err != nil {
+			return err
+		}
+		qp, err := syscall.UTF16PtrFromString(xml)
+		if err != nil {
+			return err
+		}
+		return evtExportLog(0, path, target, qp, flags)
+	})
+}
+
+// ClearLog 清除通道中的全部事件，backupPath非空时先备份到该.evtx文件。
+//   channel - 通道名称
+//   backupPath - 备份文件路径，为空时不备份
+//   opts - 清除配置，DryRun时只统计将被清除的记录
+//   返回1 - 预演时为将被清除记录的统计，否则为零值
+//   返回2 - 失败时的*LogOpError，成功时为nil
+func ClearLog(channel, backupPath string, opts LogOptions) (LogSummary, error) {
+	query, err := channelQuery(channel, nil)
+	if err != nil {
+		return LogSummary{}, &LogOpError{Op: OpClear, Channel: channel, Path: backupPath, DryRun: opts.DryRun, Err: err}
+	}
+	return runLogOp(OpClear, channel, backupPath, query, withDefaultOpen(opts), func() error {
+		path, err := syscall.UTF16PtrFromString(channel)
+		if err != nil {
+			return err
+		}
+		var target *uint16
+		if backupPath != "" {
+			if target, err = syscall.UTF16PtrFromString(backupPath); err != nil {
+				return err
+			}
+		}
+		return evtClearLog(0, path, target, 0)
+	})
+}
+
+// ArchiveExportedLog 将本地化消息写入导出的.evtx文件，使其在其他计算机上也能显示事件消息。
+//   path - 由ExportLog或ClearLog备份生成的.evtx文件路径
+//   opts - 归档配置，Locale指定消息语言；DryRun时只统计文件中的记录
+//   返回1 - 预演时为文件中记录的统计，否则为零值
+//   返回2 - 失败时的*LogOpError，成功时为nil
+func ArchiveExportedLog(path string, opts LogOptions) (LogSummary, error) {
+	query, err := channelQuery(path, nil)
+	if err != nil {
+		return LogSummary{}, &LogOpError{Op: OpArchive, Channel: path, DryRun: opts.DryRun, Err: err}
+	}
+	return runLogOp(OpArchive, path, "", query, withDefaultOpen(opts), func() error {
+		p, err := syscall.UTF16PtrFromString(path)
+		if err != nil {
+			return err
+		}
+		return evtArchiveExportedLog(0, p, opts.Locale, 0)
+	})
+}
+
+// withDefaultOpen 在未指定opts.Open时使用Reader读取预演记录。
+func withDefaultOpen(opts LogOptions) LogOptions {
+	if opts.Open == nil {
+		opts.Open = func(q Query) (RecordReader, error) {
+			r, err := NewReaderWithQuery(q)
+			if err != nil {
+				return nil, err
+			}
+			if err := r.Open(0); err != nil {
+				r.Close()
+				return nil, err
+			}
+			return r, nil
+		}
+	}
+	return opts
+}
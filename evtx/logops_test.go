@@ -0,0 +1,127 @@
+package evtx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sliceReader 是按批次返回记录的RecordReader。
+type sliceReader struct {
+	batches [][]Record
+	err     error
+	closed  bool
+}
+
+func (r *sliceReader) Read() ([]Record, error) {
+	if len(r.batches) == 0 {
+		return nil, r.err
+	}
+	b := r.batches[0]
+	r.batches = r.batches[1:]
+	return b, nil
+}
+
+func (r *sliceReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func rec(id uint64, t time.Time) Record {
+	return Record{Event: Event{RecordID: id, TimeCreated: TimeCreated{SystemTime: t}}}
+}
+
+func TestSummarize(t *testing.T) {
+	t0 := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	r := &sliceReader{batches: [][]Record{
+		{rec(10, t0.Add(time.Hour)), rec(11, t0)},
+		{rec(12, t0.Add(3*time.Hour))},
+	}}
+	s, err := Summarize(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := LogSummary{Count: 3, FirstRecordID: 10, LastRecordID: 12, First: t0, Last: t0.Add(3 * time.Hour)}
+	if s != want {
+		t.Errorf("Summarize = %+v, want %+v", s, want)
+	}
+	if s, err := Summarize(&sliceReader{}); err != nil || s != (LogSummary{}) {
+		t.Errorf("Summarize(empty) = %+v, %v", s, err)
+	}
+}
+
+func TestChannelQuery(t *testing.T) {
+	q, err := channelQuery("Security", &Query{
+		Selects:    []QueryPath{{EventIDs: EventIDs(4624)}},
+		Suppresses: []QueryPath{{Path: "Security", Data: []DataFilter{{Name: "TargetUserName", Values: []string{"SYSTEM"}}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Selects[0].Path != "Security" || q.Suppresses[0].Path != "Security" {
+		t.Errorf("channelQuery = %+v", q)
+	}
+	if q, _ := channelQuery("System", nil); len(q.Selects) != 1 || q.Selects[0].Path != "System" {
+		t.Errorf("channelQuery(nil) = %+v", q)
+	}
+	if _, err := channelQuery("Security", &Query{Selects: []QueryPath{{Path: "System"}}}); err == nil || !strings.Contains(err.Error(), `"System" does not match`) {
+		t.Errorf("mismatched path: err = %v", err)
+	}
+	if _, err := channelQuery("Security", &Query{}); !errors.Is(err, ErrEmptyQuery) {
+		t.Errorf("empty query: err = %v", err)
+	}
+	if _, err := channelQuery("", nil); err == nil {
+		t.Error("empty channel accepted")
+	}
+}
+
+func TestRunLogOpDryRun(t *testing.T) {
+	t0 := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	r := &sliceReader{batches: [][]Record{{rec(1, t0), rec(2, t0.Add(time.Minute))}}}
+	var opened Query
+	opts := LogOptions{DryRun: true, Open: func(q Query) (RecordReader, error) {
+		opened = q
+		return r, nil
+	}}
+	q, _ := channelQuery("Security", nil)
+	s, err := runLogOp(OpClear, "Security", `C:\backup.evtx`, q, opts, func() error {
+		t.Fatal("dry run executed the operation")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Count != 2 || !s.Last.Equal(t0.Add(time.Minute)) || opened.Selects[0].Path != "Security" || !r.closed {
+		t.Errorf("dry run = %+v, query %+v, closed %v", s, opened, r.closed)
+	}
+
+	opts.Open = func(Query) (RecordReader, error) { return &sliceReader{err: errors.New("access denied")}, nil }
+	_, err = runLogOp(OpExport, "Security", "out.evtx", q, opts, nil)
+	var opErr *LogOpError
+	if !errors.As(err, &opErr) || opErr.Op != OpExport || !opErr.DryRun ||
+		err.Error() != "evtx: export (dry run) Security -> out.evtx: access denied" {
+		t.Errorf("dry run error = %v", err)
+	}
+}
+
+func TestRunLogOpExecute(t *testing.T) {
+	q, _ := channelQuery("System", nil)
+	ran := false
+	s, err := runLogOp(OpClear, "System", "", q, LogOptions{}, func() error {
+		ran = true
+		return nil
+	})
+	if err != nil || !ran || s != (LogSummary{}) {
+		t.Errorf("runLogOp = %+v, %v, ran %v", s, err, ran)
+	}
+
+	cause := errors.New("the process cannot access the file")
+	_, err = runLogOp(OpArchive, `C:\logs\sec.evtx`, "", q, LogOptions{}, func() error { return cause })
+	if !errors.Is(err, cause) || err.Error() != `evtx: archive C:\logs\sec.evtx: the process cannot access the file` {
+		t.Errorf("runLogOp error = %v", err)
+	}
+	if _, err := runLogOp(OpClear, "System", "", q, LogOptions{DryRun: true}, nil); err == nil {
+		t.Error("dry run without reader succeeded")
+	}
+}
@@ -0,0 +1,485 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Manifest 是一个事件提供程序的元数据，来自插桩清单（.man）或提供程序二进制中的WEVT_TEMPLATE资源，
+// 可离线解析级别、任务、操作码、关键字名称及事件消息模板。
+type Manifest struct {
+	// Name 提供程序名称。
+	Name string
+	// GUID 提供程序GUID，格式为 {XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX}。
+	GUID string
+	// Symbol 清单中的符号名称。
+	Symbol string
+	// ResourceFileName 包含WEVT_TEMPLATE的二进制路径（仅.man）。
+	ResourceFileName string
+	// MessageFileName 包含消息表的二进制路径（仅.man）。
+	MessageFileName string
+	// Meta 提供程序自定义的级别、任务、操作码与关键字名称，可直接传给EnrichRawValuesWithNames。
+	// Windows保留的标准值（级别0-15、操作码0-10、高16位关键字等）不在其中，由默认映射处理。
+	Meta WinMeta
+	// Channels 通道值到通道名称的映射。
+	Channels map[uint8]string
+	// Events 事件定义，按ID与版本排序。
+	Events []ManifestEvent
+	// Strings 本地化字符串表（string id → 文本），仅.man。
+	Strings map[string]string
+
+	// msgIDs 记录WEVT_TEMPLATE中名称对应的消息ID，便于用消息表替换为本地化名称。
+	msgIDs []metaMessage
+}
+
+// metaMessage 是WinMeta中一项名称对应的消息ID。
+type metaMessage struct {
+	kind  byte // 'p' 提供程序名称, 'l' 级别, 't' 任务, 'o' 操作码, 'k' 关键字
+	value uint64
+	id    uint32
+}
+
+// ManifestEvent 是清单中的一个事件定义。
+type ManifestEvent struct {
+	// ID 事件ID。
+	ID uint32
+	// Version 事件版本。
+	Version uint8
+	// Level 级别值。
+	Level uint8
+	// Task 任务值。
+	Task uint16
+	// Opcode 操作码值。
+	Opcode uint8
+	// Keywords 关键字掩码。
+	Keywords uint64
+	// Channel 通道名称。
+	Channel string
+	// Symbol 事件符号名称。
+	Symbol string
+	// Message 消息模板，如 "The %1 service entered the %2 state."；来自WEVT_TEMPLATE时为空。
+	Message string
+	// MessageID 消息表中的消息ID，0xFFFFFFFF表示没有消息；来自.man时为0。
+	MessageID uint32
+	// Fields 模板中的数据字段，按EventData中的顺序排列。
+	Fields []TemplateField
+}
+
+// TemplateField 是事件模板中的一个数据字段。
+type TemplateField struct {
+	// Name 字段名称，对应EventData中Data的Name属性。
+	Name string
+	// InType 输入类型，如 "win:UnicodeString"、"win:HexInt32"。
+	InType string
+	// OutType 输出类型，如 "xs:string"，可为空。
+	OutType string
+}
+
+// 标准级别、操作码、关键字与任务名称，对应winmeta.xml。
+var (
+	standardLevels = map[string]uint8{
+		"win:LogAlways": 0, "win:Critical": 1, "win:Error": 2, "win:Warning": 3, "win:Informational": 4, "win:Verbose": 5,
+	}
+	standardOpcodes = map[string]uint8{
+		"win:Info": 0, "win:Start": 1, "win:Stop": 2, "win:DC_Start": 3, "win:DC_Stop": 4, "win:Extension": 5,
+		"win:Reply": 6, "win:Resume": 7, "win:Suspend": 8, "win:Send": 9, "win:Receive": 240,
+	}
+	standardKeywords = map[string]uint64{
+		"win:AnyKeyword": 0, "win:ResponseTime": 0x1000000000000, "win:WDIContext": 0x2000000000000,
+		"win:WDIDiag": 0x4000000000000, "win:SQM": 0x8000000000000, "win:AuditFailure": 0x10000000000000,
+		"win:AuditSuccess": 0x20000000000000, "win:CorrelationHint": 0x10000000000000, "win:EventlogClassic": 0x80000000000000,
+	}
+	standardTasks = map[string]uint16{"win:None": 0}
+)
+
+// inTypeNames 将模板字段的输入类型编号（与BinXML值类型相同）映射为清单类型名称。
+var inTypeNames = map[byte]string{
+	valueNull: "win:Null", valueString: "win:UnicodeString", valueAnsiString: "win:AnsiString",
+	valueInt8: "win:Int8", valueUInt8: "win:UInt8", valueInt16: "win:Int16", valueUInt16: "win:UInt16",
+	valueInt32: "win:Int32", valueUInt32: "win:UInt32", valueInt64: "win:Int64", valueUInt64: "win:UInt64",
+	valueReal32: "win:Float", valueReal64: "win:Double", valueBool: "win:Boolean", valueBinary: "win:Binary",
+	valueGUID: "win:GUID", valueSizeT: "win:Pointer", valueFileTime: "win:FILETIME", valueSystemTime: "win:SYSTEMTIME",
+	valueSID: "win:SID", valueHexInt32: "win:HexInt32", valueHexInt64: "win:HexInt64",
+}
+
+// Event 按ID与版本查找事件定义，没有该版本时返回同ID的最高版本。
+//   id - 事件ID
+//   version - 事件版本
+//   返回 - 事件定义，未找到时为nil
+func (m *Manifest) Event(id uint32, version uint8) *ManifestEvent {
+	var best *ManifestEvent
+	for i := range m.Events {
+		e := &m.Events[i]
+		if e.ID != id {
+			continue
+		}
+		if e.Version == version {
+			return e
+		}
+		if best == nil || e.Version > best.Version {
+			best = e
+		}
+	}
+	return best
+}
+
+// TypeHints 由事件模板的输入类型生成EventData字段类型提示，供Event.TypedData与EncodeOptions使用。
+//   id - 事件ID
+//   version - 事件版本
+//   返回 - 字段类型提示，事件不存在或没有模板时为nil
+func (m *Manifest) TypeHints(id uint32, version uint8) TypeHints {
+	e := m.Event(id, version)
+	if e == nil || len(e.Fields) == 0 {
+		return nil
+	}
+	hints := TypeHints{}
+	for _, f := range e.Fields {
+		if f.Name == "" {
+			continue
+		}
+		kind := KindFromInType(f.InType)
+		if f.OutType != "" && KindFromInType(f.OutType) == KindTime {
+			kind = KindTime
+		}
+		hints[f.Name] = kind
+	}
+	return hints
+}
+
+// Enrich 用清单元数据填充事件的Level、Task、Opcode与Keywords名称。
+//   e - 待填充的事件
+func (m *Manifest) Enrich(e *Event) {
+	EnrichRawValuesWithNames(&m.Meta, e)
+}
+
+// ---- .man 清单 ----
+
+type manifestXML struct {
+	Providers []providerXML `xml:"instrumentation>events>provider"`
+	Resources []struct {
+		Culture string `xml:"culture,attr"`
+		Strings []struct {
+			ID    string `xml:"id,attr"`
+			Value string `xml:"value,attr"`
+		} `xml:"stringTable>string"`
+	} `xml:"localization>resources"`
+}
+
+type providerXML struct {
+	Name             string `xml:"name,attr"`
+	GUID             string `xml:"guid,attr"`
+	Symbol           string `xml:"symbol,attr"`
+	ResourceFileName string `xml:"resourceFileName,attr"`
+	MessageFileName  string `xml:"messageFileName,attr"`
+	Channels         []struct {
+		XMLName xml.Name
+		Name    string `xml:"name,attr"`
+		ChID    string `xml:"chid,attr"`
+		Value   string `xml:"value,attr"`
+	} `xml:"channels>channel"`
+	ImportChannels []struct {
+		Name string `xml:"name,attr"`
+		ChID string `xml:"chid,attr"`
+	} `xml:"channels>importChannel"`
+	Levels []struct {
+		Name    string `xml:"name,attr"`
+		Value   string `xml:"value,attr"`
+		Message string `xml:"message,attr"`
+	} `xml:"levels>level"`
+	Tasks []struct {
+		Name    string         `xml:"name,attr"`
+		Value   string         `xml:"value,attr"`
+		Message string         `xml:"message,attr"`
+		Opcodes []manOpcodeXML `xml:"opcodes>opcode"`
+	} `xml:"tasks>task"`
+	Opcodes  []manOpcodeXML `xml:"opcodes>opcode"`
+	Keywords []struct {
+		Name    string `xml:"name,attr"`
+		Mask    string `xml:"mask,attr"`
+		Message string `xml:"message,attr"`
+	} `xml:"keywords>keyword"`
+	Templates []struct {
+		TID    string `xml:"tid,attr"`
+		Fields []struct {
+			XMLName xml.Name
+			Name    string `xml:"name,attr"`
+			InType  string `xml:"inType,attr"`
+			OutType string `xml:"outType,attr"`
+		} `xml:",any"`
+	} `xml:"templates>template"`
+	Events []struct {
+		Value    string `xml:"value,attr"`
+		Version  string `xml:"version,attr"`
+		Level    string `xml:"level,attr"`
+		Task     string `xml:"task,attr"`
+		Opcode   string `xml:"opcode,attr"`
+		Keywords string `xml:"keywords,attr"`
+		Channel  string `xml:"channel,attr"`
+		Symbol   string `xml:"symbol,attr"`
+		Template string `xml:"template,attr"`
+		Message  string `xml:"message,attr"`
+	} `xml:"events>event"`
+}
+
+type manOpcodeXML struct {
+	Name    string `xml:"name,attr"`
+	Value   string `xml:"value,attr"`
+	Message string `xml:"message,attr"`
+}
+
+// ParseManifest 解析插桩清单XML（UTF-8或带BOM的UTF-16），返回其中的全部提供程序。
+// 消息与名称中的 $(string.X) 引用按本地化字符串表解析，有多种语言时优先使用en-US。
+//   data - 清单文件内容
+//   返回1 - 提供程序元数据列表
+//   返回2 - XML格式错误或属性值无效时的错误，成功时为nil
+func ParseManifest(data []byte) ([]*Manifest, error) {
+	data = utf16ToUTF8(data)
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = func(label string, r io.Reader) (io.Reader, error) {
+		if strings.HasPrefix(strings.ToLower(label), "utf-16") {
+			return r, nil
+		}
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+	var raw manifestXML
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+
+	stringsByID := map[string]string{}
+	for i, res := range raw.Resources {
+		if i > 0 && !strings.EqualFold(res.Culture, "en-US") {
+			continue
+		}
+		for _, s := range res.Strings {
+			stringsByID[s.ID] = s.Value
+		}
+	}
+
+	var out []*Manifest
+	for _, p := range raw.Providers {
+		m, err := p.manifest(stringsByID)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: %w", p.Name, err)
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func (p *providerXML) manifest(table map[string]string) (*Manifest, error) {
+	m := &Manifest{
+		Name:             p.Name,
+		GUID:             strings.ToUpper(p.GUID),
+		Symbol:           p.Symbol,
+		ResourceFileName: p.ResourceFileName,
+		MessageFileName:  p.MessageFileName,
+		Meta: WinMeta{
+			Keywords: map[int64]string{},
+			Opcodes:  map[uint8]string{},
+			Levels:   map[uint8]string{},
+			Tasks:    map[uint16]string{},
+		},
+		Channels: map[uint8]string{},
+		Strings:  table,
+	}
+	resolve := func(msg, name string) string {
+		if s := resolveString(msg, table); s != "" {
+			return s
+		}
+		return name
+	}
+
+	channels := map[string]string{}
+	for _, c := range p.ImportChannels {
+		channels[c.Name] = c.Name
+		if c.ChID != "" {
+			channels[c.ChID] = c.Name
+		}
+	}
+	for _, c := range p.Channels {
+		channels[c.Name] = c.Name
+		if c.ChID != "" {
+			channels[c.ChID] = c.Name
+		}
+		if c.Value != "" {
+			v, err := parseManifestUint(c.Value, 8)
+			if err != nil {
+				return nil, fmt.Errorf("channel %s: %w", c.Name, err)
+			}
+			m.Channels[uint8(v)] = c.Name
+		}
+	}
+
+	levels := map[string]uint8{}
+	for _, l := range p.Levels {
+		v, err := parseManifestUint(l.Value, 8)
+		if err != nil {
+			return nil, fmt.Errorf("level %s: %w", l.Name, err)
+		}
+		levels[l.Name] = uint8(v)
+		m.Meta.Levels[uint8(v)] = resolve(l.Message, l.Name)
+	}
+	opcodes := map[string]uint8{}
+	addOpcode := func(o manOpcodeXML) error {
+		v, err := parseManifestUint(o.Value, 8)
+		if err != nil {
+			return fmt.Errorf("opcode %s: %w", o.Name, err)
+		}
+		opcodes[o.Name] = uint8(v)
+		if _, ok := m.Meta.Opcodes[uint8(v)]; !ok {
+			m.Meta.Opcodes[uint8(v)] = resolve(o.Message, o.Name)
+		}
+		return nil
+	}
+	for _, o := range p.Opcodes {
+		if err := addOpcode(o); err != nil {
+			return nil, err
+		}
+	}
+	tasks := map[string]uint16{}
+	for _, t := range p.Tasks {
+		v, err := parseManifestUint(t.Value, 16)
+		if err != nil {
+			return nil, fmt.Errorf("task %s: %w", t.Name, err)
+		}
+		tasks[t.Name] = uint16(v)
+		m.Meta.Tasks[uint16(v)] = resolve(t.Message, t.Name)
+		for _, o := range t.Opcodes {
+			if err := addOpcode(o); err != nil {
+				return nil, err
+			}
+		}
+	}
+	keywords := map[string]uint64{}
+	for _, k := range p.Keywords {
+		v, err := parseManifestUint(k.Mask, 64)
+		if err != nil {
+			return nil, fmt.Errorf("keyword %s: %w", k.Name, err)
+		}
+		keywords[k.Name] = v
+		m.Meta.Keywords[int64(v)] = resolve(k.Message, k.Name)
+	}
+
+	templates := map[string][]TemplateField{}
+	for _, t := range p.Templates {
+		var fields []TemplateField
+		for _, f := range t.Fields {
+			switch f.XMLName.Local {
+			case "data":
+				fields = append(fields, TemplateField{Name: f.Name, InType: f.InType, OutType: f.OutType})
+			case "struct":
+				fields = append(fields, TemplateField{Name: f.Name})
+			}
+		}
+		templates[t.TID] = fields
+	}
+
+	for _, ev := range p.Events {
+		id, err := parseManifestUint(ev.Value, 32)
+		if err != nil {
+			return nil, fmt.Errorf("event %s: %w", ev.Symbol, err)
+		}
+		e := ManifestEvent{
+			ID:      uint32(id),
+			Channel: channels[ev.Channel],
+			Symbol:  ev.Symbol,
+			Message: resolveString(ev.Message, table),
+			Fields:  templates[ev.Template],
+		}
+		if ev.Version != "" {
+			v, err := parseManifestUint(ev.Version, 8)
+			if err != nil {
+				return nil, fmt.Errorf("event %d version: %w", id, err)
+			}
+			e.Version = uint8(v)
+		}
+		if ev.Level != "" {
+			if e.Level, err = lookupName(ev.Level, levels, standardLevels); err != nil {
+				return nil, fmt.Errorf("event %d: %w", id, err)
+			}
+		}
+		if ev.Task != "" {
+			if e.Task, err = lookupName(ev.Task, tasks, standardTasks); err != nil {
+				return nil, fmt.Errorf("event %d: %w", id, err)
+			}
+		}
+		if ev.Opcode != "" {
+			if e.Opcode, err = lookupName(ev.Opcode, opcodes, standardOpcodes); err != nil {
+				return nil, fmt.Errorf("event %d: %w", id, err)
+			}
+		}
+		for _, k := range strings.Fields(ev.Keywords) {
+			mask, err := lookupName(k, keywords, standardKeywords)
+			if err != nil {
+				return nil, fmt.Errorf("event %d: %w", id, err)
+			}
+			e.Keywords |= mask
+		}
+		m.Events = append(m.Events, e)
+	}
+	m.sortEvents()
+	return m, nil
+}
+
+func (m *Manifest) sortEvents() {
+	sort.SliceStable(m.Events, func(i, j int) bool {
+		a, b := m.Events[i], m.Events[j]
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Version < b.Version
+	})
+}
+
+// lookupName 先在提供程序自定义名称中查找，再查找win:前缀的标准名称。
+func lookupName[T uint8 | uint16 | uint64](name string, custom, standard map[string]T) (T, error) {
+	if v, ok := custom[name]; ok {
+		return v, nil
+	}
+	if v, ok := standard[name]; ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("undefined name %q", name)
+}
+
+// resolveString 解析 $(string.X) 引用，非引用的文本原样返回。
+func resolveString(s string, table map[string]string) string {
+	if strings.HasPrefix(s, "$(string.") && strings.HasSuffix(s, ")") {
+		return table[s[len("$(string."):len(s)-1]]
+	}
+	return s
+}
+
+func parseManifestUint(s string, bits int) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return strconv.ParseUint(s[2:], 16, bits)
+	}
+	return strconv.ParseUint(s, 10, bits)
+}
+
+// utf16ToUTF8 将带BOM的UTF-16文本转换为UTF-8，其他内容原样返回。
+func utf16ToUTF8(data []byte) []byte {
+	var order binary.ByteOrder
+	switch {
+	case len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE:
+		order = binary.LittleEndian
+	case len(data) >= 2 && data[0] == 0xFE && data[1] == 0xFF:
+		order = binary.BigEndian
+	default:
+		return bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+	}
+	u := make([]uint16, (len(data)-2)/2)
+	for i := range u {
+		u[i] = order.Uint16(data[2+2*i:])
+	}
+	return []byte(string(utf16.Decode(u)))
+}
@@ -0,0 +1,140 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func loadSampleManifest(t *testing.T, data []byte) *Manifest {
+	t.Helper()
+	ms, err := ParseManifest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 {
+		t.Fatalf("ParseManifest = %d providers, want 1", len(ms))
+	}
+	return ms[0]
+}
+
+func TestParseManifest(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sample.man"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := loadSampleManifest(t, data)
+	if m.Name != "Contoso-Backup" || m.GUID != "{6A3D0B4C-1F2E-4D5A-9B8C-7E6F5A4B3C2D}" || m.Symbol != "CONTOSO_BACKUP" {
+		t.Errorf("provider = %q %q %q", m.Name, m.GUID, m.Symbol)
+	}
+	wantMeta := WinMeta{
+		Keywords: map[int64]string{1: "Disk Backup", 2: "Cloud"},
+		Opcodes:  map[uint8]string{11: "Verify", 20: "Retry"},
+		Levels:   map[uint8]string{16: "Trace"},
+		Tasks:    map[uint16]string{1: "Backup Job", 2: "Restore"},
+	}
+	if !reflect.DeepEqual(m.Meta, wantMeta) {
+		t.Errorf("Meta = %+v, want %+v", m.Meta, wantMeta)
+	}
+	if !reflect.DeepEqual(m.Channels, map[uint8]string{16: "Contoso-Backup/Operational"}) {
+		t.Errorf("Channels = %v", m.Channels)
+	}
+
+	fields := []TemplateField{
+		{Name: "JobName", InType: "win:UnicodeString", OutType: "xs:string"},
+		{Name: "Bytes", InType: "win:UInt64"},
+		{Name: "Status", InType: "win:HexInt32"},
+		{Name: "Started", InType: "win:FILETIME", OutType: "xs:dateTime"},
+	}
+	want := []ManifestEvent{
+		{ID: 100, Level: 4, Task: 1, Opcode: 1, Keywords: 0x1, Channel: "Contoso-Backup/Operational",
+			Symbol: "JOB_START", Message: "Backup job %1 started (%2 bytes).", Fields: fields},
+		{ID: 100, Version: 1, Level: 16, Task: 1, Opcode: 20, Keywords: 0x20000000000003, Channel: "Contoso-Backup/Operational",
+			Symbol: "JOB_START_V1", Message: "Backup job %1 started (%2 bytes).", Fields: fields},
+		{ID: 200, Level: 2, Task: 2, Opcode: 11, Channel: "Application", Symbol: "RESTORE_FAILED", Message: "Restore failed."},
+	}
+	if !reflect.DeepEqual(m.Events, want) {
+		t.Errorf("Events =\n%+v\nwant\n%+v", m.Events, want)
+	}
+
+	if e := m.Event(100, 1); e == nil || e.Symbol != "JOB_START_V1" {
+		t.Errorf("Event(100, 1) = %+v", e)
+	}
+	if e := m.Event(100, 7); e == nil || e.Version != 1 {
+		t.Errorf("Event(100, 7) = %+v, want highest version", e)
+	}
+	if e := m.Event(300, 0); e != nil {
+		t.Errorf("Event(300, 0) = %+v, want nil", e)
+	}
+
+	hints := m.TypeHints(100, 0)
+	wantHints := TypeHints{"JobName": KindString, "Bytes": KindInt, "Status": KindHex, "Started": KindTime}
+	if !reflect.DeepEqual(hints, wantHints) {
+		t.Errorf("TypeHints = %v, want %v", hints, wantHints)
+	}
+	if hints := m.TypeHints(200, 0); hints != nil {
+		t.Errorf("TypeHints(200) = %v, want nil", hints)
+	}
+}
+
+func TestManifestEnrich(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sample.man"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := loadSampleManifest(t, data)
+	opcode := uint8(20)
+	e := Event{LevelRaw: 16, TaskRaw: 1, OpcodeRaw: &opcode, KeywordsRaw: 0x20000000000003}
+	m.Enrich(&e)
+	sort.Strings(e.Keywords)
+	if e.Level != "Trace" || e.Task != "Backup Job" || e.Opcode != "Retry" ||
+		!reflect.DeepEqual(e.Keywords, []string{"Audit Success", "Cloud", "Disk Backup"}) {
+		t.Errorf("Enrich = level %q task %q opcode %q keywords %v", e.Level, e.Task, e.Opcode, e.Keywords)
+	}
+}
+
+func TestParseManifestUTF16(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sample.man"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := strings.Replace(string(data), `encoding="UTF-8"`, `encoding="UTF-16"`, 1)
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xFE})
+	for _, u := range utf16.Encode([]rune(text)) {
+		binary.Write(&buf, binary.LittleEndian, u)
+	}
+	m := loadSampleManifest(t, buf.Bytes())
+	if m.Name != "Contoso-Backup" || len(m.Events) != 3 {
+		t.Errorf("UTF-16 manifest = %q with %d events", m.Name, len(m.Events))
+	}
+}
+
+func TestParseManifestErrors(t *testing.T) {
+	tests := []struct {
+		events string
+		err    string
+	}{
+		{`<event value="1" level="Missing"/>`, `undefined name "Missing"`},
+		{`<event value="1" keywords="win:AuditSuccess Nope"/>`, `undefined name "Nope"`},
+		{`<event value="x"/>`, "invalid syntax"},
+		{`<event value="1" version="300"/>`, "out of range"},
+	}
+	for _, tt := range tests {
+		doc := `<instrumentationManifest><instrumentation><events><provider name="P" guid="{00000000-0000-0000-0000-000000000000}">` +
+			`<events>` + tt.events + `</events></provider></events></instrumentation></instrumentationManifest>`
+		_, err := ParseManifest([]byte(doc))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %q", tt.events, err, tt.err)
+		}
+	}
+	if _, err := ParseManifest([]byte("<instrumentationManifest>")); err == nil {
+		t.Error("truncated manifest accepted")
+	}
+}
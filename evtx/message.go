@@ -0,0 +1,358 @@
+package evtx
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// rtMessageTable 是RT_MESSAGETABLE资源类型。
+const rtMessageTable = 11
+
+// ErrMessageNotFound 表示没有找到事件对应的消息模板。
+var ErrMessageNotFound = errors.New("evtx: message not found")
+
+// MessageTable 是消息ID到消息文本的映射，来自PE文件的MESSAGETABLE资源。
+// 文本保持原样（通常以 "\r\n" 结尾），由FormatMessage展开插入项。
+type MessageTable map[uint32]string
+
+// ParseMessageTable 解析MESSAGETABLE资源数据（MESSAGE_RESOURCE_DATA）。
+//   data - 资源数据
+//   返回1 - 消息表
+//   返回2 - 数据被截断时的错误，成功时为nil
+func ParseMessageTable(data []byte) (MessageTable, error) {
+	if len(data) < 4 {
+		return nil, errors.New("message table truncated")
+	}
+	n := binary.LittleEndian.Uint32(data)
+	if uint64(n)*12+4 > uint64(len(data)) {
+		return nil, fmt.Errorf("message table: %d blocks truncated", n)
+	}
+	t := MessageTable{}
+	for i := uint32(0); i < n; i++ {
+		b := data[4+i*12:]
+		low := binary.LittleEndian.Uint32(b)
+		high := binary.LittleEndian.Uint32(b[4:])
+		off := binary.LittleEndian.Uint32(b[8:])
+		for id := uint64(low); id <= uint64(high); id++ {
+			if uint64(off)+4 > uint64(len(data)) {
+				return nil, fmt.Errorf("message 0x%x: entry truncated", id)
+			}
+			size := uint32(binary.LittleEndian.Uint16(data[off:]))
+			flags := binary.LittleEndian.Uint16(data[off+2:])
+			if size < 4 || uint64(off)+uint64(size) > uint64(len(data)) {
+				return nil, fmt.Errorf("message 0x%x: invalid length %d", id, size)
+			}
+			text := data[off+4 : off+size]
+			switch flags {
+			case 1:
+				u := make([]uint16, len(text)/2)
+				for j := range u {
+					u[j] = binary.LittleEndian.Uint16(text[2*j:])
+				}
+				t[uint32(id)] = strings.TrimRight(string(utf16.Decode(u)), "\x00")
+			default:
+				t[uint32(id)] = strings.TrimRight(string(text), "\x00")
+			}
+			off += size
+		}
+	}
+	return t, nil
+}
+
+// LoadMessageTable 读取PE文件中的MESSAGETABLE资源，多个资源合并为一个消息表。
+//   path - 消息文件路径，如清单的messageFileName、parameterFileName或经典事件源的EventMessageFile
+//   lang - 语言ID，如0x409；为0时优先使用英语（0x409），否则使用第一种语言
+//   返回1 - 消息表
+//   返回2 - 文件不是PE、没有消息表资源或解析失败时的错误，成功时为nil
+func LoadMessageTable(path string, lang uint32) (MessageTable, error) {
+	f, err := pe.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	res, err := readResources(f, resourceID{id: rtMessageTable})
+	if err != nil {
+		return nil, fmt.Errorf("%s: MESSAGETABLE: %w", path, err)
+	}
+	want := lang
+	if want == 0 {
+		want = 0x409
+	}
+	chosen := map[resourceID]peResource{}
+	for _, r := range res {
+		prev, ok := chosen[r.name]
+		if !ok || (r.lang == want && prev.lang != want) {
+			chosen[r.name] = r
+		}
+	}
+	t := MessageTable{}
+	for _, r := range res {
+		c, ok := chosen[r.name]
+		if !ok || c.lang != r.lang {
+			continue
+		}
+		if lang != 0 && c.lang != lang {
+			return nil, fmt.Errorf("%s: MESSAGETABLE %s: language 0x%x not found", path, r.name, lang)
+		}
+		delete(chosen, r.name)
+		part, err := ParseMessageTable(r.data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for id, s := range part {
+			t[id] = s
+		}
+	}
+	return t, nil
+}
+
+// FormatMessage 按FormatMessage的规则展开消息模板。
+// 支持 %1..%99 插入项（可带 !d!、!x!、!08X!、!s! 等printf格式），%% → %，%n/%r/%t/%b 换行、回车、
+// 制表符与空格，%. %! 等转义字面字符，%0 结束输出；插入项及模板中的 %%nnnn 按params中的参数消息替换。
+// 结果中的 "\r\n" 统一为 "\n"，并去掉结尾的换行。
+//   template - 消息模板
+//   inserts - 插入项，inserts[0]对应%1
+//   params - 参数消息表，可为nil
+//   返回 - 展开后的消息
+func FormatMessage(template string, inserts []string, params MessageTable) string {
+	var b strings.Builder
+	expandMessage(&b, template, inserts, params)
+	s := strings.ReplaceAll(b.String(), "\r\n", "\n")
+	return strings.TrimRight(s, "\r\n")
+}
+
+func expandMessage(b *strings.Builder, s string, inserts []string, params MessageTable) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '%' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = s[i]; {
+		case c == '0':
+			return
+		case c >= '1' && c <= '9':
+			j := i + 1
+			if j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			n, _ := strconv.Atoi(s[i:j])
+			spec := ""
+			if j < len(s) && s[j] == '!' {
+				if k := strings.IndexByte(s[j+1:], '!'); k >= 0 {
+					spec = s[j+1 : j+1+k]
+					j += k + 2
+				}
+			}
+			if n > len(inserts) {
+				b.WriteString(s[i-1 : j])
+			} else {
+				b.WriteString(formatInsert(resolveParams(inserts[n-1], params), spec))
+			}
+			i = j - 1
+		case c == '%':
+			j := i + 1
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			if j > i+1 {
+				b.WriteString(resolveParams(s[i-1:j], params))
+				i = j - 1
+			} else {
+				b.WriteByte('%')
+			}
+		case c == 'n':
+			b.WriteString("\r\n")
+		case c == 'r':
+			b.WriteByte('\r')
+		case c == 't':
+			b.WriteByte('\t')
+		case c == 'b':
+			b.WriteByte(' ')
+		case c == '.' || c == '!' || c == ' ':
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(c)
+		}
+	}
+}
+
+// resolveParams 将 %%nnnn 替换为参数消息，如Security日志中的 %%1833 → Yes；未知参数原样保留。
+func resolveParams(s string, params MessageTable) string {
+	if params == nil || !strings.Contains(s, "%%") {
+		return s
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "%%")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		j := i + 2
+		for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			j++
+		}
+		id, err := strconv.ParseUint(s[i+2:j], 10, 32)
+		text, ok := params[uint32(id)]
+		b.WriteString(s[:i])
+		if err == nil && ok {
+			var p strings.Builder
+			expandMessage(&p, text, nil, nil)
+			b.WriteString(strings.TrimRight(p.String(), "\r\n"))
+		} else {
+			b.WriteString(s[i:j])
+		}
+		s = s[j:]
+	}
+}
+
+// formatInsert 按printf格式（如 d、lu、I64x、08X、-10s）格式化插入项，无法解析为数字时原样返回。
+func formatInsert(v, spec string) string {
+	if spec == "" {
+		return v
+	}
+	conv := spec[len(spec)-1]
+	i := 0
+	for i < len(spec)-1 && strings.IndexByte("-+ #0", spec[i]) >= 0 {
+		i++
+	}
+	flags := spec[:i]
+	j := i
+	for j < len(spec)-1 && (spec[j] >= '0' && spec[j] <= '9' || spec[j] == '.') {
+		j++
+	}
+	width := spec[i:j]
+	switch size := spec[j : len(spec)-1]; size {
+	case "", "h", "hh", "l", "ll", "L", "w", "I", "I32", "I64":
+	default:
+		return v
+	}
+	verb := "%" + flags + width
+	switch conv {
+	case 's', 'S':
+		return fmt.Sprintf(verb+"s", v)
+	case 'c', 'C':
+		if r := []rune(v); len(r) > 0 {
+			return fmt.Sprintf(verb+"c", r[0])
+		}
+		return v
+	case 'd', 'i':
+		n, err := parseInsertInt(v)
+		if err != nil {
+			return v
+		}
+		return fmt.Sprintf(verb+"d", n)
+	case 'u':
+		n, err := parseInsertInt(v)
+		if err != nil {
+			return v
+		}
+		return fmt.Sprintf(verb+"d", uint64(n))
+	case 'x', 'X', 'o':
+		n, err := parseInsertInt(v)
+		if err != nil {
+			return v
+		}
+		return fmt.Sprintf(verb+string(conv), uint64(n))
+	}
+	return v
+}
+
+// parseInsertInt 解析十进制或 0x 十六进制的插入项。
+func parseInsertInt(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		u, err := strconv.ParseUint(s[2:], 16, 64)
+		return int64(u), err
+	}
+	if strings.HasPrefix(s, "-") {
+		return strconv.ParseInt(s, 10, 64)
+	}
+	u, err := strconv.ParseUint(s, 10, 64)
+	return int64(u), err
+}
+
+// MessageFormatter 离线生成事件消息，相当于实时渲染的RenderingInfo/Message。
+type MessageFormatter struct {
+	// Manifest 提供程序清单，可为nil；.man中的消息模板优先使用，WEVT_TEMPLATE按MessageID查Messages。
+	Manifest *Manifest
+	// Messages 提供程序的消息表（messageFileName或经典事件源的EventMessageFile）。
+	Messages MessageTable
+	// Parameters 参数消息表（parameterFileName或ParameterMessageFile），用于 %%nnnn，可为nil。
+	Parameters MessageTable
+}
+
+// Format 查找事件的消息模板并用EventData（没有时用UserData）的值展开。
+// 没有清单定义时按经典事件日志的规则以 Qualifiers<<16|EventID 查找消息。
+//   e - 事件
+//   返回1 - 展开后的消息
+//   返回2 - 找不到消息模板时为ErrMessageNotFound，成功时为nil
+func (f *MessageFormatter) Format(e *Event) (string, error) {
+	tmpl, ok := f.template(e)
+	if !ok {
+		return "", fmt.Errorf("%w: event %d", ErrMessageNotFound, e.EventIdentifier.ID)
+	}
+	pairs := e.EventData.Pairs
+	if len(pairs) == 0 {
+		pairs = e.UserData.Pairs
+	}
+	inserts := make([]string, len(pairs))
+	for i, p := range pairs {
+		inserts[i] = p.Value
+	}
+	return FormatMessage(tmpl, inserts, f.Parameters), nil
+}
+
+func (f *MessageFormatter) template(e *Event) (string, bool) {
+	id := e.EventIdentifier.ID
+	if f.Manifest != nil {
+		if def := f.Manifest.Event(id, uint8(e.Version)); def != nil {
+			if def.Message != "" {
+				return def.Message, true
+			}
+			if def.MessageID != wevtNoMessage && def.MessageID != 0 {
+				s, ok := f.Messages[def.MessageID]
+				return s, ok
+			}
+			return "", false
+		}
+	}
+	if s, ok := f.Messages[uint32(e.EventIdentifier.Qualifiers)<<16|id]; ok {
+		return s, true
+	}
+	s, ok := f.Messages[id]
+	return s, ok
+}
+
+// ApplyMessageTable 用消息表中的本地化文本替换WEVT_TEMPLATE解析出的符号名称：
+// 提供程序名称、Meta中的级别、任务、操作码与关键字名称。对.man解析的清单没有影响。
+//   t - 提供程序的消息表
+func (m *Manifest) ApplyMessageTable(t MessageTable) {
+	for _, ref := range m.msgIDs {
+		text, ok := t[ref.id]
+		if !ok {
+			continue
+		}
+		text = FormatMessage(text, nil, nil)
+		switch ref.kind {
+		case 'p':
+			m.Name = text
+		case 'l':
+			m.Meta.Levels[uint8(ref.value)] = text
+		case 't':
+			m.Meta.Tasks[uint16(ref.value)] = text
+		case 'o':
+			m.Meta.Opcodes[uint8(ref.value)] = text
+		case 'k':
+			m.Meta.Keywords[int64(ref.value)] = text
+		}
+	}
+}
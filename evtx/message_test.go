@@ -0,0 +1,190 @@
+package evtx
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// buildMessageTable 构造MESSAGE_RESOURCE_DATA，每个消息单独一个块；ansi中的ID按ANSI编码，其余按Unicode。
+func buildMessageTable(msgs map[uint32]string, ansi ...uint32) []byte {
+	var ids []uint32
+	for id := range msgs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	le := binary.LittleEndian
+	head := le.AppendUint32(nil, uint32(len(ids)))
+	var body []byte
+	base := uint32(4 + 12*len(ids))
+	for _, id := range ids {
+		head = le.AppendUint32(le.AppendUint32(le.AppendUint32(head, id), id), base+uint32(len(body)))
+		var text []byte
+		flags := uint16(1)
+		if isAnsi(id, ansi) {
+			flags = 0
+			text = append([]byte(msgs[id]), 0)
+		} else {
+			for _, u := range append(utf16.Encode([]rune(msgs[id])), 0) {
+				text = le.AppendUint16(text, u)
+			}
+		}
+		for len(text)%4 != 0 {
+			text = append(text, 0)
+		}
+		body = le.AppendUint16(body, uint16(4+len(text)))
+		body = le.AppendUint16(body, flags)
+		body = append(body, text...)
+	}
+	return append(head, body...)
+}
+
+func isAnsi(id uint32, ansi []uint32) bool {
+	for _, a := range ansi {
+		if a == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParseMessageTable(t *testing.T) {
+	want := MessageTable{
+		1:          "The %1 service entered the %2 state.\r\n",
+		2:          "ANSI message\r\n",
+		0xB0000064: "Sicherung\r\n",
+	}
+	got, err := ParseMessageTable(buildMessageTable(want, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseMessageTable = %q, want %q", got, want)
+	}
+	data := buildMessageTable(want)
+	for _, n := range []int{2, 20, len(data) - 8} {
+		if _, err := ParseMessageTable(data[:n]); err == nil {
+			t.Errorf("ParseMessageTable(data[:%d]) accepted truncated data", n)
+		}
+	}
+}
+
+func TestFormatMessage(t *testing.T) {
+	params := MessageTable{1833: "Yes\r\n", 1843: "No\r\n", 1537: "DELETE\r\n", 1538: "READ_CONTROL\r\n"}
+	tests := []struct {
+		tmpl    string
+		inserts []string
+		want    string
+	}{
+		{"The %1 service entered the %2 state.\r\n", []string{"Spooler", "running"}, "The Spooler service entered the running state."},
+		{"Line one%nLine two%0ignored", nil, "Line one\nLine two"},
+		{"a%tb%bc%%d%.%!%rX", nil, "a\tb c%d.!\rX"},
+		{"%2 before %1", []string{"x", "y"}, "y before x"},
+		{"missing %3 stays", []string{"x"}, "missing %3 stays"},
+		{"%10 %1", []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "ten"}, "ten 1"},
+		{"pid %1!d! hex %1!08X! %2!#x! %3!-6s!|", []string{"0x1F", "255", "ab"}, "pid 31 hex 0000001F 0xff ab    |"},
+		{"%1!I64u! %1!lu! %2!c!", []string{"42", "Zed"}, "42 42 Z"},
+		{"bad %1!d!", []string{"n/a"}, "bad n/a"},
+		{"Elevated: %1 Mask: %2", []string{"%%1833", "%%1537\r\n\t\t\t\t%%1538 %%9999"}, "Elevated: Yes Mask: DELETE\r\n\t\t\t\tREAD_CONTROL %%9999"},
+		{"Direct %%1843.", nil, "Direct No."},
+		{"trailing %", nil, "trailing %"},
+	}
+	for _, tt := range tests {
+		want := strings.ReplaceAll(tt.want, "\r\n", "\n")
+		if got := FormatMessage(tt.tmpl, tt.inserts, params); got != want {
+			t.Errorf("FormatMessage(%q) = %q, want %q", tt.tmpl, got, want)
+		}
+	}
+	if got := FormatMessage("%1", []string{"%%1833"}, nil); got != "%%1833" {
+		t.Errorf("FormatMessage without params = %q", got)
+	}
+}
+
+func TestLoadMessageTable(t *testing.T) {
+	path := writePE(t, []testResource{
+		{typ: resourceID{id: rtMessageTable}, name: resourceID{id: 1}, lang: 0x407, data: buildMessageTable(MessageTable{7: "Dienst %1.\r\n"})},
+		{typ: resourceID{id: rtMessageTable}, name: resourceID{id: 1}, lang: 0x409, data: buildMessageTable(MessageTable{7: "Service %1.\r\n"})},
+	})
+	for _, tt := range []struct {
+		lang uint32
+		want string
+	}{{0, "Service %1.\r\n"}, {0x409, "Service %1.\r\n"}, {0x407, "Dienst %1.\r\n"}} {
+		got, err := LoadMessageTable(path, tt.lang)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got[7] != tt.want {
+			t.Errorf("LoadMessageTable(0x%x)[7] = %q, want %q", tt.lang, got[7], tt.want)
+		}
+	}
+	if _, err := LoadMessageTable(path, 0x411); err == nil {
+		t.Error("LoadMessageTable(0x411) succeeded without a Japanese table")
+	}
+}
+
+func TestMessageFormatter(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sample.man"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	man := loadSampleManifest(t, data)
+	e := &Event{EventIdentifier: EventIdentifier{ID: 100}, Version: 1}
+	e.EventData.Pairs = []KeyValue{{Key: "JobName", Value: "nightly"}, {Key: "Bytes", Value: "1024"}}
+	f := &MessageFormatter{Manifest: man}
+	if got, err := f.Format(e); err != nil || got != "Backup job nightly started (1024 bytes)." {
+		t.Errorf("Format(manifest) = %q, %v", got, err)
+	}
+
+	crim, err := ParseWEVTTemplate(buildCRIM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f = &MessageFormatter{Manifest: crim[0], Messages: MessageTable{0xB0000064: "Job %1 copied %2!d! bytes.\r\n"}}
+	if got, err := f.Format(e); err != nil || got != "Job nightly copied 1024 bytes." {
+		t.Errorf("Format(WEVT) = %q, %v", got, err)
+	}
+
+	classic := &Event{EventIdentifier: EventIdentifier{Qualifiers: 0x4000, ID: 7036}}
+	classic.EventData.Pairs = []KeyValue{{Value: "Print Spooler"}, {Value: "%%1843"}}
+	f = &MessageFormatter{
+		Messages:   MessageTable{0x40001B7C: "The %1 service entered the %2 state.\r\n"},
+		Parameters: MessageTable{1843: "stopped\r\n"},
+	}
+	if got, err := f.Format(classic); err != nil || got != "The Print Spooler service entered the stopped state." {
+		t.Errorf("Format(classic) = %q, %v", got, err)
+	}
+	classic.EventIdentifier.ID = 7040
+	if _, err := f.Format(classic); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Format(unknown) err = %v, want ErrMessageNotFound", err)
+	}
+}
+
+func TestApplyMessageTable(t *testing.T) {
+	ms, err := ParseWEVTTemplate(buildCRIM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := ms[0]
+	m.ApplyMessageTable(MessageTable{
+		0x90000001: "Contoso-Backup\r\n",
+		0x50000010: "Trace\r\n",
+		0x30140001: "Retrying%0",
+		0x70000001: "Backup Job\r\n",
+		0x10000001: "Disk Backup\r\n",
+	})
+	want := WinMeta{
+		Keywords: map[int64]string{1: "Disk Backup"},
+		Opcodes:  map[uint8]string{11: "Verify", 20: "Retrying"},
+		Levels:   map[uint8]string{16: "Trace"},
+		Tasks:    map[uint16]string{1: "Backup Job"},
+	}
+	if m.Name != "Contoso-Backup" || !reflect.DeepEqual(m.Meta, want) {
+		t.Errorf("ApplyMessageTable = %q %+v", m.Name, m.Meta)
+	}
+}
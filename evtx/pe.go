@@ -0,0 +1,193 @@
+package evtx
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// resourceID 标识资源目录中的一项：name非空时为字符串名称，否则为数字ID。
+type resourceID struct {
+	name string
+	id   uint32
+}
+
+func (r resourceID) String() string {
+	if r.name != "" {
+		return r.name
+	}
+	return fmt.Sprintf("#%d", r.id)
+}
+
+// peResource 是资源目录中的一个叶子：类型/名称/语言及其数据。
+type peResource struct {
+	name resourceID
+	lang uint32
+	data []byte
+}
+
+// errNoResource 表示PE文件中没有请求的资源类型。
+var errNoResource = errors.New("resource not found")
+
+// readResources 返回PE文件中指定类型的全部资源。
+func readResources(f *pe.File, typ resourceID) ([]peResource, error) {
+	var dirs []pe.DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		dirs = oh.DataDirectory[:]
+		if oh.NumberOfRvaAndSizes < uint32(len(dirs)) {
+			dirs = dirs[:oh.NumberOfRvaAndSizes]
+		}
+	case *pe.OptionalHeader64:
+		dirs = oh.DataDirectory[:]
+		if oh.NumberOfRvaAndSizes < uint32(len(dirs)) {
+			dirs = dirs[:oh.NumberOfRvaAndSizes]
+		}
+	}
+	if len(dirs) <= pe.IMAGE_DIRECTORY_ENTRY_RESOURCE || dirs[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE].Size == 0 {
+		return nil, errNoResource
+	}
+	rva := dirs[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE].VirtualAddress
+	rsrc, err := sectionAt(f, rva)
+	if err != nil {
+		return nil, err
+	}
+	r := &resourceReader{f: f, rsrc: rsrc}
+
+	types, err := r.dir(0)
+	if err != nil {
+		return nil, err
+	}
+	var out []peResource
+	for _, t := range types {
+		if !t.dir || t.id != typ {
+			continue
+		}
+		names, err := r.dir(t.offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range names {
+			leaves := []resEntry{n}
+			if n.dir {
+				if leaves, err = r.dir(n.offset); err != nil {
+					return nil, err
+				}
+			}
+			for _, l := range leaves {
+				if l.dir {
+					continue
+				}
+				data, err := r.data(l.offset)
+				if err != nil {
+					return nil, fmt.Errorf("resource %s/%s: %w", typ, n.id, err)
+				}
+				out = append(out, peResource{name: n.id, lang: l.id.id, data: data})
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil, errNoResource
+	}
+	return out, nil
+}
+
+// sectionAt 返回从rva开始到所在节末尾的数据。
+func sectionAt(f *pe.File, rva uint32) ([]byte, error) {
+	for _, s := range f.Sections {
+		size := s.VirtualSize
+		if size < s.Size {
+			size = s.Size
+		}
+		if rva < s.VirtualAddress || rva >= s.VirtualAddress+size {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, fmt.Errorf("read section %s: %w", s.Name, err)
+		}
+		off := rva - s.VirtualAddress
+		if off >= uint32(len(data)) {
+			return nil, fmt.Errorf("rva 0x%x beyond raw data of section %s", rva, s.Name)
+		}
+		return data[off:], nil
+	}
+	return nil, fmt.Errorf("rva 0x%x not in any section", rva)
+}
+
+type resourceReader struct {
+	f    *pe.File
+	rsrc []byte
+}
+
+// resEntry 是IMAGE_RESOURCE_DIRECTORY_ENTRY，offset相对资源目录起点。
+type resEntry struct {
+	id     resourceID
+	dir    bool
+	offset uint32
+}
+
+func (r *resourceReader) dir(off uint32) ([]resEntry, error) {
+	if uint64(off)+16 > uint64(len(r.rsrc)) {
+		return nil, fmt.Errorf("resource directory at 0x%x truncated", off)
+	}
+	n := int(binary.LittleEndian.Uint16(r.rsrc[off+12:])) + int(binary.LittleEndian.Uint16(r.rsrc[off+14:]))
+	start := off + 16
+	if uint64(start)+uint64(n)*8 > uint64(len(r.rsrc)) {
+		return nil, fmt.Errorf("resource directory at 0x%x: %d entries truncated", off, n)
+	}
+	entries := make([]resEntry, n)
+	for i := range entries {
+		p := start + uint32(i)*8
+		name := binary.LittleEndian.Uint32(r.rsrc[p:])
+		target := binary.LittleEndian.Uint32(r.rsrc[p+4:])
+		e := &entries[i]
+		if name&0x80000000 != 0 {
+			s, err := r.name(name &^ 0x80000000)
+			if err != nil {
+				return nil, err
+			}
+			e.id.name = s
+		} else {
+			e.id.id = name
+		}
+		e.dir = target&0x80000000 != 0
+		e.offset = target &^ 0x80000000
+	}
+	return entries, nil
+}
+
+// name 读取IMAGE_RESOURCE_DIR_STRING_U。
+func (r *resourceReader) name(off uint32) (string, error) {
+	if uint64(off)+2 > uint64(len(r.rsrc)) {
+		return "", fmt.Errorf("resource name at 0x%x truncated", off)
+	}
+	n := uint32(binary.LittleEndian.Uint16(r.rsrc[off:]))
+	if uint64(off)+2+uint64(n)*2 > uint64(len(r.rsrc)) {
+		return "", fmt.Errorf("resource name at 0x%x truncated", off)
+	}
+	u := make([]uint16, n)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(r.rsrc[off+2+uint32(i)*2:])
+	}
+	return string(utf16.Decode(u)), nil
+}
+
+// data 读取IMAGE_RESOURCE_DATA_ENTRY指向的数据，其中OffsetToData为RVA。
+func (r *resourceReader) data(off uint32) ([]byte, error) {
+	if uint64(off)+16 > uint64(len(r.rsrc)) {
+		return nil, fmt.Errorf("resource data entry at 0x%x truncated", off)
+	}
+	rva := binary.LittleEndian.Uint32(r.rsrc[off:])
+	size := binary.LittleEndian.Uint32(r.rsrc[off+4:])
+	data, err := sectionAt(r.f, rva)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(size) > uint64(len(data)) {
+		return nil, fmt.Errorf("resource data at rva 0x%x: size %d exceeds section", rva, size)
+	}
+	return data[:size], nil
+}
@@ -0,0 +1,211 @@
+package evtx
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"unicode/utf16"
+)
+
+// testResource 是buildPE写入资源目录的一项。
+type testResource struct {
+	typ, name resourceID
+	lang      uint32
+	data      []byte
+}
+
+// resNode 是构造资源目录树时的节点，data非nil时为叶子。
+type resNode struct {
+	id       resourceID
+	children []*resNode
+	data     []byte
+	offset   uint32
+}
+
+func (n *resNode) child(id resourceID) *resNode {
+	for _, c := range n.children {
+		if c.id == id {
+			return c
+		}
+	}
+	c := &resNode{id: id}
+	n.children = append(n.children, c)
+	return c
+}
+
+// buildPE 构造只包含一个.rsrc节的最小PE32+文件。
+func buildPE(t *testing.T, resources []testResource) []byte {
+	t.Helper()
+	const rva = 0x1000
+	root := &resNode{}
+	for _, r := range resources {
+		leaf := root.child(r.typ).child(r.name).child(resourceID{id: r.lang})
+		leaf.data = r.data
+	}
+
+	// 目录按层序排列（命名项在前），随后依次是数据项、名称字符串与资源数据。
+	var dirs, leaves []*resNode
+	queue := []*resNode{root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n.data != nil {
+			leaves = append(leaves, n)
+			continue
+		}
+		sort.SliceStable(n.children, func(i, j int) bool {
+			return n.children[i].id.name != "" && n.children[j].id.name == ""
+		})
+		dirs = append(dirs, n)
+		queue = append(queue, n.children...)
+	}
+	var off uint32
+	for _, d := range dirs {
+		d.offset = off
+		off += 16 + 8*uint32(len(d.children))
+	}
+	for _, l := range leaves {
+		l.offset = off
+		off += 16
+	}
+	names := map[string]uint32{}
+	var strs []byte
+	for _, d := range dirs {
+		for _, c := range d.children {
+			if c.id.name == "" {
+				continue
+			}
+			if _, ok := names[c.id.name]; ok {
+				continue
+			}
+			names[c.id.name] = off + uint32(len(strs))
+			u := utf16.Encode([]rune(c.id.name))
+			strs = binary.LittleEndian.AppendUint16(strs, uint16(len(u)))
+			for _, v := range u {
+				strs = binary.LittleEndian.AppendUint16(strs, v)
+			}
+		}
+	}
+	off += uint32(len(strs))
+
+	rsrc := make([]byte, off)
+	for _, d := range dirs {
+		var named, ids uint16
+		for i, c := range d.children {
+			p := d.offset + 16 + uint32(i)*8
+			if c.id.name != "" {
+				named++
+				binary.LittleEndian.PutUint32(rsrc[p:], names[c.id.name]|0x80000000)
+			} else {
+				ids++
+				binary.LittleEndian.PutUint32(rsrc[p:], c.id.id)
+			}
+			target := c.offset
+			if c.data == nil {
+				target |= 0x80000000
+			}
+			binary.LittleEndian.PutUint32(rsrc[p+4:], target)
+		}
+		binary.LittleEndian.PutUint16(rsrc[d.offset+12:], named)
+		binary.LittleEndian.PutUint16(rsrc[d.offset+14:], ids)
+	}
+	copy(rsrc[off-uint32(len(strs)):], strs)
+	for _, l := range leaves {
+		for len(rsrc)%8 != 0 {
+			rsrc = append(rsrc, 0)
+		}
+		binary.LittleEndian.PutUint32(rsrc[l.offset:], rva+uint32(len(rsrc)))
+		binary.LittleEndian.PutUint32(rsrc[l.offset+4:], uint32(len(l.data)))
+		rsrc = append(rsrc, l.data...)
+	}
+
+	raw := (len(rsrc) + 0x1FF) &^ 0x1FF
+	var buf bytes.Buffer
+	dos := make([]byte, 0x40)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 0x40)
+	buf.Write(dos)
+	buf.WriteString("PE\x00\x00")
+	oh := pe.OptionalHeader64{
+		Magic:               0x20b,
+		SectionAlignment:    0x1000,
+		FileAlignment:       0x200,
+		SizeOfImage:         rva + uint32(raw),
+		SizeOfHeaders:       0x200,
+		NumberOfRvaAndSizes: 16,
+	}
+	oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE] = pe.DataDirectory{VirtualAddress: rva, Size: uint32(len(rsrc))}
+	fh := pe.FileHeader{
+		Machine:              pe.IMAGE_FILE_MACHINE_AMD64,
+		NumberOfSections:     1,
+		SizeOfOptionalHeader: uint16(binary.Size(oh)),
+		Characteristics:      pe.IMAGE_FILE_EXECUTABLE_IMAGE | pe.IMAGE_FILE_DLL,
+	}
+	sh := pe.SectionHeader32{
+		VirtualSize:      uint32(len(rsrc)),
+		VirtualAddress:   rva,
+		SizeOfRawData:    uint32(raw),
+		PointerToRawData: 0x200,
+	}
+	copy(sh.Name[:], ".rsrc")
+	for _, v := range []interface{}{fh, oh, sh} {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf.Write(make([]byte, 0x200-buf.Len()))
+	buf.Write(rsrc)
+	buf.Write(make([]byte, raw-len(rsrc)))
+	return buf.Bytes()
+}
+
+// writePE 将buildPE的结果写入临时文件并返回路径。
+func writePE(t *testing.T, resources []testResource) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "provider.dll")
+	if err := os.WriteFile(path, buildPE(t, resources), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadResources(t *testing.T) {
+	data := buildPE(t, []testResource{
+		{typ: resourceID{id: 11}, name: resourceID{id: 1}, lang: 0x409, data: []byte("english")},
+		{typ: resourceID{id: 11}, name: resourceID{id: 1}, lang: 0x407, data: []byte("deutsch")},
+		{typ: resourceID{name: "WEVT_TEMPLATE"}, name: resourceID{id: 1}, lang: 0x409, data: []byte("CRIM")},
+		{typ: resourceID{id: 16}, name: resourceID{name: "VERSION"}, lang: 0, data: []byte("v")},
+	})
+	f, err := pe.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readResources(f, resourceID{id: 11})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []peResource{
+		{name: resourceID{id: 1}, lang: 0x409, data: []byte("english")},
+		{name: resourceID{id: 1}, lang: 0x407, data: []byte("deutsch")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readResources(#11) = %+v, want %+v", got, want)
+	}
+	got, err = readResources(f, resourceID{name: "WEVT_TEMPLATE"})
+	if err != nil || len(got) != 1 || string(got[0].data) != "CRIM" {
+		t.Errorf("readResources(WEVT_TEMPLATE) = %+v, %v", got, err)
+	}
+	got, err = readResources(f, resourceID{id: 16})
+	if err != nil || len(got) != 1 || got[0].name.String() != "VERSION" {
+		t.Errorf("readResources(#16) = %+v, %v", got, err)
+	}
+	if _, err := readResources(f, resourceID{id: 6}); !errors.Is(err, errNoResource) {
+		t.Errorf("readResources(#6) err = %v, want errNoResource", err)
+	}
+}
@@ -0,0 +1,278 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrEmptyQuery 表示查询中没有任何Select路径。
+var ErrEmptyQuery = errors.New("evtx: query has no select path")
+
+// Query 描述一个结构化的事件日志查询，可编译为EvtQuery/EvtSubscribe使用的<QueryList> XML。
+// 所有路径编译到同一个<Query>元素中，Suppress从Select的结果中排除匹配的事件。
+type Query struct {
+	// Selects 要选择事件的路径及条件，至少需要一个。
+	Selects []QueryPath
+	// Suppresses 要排除事件的路径及条件。
+	Suppresses []QueryPath
+}
+
+// QueryPath 描述一个通道（或.evtx文件）上的过滤条件。
+// 不同字段之间为"与"关系，同一字段内的多个值之间为"或"关系，未设置的字段不参与过滤。
+type QueryPath struct {
+	// Path 通道名称或.evtx文件路径。
+	Path string
+	// Levels 事件级别，如1 Critical、2 Error、3 Warning、4 Information。
+	Levels []uint8
+	// Providers 提供程序名称。
+	Providers []string
+	// EventIDs 事件ID或事件ID范围。
+	EventIDs []IDRange
+	// Keywords 关键字掩码，事件关键字与掩码按位与结果非零时匹配。
+	Keywords uint64
+	// Since 只匹配该时间及之后创建的事件。
+	Since time.Time
+	// Until 只匹配该时间及之前创建的事件。
+	Until time.Time
+	// Within 只匹配距当前时间不超过该时长的事件（timediff）。
+	Within time.Duration
+	// Data 按EventData中命名数据项的值过滤。
+	Data []DataFilter
+	// SystemXPath 附加在System[...]中的原始XPath条件，用于兼容旧的字符串过滤方式。
+	SystemXPath string
+}
+
+// IDRange 表示闭区间[Min,Max]的事件ID范围，Max为0时只匹配Min。
+type IDRange struct {
+	// Min 范围下限。
+	Min uint16
+	// Max 范围上限。
+	Max uint16
+}
+
+// EventIDs 将若干单个事件ID转换为IDRange切片。
+//   ids - 事件ID列表
+//   返回 - 每个ID对应一个IDRange的切片
+func EventIDs(ids ...uint16) []IDRange {
+	out := make([]IDRange, len(ids))
+	for i, id := range ids {
+		out[i] = IDRange{Min: id}
+	}
+	return out
+}
+
+// DataFilter 匹配EventData中 Data[@Name=Name] 的值等于Values中任意一个的事件。
+type DataFilter struct {
+	// Name 数据项名称，如 TargetUserName。
+	Name string
+	// Values 可接受的值。
+	Values []string
+}
+
+// QueryList 是<QueryList> XML的结构化表示，用于解析已有查询。
+type QueryList struct {
+	XMLName xml.Name       `xml:"QueryList"`
+	Queries []QueryElement `xml:"Query"`
+}
+
+// QueryElement 对应<QueryList>中的一个<Query>元素。
+type QueryElement struct {
+	// ID 查询编号。
+	ID int `xml:"Id,attr"`
+	// Selects <Select>元素列表。
+	Selects []QuerySelector `xml:"Select"`
+	// Suppresses <Suppress>元素列表。
+	Suppresses []QuerySelector `xml:"Suppress"`
+}
+
+// QuerySelector 对应<Select>或<Suppress>元素。
+type QuerySelector struct {
+	// Path 通道名称或文件路径。
+	Path string `xml:"Path,attr"`
+	// XPath 元素内容中的XPath表达式。
+	XPath string `xml:",chardata"`
+}
+
+// ParseQueryList 解析<QueryList> XML。
+//   data - 查询XML
+//   返回1 - 解析后的查询列表
+//   返回2 - 解析过程中的错误，成功时为nil
+func ParseQueryList(data string) (QueryList, error) {
+	var ql QueryList
+	if err := xml.Unmarshal([]byte(data), &ql); err != nil {
+		return QueryList{}, fmt.Errorf("parse query list: %w", err)
+	}
+	for i := range ql.Queries {
+		for j := range ql.Queries[i].Selects {
+			ql.Queries[i].Selects[j].XPath = strings.TrimSpace(ql.Queries[i].Selects[j].XPath)
+		}
+		for j := range ql.Queries[i].Suppresses {
+			ql.Queries[i].Suppresses[j].XPath = strings.TrimSpace(ql.Queries[i].Suppresses[j].XPath)
+		}
+	}
+	return ql, nil
+}
+
+// XML 将查询编译为<QueryList> XML。
+//   返回1 - 查询XML字符串
+//   返回2 - 查询条件无效时的错误，成功时为nil
+func (q Query) XML() (string, error) {
+	if len(q.Selects) == 0 {
+		return "", ErrEmptyQuery
+	}
+	var b bytes.Buffer
+	b.WriteString("<QueryList>\n  <Query Id=\"0\">\n")
+	write := func(tag string, paths []QueryPath) error {
+		for i, p := range paths {
+			xp, err := p.XPath()
+			if err != nil {
+				return fmt.Errorf("%s %d: %w", strings.ToLower(tag), i, err)
+			}
+			b.WriteString("    <" + tag + " Path=\"")
+			xml.EscapeText(&b, []byte(p.Path))
+			b.WriteString("\">")
+			xml.EscapeText(&b, []byte(xp))
+			b.WriteString("</" + tag + ">\n")
+		}
+		return nil
+	}
+	if err := write("Select", q.Selects); err != nil {
+		return "", err
+	}
+	if err := write("Suppress", q.Suppresses); err != nil {
+		return "", err
+	}
+	b.WriteString("  </Query>\n</QueryList>")
+	return b.String(), nil
+}
+
+// window 返回所有Select路径都限制在最近d时长内的查询副本，用于订阅重连后避免重读旧事件。
+func (q Query) window(d time.Duration) Query {
+	selects := make([]QueryPath, len(q.Selects))
+	copy(selects, q.Selects)
+	for i := range selects {
+		selects[i].Within = d
+	}
+	q.Selects = selects
+	return q
+}
+
+// XPath 将单个路径的过滤条件编译为XPath表达式（未经XML转义）。
+//   返回1 - XPath表达式，无任何条件时为 "*"
+//   返回2 - 条件无效时的错误，成功时为nil
+func (p QueryPath) XPath() (string, error) {
+	if p.Path == "" {
+		return "", fmt.Errorf("empty path")
+	}
+	var system []string
+	if len(p.Providers) > 0 {
+		var names []string
+		for _, name := range p.Providers {
+			lit, err := xpathLiteral(name)
+			if err != nil {
+				return "", fmt.Errorf("provider: %w", err)
+			}
+			names = append(names, "@Name="+lit)
+		}
+		system = append(system, "Provider["+strings.Join(names, " or ")+"]")
+	}
+	if len(p.EventIDs) > 0 {
+		var ids []string
+		for _, r := range p.EventIDs {
+			switch {
+			case r.Max == 0 || r.Max == r.Min:
+				ids = append(ids, "EventID="+strconv.Itoa(int(r.Min)))
+			case r.Max < r.Min:
+				return "", fmt.Errorf("invalid event id range %d-%d", r.Min, r.Max)
+			default:
+				ids = append(ids, fmt.Sprintf("(EventID>=%d and EventID<=%d)", r.Min, r.Max))
+			}
+		}
+		system = append(system, orGroup(ids))
+	}
+	if len(p.Levels) > 0 {
+		var levels []string
+		for _, l := range p.Levels {
+			levels = append(levels, "Level="+strconv.Itoa(int(l)))
+		}
+		system = append(system, orGroup(levels))
+	}
+	if p.Keywords != 0 {
+		system = append(system, "band(Keywords,"+strconv.FormatUint(p.Keywords, 10)+")")
+	}
+	var times []string
+	if !p.Since.IsZero() {
+		times = append(times, "@SystemTime>='"+formatQueryTime(p.Since)+"'")
+	}
+	if !p.Until.IsZero() {
+		if !p.Since.IsZero() && p.Until.Before(p.Since) {
+			return "", fmt.Errorf("time range end %v before start %v", p.Until, p.Since)
+		}
+		times = append(times, "@SystemTime<='"+formatQueryTime(p.Until)+"'")
+	}
+	if p.Within > 0 {
+		times = append(times, "timediff(@SystemTime)<="+strconv.FormatInt(p.Within.Milliseconds(), 10))
+	}
+	if len(times) > 0 {
+		system = append(system, "TimeCreated["+strings.Join(times, " and ")+"]")
+	}
+	if p.SystemXPath != "" {
+		system = append(system, p.SystemXPath)
+	}
+
+	var conds []string
+	if len(system) > 0 {
+		conds = append(conds, "System["+strings.Join(system, " and ")+"]")
+	}
+	for _, d := range p.Data {
+		if d.Name == "" || len(d.Values) == 0 {
+			return "", fmt.Errorf("data filter needs a name and at least one value")
+		}
+		name, err := xpathLiteral(d.Name)
+		if err != nil {
+			return "", fmt.Errorf("data filter %s: %w", d.Name, err)
+		}
+		var values []string
+		for _, v := range d.Values {
+			lit, err := xpathLiteral(v)
+			if err != nil {
+				return "", fmt.Errorf("data filter %s: %w", d.Name, err)
+			}
+			values = append(values, "Data[@Name="+name+"]="+lit)
+		}
+		conds = append(conds, "EventData["+strings.Join(values, " or ")+"]")
+	}
+	if len(conds) == 0 {
+		return "*", nil
+	}
+	return "*[" + strings.Join(conds, " and ") + "]", nil
+}
+
+// orGroup 以 or 连接多个条件，多于一个时加括号。
+func orGroup(conds []string) string {
+	if len(conds) == 1 {
+		return conds[0]
+	}
+	return "(" + strings.Join(conds, " or ") + ")"
+}
+
+// xpathLiteral 将字符串转换为XPath字符串字面量，同时包含单双引号时无法表示。
+func xpathLiteral(s string) (string, error) {
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'", nil
+	}
+	if !strings.Contains(s, "\"") {
+		return "\"" + s + "\"", nil
+	}
+	return "", fmt.Errorf("value %q contains both quote characters", s)
+}
+
+// formatQueryTime 以事件日志查询接受的UTC格式输出时间。
+func formatQueryTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
@@ -0,0 +1,118 @@
+package evtx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryPathXPath(t *testing.T) {
+	since := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		p    QueryPath
+		want string
+	}{
+		{"all", QueryPath{Path: "Security"}, "*"},
+		{"single id", QueryPath{Path: "Security", EventIDs: EventIDs(4624)},
+			"*[System[EventID=4624]]"},
+		{"ids and range", QueryPath{Path: "Security", EventIDs: []IDRange{{Min: 4624}, {Min: 4720, Max: 4738}}},
+			"*[System[(EventID=4624 or (EventID>=4720 and EventID<=4738))]]"},
+		{"levels and provider", QueryPath{Path: "System", Levels: []uint8{1, 2}, Providers: []string{"Service Control Manager"}},
+			"*[System[Provider[@Name='Service Control Manager'] and (Level=1 or Level=2)]]"},
+		{"keywords", QueryPath{Path: "Security", Keywords: 0x10000000000000},
+			"*[System[band(Keywords,4503599627370496)]]"},
+		{"time range", QueryPath{Path: "Security", Since: since, Until: since.Add(36 * time.Hour)},
+			"*[System[TimeCreated[@SystemTime>='2024-01-15T00:00:00.000Z' and @SystemTime<='2024-01-16T12:00:00.000Z']]]"},
+		{"timediff", QueryPath{Path: "Application", Within: time.Hour},
+			"*[System[TimeCreated[timediff(@SystemTime)<=3600000]]]"},
+		{"data", QueryPath{Path: "Security", EventIDs: EventIDs(4625), Data: []DataFilter{
+			{Name: "TargetUserName", Values: []string{"admin", "o'brien"}},
+			{Name: "LogonType", Values: []string{"10"}},
+		}}, `*[System[EventID=4625] and EventData[Data[@Name='TargetUserName']='admin' or Data[@Name='TargetUserName']="o'brien"] and EventData[Data[@Name='LogonType']='10']]`},
+		{"raw", QueryPath{Path: "System", SystemXPath: "EventID=7045 or EventID=7036"},
+			"*[System[EventID=7045 or EventID=7036]]"},
+	}
+	for _, tt := range tests {
+		got, err := tt.p.XPath()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s:\n got  %s\n want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQueryXMLRoundTrip(t *testing.T) {
+	q := Query{
+		Selects: []QueryPath{
+			{Path: "Security", EventIDs: []IDRange{{Min: 4624}, {Min: 4625}}, Data: []DataFilter{{Name: "LogonType", Values: []string{"3", "10"}}}},
+			{Path: "Microsoft-Windows-Sysmon/Operational", EventIDs: EventIDs(1), Levels: []uint8{4}, Within: 24 * time.Hour},
+			{Path: `C:\logs\a&b.evtx`},
+		},
+		Suppresses: []QueryPath{
+			{Path: "Security", Data: []DataFilter{{Name: "TargetUserName", Values: []string{"SYSTEM"}}}},
+		},
+	}
+	data, err := q.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(data, "<=") || strings.Contains(data, ">=") {
+		t.Errorf("comparison operators not escaped:\n%s", data)
+	}
+
+	ql, err := ParseQueryList(data)
+	if err != nil {
+		t.Fatalf("generated query is not valid XML: %v\n%s", err, data)
+	}
+	if len(ql.Queries) != 1 || ql.Queries[0].ID != 0 {
+		t.Fatalf("Queries = %+v", ql.Queries)
+	}
+	check := func(kind string, got []QuerySelector, want []QueryPath) {
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %d paths, want %d", kind, len(got), len(want))
+		}
+		for i, p := range want {
+			xp, _ := p.XPath()
+			if got[i].Path != p.Path || got[i].XPath != xp {
+				t.Errorf("%s %d = %q %q, want %q %q", kind, i, got[i].Path, got[i].XPath, p.Path, xp)
+			}
+		}
+	}
+	check("select", ql.Queries[0].Selects, q.Selects)
+	check("suppress", ql.Queries[0].Suppresses, q.Suppresses)
+}
+
+func TestQueryXMLErrors(t *testing.T) {
+	if _, err := (Query{}).XML(); !errors.Is(err, ErrEmptyQuery) {
+		t.Errorf("empty query err = %v, want ErrEmptyQuery", err)
+	}
+	now := time.Now()
+	bad := []QueryPath{
+		{},
+		{Path: "Security", EventIDs: []IDRange{{Min: 10, Max: 5}}},
+		{Path: "Security", Since: now, Until: now.Add(-time.Hour)},
+		{Path: "Security", Data: []DataFilter{{Name: "X"}}},
+		{Path: "Security", Providers: []string{`a'b"c`}},
+	}
+	for i, p := range bad {
+		if _, err := (Query{Selects: []QueryPath{p}}).XML(); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
+
+func TestQueryWindow(t *testing.T) {
+	q := Query{Selects: []QueryPath{{Path: "Security", Within: 48 * time.Hour}}}
+	w := q.window(time.Minute)
+	if w.Selects[0].Within != time.Minute {
+		t.Errorf("window Within = %v", w.Selects[0].Within)
+	}
+	if q.Selects[0].Within != 48*time.Hour {
+		t.Error("window modified the original query")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"time"
 	"unsafe"
 
@@ -23,14 +24,18 @@ const (
 // Reader 读取Windows事件日志事件。
 type Reader struct {
 	query        string
+	spec         Query
 	target       string
 	isFile       bool
 	isFirstQuery bool
 	subscription EvtHandle
+	signal       windows.Handle
 	maxRead      int
 	lastRead     uint64
 	renderBuf    []byte
 	outputBuf    *ByteBuffer
+	store        BookmarkStore
+	positions    map[string]uint64
 }
 
 // NewReader 创建一个新的事件日志读取器。
@@ -46,23 +51,108 @@ func NewReader(target, eventID string) (*Reader, error) {
 	} else {
 		ignoreOlder = 732 * 24 * time.Hour
 	}
+	return newReader(target, isFile, legacyQuery(target, ignoreOlder, eventID))
+}
 
-	q, err := buildQuery(target, ignoreOlder, eventID)
+// NewReaderWithQuery 使用结构化查询创建事件日志读取器。
+// 所有Select路径相同时按该通道（或.evtx文件）读取并支持书签续读，
+// 跨多个通道时从各通道最早的记录开始订阅。
+//   q - 结构化查询，至少包含一个Select路径
+//   返回1 - 新创建的Reader指针
+//   返回2 - 查询无效时的错误，成功时为nil
+func NewReaderWithQuery(q Query) (*Reader, error) {
+	if len(q.Selects) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	target := q.Selects[0].Path
+	for _, p := range q.Selects[1:] {
+		if p.Path != target {
+			target = ""
+			break
+		}
+	}
+	return newReader(target, isFileLog(target), q)
+}
+
+func newReader(target string, isFile bool, spec Query) (*Reader, error) {
+	q, err := spec.XML()
 	if err != nil {
 		return nil, fmt.Errorf("build query: %w", err)
 	}
 
 	return &Reader{
 		query:        q,
+		spec:         spec,
 		target:       target,
 		isFile:       isFile,
 		isFirstQuery: !isFile,
 		maxRead:      defaultMaxRead,
 		renderBuf:    make([]byte, renderBufferSize),
 		outputBuf:    NewByteBuffer(renderBufferSize),
+		positions:    map[string]uint64{},
 	}, nil
 }
 
+// SetBookmarkStore 设置进度存储，此后每次成功Read都会保存各通道最新的记录编号。
+//   store - 进度存储，为nil时不再保存
+func (r *Reader) SetBookmarkStore(store BookmarkStore) {
+	r.store = store
+}
+
+// Resume 从进度存储中保存的位置继续打开日志，没有保存进度的通道从最早的记录开始。
+// 读取.evtx文件时从头查询并跳过已处理的记录。
+//   返回 - 读取进度或打开过程中的错误，成功时为nil
+func (r *Reader) Resume() error {
+	if r.store == nil {
+		return fmt.Errorf("resume: no bookmark store")
+	}
+	for _, ch := range r.channels() {
+		id, ok, err := r.store.Load(ch)
+		if err != nil {
+			return fmt.Errorf("load bookmark %s: %w", ch, err)
+		}
+		if ok {
+			r.positions[ch] = id
+			if id > r.lastRead {
+				r.lastRead = id
+			}
+		}
+	}
+	return r.reopen()
+}
+
+// channels 返回查询涉及的全部通道（或文件路径），顺序与Select一致。
+func (r *Reader) channels() []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, p := range r.spec.Selects {
+		if !seen[p.Path] {
+			seen[p.Path] = true
+			out = append(out, p.Path)
+		}
+	}
+	return out
+}
+
+// reopen 按已记录的各通道进度重新订阅，没有进度时从最早的记录开始；文件日志重新查询。
+func (r *Reader) reopen() error {
+	if r.isFile {
+		return r.Open(0)
+	}
+	if len(r.positions) == 0 {
+		if r.target != "" && r.lastRead > 0 {
+			return r.Open(r.lastRead)
+		}
+		return r.subscribe(0, EvtSubscribeStartAtOldestRecord)
+	}
+	bookmark, err := bookmarkListFromPositions(r.positions).Handle()
+	if err != nil {
+		return fmt.Errorf("create bookmark: %w", err)
+	}
+	defer bookmark.Close()
+	return r.subscribe(bookmark, EvtSubscribeStartAfterBookmark)
+}
+
 // Open 从指定记录编号开始打开日志。
 //   recordNumber - 要开始读取的记录编号，用于创建书签
 //   返回 - 打开过程中的错误，成功时为nil
@@ -76,32 +166,37 @@ func (r *Reader) Open(recordNumber uint64) error {
 		return nil
 	}
 
-	bookmarkXML := fmt.Sprintf(`<BookmarkList>
-  <Bookmark Channel='%s' RecordId='%d' IsCurrent='true'/>
-</BookmarkList>`, r.target, recordNumber)
+	if r.target == "" {
+		return r.subscribe(0, EvtSubscribeStartAtOldestRecord)
+	}
 
-	bookmark, err := CreateBookmarkFromXML(bookmarkXML)
+	bookmark, err := BookmarkList{Bookmarks: []BookmarkEntry{{Channel: r.target, RecordID: recordNumber, IsCurrent: true}}}.Handle()
 	if err != nil {
 		return fmt.Errorf("create bookmark: %w", err)
 	}
 	defer bookmark.Close()
+	return r.subscribe(bookmark, EvtSubscribeStartAfterBookmark)
+}
 
+func (r *Reader) subscribe(bookmark EvtHandle, flags EvtSubscribeFlag) error {
 	signalEvent, err := windows.CreateEvent(nil, 0, 0, nil)
 	if err != nil {
 		return fmt.Errorf("create signal event: %w", err)
 	}
 
-	handle, err := Subscribe(0, signalEvent, r.target, r.query, bookmark, EvtSubscribeStartAfterBookmark)
+	handle, err := Subscribe(0, signalEvent, r.target, r.query, bookmark, flags)
 	if err != nil {
+		windows.CloseHandle(signalEvent)
 		return fmt.Errorf("evtsubscribe: %w", err)
 	}
 	r.subscription = handle
+	r.signal = signalEvent
 	return nil
 }
 
-// Read 从日志中读取事件。
+// Read 从日志中读取事件。设置了进度存储时，成功读取后保存各通道的最新记录编号。
 //   返回1 - 事件记录切片
-//   返回2 - 读取过程中的错误，成功时为nil
+//   返回2 - 读取过程中的错误，成功时为nil；保存进度失败时仍返回本批记录
 func (r *Reader) Read() ([]Record, error) {
 	handles, err := r.getEventHandles()
 	if err != nil {
@@ -118,53 +213,99 @@ func (r *Reader) Read() ([]Record, error) {
 	}()
 
 	var records []Record
+	touched := map[string]bool{}
 	for _, h := range handles {
-		r.outputBuf.Reset()
-		err := RenderEventXML(h, r.renderBuf, r.outputBuf)
-		var ib *winapi.ErrInsufficientBuffer
-		if errors.As(err, &ib) {
-			r.renderBuf = make([]byte, ib.Size)
-			err = RenderEventXML(h, r.renderBuf, r.outputBuf)
-		}
+		rec, err := renderRecord(h, &r.renderBuf, r.outputBuf)
 		if err != nil {
-			log.Printf("warn: render event: %v", err)
+			log.Printf("warn: %v", err)
 			continue
 		}
 
-		xmlData := r.outputBuf.Bytes()
-		evt, err := UnmarshalXML(xmlData)
-		if err != nil {
-			log.Printf("warn: unmarshal xml: %v", err)
+		key := r.positionKey(rec.Event)
+		if pos, ok := r.positions[key]; ok && r.isFile && rec.RecordID <= pos {
 			continue
 		}
 
-		PopulateAccount(&evt.User)
-
-		records = append(records, Record{
-			Event: evt,
-			API:   "evtx",
-			XML:   string(xmlData),
-		})
-		r.lastRead = evt.RecordID
+		records = append(records, rec)
+		r.lastRead = rec.RecordID
+		if rec.RecordID > r.positions[key] {
+			r.positions[key] = rec.RecordID
+			touched[key] = true
+		}
 	}
 
 	if r.isFirstQuery {
 		r.isFirstQuery = false
-		q, err := buildQuery(r.target, 60*time.Second, r.query)
-		if err == nil {
+		spec := r.spec.window(60 * time.Second)
+		if q, err := spec.XML(); err == nil {
 			r.query = q
 		}
 	}
+	if r.store != nil {
+		for key := range touched {
+			if err := r.store.Save(key, r.positions[key]); err != nil {
+				return records, fmt.Errorf("save bookmark %s: %w", key, err)
+			}
+		}
+	}
 	return records, nil
 }
 
+// renderRecord 将事件句柄渲染为XML（EvtRender输出UTF-16，转换为UTF-8）并解析为记录，
+// 渲染缓冲区不足时按所需大小扩容。
+func renderRecord(h EvtHandle, renderBuf *[]byte, out *ByteBuffer) (Record, error) {
+	out.Reset()
+	err := RenderEventXML(h, *renderBuf, out)
+	var ib *winapi.ErrInsufficientBuffer
+	if errors.As(err, &ib) {
+		*renderBuf = make([]byte, ib.Size)
+		err = RenderEventXML(h, *renderBuf, out)
+	}
+	if err != nil {
+		return Record{}, fmt.Errorf("render event: %w", err)
+	}
+
+	var xmlData string
+	if raw := out.Bytes(); len(raw) >= 2 {
+		xmlData = windows.UTF16ToString(unsafe.Slice((*uint16)(unsafe.Pointer(&raw[0])), len(raw)/2))
+	}
+	evt, err := UnmarshalXML([]byte(xmlData))
+	if err != nil {
+		return Record{}, fmt.Errorf("unmarshal xml: %w", err)
+	}
+	PopulateAccount(&evt.User)
+	return Record{Event: evt, API: "evtx", XML: xmlData}, nil
+}
+
+// Bookmark 返回读取器当前的进度书签，包含已读取过的全部通道。
+//   返回 - 书签对象，可通过XML()序列化保存
+func (r *Reader) Bookmark() BookmarkList {
+	return bookmarkListFromPositions(r.positions)
+}
+
+// positionKey 返回记录进度使用的键：文件读取时为文件路径，否则为事件所属通道。
+func (r *Reader) positionKey(evt Event) string {
+	if r.isFile || evt.Channel == "" {
+		return r.target
+	}
+	return evt.Channel
+}
+
 // Close 关闭读取器。
 //   返回 - 关闭过程中的错误，成功时为nil
 func (r *Reader) Close() error {
+	var err error
 	if r.subscription != 0 {
-		return r.subscription.Close()
+		err = r.subscription.Close()
+		r.subscription = 0
 	}
-	return nil
+	if r.signal != 0 {
+		if closeErr := windows.CloseHandle(r.signal); err == nil {
+			err = closeErr
+		}
+		r.signal = 0
+	}
+	return err
 }
 
 func (r *Reader) getEventHandles() ([]EvtHandle, error) {
@@ -183,7 +324,7 @@ func (r *Reader) getEventHandles() ([]EvtHandle, error) {
 			if closeErr := r.Close(); closeErr != nil {
 				return nil, fmt.Errorf("reconnect close: %w", closeErr)
 			}
-			if openErr := r.Open(r.lastRead); openErr != nil {
+			if openErr := r.reopen(); openErr != nil {
 				return nil, fmt.Errorf("reconnect open: %w", openErr)
 			}
 			r.maxRead /= 2
@@ -230,43 +371,25 @@ func isFileLog(target string) bool {
 
 // buildQuery constructs a WEL query XML string.
 func buildQuery(logName string, ignoreOlder time.Duration, eventID string) (string, error) {
-	var selects []string
-	if ignoreOlder > 0 {
-		ms := ignoreOlder.Nanoseconds() / int64(time.Millisecond)
-		selects = append(selects,
-			fmt.Sprintf("TimeCreated[timediff(@SystemTime) &lt;= %d]", ms))
-	}
-	if eventID != "" {
-		selects = append(selects, fmt.Sprintf("EventID=%s", eventID))
-	}
-
-	selectXML := ""
-	if len(selects) > 0 {
-		selectXML = fmt.Sprintf("[System[%s]]", joinStrings(selects, " and "))
-	}
-
-	return fmt.Sprintf(`<QueryList>
-  <Query Id="0">
-    <Select Path="%s">*%s</Select>
-  </Query>
-</QueryList>`, logName, selectXML), nil
+	return legacyQuery(logName, ignoreOlder, eventID).XML()
 }
 
-func joinStrings(elems []string, sep string) string {
-	if len(elems) == 0 {
-		return ""
-	}
-	n := len(sep) * (len(elems) - 1)
-	for _, e := range elems {
-		n += len(e)
-	}
-	b := make([]byte, n)
-	bp := copy(b, elems[0])
-	for _, s := range elems[1:] {
-		bp += copy(b[bp:], sep)
-		bp += copy(b[bp:], s)
+// legacyQuery 将NewReader的参数转换为结构化查询。eventID为十进制数字时转换为EventIDs过滤条件，
+// 其他内容作为原始XPath保留。
+//   logName - 通道名称或.evtx文件路径
+//   ignoreOlder - 只读取此时长内的事件，0表示不限制
+//   eventID - 事件ID或XPath表达式，为空时不过滤
+//   返回 - 只含一个Select路径的查询
+func legacyQuery(logName string, ignoreOlder time.Duration, eventID string) Query {
+	p := QueryPath{Path: logName, Within: ignoreOlder}
+	if eventID != "" {
+		if id, err := strconv.ParseUint(eventID, 10, 16); err == nil {
+			p.EventIDs = EventIDs(uint16(id))
+		} else {
+			p.SystemXPath = "EventID=" + eventID
+		}
 	}
-	return string(b)
+	return Query{Selects: []QueryPath{p}}
 }
 
 // Bookmark 表示事件日志书签句柄。
@@ -358,7 +481,4 @@ func EvtOpenLog(session EvtHandle, path string, flags EvtOpenLogFlag) (EvtHandle
 	return evtOpenLog(session, pathPtr, uint32(flags))
 }
 
-// Ensure unused import suppression.
-var _ = unsafe.Pointer(nil)
-
 
@@ -0,0 +1,145 @@
+package evtx
+
+// fieldMapping 将EventData/UserData中的一个字段映射为CEF与LEEF的扩展键。
+type fieldMapping struct {
+	// data EventData中的字段名称。
+	data string
+	// cef CEF扩展键，为空表示CEF中不输出。
+	cef string
+	// cefLabel 非空时cef为cs1/cn1等自定义键，同时输出 <cef>Label=<cefLabel>。
+	cefLabel string
+	// leef LEEF属性名称，为空表示LEEF中不输出。
+	leef string
+}
+
+var (
+	subjectFields = []fieldMapping{
+		{"SubjectUserSid", "suid", "", "accountSid"},
+		{"SubjectUserName", "suser", "", "accountName"},
+		{"SubjectDomainName", "sntdom", "", "accountDomain"},
+	}
+	targetFields = []fieldMapping{
+		{"TargetUserSid", "duid", "", "usrSid"},
+		{"TargetSid", "duid", "", "usrSid"},
+		{"TargetUserName", "duser", "", "usrName"},
+		{"TargetDomainName", "dntdom", "", "domain"},
+	}
+	logonFields = []fieldMapping{
+		{"LogonType", "cn1", "LogonType", "logonType"},
+		{"IpAddress", "src", "", "src"},
+		{"IpPort", "spt", "", "srcPort"},
+		{"WorkstationName", "shost", "", "identHostName"},
+		{"LogonProcessName", "cs1", "LogonProcessName", "logonProcess"},
+		{"AuthenticationPackageName", "cs2", "AuthenticationPackage", "authPackage"},
+		{"TargetLogonId", "cs3", "LogonID", "logonId"},
+		{"ProcessName", "sproc", "", "srcProcessName"},
+		{"ProcessId", "spid", "", "srcPid"},
+	}
+	failureFields = []fieldMapping{
+		{"Status", "cs4", "Status", "status"},
+		{"SubStatus", "cs5", "SubStatus", "subStatus"},
+		{"FailureReason", "reason", "", "failureReason"},
+	}
+	groupFields = []fieldMapping{
+		{"MemberSid", "duid", "", "usrSid"},
+		{"MemberName", "duser", "", "usrName"},
+		{"TargetUserName", "cs1", "Group", "groupName"},
+		{"TargetDomainName", "cs2", "GroupDomain", "groupDomain"},
+		{"TargetSid", "cs3", "GroupSid", "groupSid"},
+	}
+	kerberosFields = []fieldMapping{
+		{"TargetUserName", "duser", "", "usrName"},
+		{"TargetDomainName", "dntdom", "", "domain"},
+		{"IpAddress", "src", "", "src"},
+		{"IpPort", "spt", "", "srcPort"},
+		{"ServiceName", "cs1", "ServiceName", "service"},
+		{"TicketEncryptionType", "cs2", "TicketEncryptionType", "ticketEncryption"},
+		{"Status", "cs4", "Status", "status"},
+	}
+)
+
+// securityFieldMap 是常见Security通道事件ID到扩展键映射的对照表，
+// 未列出的事件只输出通用字段（CEF）或原始字段名（LEEF）。
+var securityFieldMap = map[uint32][]fieldMapping{
+	// 1102 审核日志已清除（UserData/LogFileCleared）。
+	1102: subjectFields,
+	// 4624 账户登录成功。
+	4624: concatFields(subjectFields, targetFields, logonFields),
+	// 4625 账户登录失败。
+	4625: concatFields(subjectFields, targetFields, logonFields, failureFields),
+	// 4634 账户注销。
+	4634: concatFields(targetFields, []fieldMapping{
+		{"LogonType", "cn1", "LogonType", "logonType"},
+		{"TargetLogonId", "cs3", "LogonID", "logonId"},
+	}),
+	// 4647 用户发起注销。
+	4647: concatFields(targetFields, []fieldMapping{
+		{"TargetLogonId", "cs3", "LogonID", "logonId"},
+	}),
+	// 4648 使用显式凭据登录。
+	4648: concatFields(subjectFields, []fieldMapping{
+		{"TargetUserName", "duser", "", "usrName"},
+		{"TargetDomainName", "dntdom", "", "domain"},
+		{"TargetServerName", "dhost", "", "dstHostName"},
+		{"IpAddress", "src", "", "src"},
+		{"IpPort", "spt", "", "srcPort"},
+		{"ProcessName", "sproc", "", "srcProcessName"},
+		{"ProcessId", "spid", "", "srcPid"},
+	}),
+	// 4672 为新登录分配特殊权限。
+	4672: concatFields(subjectFields, []fieldMapping{
+		{"PrivilegeList", "cs1", "Privileges", "privileges"},
+		{"SubjectLogonId", "cs3", "LogonID", "logonId"},
+	}),
+	// 4688 创建新进程。
+	4688: concatFields(subjectFields, []fieldMapping{
+		{"NewProcessName", "dproc", "", "processName"},
+		{"NewProcessId", "dpid", "", "pid"},
+		{"ParentProcessName", "sproc", "", "parentProcessName"},
+		{"ProcessId", "spid", "", "parentPid"},
+		{"CommandLine", "cs1", "CommandLine", "commandLine"},
+		{"TokenElevationType", "cs2", "TokenElevationType", "tokenElevationType"},
+		{"TargetUserName", "duser", "", "usrName"},
+		{"TargetDomainName", "dntdom", "", "domain"},
+	}),
+	// 4689 进程退出。
+	4689: concatFields(subjectFields, []fieldMapping{
+		{"ProcessName", "dproc", "", "processName"},
+		{"ProcessId", "dpid", "", "pid"},
+		{"Status", "cs4", "Status", "status"},
+	}),
+	// 4720/4722/4725/4726/4738 用户账户创建、启用、禁用、删除与修改。
+	4720: concatFields(subjectFields, targetFields),
+	4722: concatFields(subjectFields, targetFields),
+	4725: concatFields(subjectFields, targetFields),
+	4726: concatFields(subjectFields, targetFields),
+	4738: concatFields(subjectFields, targetFields),
+	// 4728/4732/4756 向全局、本地、通用安全组添加成员。
+	4728: concatFields(subjectFields, groupFields),
+	4732: concatFields(subjectFields, groupFields),
+	4756: concatFields(subjectFields, groupFields),
+	// 4740 账户被锁定，TargetDomainName为调用方计算机名。
+	4740: concatFields(subjectFields, []fieldMapping{
+		{"TargetSid", "duid", "", "usrSid"},
+		{"TargetUserName", "duser", "", "usrName"},
+		{"TargetDomainName", "shost", "", "identHostName"},
+	}),
+	// 4768/4769 Kerberos TGT与服务票据请求。
+	4768: kerberosFields,
+	4769: kerberosFields,
+	// 4776 NTLM凭据验证。
+	4776: {
+		{"TargetUserName", "duser", "", "usrName"},
+		{"Workstation", "shost", "", "identHostName"},
+		{"PackageName", "cs2", "AuthenticationPackage", "authPackage"},
+		{"Status", "cs4", "Status", "status"},
+	},
+}
+
+func concatFields(groups ...[]fieldMapping) []fieldMapping {
+	var out []fieldMapping
+	for _, g := range groups {
+		out = append(out, g...)
+	}
+	return out
+}
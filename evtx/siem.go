@@ -0,0 +1,424 @@
+package evtx
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SyslogOptions 控制RFC 5424 syslog输出。
+type SyslogOptions struct {
+	// Facility syslog设施编号，0时使用16（local0）。
+	Facility int
+	// Hostname 主机名，为空时使用事件的Computer。
+	Hostname string
+	// AppName 应用名称，为空时使用提供程序名称。
+	AppName string
+	// EnterpriseID 结构化数据SD-ID中的私有企业编号，为空时使用32473（RFC 5612示例编号）。
+	EnterpriseID string
+}
+
+// SIEMOptions 控制CEF与LEEF头部中的设备信息。
+type SIEMOptions struct {
+	// Vendor 设备厂商，为空时使用 "Microsoft"。
+	Vendor string
+	// Product 设备产品，为空时使用 "Microsoft Windows"。
+	Product string
+	// Version 设备版本，可为空。
+	Version string
+	// Delimiter LEEF属性分隔符，0时使用制表符。
+	Delimiter byte
+}
+
+// FormatSyslog 将记录格式化为一行RFC 5424 syslog消息，System字段写入win@<PEN>结构化数据，
+// EventData/UserData写入data@<PEN>，渲染后的消息压缩空白后作为MSG部分。
+//   r - 事件记录
+//   opts - syslog选项
+//   返回 - 不含换行符与传输层帧的syslog消息
+func FormatSyslog(r Record, opts SyslogOptions) string {
+	facility := opts.Facility
+	if facility == 0 {
+		facility = 16
+	}
+	pen := opts.EnterpriseID
+	if pen == "" {
+		pen = "32473"
+	}
+	hostname := opts.Hostname
+	if hostname == "" {
+		hostname = r.Computer
+	}
+	app := opts.AppName
+	if app == "" {
+		app = r.Provider.Name
+	}
+
+	var b strings.Builder
+	b.WriteString("<")
+	b.WriteString(strconv.Itoa(facility*8 + syslogSeverity(r.Event)))
+	b.WriteString(">1 ")
+	if r.TimeCreated.SystemTime.IsZero() {
+		b.WriteString("-")
+	} else {
+		b.WriteString(r.TimeCreated.SystemTime.UTC().Format("2006-01-02T15:04:05.000000Z07:00"))
+	}
+	for _, field := range []struct {
+		value string
+		max   int
+	}{
+		{hostname, 255},
+		{app, 48},
+		{pidString(r.Execution.ProcessID), 128},
+		{strconv.FormatUint(uint64(r.EventIdentifier.ID), 10), 32},
+	} {
+		b.WriteString(" ")
+		b.WriteString(syslogHeaderField(field.value, field.max))
+	}
+
+	b.WriteString(" [win@")
+	b.WriteString(pen)
+	writeSDParam(&b, "Channel", r.Channel)
+	writeSDParam(&b, "Provider", r.Provider.Name)
+	writeSDParam(&b, "EventID", strconv.FormatUint(uint64(r.EventIdentifier.ID), 10))
+	writeSDParam(&b, "RecordID", strconv.FormatUint(r.RecordID, 10))
+	writeSDParam(&b, "Level", strconv.Itoa(int(r.LevelRaw)))
+	writeSDParam(&b, "Task", strconv.Itoa(int(r.TaskRaw)))
+	writeSDParam(&b, "Keywords", "0x"+strconv.FormatUint(uint64(r.KeywordsRaw), 16))
+	if r.User.Identifier != "" {
+		writeSDParam(&b, "UserID", r.User.Identifier)
+	}
+	b.WriteString("]")
+	if pairs := recordPairs(r); len(pairs) > 0 {
+		b.WriteString("[data@")
+		b.WriteString(pen)
+		for i, kv := range pairs {
+			name := kv.Key
+			if name == "" {
+				name = "param" + strconv.Itoa(i+1)
+			}
+			writeSDParam(&b, name, kv.Value)
+		}
+		b.WriteString("]")
+	}
+	if msg := strings.Join(strings.Fields(r.Message), " "); msg != "" {
+		b.WriteString(" ")
+		b.WriteString(msg)
+	}
+	return b.String()
+}
+
+// FormatCEF 将记录格式化为ArcSight CEF:0行。Security通道的常见事件按对照表
+// 将EventData映射为suser、duser、src、cn1等扩展键，其他字段不输出。
+//   r - 事件记录
+//   opts - 设备信息
+//   返回 - CEF行
+func FormatCEF(r Record, opts SIEMOptions) string {
+	vendor, product := siemDevice(opts)
+	var b strings.Builder
+	b.WriteString("CEF:0")
+	for _, h := range []string{
+		vendor, product, opts.Version,
+		r.Provider.Name + ":" + strconv.FormatUint(uint64(r.EventIdentifier.ID), 10),
+		eventName(r.Event),
+		strconv.Itoa(siemSeverity(r.Event, 0)),
+	} {
+		b.WriteString("|")
+		b.WriteString(cefHeaderEscape(h))
+	}
+	b.WriteString("|")
+
+	ext := &extWriter{b: &b, sep: " ", escape: cefValueEscape}
+	if !r.TimeCreated.SystemTime.IsZero() {
+		ext.add("rt", strconv.FormatInt(r.TimeCreated.SystemTime.UnixNano()/int64(time.Millisecond), 10))
+	}
+	ext.add("dvchost", r.Computer)
+	if r.Execution.ProcessID != 0 {
+		ext.add("dvcpid", pidString(r.Execution.ProcessID))
+	}
+	ext.add("externalId", strconv.FormatUint(r.RecordID, 10))
+	ext.add("cat", r.Channel)
+	ext.add("outcome", keywordOutcome(uint64(r.KeywordsRaw)))
+	for _, m := range recordMappings(r) {
+		if m.cef == "" {
+			continue
+		}
+		if ext.add(m.cef, m.value) && m.cefLabel != "" {
+			ext.add(m.cef+"Label", m.cefLabel)
+		}
+	}
+	ext.add("msg", strings.TrimSpace(RemoveWindowsLineEndings(r.Message)))
+	return b.String()
+}
+
+// FormatLEEF 将记录格式化为QRadar LEEF:2.0行。Security通道的常见事件按对照表
+// 将EventData映射为usrName、src、logonType等属性，其余EventData按原字段名输出。
+//   r - 事件记录
+//   opts - 设备信息及属性分隔符
+//   返回 - LEEF行
+func FormatLEEF(r Record, opts SIEMOptions) string {
+	vendor, product := siemDevice(opts)
+	delim := opts.Delimiter
+	if delim == 0 {
+		delim = '\t'
+	}
+	var b strings.Builder
+	b.WriteString("LEEF:2.0")
+	for _, h := range []string{vendor, product, opts.Version, strconv.FormatUint(uint64(r.EventIdentifier.ID), 10)} {
+		b.WriteString("|")
+		b.WriteString(cefHeaderEscape(h))
+	}
+	b.WriteString("|")
+	if delim > ' ' && delim < 0x7f && delim != '|' {
+		b.WriteByte(delim)
+	} else {
+		b.WriteString("x")
+		b.WriteString(strings.ToUpper(strconv.FormatUint(uint64(delim)|0x100, 16)[1:]))
+	}
+	b.WriteString("|")
+
+	ext := &extWriter{b: &b, sep: string(delim), escape: func(s string) string { return leefValueEscape(s, delim) }}
+	if !r.TimeCreated.SystemTime.IsZero() {
+		ext.add("devTime", strconv.FormatInt(r.TimeCreated.SystemTime.UnixNano()/int64(time.Millisecond), 10))
+	}
+	ext.add("sev", strconv.Itoa(siemSeverity(r.Event, 1)))
+	ext.add("cat", r.Channel)
+	ext.add("computer", r.Computer)
+	ext.add("recordId", strconv.FormatUint(r.RecordID, 10))
+	ext.add("outcome", keywordOutcome(uint64(r.KeywordsRaw)))
+	mapped := map[string]bool{}
+	for _, m := range recordMappings(r) {
+		mapped[m.data] = true
+		if m.leef != "" {
+			ext.add(m.leef, m.value)
+		}
+	}
+	for _, kv := range recordPairs(r) {
+		if kv.Key != "" && !mapped[kv.Key] {
+			ext.add(kv.Key, kv.Value)
+		}
+	}
+	return b.String()
+}
+
+// extWriter 按顺序写入key=value扩展，跳过空值与"-"，同一个键只写一次。
+type extWriter struct {
+	b      *strings.Builder
+	sep    string
+	escape func(string) string
+	seen   map[string]bool
+	n      int
+}
+
+func (w *extWriter) add(key, value string) bool {
+	if value == "" || value == "-" || w.seen[key] {
+		return false
+	}
+	if w.seen == nil {
+		w.seen = map[string]bool{}
+	}
+	w.seen[key] = true
+	if w.n > 0 {
+		w.b.WriteString(w.sep)
+	}
+	w.n++
+	w.b.WriteString(key)
+	w.b.WriteString("=")
+	w.b.WriteString(w.escape(value))
+	return true
+}
+
+// mappedValue 是对照表中一个已取到值的字段。
+type mappedValue struct {
+	fieldMapping
+	value string
+}
+
+// recordMappings 按对照表顺序取出记录中存在的字段，进程号转为十进制，IPv4映射地址去掉::ffff:前缀。
+func recordMappings(r Record) []mappedValue {
+	if r.Channel != "Security" {
+		return nil
+	}
+	var out []mappedValue
+	for _, m := range securityFieldMap[r.EventIdentifier.ID] {
+		v, ok := pairValue(r, m.data)
+		if !ok {
+			continue
+		}
+		switch m.cef {
+		case "spid", "dpid":
+			if n, err := strconv.ParseUint(v, 0, 32); err == nil {
+				v = strconv.FormatUint(n, 10)
+			}
+		case "src":
+			v = strings.TrimPrefix(v, "::ffff:")
+		}
+		out = append(out, mappedValue{m, v})
+	}
+	return out
+}
+
+func recordPairs(r Record) []KeyValue {
+	if len(r.UserData.Pairs) == 0 {
+		return r.EventData.Pairs
+	}
+	out := make([]KeyValue, 0, len(r.EventData.Pairs)+len(r.UserData.Pairs))
+	out = append(out, r.EventData.Pairs...)
+	return append(out, r.UserData.Pairs...)
+}
+
+func pairValue(r Record, name string) (string, bool) {
+	for _, kv := range recordPairs(r) {
+		if kv.Key == name {
+			return kv.Value, true
+		}
+	}
+	return "", false
+}
+
+func siemDevice(opts SIEMOptions) (string, string) {
+	vendor, product := opts.Vendor, opts.Product
+	if vendor == "" {
+		vendor = "Microsoft"
+	}
+	if product == "" {
+		product = "Microsoft Windows"
+	}
+	return vendor, product
+}
+
+// eventName 返回消息的第一行，没有消息时依次使用任务名称和 "Event <ID>"。
+func eventName(e Event) string {
+	msg := strings.TrimSpace(RemoveWindowsLineEndings(e.Message))
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		msg = strings.TrimSpace(msg[:i])
+	}
+	switch {
+	case msg != "":
+		return msg
+	case e.Task != "":
+		return e.Task
+	}
+	return "Event " + strconv.FormatUint(uint64(e.EventIdentifier.ID), 10)
+}
+
+// siemSeverity 将事件级别映射为CEF/LEEF严重性，审核失败至少为5。
+//   floor - 严重性下限，CEF为0，LEEF为1
+func siemSeverity(e Event, floor int) int {
+	sev := 3
+	switch e.LevelRaw {
+	case 1:
+		sev = 10
+	case 2:
+		sev = 7
+	case 3:
+		sev = 5
+	case 5:
+		sev = 1
+	}
+	if keywordOutcome(uint64(e.KeywordsRaw)) == "failure" && sev < 5 {
+		sev = 5
+	}
+	if sev < floor {
+		sev = floor
+	}
+	return sev
+}
+
+// syslogSeverity 将事件级别映射为RFC 5424严重性，审核失败为notice(5)。
+func syslogSeverity(e Event) int {
+	switch e.LevelRaw {
+	case 1:
+		return 2
+	case 2:
+		return 3
+	case 3:
+		return 4
+	case 5:
+		return 7
+	}
+	if keywordOutcome(uint64(e.KeywordsRaw)) == "failure" {
+		return 5
+	}
+	return 6
+}
+
+func pidString(pid uint32) string {
+	if pid == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(pid), 10)
+}
+
+// syslogHeaderField 将头部字段限制为可打印ASCII并截断到max字节，为空时返回 "-"。
+func syslogHeaderField(s string, max int) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+	if len(b) > max {
+		b = b[:max]
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
+
+// writeSDParam 写入一个SD-PARAM，名称中的非法字符替换为_，值中的 " \ ] 以反斜杠转义、换行替换为空格。
+func writeSDParam(b *strings.Builder, name, value string) {
+	n := []byte(name)
+	for i, c := range n {
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			n[i] = '_'
+		}
+	}
+	if len(n) > 32 {
+		n = n[:32]
+	}
+	b.WriteString(" ")
+	b.Write(n)
+	b.WriteString(`="`)
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '"', '\\', ']':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\r', '\n':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteString(`"`)
+}
+
+// cefHeaderEscape 转义头部字段中的 \ 与 |，换行替换为空格。
+func cefHeaderEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r\n", " ", "\n", " ", "\r", " ").Replace(s)
+}
+
+// cefValueEscape 转义扩展值中的 \ 与 =，换行写为 \n、\r。
+func cefValueEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`).Replace(s)
+}
+
+// leefValueEscape 转义属性值中的 \ 与分隔符，换行写为 \n、\r。
+func leefValueEscape(s string, delim byte) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' || c == delim:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
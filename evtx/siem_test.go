@@ -0,0 +1,110 @@
+package evtx
+
+import (
+	"strings"
+	"testing"
+)
+
+// siemRecords 返回覆盖对照表、转义与无名字段的事件记录。
+func siemRecords(t *testing.T) []Record {
+	logon := filterRecord(t)
+	logon.Message = "An account was successfully logged on.\r\n\r\nSubject:\r\n\tSecurity ID:\tSYSTEM"
+	logon.EventData.Pairs = []KeyValue{
+		{"SubjectUserSid", "S-1-5-18"},
+		{"SubjectUserName", "DC01$"},
+		{"SubjectDomainName", "CORP"},
+		{"TargetUserName", `alice=admin|ops\x`},
+		{"TargetDomainName", "CORP"},
+		{"LogonType", "10"},
+		{"WorkstationName", "-"},
+		{"IpAddress", "::ffff:10.0.0.5"},
+		{"IpPort", "51234"},
+		{"Comment", "tab\there]\"quoted\""},
+	}
+
+	var proc Record
+	proc.Channel = "Security"
+	proc.Computer = "WS01.corp.example"
+	proc.Provider.Name = "Microsoft-Windows-Security-Auditing"
+	proc.EventIdentifier.ID = 4688
+	proc.RecordID = 42
+	proc.TimeCreated.SystemTime = testBase
+	proc.KeywordsRaw = 0x8020000000000000
+	proc.Task = "Process Creation"
+	proc.Execution.ProcessID = 4
+	proc.EventData.Pairs = []KeyValue{
+		{"SubjectUserName", "bob"},
+		{"NewProcessId", "0x1a4"},
+		{"NewProcessName", `C:\Windows\System32\cmd.exe`},
+		{"ProcessId", "0x3e8"},
+		{"CommandLine", "cmd.exe /c \"set A=1\"\nwhoami"},
+		{"ParentProcessName", `C:\Windows\explorer.exe`},
+	}
+
+	var app Record
+	app.Channel = "Application"
+	app.Provider.Name = "Application Error"
+	app.EventIdentifier.ID = 1000
+	app.EventIdentifier.Qualifiers = 0
+	app.LevelRaw = 2
+	app.RecordID = 9
+	app.EventData.Pairs = []KeyValue{{"", "app.exe"}, {"", "1.0.0.0"}}
+
+	var failure Record
+	failure.Channel = "Security"
+	failure.Computer = "DC01.corp.example"
+	failure.Provider.Name = "Microsoft-Windows-Security-Auditing"
+	failure.EventIdentifier.ID = 4625
+	failure.RecordID = 8
+	failure.TimeCreated.SystemTime = testBase
+	failure.KeywordsRaw = 0x8010000000000000
+	failure.EventData.Pairs = []KeyValue{
+		{"TargetUserName", "mallory"},
+		{"Status", "0xc000006d"},
+		{"SubStatus", "0xc000006a"},
+		{"LogonType", "3"},
+		{"IpAddress", "192.0.2.10"},
+	}
+	return []Record{logon, proc, app, failure}
+}
+
+func formatAll(records []Record, fn func(Record) string) []byte {
+	lines := make([]string, len(records))
+	for i, r := range records {
+		lines[i] = fn(r)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+func TestFormatSyslog(t *testing.T) {
+	got := formatAll(siemRecords(t), func(r Record) string { return FormatSyslog(r, SyslogOptions{}) })
+	checkGolden(t, "siem.syslog", got)
+}
+
+func TestFormatCEF(t *testing.T) {
+	got := formatAll(siemRecords(t), func(r Record) string { return FormatCEF(r, SIEMOptions{}) })
+	checkGolden(t, "siem.cef", got)
+}
+
+func TestFormatLEEF(t *testing.T) {
+	got := formatAll(siemRecords(t), func(r Record) string { return FormatLEEF(r, SIEMOptions{}) })
+	checkGolden(t, "siem.leef", got)
+
+	r := siemRecords(t)[3]
+	line := FormatLEEF(r, SIEMOptions{Vendor: "Acme", Product: "Agent", Version: "2.1", Delimiter: '^'})
+	want := "LEEF:2.0|Acme|Agent|2.1|4625|^|devTime=1705314600123^sev=5^cat=Security^computer=DC01.corp.example^" +
+		"recordId=8^outcome=failure^usrName=mallory^logonType=3^src=192.0.2.10^status=0xc000006d^subStatus=0xc000006a"
+	if line != want {
+		t.Errorf("FormatLEEF(^)\n got: %s\nwant: %s", line, want)
+	}
+}
+
+func TestSyslogOptions(t *testing.T) {
+	r := siemRecords(t)[2]
+	got := FormatSyslog(r, SyslogOptions{Facility: 4, Hostname: "host name", AppName: "wcorefx", EnterpriseID: "99999"})
+	want := `<35>1 - host_name wcorefx - 1000 [win@99999 Channel="Application" Provider="Application Error" ` +
+		`EventID="1000" RecordID="9" Level="2" Task="0" Keywords="0x0"][data@99999 param1="app.exe" param2="1.0.0.0"]`
+	if got != want {
+		t.Errorf("FormatSyslog\n got: %s\nwant: %s", got, want)
+	}
+}
@@ -0,0 +1,225 @@
+package evtx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrSourceReset 表示事件来源的连接已失效（如远程会话返回RPC_S_INVALID_BOUND），
+// Subscription收到后关闭来源并从已交付的进度重新打开。
+var ErrSourceReset = errors.New("evtx: event source must be reopened")
+
+const (
+	// defaultBatchSize 是SubscriptionOptions.BatchSize的默认值。
+	defaultBatchSize = 100
+	// maxSourceResets 是未读到任何记录时允许的连续重连次数。
+	maxSourceResets = 8
+)
+
+// EventSource 是Subscription读取事件的来源。Windows上由EventLogSource基于EvtSubscribe实现，
+// 测试中可以用内存实现替代。
+type EventSource interface {
+	// Channels 返回来源涉及的通道（或文件路径），用于从BookmarkStore恢复进度。
+	Channels() []string
+	// Open 打开来源：bookmark为空时按来源的默认位置开始，否则从各通道书签之后开始。
+	Open(bookmark BookmarkList) error
+	// Next 读取最多max条记录，暂无新记录时返回空切片和nil；连接失效时返回包装了ErrSourceReset的错误。
+	Next(max int) ([]Record, error)
+	// Wait 阻塞直到可能有新记录到达，ctx取消时返回ctx.Err()。
+	Wait(ctx context.Context) error
+	// Close 关闭来源，关闭后可以再次Open。
+	Close() error
+}
+
+// SubscriptionOptions 是Subscription的可选配置。
+type SubscriptionOptions struct {
+	// BatchSize 每次从来源读取的最大记录数，为0时使用100；连接失效重连后减半，最小为1。
+	BatchSize int
+	// Buffer Records返回的通道容量，为0时无缓冲：消费者取走记录前不会继续读取来源。
+	Buffer int
+	// Store 进度存储，每条记录交付后保存其所属通道的记录编号，启动时优先从中恢复进度。
+	Store BookmarkStore
+	// Bookmark 起始书签，Store中没有某通道的进度时使用。
+	Bookmark BookmarkList
+}
+
+// Subscription 以推送方式交付事件记录：通过回调（Run）或通道（Records）逐条交付，
+// 处理完一条才读取下一批，并在每条记录交付后记录进度。
+type Subscription struct {
+	src  EventSource
+	opts SubscriptionOptions
+
+	mu  sync.Mutex
+	pos BookmarkList
+	err error
+}
+
+// NewSubscription 创建基于指定事件来源的订阅。
+//   src - 事件来源，如NewEventLogSource的返回值
+//   opts - 订阅配置
+//   返回 - 新创建的Subscription指针
+func NewSubscription(src EventSource, opts SubscriptionOptions) *Subscription {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	return &Subscription{src: src, opts: opts, pos: opts.Bookmark.Merge(BookmarkList{})}
+}
+
+// Bookmark 返回已交付记录的进度书签。
+//   返回 - 书签对象，可通过XML()序列化保存
+func (s *Subscription) Bookmark() BookmarkList {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pos.Merge(BookmarkList{})
+}
+
+// Run 打开来源并将记录依次交给fn，直到ctx取消、fn返回错误或来源出错。
+// fn返回错误的记录不计入进度，重新订阅时会再次交付。
+//   ctx - 用于取消订阅的上下文
+//   fn - 记录处理函数，同一时刻只会被一个goroutine调用
+//   返回 - 结束原因：ctx取消时为ctx.Err()，否则为fn或来源返回的错误
+func (s *Subscription) Run(ctx context.Context, fn func(Record) error) error {
+	if err := s.restore(); err != nil {
+		return err
+	}
+	if err := s.src.Open(s.Bookmark()); err != nil {
+		return fmt.Errorf("open source: %w", err)
+	}
+	defer s.src.Close()
+
+	batch := s.opts.BatchSize
+	resets := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		records, err := s.src.Next(batch)
+		if errors.Is(err, ErrSourceReset) {
+			if resets++; resets > maxSourceResets {
+				return fmt.Errorf("reconnect: giving up after %d attempts: %w", maxSourceResets, err)
+			}
+			if err := s.reopen(); err != nil {
+				return err
+			}
+			if batch /= 2; batch < 1 {
+				batch = 1
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read source: %w", err)
+		}
+		if len(records) == 0 {
+			if err := s.src.Wait(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		resets = 0
+		for _, rec := range records {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			key := s.positionKey(rec)
+			s.mu.Lock()
+			last, seen := s.pos.RecordID(key)
+			s.mu.Unlock()
+			if seen && rec.RecordID <= last {
+				continue
+			}
+			if err := fn(rec); err != nil {
+				return err
+			}
+			if err := s.checkpoint(key, rec.RecordID); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Records 在后台运行订阅，通过返回的通道交付记录。通道关闭后可调用Err获取结束原因。
+// 记录被取走（有缓冲时为放入通道）即计入进度，需要处理完成后才计入进度时应使用Run。
+//   ctx - 用于取消订阅的上下文
+//   返回 - 记录通道
+func (s *Subscription) Records(ctx context.Context) <-chan Record {
+	ch := make(chan Record, s.opts.Buffer)
+	go func() {
+		err := s.Run(ctx, func(rec Record) error {
+			select {
+			case ch <- rec:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		close(ch)
+	}()
+	return ch
+}
+
+// Err 返回Records结束的原因，通道关闭前为nil。
+//   返回 - 结束原因，ctx取消时为context.Canceled或context.DeadlineExceeded
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// restore 从进度存储中读取各通道的进度，覆盖起始书签中的同名通道。
+func (s *Subscription) restore() error {
+	if s.opts.Store == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range s.src.Channels() {
+		id, ok, err := s.opts.Store.Load(ch)
+		if err != nil {
+			return fmt.Errorf("load bookmark %s: %w", ch, err)
+		}
+		if ok {
+			s.pos.Set(ch, id)
+		}
+	}
+	return nil
+}
+
+// reopen 关闭来源并从已交付的进度重新打开。
+func (s *Subscription) reopen() error {
+	if err := s.src.Close(); err != nil {
+		return fmt.Errorf("reconnect close: %w", err)
+	}
+	if err := s.src.Open(s.Bookmark()); err != nil {
+		return fmt.Errorf("reconnect open: %w", err)
+	}
+	return nil
+}
+
+// checkpoint 记录通道的最新进度，设置了进度存储时同时保存。
+func (s *Subscription) checkpoint(key string, recordID uint64) error {
+	s.mu.Lock()
+	s.pos.Set(key, recordID)
+	s.mu.Unlock()
+	if s.opts.Store != nil {
+		if err := s.opts.Store.Save(key, recordID); err != nil {
+			return fmt.Errorf("save bookmark %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// positionKey 返回记录进度使用的键：事件所属通道，缺失时为来源的第一个通道。
+func (s *Subscription) positionKey(rec Record) string {
+	if rec.Channel != "" {
+		return rec.Channel
+	}
+	if chs := s.src.Channels(); len(chs) > 0 {
+		return chs[0]
+	}
+	return ""
+}
@@ -0,0 +1,244 @@
+package evtx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSource 是内存中的EventSource，Open后从书签之后的记录开始返回。
+type fakeSource struct {
+	mu       sync.Mutex
+	channels []string
+	records  []Record
+	next     int
+	open     bool
+	opens    []BookmarkList
+	batches  []int
+	resets   map[int]bool // 第n次Next调用返回ErrSourceReset
+	notify   chan struct{}
+}
+
+func newFakeSource(channels ...string) *fakeSource {
+	return &fakeSource{channels: channels, resets: map[int]bool{}, notify: make(chan struct{}, 1)}
+}
+
+func (f *fakeSource) add(channel string, ids ...uint64) {
+	f.mu.Lock()
+	for _, id := range ids {
+		f.records = append(f.records, Record{Event: Event{RecordID: id, Channel: channel}, API: "fake"})
+	}
+	f.mu.Unlock()
+	select {
+	case f.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (f *fakeSource) Channels() []string { return f.channels }
+
+func (f *fakeSource) Open(bookmark BookmarkList) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.open {
+		return errors.New("already open")
+	}
+	f.open = true
+	f.opens = append(f.opens, bookmark)
+	f.next = 0
+	for f.next < len(f.records) {
+		r := f.records[f.next]
+		if id, ok := bookmark.RecordID(r.Channel); !ok || r.RecordID > id {
+			break
+		}
+		f.next++
+	}
+	return nil
+}
+
+func (f *fakeSource) Next(max int) ([]Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.open {
+		return nil, errors.New("not open")
+	}
+	f.batches = append(f.batches, max)
+	if f.resets[len(f.batches)] {
+		return nil, fmt.Errorf("%w: rpc bound", ErrSourceReset)
+	}
+	end := f.next + max
+	if end > len(f.records) {
+		end = len(f.records)
+	}
+	out := append([]Record(nil), f.records[f.next:end]...)
+	f.next = end
+	return out, nil
+}
+
+func (f *fakeSource) Wait(ctx context.Context) error {
+	select {
+	case <-f.notify:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *fakeSource) Close() error {
+	f.mu.Lock()
+	f.open = false
+	f.mu.Unlock()
+	return nil
+}
+
+func TestSubscriptionRun(t *testing.T) {
+	src := newFakeSource("Security", "System")
+	src.add("Security", 1, 2, 3)
+	store, err := NewFileBookmarkStore(filepath.Join(t.TempDir(), "bm.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := NewSubscription(src, SubscriptionOptions{BatchSize: 2, Store: store})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []uint64
+	err = sub.Run(ctx, func(r Record) error {
+		got = append(got, r.RecordID)
+		switch len(got) {
+		case 3:
+			// 来源读完后Run应阻塞在Wait上，直到新事件到达。
+			go src.add("System", 10, 11)
+		case 5:
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run = %v, want context.Canceled", err)
+	}
+	if !reflect.DeepEqual(got, []uint64{1, 2, 3, 10, 11}) {
+		t.Errorf("records = %v", got)
+	}
+	for ch, want := range map[string]uint64{"Security": 3, "System": 11} {
+		if id, ok, _ := store.Load(ch); !ok || id != want {
+			t.Errorf("store %s = %d, %v; want %d", ch, id, ok, want)
+		}
+	}
+	if src.open {
+		t.Error("source left open")
+	}
+
+	// 重新订阅时从进度存储恢复。
+	src.add("Security", 4)
+	sub = NewSubscription(src, SubscriptionOptions{Store: store})
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	got = nil
+	sub.Run(ctx, func(r Record) error {
+		got = append(got, r.RecordID)
+		cancel()
+		return nil
+	})
+	if !reflect.DeepEqual(got, []uint64{4}) {
+		t.Errorf("resumed records = %v", got)
+	}
+	want := BookmarkList{Bookmarks: []BookmarkEntry{{Channel: "Security", RecordID: 3}, {Channel: "System", RecordID: 11, IsCurrent: true}}}
+	if opened := src.opens[len(src.opens)-1]; !reflect.DeepEqual(opened, want) {
+		t.Errorf("Open bookmark = %+v", opened)
+	}
+}
+
+func TestSubscriptionReconnect(t *testing.T) {
+	src := newFakeSource("Security")
+	src.add("Security", 1, 2, 3, 4, 5, 6)
+	src.resets[2] = true
+	src.resets[3] = true
+	sub := NewSubscription(src, SubscriptionOptions{BatchSize: 4})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []uint64
+	err := sub.Run(ctx, func(r Record) error {
+		if got = append(got, r.RecordID); len(got) == 6 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || !reflect.DeepEqual(got, []uint64{1, 2, 3, 4, 5, 6}) {
+		t.Fatalf("Run = %v, records %v", err, got)
+	}
+	if !reflect.DeepEqual(src.batches, []int{4, 4, 2, 1, 1}) {
+		t.Errorf("batches = %v", src.batches)
+	}
+	if len(src.opens) != 3 {
+		t.Fatalf("opens = %d, want 3", len(src.opens))
+	}
+	if id, _ := src.opens[1].RecordID("Security"); id != 4 {
+		t.Errorf("reopen bookmark = %d, want 4", id)
+	}
+
+	src = newFakeSource("Security")
+	for i := 1; i <= maxSourceResets+1; i++ {
+		src.resets[i] = true
+	}
+	err = NewSubscription(src, SubscriptionOptions{}).Run(context.Background(), func(Record) error { return nil })
+	if !errors.Is(err, ErrSourceReset) {
+		t.Errorf("Run after repeated resets = %v", err)
+	}
+}
+
+func TestSubscriptionHandlerError(t *testing.T) {
+	src := newFakeSource("Security")
+	src.add("Security", 1, 2, 3)
+	sub := NewSubscription(src, SubscriptionOptions{Bookmark: BookmarkList{Bookmarks: []BookmarkEntry{{Channel: "Security", RecordID: 1}}}})
+	errStop := errors.New("stop")
+	err := sub.Run(context.Background(), func(r Record) error {
+		if r.RecordID == 3 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("Run = %v", err)
+	}
+	if id, _ := sub.Bookmark().RecordID("Security"); id != 2 {
+		t.Errorf("Bookmark = %d, want 2 (failed record not checkpointed)", id)
+	}
+}
+
+func TestSubscriptionRecords(t *testing.T) {
+	src := newFakeSource("Security")
+	src.add("Security", 1, 2, 3, 4, 5)
+	sub := NewSubscription(src, SubscriptionOptions{BatchSize: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := sub.Records(ctx)
+
+	if r := <-ch; r.RecordID != 1 {
+		t.Fatalf("first record = %d", r.RecordID)
+	}
+	// 无缓冲通道：消费者未取走记录时，订阅最多再读取一批。
+	time.Sleep(20 * time.Millisecond)
+	src.mu.Lock()
+	reads := len(src.batches)
+	src.mu.Unlock()
+	if reads > 2 {
+		t.Errorf("source read %d batches ahead of consumer", reads)
+	}
+
+	if r := <-ch; r.RecordID != 2 {
+		t.Fatalf("second record = %d", r.RecordID)
+	}
+	cancel()
+	for range ch {
+	}
+	if !errors.Is(sub.Err(), context.Canceled) {
+		t.Errorf("Err = %v", sub.Err())
+	}
+}
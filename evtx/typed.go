@@ -0,0 +1,186 @@
+package evtx
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValueKind 是EventData/UserData字段值的类型。
+type ValueKind int
+
+const (
+	// KindString 保持原始字符串。
+	KindString ValueKind = iota
+	// KindInt 十进制整数，解码为int64，超出范围的无符号数解码为uint64。
+	KindInt
+	// KindHex 十六进制整数（如HexInt32、HexInt64、指针），解码为uint64。
+	KindHex
+	// KindFloat 浮点数，解码为float64。
+	KindFloat
+	// KindBool 布尔值，解码为bool。
+	KindBool
+	// KindGUID GUID，解码为 {XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX} 格式的大写字符串。
+	KindGUID
+	// KindSID 安全标识符，解码为 S-1-... 字符串。
+	KindSID
+	// KindTime 时间，接受ISO 8601、FILETIME整数或SYSTEMTIME十六进制，解码为UTC的time.Time。
+	KindTime
+)
+
+var kindNames = []string{"string", "int", "hex", "float", "bool", "guid", "sid", "time"}
+
+// String 返回类型名称。
+func (k ValueKind) String() string {
+	if k >= 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "ValueKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// TypeHints 按字段名称指定EventData/UserData值的类型，未列出的字段保持字符串。
+type TypeHints map[string]ValueKind
+
+// KindFromInType 将清单模板中的inType/outType名称映射为ValueKind。
+//   t - 类型名称，如 "win:HexInt32"、"win:FILETIME"、"xs:dateTime"，前缀可省略
+//   返回 - 对应的类型，未知类型返回KindString
+func KindFromInType(t string) ValueKind {
+	if i := strings.IndexByte(t, ':'); i >= 0 {
+		t = t[i+1:]
+	}
+	switch strings.ToLower(t) {
+	case "int8", "uint8", "int16", "uint16", "int32", "uint32", "int64", "uint64",
+		"byte", "unsignedbyte", "short", "unsignedshort", "int", "unsignedint", "long", "unsignedlong", "integer":
+		return KindInt
+	case "hexint8", "hexint16", "hexint32", "hexint64", "pointer", "sizet", "win32error", "ntstatus", "hresult":
+		return KindHex
+	case "float", "double":
+		return KindFloat
+	case "boolean":
+		return KindBool
+	case "guid":
+		return KindGUID
+	case "sid":
+		return KindSID
+	case "filetime", "systemtime", "datetime":
+		return KindTime
+	}
+	return KindString
+}
+
+// TypedValue 是带类型的字段值。
+type TypedValue struct {
+	// Key 字段名称。
+	Key string
+	// Raw 原始字符串。
+	Raw string
+	// Kind 解码后的类型，原始值无法按指定类型解析时为KindString。
+	Kind ValueKind
+	// Value 解码后的值：string、int64、uint64、float64、bool或time.Time。
+	Value interface{}
+}
+
+// TypedData 按类型提示解码EventData字段，UserData字段附加在其后。
+//   hints - 字段类型提示，可为nil（全部保持字符串）
+//   返回 - 与原字段一一对应的带类型值
+func (e *Event) TypedData(hints TypeHints) []TypedValue {
+	out := make([]TypedValue, 0, len(e.EventData.Pairs)+len(e.UserData.Pairs))
+	for _, pairs := range [][]KeyValue{e.EventData.Pairs, e.UserData.Pairs} {
+		for _, kv := range pairs {
+			out = append(out, typedValue(kv, hints))
+		}
+	}
+	return out
+}
+
+func typedValue(kv KeyValue, hints TypeHints) TypedValue {
+	tv := TypedValue{Key: kv.Key, Raw: kv.Value, Kind: KindString, Value: kv.Value}
+	kind, ok := hints[kv.Key]
+	if !ok || kind == KindString {
+		return tv
+	}
+	if v, err := ParseValue(kind, kv.Value); err == nil {
+		tv.Kind, tv.Value = kind, v
+	}
+	return tv
+}
+
+var guidPattern = regexp.MustCompile(`^\{?([0-9a-fA-F]{8})-([0-9a-fA-F]{4})-([0-9a-fA-F]{4})-([0-9a-fA-F]{4})-([0-9a-fA-F]{12})\}?$`)
+
+// ParseValue 按指定类型解析事件字段的字符串值。
+//   kind - 目标类型
+//   s - 原始字符串
+//   返回1 - 解码后的值，类型见TypedValue.Value
+//   返回2 - 字符串不符合该类型时的错误，成功时为nil
+func ParseValue(kind ValueKind, s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	switch kind {
+	case KindString:
+		return s, nil
+	case KindInt:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+		if n, err := strconv.ParseUint(s, 0, 64); err == nil {
+			if n <= math.MaxInt64 {
+				return int64(n), nil
+			}
+			return n, nil
+		}
+	case KindHex:
+		h := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+		if n, err := strconv.ParseUint(h, 16, 64); err == nil && h != "" {
+			return n, nil
+		}
+	case KindFloat:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+	case KindBool:
+		switch strings.ToLower(s) {
+		case "true", "1":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+	case KindGUID:
+		if m := guidPattern.FindStringSubmatch(s); m != nil {
+			return strings.ToUpper("{" + strings.Join(m[1:], "-") + "}"), nil
+		}
+	case KindSID:
+		if strings.HasPrefix(s, "S-") && len(strings.Split(s, "-")) >= 3 {
+			return s, nil
+		}
+	case KindTime:
+		if t, err := parseEventTime(s); err == nil {
+			return t, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown value kind %d", kind)
+	}
+	return nil, fmt.Errorf("invalid %s value %q", kind, s)
+}
+
+// parseEventTime 解析ISO 8601时间、十进制或0x十六进制FILETIME、32位十六进制的SYSTEMTIME结构。
+func parseEventTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.UTC(), nil
+	}
+	if len(s) == 32 && !strings.HasPrefix(s, "0x") {
+		if b, err := hex.DecodeString(s); err == nil {
+			return parseSystemTime(b)
+		}
+	}
+	base, digits := 10, s
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		base, digits = 16, s[2:]
+	}
+	if ft, err := strconv.ParseUint(digits, base, 64); err == nil {
+		return filetimeToTime(ft), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
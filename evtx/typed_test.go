@@ -0,0 +1,156 @@
+package evtx
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalRawTime(t *testing.T) {
+	tests := []struct {
+		attr string
+		want time.Time
+	}{
+		{`RawTime="133497882001234567"`, time.Date(2024, 1, 15, 10, 30, 0, 123456700, time.UTC)},
+		{`RawTime="0x1DA479DCAF35A87"`, time.Date(2024, 1, 15, 10, 30, 0, 123456700, time.UTC)},
+		{`SystemTime="2024-01-15T10:30:00.1234567Z" RawTime="1"`, time.Date(2024, 1, 15, 10, 30, 0, 123456700, time.UTC)},
+		{`RawTime="2650467743999999999"`, time.Date(9999, 12, 31, 23, 59, 59, 999999900, time.UTC)},
+	}
+	for _, tt := range tests {
+		e, err := UnmarshalXML([]byte(`<Event><System><EventID>1</EventID><TimeCreated ` + tt.attr + `/></System></Event>`))
+		if err != nil {
+			t.Errorf("%s: %v", tt.attr, err)
+			continue
+		}
+		if !e.TimeCreated.SystemTime.Equal(tt.want) {
+			t.Errorf("%s: SystemTime = %v, want %v", tt.attr, e.TimeCreated.SystemTime, tt.want)
+		}
+	}
+	if _, err := UnmarshalXML([]byte(`<Event><System><TimeCreated RawTime="soon"/></System></Event>`)); err == nil {
+		t.Error("invalid RawTime accepted")
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	ts := time.Date(2024, 1, 15, 10, 30, 0, 123000000, time.UTC)
+	tests := []struct {
+		kind ValueKind
+		in   string
+		want interface{}
+	}{
+		{KindInt, "-12", int64(-12)},
+		{KindInt, "18446744073709551615", uint64(18446744073709551615)},
+		{KindHex, "0x1a4", uint64(420)},
+		{KindHex, "C000006D", uint64(0xC000006D)},
+		{KindFloat, "1.5", 1.5},
+		{KindBool, "true", true},
+		{KindBool, "0", false},
+		{KindGUID, "54544f85-5a96-494b-a5ba-3e3b0328c30d", "{54544F85-5A96-494B-A5BA-3E3B0328C30D}"},
+		{KindSID, "S-1-5-21-1-2-3-500", "S-1-5-21-1-2-3-500"},
+		{KindTime, "2024-01-15T10:30:00.1230000Z", ts},
+		{KindTime, "133497882001230000", ts},
+		{KindTime, "0x1DA479DCAF348B0", ts},
+		{KindTime, "E807010001000F000A001E0000007B00", ts},
+	}
+	for _, tt := range tests {
+		got, err := ParseValue(tt.kind, tt.in)
+		if err != nil {
+			t.Errorf("ParseValue(%s, %q): %v", tt.kind, tt.in, err)
+			continue
+		}
+		if gt, ok := got.(time.Time); ok {
+			if !gt.Equal(tt.want.(time.Time)) {
+				t.Errorf("ParseValue(%s, %q) = %v, want %v", tt.kind, tt.in, gt, tt.want)
+			}
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseValue(%s, %q) = %#v, want %#v", tt.kind, tt.in, got, tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		kind ValueKind
+		in   string
+	}{
+		{KindInt, "ten"}, {KindHex, "0x"}, {KindBool, "yes"}, {KindGUID, "{1234}"},
+		{KindSID, "-"}, {KindTime, "yesterday"}, {KindTime, "E8070D0001000F000A001E0000007B00"},
+	} {
+		if v, err := ParseValue(tt.kind, tt.in); err == nil {
+			t.Errorf("ParseValue(%s, %q) = %v, want error", tt.kind, tt.in, v)
+		}
+	}
+}
+
+func TestTypedData(t *testing.T) {
+	var e Event
+	e.EventData.Pairs = []KeyValue{
+		{"NewProcessId", "0x1a4"},
+		{"LogonType", "10"},
+		{"Elevated", "-"},
+		{"Name", "cmd.exe"},
+	}
+	e.UserData.Pairs = []KeyValue{{"When", "133497882001230000"}}
+	hints := TypeHints{
+		"NewProcessId": KindFromInType("win:Pointer"),
+		"LogonType":    KindFromInType("win:UInt32"),
+		"Elevated":     KindFromInType("win:Boolean"),
+		"When":         KindFromInType("win:FILETIME"),
+	}
+	got := e.TypedData(hints)
+	if len(got) != 5 {
+		t.Fatalf("TypedData = %d values", len(got))
+	}
+	want := []struct {
+		kind  ValueKind
+		value interface{}
+	}{
+		{KindHex, uint64(420)},
+		{KindInt, int64(10)},
+		{KindString, "-"},
+		{KindString, "cmd.exe"},
+	}
+	for i, w := range want {
+		if got[i].Kind != w.kind || got[i].Value != w.value {
+			t.Errorf("TypedData[%d] = %s %#v, want %s %#v", i, got[i].Kind, got[i].Value, w.kind, w.value)
+		}
+	}
+	if got[4].Kind != KindTime || got[4].Raw != "133497882001230000" {
+		t.Errorf("TypedData[4] = %+v", got[4])
+	}
+
+	data, err := EncodeJSON(Record{Event: e}, EncodeOptions{Hints: hints})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		EventData map[string]interface{} `json:"event_data"`
+		UserData  map[string]interface{} `json:"user_data"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.EventData["NewProcessId"] != 420.0 || doc.EventData["LogonType"] != 10.0 || doc.EventData["Elevated"] != "-" {
+		t.Errorf("event_data = %v", doc.EventData)
+	}
+	if doc.UserData["When"] != "2024-01-15T10:30:00.123Z" {
+		t.Errorf("user_data = %v", doc.UserData)
+	}
+}
+
+func TestKindFromInType(t *testing.T) {
+	for in, want := range map[string]ValueKind{
+		"win:UnicodeString": KindString,
+		"win:HexInt64":      KindHex,
+		"xs:unsignedInt":    KindInt,
+		"win:SYSTEMTIME":    KindTime,
+		"xs:dateTime":       KindTime,
+		"win:GUID":          KindGUID,
+		"win:SID":           KindSID,
+		"Boolean":           KindBool,
+		"win:Double":        KindFloat,
+	} {
+		if got := KindFromInType(in); got != want {
+			t.Errorf("KindFromInType(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package evtx
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// wevtNoMessage 表示WEVT_TEMPLATE中没有关联消息。
+const wevtNoMessage = 0xFFFFFFFF
+
+// ParseWEVTTemplate 解析提供程序二进制中WEVT_TEMPLATE资源的内容（CRIM块）。
+// 其中只有符号名称与消息ID：Name为空，ManifestEvent.Message为空，本地化文本需通过消息表按MessageID解析。
+//   data - WEVT_TEMPLATE资源数据
+//   返回1 - 资源中的全部提供程序
+//   返回2 - 签名不符或数据被截断时的错误，成功时为nil
+func ParseWEVTTemplate(data []byte) ([]*Manifest, error) {
+	r := wevtReader(data)
+	if err := r.sig(0, "CRIM"); err != nil {
+		return nil, err
+	}
+	n, err := r.u32(12)
+	if err != nil {
+		return nil, err
+	}
+	var out []*Manifest
+	for i := uint32(0); i < n; i++ {
+		entry := 16 + i*20
+		guid, err := r.bytes(entry, 16)
+		if err != nil {
+			return nil, fmt.Errorf("provider %d: %w", i, err)
+		}
+		off, err := r.u32(entry + 16)
+		if err != nil {
+			return nil, fmt.Errorf("provider %d: %w", i, err)
+		}
+		m, err := r.provider(off)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: %w", formatGUID(guid), err)
+		}
+		m.GUID = formatGUID(guid)
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// LoadWEVTTemplate 读取PE文件（.dll/.exe/.sys）中的WEVT_TEMPLATE资源并解析。
+//   path - 提供程序二进制路径，通常是清单resourceFileName指向的文件
+//   返回1 - 资源中的全部提供程序
+//   返回2 - 文件不是PE、没有WEVT_TEMPLATE资源或解析失败时的错误，成功时为nil
+func LoadWEVTTemplate(path string) ([]*Manifest, error) {
+	f, err := pe.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	res, err := readResources(f, resourceID{name: "WEVT_TEMPLATE"})
+	if err != nil {
+		return nil, fmt.Errorf("%s: WEVT_TEMPLATE: %w", path, err)
+	}
+	ms, err := ParseWEVTTemplate(res[0].data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ms, nil
+}
+
+// wevtReader 按CRIM起点的偏移读取数据，所有越界都返回错误。
+type wevtReader []byte
+
+func (r wevtReader) bytes(off, n uint32) ([]byte, error) {
+	if uint64(off)+uint64(n) > uint64(len(r)) {
+		return nil, fmt.Errorf("offset 0x%x: %d bytes truncated", off, n)
+	}
+	return r[off : off+n], nil
+}
+
+// array 校验off处的n个size字节条目，数量来自文件，乘法在uint64中计算以免回绕。
+func (r wevtReader) array(off, n, size uint32) error {
+	if uint64(off)+uint64(n)*uint64(size) > uint64(len(r)) {
+		return fmt.Errorf("offset 0x%x: %d entries of %d bytes truncated", off, n, size)
+	}
+	return nil
+}
+
+func (r wevtReader) u32(off uint32) (uint32, error) {
+	b, err := r.bytes(off, 4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (r wevtReader) sig(off uint32, want string) error {
+	b, err := r.bytes(off, 4)
+	if err != nil {
+		return err
+	}
+	if string(b) != want {
+		return fmt.Errorf("offset 0x%x: signature %q, want %q", off, b, want)
+	}
+	return nil
+}
+
+// name 读取名称：u32长度（包含长度字段本身）后跟UTF-16字符串。
+func (r wevtReader) name(off uint32) (string, error) {
+	if off == 0 {
+		return "", nil
+	}
+	size, err := r.u32(off)
+	if err != nil {
+		return "", err
+	}
+	if size < 4 {
+		return "", fmt.Errorf("offset 0x%x: invalid name size %d", off, size)
+	}
+	b, err := r.bytes(off+4, size-4)
+	if err != nil {
+		return "", err
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	for len(u) > 0 && u[len(u)-1] == 0 {
+		u = u[:len(u)-1]
+	}
+	return string(utf16.Decode(u)), nil
+}
+
+// table 校验元素签名并返回条目数量与第一个条目的偏移。
+func (r wevtReader) table(off uint32, sig string, header, entry uint32) (uint32, uint32, error) {
+	if err := r.sig(off, sig); err != nil {
+		return 0, 0, err
+	}
+	n, err := r.u32(off + 8)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := r.array(off+header, n, entry); err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", sig, err)
+	}
+	return n, off + header, nil
+}
+
+func (r wevtReader) provider(off uint32) (*Manifest, error) {
+	if err := r.sig(off, "WEVT"); err != nil {
+		return nil, err
+	}
+	n, err := r.u32(off + 12)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{
+		Meta: WinMeta{
+			Keywords: map[int64]string{},
+			Opcodes:  map[uint8]string{},
+			Levels:   map[uint8]string{},
+			Tasks:    map[uint16]string{},
+		},
+		Channels: map[uint8]string{},
+	}
+	if id, err := r.u32(off + 8); err == nil && id != wevtNoMessage {
+		m.msgIDs = append(m.msgIDs, metaMessage{kind: 'p', id: id})
+	}
+	for i := uint32(0); i < n; i++ {
+		elem, err := r.u32(off + 20 + i*8)
+		if err != nil {
+			return nil, err
+		}
+		sig, err := r.bytes(elem, 4)
+		if err != nil {
+			return nil, err
+		}
+		switch string(sig) {
+		case "CHAN":
+			err = r.channels(elem, m)
+		case "LEVL":
+			err = r.levels(elem, m)
+		case "OPCO":
+			err = r.opcodes(elem, m)
+		case "TASK":
+			err = r.tasks(elem, m)
+		case "KEYW":
+			err = r.keywords(elem, m)
+		case "EVNT":
+			err = r.events(elem, m)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", sig, err)
+		}
+	}
+	m.sortEvents()
+	return m, nil
+}
+
+func (r wevtReader) channels(off uint32, m *Manifest) error {
+	n, p, err := r.table(off, "CHAN", 12, 16)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		e := p + i*16
+		name, err := r.name(binary.LittleEndian.Uint32(r[e+4:]))
+		if err != nil {
+			return err
+		}
+		m.Channels[uint8(binary.LittleEndian.Uint32(r[e:]))] = name
+	}
+	return nil
+}
+
+func (r wevtReader) levels(off uint32, m *Manifest) error {
+	n, p, err := r.table(off, "LEVL", 12, 12)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		e := p + i*12
+		v := binary.LittleEndian.Uint32(r[e:])
+		if v < 16 || v > 0xFF {
+			continue
+		}
+		name, err := r.name(binary.LittleEndian.Uint32(r[e+8:]))
+		if err != nil {
+			return err
+		}
+		m.Meta.Levels[uint8(v)] = name
+		m.addMessage('l', uint64(v), binary.LittleEndian.Uint32(r[e+4:]))
+	}
+	return nil
+}
+
+// opcodes 解析OPCO；任务内定义的操作码标识为 操作码<<16|任务。
+func (r wevtReader) opcodes(off uint32, m *Manifest) error {
+	n, p, err := r.table(off, "OPCO", 12, 12)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		e := p + i*12
+		v := binary.LittleEndian.Uint32(r[e:])
+		if v > 0xFFFF {
+			v >>= 16
+		}
+		if v < 11 || v == 240 || v > 0xFF {
+			continue
+		}
+		if _, ok := m.Meta.Opcodes[uint8(v)]; ok {
+			continue
+		}
+		name, err := r.name(binary.LittleEndian.Uint32(r[e+8:]))
+		if err != nil {
+			return err
+		}
+		m.Meta.Opcodes[uint8(v)] = name
+		m.addMessage('o', uint64(v), binary.LittleEndian.Uint32(r[e+4:]))
+	}
+	return nil
+}
+
+func (r wevtReader) tasks(off uint32, m *Manifest) error {
+	n, p, err := r.table(off, "TASK", 12, 28)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		e := p + i*28
+		v := binary.LittleEndian.Uint32(r[e:])
+		if v == 0 || v > 0xFFFF {
+			continue
+		}
+		name, err := r.name(binary.LittleEndian.Uint32(r[e+24:]))
+		if err != nil {
+			return err
+		}
+		m.Meta.Tasks[uint16(v)] = name
+		m.addMessage('t', uint64(v), binary.LittleEndian.Uint32(r[e+4:]))
+	}
+	return nil
+}
+
+func (r wevtReader) keywords(off uint32, m *Manifest) error {
+	n, p, err := r.table(off, "KEYW", 12, 16)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		e := p + i*16
+		mask := binary.LittleEndian.Uint64(r[e:])
+		if mask == 0 || mask&0xFFFF000000000000 != 0 {
+			continue
+		}
+		name, err := r.name(binary.LittleEndian.Uint32(r[e+12:]))
+		if err != nil {
+			return err
+		}
+		m.Meta.Keywords[int64(mask)] = name
+		m.addMessage('k', mask, binary.LittleEndian.Uint32(r[e+8:]))
+	}
+	return nil
+}
+
+func (r wevtReader) events(off uint32, m *Manifest) error {
+	n, p, err := r.table(off, "EVNT", 16, 48)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		e := r[p+i*48 : p+i*48+48]
+		ev := ManifestEvent{
+			ID:        uint32(binary.LittleEndian.Uint16(e[0:])),
+			Version:   e[2],
+			Channel:   m.Channels[e[3]],
+			Level:     e[4],
+			Opcode:    e[5],
+			Task:      binary.LittleEndian.Uint16(e[6:]),
+			Keywords:  binary.LittleEndian.Uint64(e[8:]),
+			MessageID: binary.LittleEndian.Uint32(e[16:]),
+		}
+		if tmpl := binary.LittleEndian.Uint32(e[20:]); tmpl != 0 {
+			if ev.Fields, err = r.template(tmpl); err != nil {
+				return fmt.Errorf("event %d template: %w", ev.ID, err)
+			}
+		}
+		m.Events = append(m.Events, ev)
+	}
+	return nil
+}
+
+// template 解析TEMP：40字节头部与BinXML之后是20字节的字段描述。
+func (r wevtReader) template(off uint32) ([]TemplateField, error) {
+	if err := r.sig(off, "TEMP"); err != nil {
+		return nil, err
+	}
+	head, err := r.bytes(off, 40)
+	if err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(head[8:])
+	items := binary.LittleEndian.Uint32(head[16:])
+	if n == 0 {
+		return nil, nil
+	}
+	if err := r.array(items, n, 20); err != nil {
+		return nil, errors.New("template items truncated")
+	}
+	fields := make([]TemplateField, n)
+	for i := range fields {
+		d := r[items+uint32(i)*20:]
+		name, err := r.name(binary.LittleEndian.Uint32(d[16:]))
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = TemplateField{Name: name, InType: inTypeNames[d[4]], OutType: outTypeNames[d[5]]}
+	}
+	return fields, nil
+}
+
+// addMessage 记录名称关联的消息ID。
+func (m *Manifest) addMessage(kind byte, value uint64, id uint32) {
+	if id != wevtNoMessage {
+		m.msgIDs = append(m.msgIDs, metaMessage{kind: kind, value: value, id: id})
+	}
+}
+
+// outTypeNames 将模板字段的输出类型编号映射为清单类型名称。
+var outTypeNames = map[byte]string{
+	1: "xs:string", 2: "xs:dateTime", 3: "xs:byte", 4: "xs:unsignedByte", 5: "xs:short", 6: "xs:unsignedShort",
+	7: "xs:int", 8: "xs:unsignedInt", 9: "xs:long", 10: "xs:unsignedLong", 11: "xs:float", 12: "xs:double",
+	13: "xs:boolean", 14: "xs:GUID", 15: "xs:hexBinary", 16: "win:HexInt8", 17: "win:HexInt16",
+	18: "win:HexInt32", 19: "win:HexInt64", 20: "win:PID", 21: "win:TID", 22: "win:Port", 23: "win:IPv4",
+	24: "win:IPv6", 25: "win:SocketAddress", 26: "win:CIMDateTime", 27: "win:ETWTIME", 28: "win:Xml",
+	29: "win:ErrorCode", 30: "win:Win32Error", 31: "win:NTSTATUS", 32: "win:HResult", 33: "win:DateTimeCultureInsensitive",
+	34: "win:Json", 35: "win:Utf8", 36: "win:Pkcs7WithTypeInfo", 37: "win:CodePointer", 38: "win:DateTimeUtc",
+}
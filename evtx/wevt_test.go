@@ -0,0 +1,269 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// crimBuilder 按小端序拼装WEVT_TEMPLATE数据，偏移相对CRIM起点。
+type crimBuilder struct{ buf []byte }
+
+func (b *crimBuilder) pos() uint32  { return uint32(len(b.buf)) }
+func (b *crimBuilder) str(s string) { b.buf = append(b.buf, s...) }
+func (b *crimBuilder) u8(v uint8)   { b.buf = append(b.buf, v) }
+func (b *crimBuilder) u16(v uint16) { b.buf = binary.LittleEndian.AppendUint16(b.buf, v) }
+func (b *crimBuilder) u32(v uint32) { b.buf = binary.LittleEndian.AppendUint32(b.buf, v) }
+func (b *crimBuilder) u64(v uint64) { b.buf = binary.LittleEndian.AppendUint64(b.buf, v) }
+
+func (b *crimBuilder) put32(at, v uint32) { binary.LittleEndian.PutUint32(b.buf[at:], v) }
+
+// name 写入带长度前缀、以NUL结尾的UTF-16名称并返回其偏移。
+func (b *crimBuilder) name(s string) uint32 {
+	off := b.pos()
+	u := append(utf16.Encode([]rune(s)), 0)
+	b.u32(4 + uint32(len(u))*2)
+	for _, v := range u {
+		b.u16(v)
+	}
+	return off
+}
+
+// table 写入元素头部（签名、大小、数量）并返回元素起点，大小由end回填。
+func (b *crimBuilder) table(sig string, n uint32) uint32 {
+	off := b.pos()
+	b.str(sig)
+	b.u32(0)
+	b.u32(n)
+	return off
+}
+
+func (b *crimBuilder) end(elem uint32) { b.put32(elem+4, b.pos()-elem) }
+
+// buildCRIM 构造包含一个提供程序的WEVT_TEMPLATE。
+func buildCRIM() []byte {
+	b := &crimBuilder{}
+	b.str("CRIM")
+	b.u32(0)
+	b.u16(3)
+	b.u16(1)
+	b.u32(1)
+	b.buf = append(b.buf, 0x4c, 0x0b, 0x3d, 0x6a, 0x2e, 0x1f, 0x5a, 0x4d, 0x9b, 0x8c, 0x7e, 0x6f, 0x5a, 0x4b, 0x3c, 0x2d)
+	provider := b.pos()
+	b.u32(0)
+
+	names := map[string]uint32{}
+	for _, s := range []string{"Contoso-Backup/Operational", "win:Informational", "Trace", "Verify", "Retry",
+		"Job", "Disk", "win:AuditSuccess", "JobName", "Bytes"} {
+		names[s] = b.name(s)
+	}
+
+	tmpl := b.pos()
+	b.str("TEMP")
+	b.u32(0)
+	b.u32(2)
+	b.u32(2)
+	b.u32(0)
+	b.u32(1)
+	b.buf = append(b.buf, make([]byte, 16)...)
+	b.buf = append(b.buf, 0x0f, 0x01, 0x01, 0x00, 0x00)
+	b.put32(tmpl+16, b.pos())
+	for _, f := range []struct {
+		name    string
+		in, out uint8
+	}{{"JobName", valueString, 1}, {"Bytes", valueUInt64, 0}} {
+		b.u32(0)
+		b.u8(f.in)
+		b.u8(f.out)
+		b.u16(0)
+		b.u32(0)
+		b.u16(1)
+		b.u16(0)
+		b.u32(names[f.name])
+	}
+	b.end(tmpl)
+
+	b.put32(provider, b.pos())
+	wevt := b.pos()
+	b.str("WEVT")
+	b.u32(0)
+	b.u32(0x90000001)
+	b.u32(6)
+	b.u32(0)
+	desc := b.pos()
+	b.buf = append(b.buf, make([]byte, 6*8)...)
+	elem := func(i int) { b.put32(desc+uint32(i)*8, b.pos()) }
+
+	elem(0)
+	e := b.table("CHAN", 1)
+	b.u32(16)
+	b.u32(names["Contoso-Backup/Operational"])
+	b.u32(0)
+	b.u32(0x90000002)
+	b.end(e)
+
+	elem(1)
+	e = b.table("LEVL", 2)
+	for _, l := range []struct {
+		v    uint32
+		name string
+	}{{4, "win:Informational"}, {16, "Trace"}} {
+		b.u32(l.v)
+		b.u32(0x50000000 + l.v)
+		b.u32(names[l.name])
+	}
+	b.end(e)
+
+	elem(2)
+	e = b.table("OPCO", 2)
+	b.u32(11)
+	b.u32(wevtNoMessage)
+	b.u32(names["Verify"])
+	b.u32(20<<16 | 1)
+	b.u32(0x30140001)
+	b.u32(names["Retry"])
+	b.end(e)
+
+	elem(3)
+	e = b.table("TASK", 1)
+	b.u32(1)
+	b.u32(0x70000001)
+	b.buf = append(b.buf, make([]byte, 16)...)
+	b.u32(names["Job"])
+	b.end(e)
+
+	elem(4)
+	e = b.table("KEYW", 2)
+	b.u64(0x1)
+	b.u32(0x10000001)
+	b.u32(names["Disk"])
+	b.u64(0x20000000000000)
+	b.u32(0x10000035)
+	b.u32(names["win:AuditSuccess"])
+	b.end(e)
+
+	elem(5)
+	e = b.table("EVNT", 2)
+	b.u32(0)
+	for _, ev := range []struct {
+		id       uint16
+		version  uint8
+		level    uint8
+		opcode   uint8
+		template uint32
+	}{{100, 1, 16, 20, tmpl}, {100, 0, 4, 1, tmpl}} {
+		b.u16(ev.id)
+		b.u8(ev.version)
+		b.u8(16)
+		b.u8(ev.level)
+		b.u8(ev.opcode)
+		b.u16(1)
+		b.u64(0x20000000000001)
+		b.u32(0xB0000064)
+		b.u32(ev.template)
+		b.buf = append(b.buf, make([]byte, 24)...)
+	}
+	b.end(e)
+
+	b.end(wevt)
+	b.put32(4, b.pos())
+	return b.buf
+}
+
+func TestParseWEVTTemplate(t *testing.T) {
+	ms, err := ParseWEVTTemplate(buildCRIM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 {
+		t.Fatalf("ParseWEVTTemplate = %d providers, want 1", len(ms))
+	}
+	m := ms[0]
+	if m.GUID != "{6A3D0B4C-1F2E-4D5A-9B8C-7E6F5A4B3C2D}" {
+		t.Errorf("GUID = %s", m.GUID)
+	}
+	wantMeta := WinMeta{
+		Keywords: map[int64]string{1: "Disk"},
+		Opcodes:  map[uint8]string{11: "Verify", 20: "Retry"},
+		Levels:   map[uint8]string{16: "Trace"},
+		Tasks:    map[uint16]string{1: "Job"},
+	}
+	if !reflect.DeepEqual(m.Meta, wantMeta) {
+		t.Errorf("Meta = %+v, want %+v", m.Meta, wantMeta)
+	}
+	if !reflect.DeepEqual(m.Channels, map[uint8]string{16: "Contoso-Backup/Operational"}) {
+		t.Errorf("Channels = %v", m.Channels)
+	}
+	wantMsgs := []metaMessage{
+		{kind: 'p', id: 0x90000001},
+		{kind: 'l', value: 16, id: 0x50000010},
+		{kind: 'o', value: 20, id: 0x30140001},
+		{kind: 't', value: 1, id: 0x70000001},
+		{kind: 'k', value: 1, id: 0x10000001},
+	}
+	if !reflect.DeepEqual(m.msgIDs, wantMsgs) {
+		t.Errorf("msgIDs = %+v, want %+v", m.msgIDs, wantMsgs)
+	}
+	fields := []TemplateField{{Name: "JobName", InType: "win:UnicodeString", OutType: "xs:string"}, {Name: "Bytes", InType: "win:UInt64"}}
+	want := []ManifestEvent{
+		{ID: 100, Level: 4, Task: 1, Opcode: 1, Keywords: 0x20000000000001, Channel: "Contoso-Backup/Operational", MessageID: 0xB0000064, Fields: fields},
+		{ID: 100, Version: 1, Level: 16, Task: 1, Opcode: 20, Keywords: 0x20000000000001, Channel: "Contoso-Backup/Operational", MessageID: 0xB0000064, Fields: fields},
+	}
+	if !reflect.DeepEqual(m.Events, want) {
+		t.Errorf("Events =\n%+v\nwant\n%+v", m.Events, want)
+	}
+	if hints := m.TypeHints(100, 1); !reflect.DeepEqual(hints, TypeHints{"JobName": KindString, "Bytes": KindInt}) {
+		t.Errorf("TypeHints = %v", hints)
+	}
+}
+
+func TestParseWEVTTemplateErrors(t *testing.T) {
+	data := buildCRIM()
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"signature", append([]byte("MIRC"), data[4:]...), `want "CRIM"`},
+		{"truncated", data[:len(data)-10], "truncated"},
+		{"header", data[:8], "truncated"},
+		// 数量与条目大小的乘积在uint32中会回绕到范围之内。
+		{"levels count", withCount(data, "LEVL", 8, 0x40000000), "truncated"},
+		{"events count", withCount(data, "EVNT", 8, 0x05555556), "truncated"},
+		{"template count", withCount(data, "TEMP", 8, 0x0CCCCCCD), "template items truncated"},
+	}
+	for _, tt := range tests {
+		_, err := ParseWEVTTemplate(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+// withCount 复制数据并改写sig元素中at处的数量字段。
+func withCount(data []byte, sig string, at int, n uint32) []byte {
+	out := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(out[bytes.Index(out, []byte(sig))+at:], n)
+	return out
+}
+
+func TestLoadWEVTTemplate(t *testing.T) {
+	path := writePE(t, []testResource{
+		{typ: resourceID{name: "WEVT_TEMPLATE"}, name: resourceID{id: 1}, lang: 0x409, data: buildCRIM()},
+	})
+	ms, err := LoadWEVTTemplate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || len(ms[0].Events) != 2 || ms[0].Meta.Tasks[1] != "Job" {
+		t.Errorf("LoadWEVTTemplate = %+v", ms)
+	}
+
+	path = writePE(t, []testResource{{typ: resourceID{id: 11}, name: resourceID{id: 1}, data: []byte{0}}})
+	if _, err := LoadWEVTTemplate(path); err == nil || !strings.Contains(err.Error(), "resource not found") {
+		t.Errorf("LoadWEVTTemplate without resource: err = %v", err)
+	}
+}
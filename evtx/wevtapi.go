@@ -280,6 +280,7 @@ const (
 
 // Proc declarations.
 var (
+	procEvtArchiveExportedLog           = winapi.NewProc("wevtapi.dll", "EvtArchiveExportedLog")
 	procEvtClearLog                     = winapi.NewProc("wevtapi.dll", "EvtClearLog")
 	procEvtClose                        = winapi.NewProc("wevtapi.dll", "EvtClose")
 	procEvtCreateBookmark               = winapi.NewProc("wevtapi.dll", "EvtCreateBookmark")
@@ -306,6 +307,15 @@ var (
 	procEvtUpdateBookmark               = winapi.NewProc("wevtapi.dll", "EvtUpdateBookmark")
 )
 
+func evtArchiveExportedLog(session EvtHandle, logFilePath *uint16, locale uint32, flags uint32) error {
+	return procEvtArchiveExportedLog.Call(
+		uintptr(session),
+		uintptr(unsafe.Pointer(logFilePath)),
+		uintptr(locale),
+		uintptr(flags),
+	)
+}
+
 func evtClearLog(session EvtHandle, channelPath, targetFilePath *uint16, flags uint32) error {
 	return procEvtClearLog.Call(
 		uintptr(session),
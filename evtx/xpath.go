@@ -0,0 +1,836 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FilterError 表示XPath过滤表达式存在语法错误或使用了Windows事件查询不支持的语法。
+type FilterError struct {
+	// Expr 原始表达式。
+	Expr string
+	// Pos 出错位置相对表达式起始的字节偏移。
+	Pos int
+	// Msg 错误描述。
+	Msg string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("evtx: xpath %s at position %d in %q", e.Msg, e.Pos, e.Expr)
+}
+
+// Filter 是编译后的事件过滤表达式，语义与Windows事件日志查询支持的XPath 1.0子集一致：
+// 只允许子元素步骤、属性、谓词、and/or、比较运算以及 band()、timediff()、position() 函数，
+// 不支持 //、轴、算术、并集与其他函数。
+type Filter struct {
+	expr string
+	path *xpPath
+	now  func() time.Time
+}
+
+// CompileFilter 编译XPath过滤表达式，如 *[System[EventID=4624]]。
+//   expr - Select/Suppress元素中使用的XPath表达式
+//   返回1 - 编译后的过滤器
+//   返回2 - 语法错误或不受支持的语法，类型为*FilterError
+func CompileFilter(expr string) (*Filter, error) {
+	p := &xpParser{expr: expr}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	path, err := p.parseSelector()
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{expr: expr, path: path, now: time.Now}, nil
+}
+
+// String 返回原始表达式。
+func (f *Filter) String() string { return f.expr }
+
+// Match 判断事件是否匹配过滤器，事件按Windows渲染XML的结构参与求值。
+//   e - 待匹配的事件
+//   返回 - 是否匹配
+func (f *Filter) Match(e *Event) bool {
+	return f.matchTree(eventTree(e))
+}
+
+// MatchXML 判断事件XML是否匹配过滤器。
+//   data - 事件XML
+//   返回1 - 是否匹配
+//   返回2 - XML解析错误，成功时为nil
+func (f *Filter) MatchXML(data []byte) (bool, error) {
+	root, err := parseXMLTree(data)
+	if err != nil {
+		return false, err
+	}
+	return f.matchTree(root), nil
+}
+
+// MatchRecord 判断记录是否匹配过滤器，有原始XML时优先使用XML求值。
+//   r - 待匹配的记录
+//   返回 - 是否匹配
+func (f *Filter) MatchRecord(r *Record) bool {
+	if r.XML != "" {
+		if ok, err := f.MatchXML([]byte(r.XML)); err == nil {
+			return ok
+		}
+	}
+	return f.Match(&r.Event)
+}
+
+func (f *Filter) matchTree(root *xnode) bool {
+	ev := &xpEval{now: f.now()}
+	return len(ev.path(f.path, []*xnode{root})) > 0
+}
+
+// xnode 是参与求值的简化XML元素。
+type xnode struct {
+	name     string
+	attrs    []KeyValue
+	text     string
+	children []*xnode
+}
+
+func (n *xnode) add(name, text string, attrs ...KeyValue) *xnode {
+	c := &xnode{name: name, text: text}
+	for _, a := range attrs {
+		if a.Value != "" {
+			c.attrs = append(c.attrs, a)
+		}
+	}
+	n.children = append(n.children, c)
+	return c
+}
+
+// value 返回元素的字符串值，即所有后代文本的拼接。
+func (n *xnode) value() string {
+	if len(n.children) == 0 {
+		return n.text
+	}
+	var sb strings.Builder
+	sb.WriteString(n.text)
+	for _, c := range n.children {
+		sb.WriteString(c.value())
+	}
+	return sb.String()
+}
+
+func parseXMLTree(data []byte) (*xnode, error) {
+	root := &xnode{}
+	stack := []*xnode{root}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse event xml: %w", err)
+		}
+		top := stack[len(stack)-1]
+		switch tok := t.(type) {
+		case xml.StartElement:
+			n := &xnode{name: tok.Name.Local}
+			for _, a := range tok.Attr {
+				if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+					continue
+				}
+				n.attrs = append(n.attrs, KeyValue{a.Name.Local, a.Value})
+			}
+			top.children = append(top.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			top.text += string(tok)
+		}
+	}
+	return root, nil
+}
+
+// eventTree 将Event还原为与Windows渲染XML一致的元素树。
+func eventTree(e *Event) *xnode {
+	root := &xnode{}
+	ev := root.add("Event", "")
+	sys := ev.add("System", "")
+	sys.add("Provider", "", KeyValue{"Name", e.Provider.Name}, KeyValue{"Guid", e.Provider.GUID},
+		KeyValue{"EventSourceName", e.Provider.EventSourceName})
+	var qualifiers string
+	if e.EventIdentifier.Qualifiers != 0 {
+		qualifiers = strconv.Itoa(int(e.EventIdentifier.Qualifiers))
+	}
+	sys.add("EventID", strconv.FormatUint(uint64(e.EventIdentifier.ID), 10), KeyValue{"Qualifiers", qualifiers})
+	sys.add("Version", strconv.Itoa(int(e.Version)))
+	sys.add("Level", strconv.Itoa(int(e.LevelRaw)))
+	sys.add("Task", strconv.Itoa(int(e.TaskRaw)))
+	if e.OpcodeRaw != nil {
+		sys.add("Opcode", strconv.Itoa(int(*e.OpcodeRaw)))
+	}
+	sys.add("Keywords", "0x"+strconv.FormatUint(uint64(e.KeywordsRaw), 16))
+	var created string
+	if !e.TimeCreated.SystemTime.IsZero() {
+		created = formatSystemTime(e.TimeCreated.SystemTime)
+	}
+	sys.add("TimeCreated", "", KeyValue{"SystemTime", created})
+	sys.add("EventRecordID", strconv.FormatUint(e.RecordID, 10))
+	sys.add("Correlation", "", KeyValue{"ActivityID", e.Correlation.ActivityID},
+		KeyValue{"RelatedActivityID", e.Correlation.RelatedActivityID})
+	sys.add("Execution", "", KeyValue{"ProcessID", strconv.FormatUint(uint64(e.Execution.ProcessID), 10)},
+		KeyValue{"ThreadID", strconv.FormatUint(uint64(e.Execution.ThreadID), 10)})
+	sys.add("Channel", e.Channel)
+	sys.add("Computer", e.Computer)
+	sys.add("Security", "", KeyValue{"UserID", e.User.Identifier})
+	if len(e.EventData.Pairs) > 0 {
+		data := ev.add("EventData", "")
+		for _, kv := range e.EventData.Pairs {
+			data.add("Data", kv.Value, KeyValue{"Name", kv.Key})
+		}
+	}
+	if e.UserData.Name.Local != "" {
+		inner := ev.add("UserData", "").add(e.UserData.Name.Local, "")
+		for _, kv := range e.UserData.Pairs {
+			inner.add(kv.Key, kv.Value)
+		}
+	}
+	return root
+}
+
+// xpToken 是XPath词法单元。
+type xpToken struct {
+	kind byte // 'n' 名称，'s' 字符串，'#' 数字，其余为运算符首字符，0 结束
+	text string
+	pos  int
+}
+
+type xpParser struct {
+	expr   string
+	tokens []xpToken
+	i      int
+}
+
+func (p *xpParser) errorf(pos int, format string, args ...interface{}) error {
+	return &FilterError{Expr: p.expr, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || c >= '0' && c <= '9' || c == '-' || c == '.'
+}
+
+// lex 将表达式切分为词法单元，并拒绝Windows不支持的符号。
+func (p *xpParser) lex() error {
+	s := p.expr
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '\'' || c == '"':
+			j := strings.IndexByte(s[i+1:], c)
+			if j < 0 {
+				return p.errorf(i, "unterminated string literal")
+			}
+			p.tokens = append(p.tokens, xpToken{'s', s[i+1 : i+1+j], i})
+			i += j + 2
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == 'x' || s[j] >= 'a' && s[j] <= 'f' || s[j] >= 'A' && s[j] <= 'F') {
+				j++
+			}
+			if _, err := strconv.ParseFloat(s[i:j], 64); err != nil {
+				if _, err := strconv.ParseUint(s[i:j], 0, 64); err != nil {
+					return p.errorf(i, "invalid number %q", s[i:j])
+				}
+			}
+			p.tokens = append(p.tokens, xpToken{'#', s[i:j], i})
+			i = j
+		case isNameStart(c):
+			j := i + 1
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			if j < len(s) && s[j] == ':' {
+				if j+1 < len(s) && s[j+1] == ':' {
+					return p.errorf(i, "axis %s:: is not supported", s[i:j])
+				}
+				return p.errorf(j, "namespace prefixes are not supported")
+			}
+			p.tokens = append(p.tokens, xpToken{'n', s[i:j], i})
+			i = j
+		case c == '/':
+			if i+1 < len(s) && s[i+1] == '/' {
+				return p.errorf(i, "descendant axis // is not supported")
+			}
+			p.tokens = append(p.tokens, xpToken{c, "/", i})
+			i++
+		case c == '!' || c == '<' || c == '>':
+			if i+1 < len(s) && s[i+1] == '=' {
+				p.tokens = append(p.tokens, xpToken{c, s[i : i+2], i})
+				i += 2
+				continue
+			}
+			if c == '!' {
+				return p.errorf(i, "unexpected '!'")
+			}
+			p.tokens = append(p.tokens, xpToken{c, s[i : i+1], i})
+			i++
+		case strings.IndexByte("[]()@,*=", c) >= 0:
+			p.tokens = append(p.tokens, xpToken{c, s[i : i+1], i})
+			i++
+		case c == '.':
+			return p.errorf(i, "context node references are not supported")
+		case c == '|':
+			return p.errorf(i, "union operator | is not supported")
+		case c == '$':
+			return p.errorf(i, "variables are not supported")
+		case c == '+' || c == '-':
+			return p.errorf(i, "arithmetic operator %c is not supported", c)
+		default:
+			return p.errorf(i, "unexpected character %q", c)
+		}
+	}
+	p.tokens = append(p.tokens, xpToken{0, "", len(s)})
+	return nil
+}
+
+func (p *xpParser) peek() xpToken { return p.tokens[p.i] }
+
+func (p *xpParser) next() xpToken {
+	t := p.tokens[p.i]
+	if t.kind != 0 {
+		p.i++
+	}
+	return t
+}
+
+func (p *xpParser) expect(kind byte) (xpToken, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.errorf(t.pos, "expected %q, found %s", kind, describe(t))
+	}
+	return t, nil
+}
+
+func describe(t xpToken) string {
+	if t.kind == 0 {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// xpPath 是由子元素步骤组成的相对路径，attr非空时以属性步骤结束。
+type xpPath struct {
+	steps []xpStep
+	attr  string
+}
+
+type xpStep struct {
+	name  string // "*" 匹配任意元素
+	preds []xpExpr
+}
+
+// xpExpr 是表达式节点：*xpPath、xpLiteral、xpNumber、*xpCall、*xpBinary。
+type xpExpr interface{}
+
+type xpLiteral string
+
+type xpNumber struct {
+	f    float64
+	u    uint64
+	text string
+}
+
+type xpCall struct {
+	name string
+	args []xpExpr
+}
+
+type xpBinary struct {
+	op   string
+	l, r xpExpr
+}
+
+// parseSelector 解析顶层选择器，必须是以 * 或 Event 开始的路径。
+func (p *xpParser) parseSelector() (*xpPath, error) {
+	t := p.peek()
+	switch {
+	case t.kind == '/':
+		return nil, p.errorf(t.pos, "absolute paths are not supported")
+	case t.kind == '*', t.kind == 'n' && t.text == "Event":
+	default:
+		return nil, p.errorf(t.pos, "selector must start with '*' or 'Event', found %s", describe(t))
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	if path.attr != "" {
+		return nil, p.errorf(t.pos, "selector must select elements")
+	}
+	if t := p.peek(); t.kind != 0 {
+		return nil, p.errorf(t.pos, "unexpected %s after selector", describe(t))
+	}
+	return path, nil
+}
+
+func (p *xpParser) parsePath() (*xpPath, error) {
+	path := &xpPath{}
+	for {
+		t := p.next()
+		switch {
+		case t.kind == '@':
+			name, err := p.expect('n')
+			if err != nil {
+				return nil, err
+			}
+			path.attr = name.text
+			if n := p.peek(); n.kind == '/' || n.kind == '[' {
+				return nil, p.errorf(n.pos, "attribute step must be the last step")
+			}
+			return path, nil
+		case t.kind == '*' || t.kind == 'n':
+			step := xpStep{name: t.text}
+			for p.peek().kind == '[' {
+				open := p.next()
+				if p.peek().kind == ']' {
+					return nil, p.errorf(open.pos, "empty predicate")
+				}
+				e, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				if _, err := p.expect(']'); err != nil {
+					return nil, err
+				}
+				step.preds = append(step.preds, e)
+			}
+			path.steps = append(path.steps, step)
+		default:
+			return nil, p.errorf(t.pos, "expected element name, found %s", describe(t))
+		}
+		if p.peek().kind != '/' {
+			return path, nil
+		}
+		p.next()
+	}
+}
+
+func (p *xpParser) parseOr() (xpExpr, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == 'n' && t.text == "or"; t = p.peek() {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &xpBinary{op: "or", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *xpParser) parseAnd() (xpExpr, error) {
+	l, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == 'n' && t.text == "and"; t = p.peek() {
+		p.next()
+		r, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		l = &xpBinary{op: "and", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *xpParser) parseComparison() (xpExpr, error) {
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch t.kind {
+	case '=', '!', '<', '>':
+		p.next()
+		r, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if n := p.peek(); n.kind == '=' || n.kind == '!' || n.kind == '<' || n.kind == '>' {
+			return nil, p.errorf(n.pos, "chained comparisons are not supported")
+		}
+		return &xpBinary{op: t.text, l: l, r: r}, nil
+	case 'n':
+		switch t.text {
+		case "div", "mod":
+			return nil, p.errorf(t.pos, "arithmetic operator %s is not supported", t.text)
+		}
+	case '*':
+		return nil, p.errorf(t.pos, "arithmetic operator * is not supported")
+	}
+	return l, nil
+}
+
+func (p *xpParser) parseOperand() (xpExpr, error) {
+	t := p.peek()
+	switch t.kind {
+	case 's':
+		p.next()
+		return xpLiteral(t.text), nil
+	case '#':
+		p.next()
+		n := xpNumber{text: t.text}
+		n.u, n.f = parseXPNumber(t.text)
+		return n, nil
+	case '(':
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(')'); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case 'n':
+		if p.tokens[p.i+1].kind == '(' {
+			return p.parseCall()
+		}
+		return p.parsePath()
+	case '@', '*':
+		return p.parsePath()
+	}
+	return nil, p.errorf(t.pos, "unexpected %s", describe(t))
+}
+
+func (p *xpParser) parseCall() (xpExpr, error) {
+	name := p.next()
+	p.next()
+	var want int
+	switch name.text {
+	case "band":
+		want = 2
+	case "timediff":
+		want = 1
+	case "position":
+		want = 0
+	default:
+		return nil, p.errorf(name.pos, "function %s() is not supported", name.text)
+	}
+	call := &xpCall{name: name.text}
+	for p.peek().kind != ')' {
+		if len(call.args) > 0 {
+			if _, err := p.expect(','); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+	}
+	end := p.next()
+	if len(call.args) != want {
+		return nil, p.errorf(end.pos, "%s() takes %d argument(s), got %d", name.text, want, len(call.args))
+	}
+	if name.text == "timediff" {
+		if path, ok := call.args[0].(*xpPath); !ok || path.attr == "" {
+			return nil, p.errorf(name.pos, "timediff() requires an attribute such as @SystemTime")
+		}
+	}
+	return call, nil
+}
+
+// parseXPNumber 解析十进制或0x前缀的十六进制数字，同时返回整数与浮点形式。
+func parseXPNumber(s string) (uint64, float64) {
+	s = strings.TrimSpace(s)
+	if u, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return u, float64(u)
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		if f >= 0 && f < math.MaxUint64 {
+			return uint64(f), f
+		}
+		return 0, f
+	}
+	return 0, math.NaN()
+}
+
+// xpValue 是求值结果：节点集（以字符串值表示）、字符串、数字或布尔值。
+type xpValue struct {
+	kind  byte // 'N' 节点集，'s' 字符串，'#' 数字，'b' 布尔
+	nodes []string
+	s     string
+	f     float64
+	u     uint64
+	b     bool
+}
+
+type xpEval struct {
+	now time.Time
+	pos int // 谓词求值时上下文节点的位置（从1开始）
+}
+
+// path 从ctx出发求值路径，返回匹配的元素。
+func (ev *xpEval) path(p *xpPath, ctx []*xnode) []*xnode {
+	cur := ctx
+	for _, step := range p.steps {
+		var next []*xnode
+		for _, n := range cur {
+			var matched []*xnode
+			for _, c := range n.children {
+				if step.name == "*" || c.name == step.name {
+					matched = append(matched, c)
+				}
+			}
+			for _, pred := range step.preds {
+				matched = ev.filter(pred, matched)
+			}
+			next = append(next, matched...)
+		}
+		cur = next
+	}
+	return cur
+}
+
+func (ev *xpEval) filter(pred xpExpr, nodes []*xnode) []*xnode {
+	var out []*xnode
+	saved := ev.pos
+	for i, n := range nodes {
+		ev.pos = i + 1
+		v := ev.eval(pred, n)
+		keep := v.truth()
+		if _, ok := pred.(xpNumber); ok {
+			// [n] 等价于 [position()=n]
+			keep = v.f == float64(i+1)
+		}
+		if keep {
+			out = append(out, n)
+		}
+	}
+	ev.pos = saved
+	return out
+}
+
+// values 求值路径并返回节点集的字符串值。
+func (ev *xpEval) values(p *xpPath, n *xnode) []string {
+	elems := []*xnode{n}
+	if len(p.steps) > 0 {
+		elems = ev.path(p, elems)
+	}
+	var out []string
+	for _, e := range elems {
+		if p.attr == "" {
+			out = append(out, e.value())
+			continue
+		}
+		for _, a := range e.attrs {
+			if a.Key == p.attr {
+				out = append(out, a.Value)
+			}
+		}
+	}
+	return out
+}
+
+func (ev *xpEval) eval(e xpExpr, n *xnode) xpValue {
+	switch x := e.(type) {
+	case *xpPath:
+		return xpValue{kind: 'N', nodes: ev.values(x, n)}
+	case xpLiteral:
+		return xpValue{kind: 's', s: string(x)}
+	case xpNumber:
+		return xpValue{kind: '#', f: x.f, u: x.u}
+	case *xpCall:
+		return ev.call(x, n)
+	case *xpBinary:
+		switch x.op {
+		case "and":
+			return xpValue{kind: 'b', b: ev.eval(x.l, n).truth() && ev.eval(x.r, n).truth()}
+		case "or":
+			return xpValue{kind: 'b', b: ev.eval(x.l, n).truth() || ev.eval(x.r, n).truth()}
+		}
+		return xpValue{kind: 'b', b: compare(x.op, ev.eval(x.l, n), ev.eval(x.r, n))}
+	}
+	return xpValue{kind: 'b'}
+}
+
+func (ev *xpEval) call(c *xpCall, n *xnode) xpValue {
+	switch c.name {
+	case "position":
+		return xpValue{kind: '#', f: float64(ev.pos), u: uint64(ev.pos)}
+	case "band":
+		a, b := ev.eval(c.args[0], n).integer(), ev.eval(c.args[1], n).integer()
+		return xpValue{kind: '#', f: float64(a & b), u: a & b}
+	case "timediff":
+		v := ev.eval(c.args[0], n)
+		if len(v.nodes) == 0 {
+			return xpValue{kind: '#', f: math.NaN()}
+		}
+		t, ok := parseXPTime(v.nodes[0])
+		if !ok {
+			return xpValue{kind: '#', f: math.NaN()}
+		}
+		ms := ev.now.Sub(t).Milliseconds()
+		if ms < 0 {
+			ms = -ms
+		}
+		return xpValue{kind: '#', f: float64(ms), u: uint64(ms)}
+	}
+	return xpValue{kind: '#', f: math.NaN()}
+}
+
+func (v xpValue) truth() bool {
+	switch v.kind {
+	case 'N':
+		return len(v.nodes) > 0
+	case 's':
+		return v.s != ""
+	case '#':
+		return v.f != 0 && !math.IsNaN(v.f)
+	}
+	return v.b
+}
+
+func (v xpValue) integer() uint64 {
+	switch v.kind {
+	case 'N':
+		if len(v.nodes) == 0 {
+			return 0
+		}
+		u, _ := parseXPNumber(v.nodes[0])
+		return u
+	case 's':
+		u, _ := parseXPNumber(v.s)
+		return u
+	case '#':
+		return v.u
+	}
+	if v.b {
+		return 1
+	}
+	return 0
+}
+
+// compare 按XPath 1.0的比较规则求值，节点集中任一节点满足即为真。
+// 两侧都能解析为时间的字符串按时间比较，以支持 @SystemTime>='...' 形式的条件。
+func compare(op string, l, r xpValue) bool {
+	if l.kind == 'N' || r.kind == 'N' {
+		if l.kind == 'b' || r.kind == 'b' {
+			return compareAtoms(op, xpValue{kind: 'b', b: l.truth()}, xpValue{kind: 'b', b: r.truth()})
+		}
+		ls, rs := atoms(l), atoms(r)
+		for _, a := range ls {
+			for _, b := range rs {
+				if compareAtoms(op, a, b) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return compareAtoms(op, l, r)
+}
+
+// atoms 将节点集展开为字符串值，其余类型原样返回。
+func atoms(v xpValue) []xpValue {
+	if v.kind != 'N' {
+		return []xpValue{v}
+	}
+	out := make([]xpValue, len(v.nodes))
+	for i, s := range v.nodes {
+		out[i] = xpValue{kind: 's', s: s}
+	}
+	return out
+}
+
+func compareAtoms(op string, l, r xpValue) bool {
+	if op == "=" || op == "!=" {
+		var eq bool
+		switch {
+		case l.kind == 'b' || r.kind == 'b':
+			eq = l.truth() == r.truth()
+		case l.kind == '#' || r.kind == '#':
+			lu, lf := l.number()
+			ru, rf := r.number()
+			eq = lf == rf && lu == ru
+		default:
+			eq = l.s == r.s
+		}
+		return eq == (op == "=")
+	}
+	if l.kind == 's' && r.kind == 's' {
+		lt, lok := parseXPTime(l.s)
+		rt, rok := parseXPTime(r.s)
+		if lok && rok {
+			return compareOrdered(op, lt.Compare(rt))
+		}
+	}
+	lu, lf := l.number()
+	ru, rf := r.number()
+	if math.IsNaN(lf) || math.IsNaN(rf) {
+		return false
+	}
+	switch {
+	case lu != ru && lf == rf:
+		// 超出float64精度的64位整数按整数比较
+		if lu < ru {
+			return compareOrdered(op, -1)
+		}
+		return compareOrdered(op, 1)
+	case lf < rf:
+		return compareOrdered(op, -1)
+	case lf > rf:
+		return compareOrdered(op, 1)
+	}
+	return compareOrdered(op, 0)
+}
+
+func compareOrdered(op string, c int) bool {
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func (v xpValue) number() (uint64, float64) {
+	switch v.kind {
+	case '#':
+		return v.u, v.f
+	case 's':
+		return parseXPNumber(v.s)
+	case 'b':
+		if v.b {
+			return 1, 1
+		}
+		return 0, 0
+	}
+	return 0, math.NaN()
+}
+
+// parseXPTime 解析事件XML中SystemTime使用的UTC时间格式。
+func parseXPTime(s string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s))
+	return t, err == nil
+}
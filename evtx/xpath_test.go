@@ -0,0 +1,184 @@
+package evtx
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// filterRecord 返回由测试块解码得到的4624事件记录。
+func filterRecord(t *testing.T) Record {
+	t.Helper()
+	c := newChunkBuilder()
+	c.addEvent(testEvent{recordID: 7, eventID: 4624, time: testBase, target: "alice", logonType: 10})
+	chunk, err := parseChunk(0, c.finish())
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := chunk.Records()
+	if err != nil || len(records) != 1 {
+		t.Fatalf("records = %d, err = %v", len(records), err)
+	}
+	return records[0]
+}
+
+func TestFilterMatch(t *testing.T) {
+	r := filterRecord(t)
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"*", true},
+		{"Event", true},
+		{"*[System[EventID=4624]]", true},
+		{"*[System[EventID=4625]]", false},
+		{"*[System[EventID!=4625]]", true},
+		{"*[System[(EventID>=4600 and EventID<=4700)]]", true},
+		{"*[System[EventID=4625 or EventID=4624]]", true},
+		{"*[System/EventID=4624]", true},
+		{"Event/System[EventID=4624]", true},
+		{"*[System[Provider[@Name='Microsoft-Windows-Security-Auditing']]]", true},
+		{"*[System[Provider[@Name='Other']]]", false},
+		{"*[System[Provider[@Guid='{54544F85-5A96-494B-A5BA-3E3B0328C30D}']]]", true},
+		{"*[System[Level=0 or Level=4]]", true},
+		{"*[System[Level>0]]", false},
+		{"*[System[band(Keywords,9007199254740992)]]", true},
+		{"*[System[band(Keywords,4503599627370496)]]", false},
+		{"*[System[band(Keywords,0x8000000000000000)]]", true},
+		{"*[System[Keywords=0x8020000000000000]]", true},
+		{"*[System[TimeCreated[@SystemTime>='2024-01-15T00:00:00.000Z']]]", true},
+		{"*[System[TimeCreated[@SystemTime<'2024-01-15T10:30:00Z']]]", false},
+		{"*[System[TimeCreated[timediff(@SystemTime)<=3600000]]]", true},
+		{"*[System[TimeCreated[timediff(@SystemTime)<=60000]]]", false},
+		{"*[System[Security[@UserID='S-1-5-18']]]", true},
+		{"*[System[Execution[@ProcessID=612]]]", true},
+		{"*[EventData[Data[@Name='TargetUserName']='alice']]", true},
+		{"*[EventData[Data[@Name='TargetUserName']='bob']]", false},
+		{"*[EventData[Data[@Name='LogonType']=10]]", true},
+		{"*[EventData[Data='alice']]", true},
+		{"*[EventData[Data[@Name='LogonType']]]", true},
+		{"*[EventData[Data[@Name='Missing']]]", false},
+		{"*[EventData[Data[2]=10]]", true},
+		{"*[EventData[Data[position()=1]='alice']]", true},
+		{"*[System[EventID=4624] and EventData[Data[@Name='LogonType']='3']]", false},
+		{`*[EventData[Data[@Name="TargetUserName"]="alice"]]`, true},
+	}
+	for _, tt := range tests {
+		f, err := CompileFilter(tt.expr)
+		if err != nil {
+			t.Errorf("CompileFilter(%s): %v", tt.expr, err)
+			continue
+		}
+		f.now = func() time.Time { return testBase.Add(30 * time.Minute) }
+		if got := f.Match(&r.Event); got != tt.want {
+			t.Errorf("Match(%s) = %v, want %v", tt.expr, got, tt.want)
+		}
+		got, err := f.MatchXML([]byte(r.XML))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("MatchXML(%s) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestFilterUserData(t *testing.T) {
+	e := Event{Channel: "Security"}
+	e.EventIdentifier.ID = 1102
+	e.UserData.Name.Local = "LogFileCleared"
+	e.UserData.Pairs = []KeyValue{{"SubjectUserName", "Administrator"}}
+	for expr, want := range map[string]bool{
+		"*[UserData/LogFileCleared[SubjectUserName='Administrator']]": true,
+		"*[UserData/*[SubjectUserName='guest']]":                      false,
+		"*[System[Channel='Security' and EventID=1102]]":              true,
+	} {
+		f, err := CompileFilter(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.Match(&e); got != want {
+			t.Errorf("Match(%s) = %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestFilterMatchRecord(t *testing.T) {
+	r := filterRecord(t)
+	f, err := CompileFilter("*[System[EventRecordID=7]]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.MatchRecord(&r) {
+		t.Error("MatchRecord with XML = false")
+	}
+	r.XML = ""
+	if !f.MatchRecord(&r) {
+		t.Error("MatchRecord without XML = false")
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+	}{
+		{"", 0},
+		{"System[EventID=1]", 0},
+		{"/Event", 0},
+		{"*[System//EventID=1]", 8},
+		{"*[System[EventID=1]", 19},
+		{"*[System[EventID=1]]]", 20},
+		{"*[System[contains(Channel,'Sec')]]", 9},
+		{"*[System[not(EventID=1)]]", 9},
+		{"*[System[EventID=1 | EventID=2]]", 19},
+		{"*[System[EventID=1+1]]", 18},
+		{"*[System[EventID=2 * 3]]", 19},
+		{"*[descendant::EventID=1]", 2},
+		{"*[.='x']", 2},
+		{"*[System[EventID='1]]", 17},
+		{"*[System[@Name/x]]", 14},
+		{"*[]", 1},
+		{"*[System[band(Keywords)]]", 22},
+		{"*[System[TimeCreated[timediff(SystemTime)<1]]]", 21},
+		{"*[System[EventID=1=1]]", 18},
+		{"*[$x]", 2},
+		{"*[System[EventID=1 div 2]]", 19},
+	}
+	for _, tt := range tests {
+		_, err := CompileFilter(tt.expr)
+		var fe *FilterError
+		if !errors.As(err, &fe) {
+			t.Errorf("CompileFilter(%q) err = %v, want FilterError", tt.expr, err)
+			continue
+		}
+		if fe.Pos != tt.pos {
+			t.Errorf("CompileFilter(%q) pos = %d (%s), want %d", tt.expr, fe.Pos, fe.Msg, tt.pos)
+		}
+	}
+}
+
+func TestFilterCompilesBuilderOutput(t *testing.T) {
+	p := QueryPath{
+		Path:      "Security",
+		Levels:    []uint8{0, 4},
+		Providers: []string{"Microsoft-Windows-Security-Auditing"},
+		EventIDs:  []IDRange{{Min: 4624}, {Min: 4600, Max: 4700}},
+		Keywords:  0x8020000000000000,
+		Since:     testBase.Add(-time.Hour),
+		Until:     testBase.Add(time.Hour),
+		Data:      []DataFilter{{Name: "LogonType", Values: []string{"3", "10"}}},
+	}
+	xp, err := p.XPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := CompileFilter(xp)
+	if err != nil {
+		t.Fatalf("CompileFilter(%s): %v", xp, err)
+	}
+	r := filterRecord(t)
+	if !f.Match(&r.Event) {
+		t.Errorf("builder query %s does not match", xp)
+	}
+}
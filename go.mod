@@ -1,7 +1,9 @@
 module github.com/kitsch-9527/wcorefx
 
-go 1.20
+go 1.24.0
 
 require golang.org/x/sys v0.37.0
 
 require github.com/go-ole/go-ole v1.3.0
+
+require gopkg.in/yaml.v3 v3.0.1
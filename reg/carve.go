@@ -0,0 +1,107 @@
+package reg
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// DeletedValue 是从空闲单元格中恢复的值。
+type DeletedValue struct {
+	Value
+	// Offset vk单元格相对第一个hbin的偏移。
+	Offset uint32
+	// Key 值列表仍引用该值的已删除键，无法关联时为nil。
+	Key *HiveKey
+}
+
+// CarveResult 是空闲单元格的扫描结果，键和值均按单元格偏移排序。
+type CarveResult struct {
+	// Keys 恢复的nk记录，Deleted均为true。
+	Keys []*HiveKey
+	// Values 恢复的vk记录，Deleted均为true。
+	Values []DeletedValue
+}
+
+// Carve 扫描全部hbin的空闲单元格，恢复删除后残留的nk与vk记录。
+// 相邻空闲单元格会被合并，旧记录可能位于合并区域内部，因此按8字节对齐检查每个位置的签名。
+// 扫描只读取数据，可以与Root、OpenKey的正常遍历在同一hive上同时使用。
+//   返回 - 恢复的键和值；单元格大小损坏的hbin会跳过其剩余部分
+func (h *Hive) Carve() *CarveResult {
+	res := &CarveResult{}
+	h.freeCells(func(start, end uint32) {
+		for off := start; off+8 <= end; off += 8 {
+			switch string(h.bins[off+4 : off+6]) {
+			case "nk":
+				if k, err := h.key(off); err == nil && k.Name != "" {
+					k.Deleted = true
+					res.Keys = append(res.Keys, k)
+				}
+			case "vk":
+				if v, err := h.value(off); err == nil {
+					v.Deleted = true
+					res.Values = append(res.Values, DeletedValue{Value: v, Offset: off})
+				}
+			}
+		}
+	})
+
+	// 已删除键的值列表通常与vk一同被释放，仍可读取时用于关联值的所属键。
+	owners := make(map[uint32]*HiveKey)
+	for _, k := range res.Keys {
+		offs, _ := k.valueOffsets()
+		for _, off := range offs {
+			owners[off] = k
+		}
+	}
+	for i := range res.Values {
+		res.Values[i].Key = owners[res.Values[i].Offset]
+	}
+	return res
+}
+
+// freeCells 遍历全部hbin，对每个空闲单元格调用fn，参数为单元格的起止偏移。
+func (h *Hive) freeCells(fn func(start, end uint32)) {
+	le := binary.LittleEndian
+	for bin := 0; bin+0x20 <= len(h.bins); {
+		size := int(le.Uint32(h.bins[bin+8:]))
+		if string(h.bins[bin:bin+4]) != "hbin" || size < 0x20 || size%4096 != 0 || bin+size > len(h.bins) {
+			return
+		}
+		for off := bin + 0x20; off+4 <= bin+size; {
+			n := int(int32(le.Uint32(h.bins[off:])))
+			free := n > 0
+			if n < 0 {
+				n = -n
+			}
+			if n < 8 || n%8 != 0 || off+n > bin+size {
+				break
+			}
+			if free {
+				fn(uint32(off), uint32(off+n))
+			}
+			off += n
+		}
+		bin += size
+	}
+}
+
+// PartialPath 返回尽可能完整的路径，用于父链可能已被覆盖的已删除键。
+// 父键无法解析时以 ? 代替缺失的部分，如 ?\Run；父链完整时与Path相同。
+//   返回 - 以反斜杠分隔的路径
+func (k *HiveKey) PartialPath() string {
+	var parts []string
+	cur := k
+	for i := 0; cur.Flags&KeyHiveEntry == 0; i++ {
+		parts = append(parts, cur.Name)
+		p, err := k.hive.key(cur.parent)
+		if err != nil || i >= maxKeyDepth {
+			parts = append(parts, "?")
+			break
+		}
+		cur = p
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, `\`)
+}
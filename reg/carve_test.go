@@ -0,0 +1,115 @@
+package reg
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// deletedHive 生成一个hive并模拟删除操作：释放单元格、从父键的索引和值列表中移除。
+func deletedHive(t *testing.T) *Hive {
+	t.Helper()
+	tree := &tkey{name: "ROOT", subkeys: []*tkey{
+		{name: "Software", subkeys: []*tkey{
+			{name: "Run", values: []Value{sz("Updater", `C:\upd.exe`), sz("Evil", `C:\evil.exe`)}},
+			{name: "ZPersist", values: []Value{sz("Payload", `C:\payload.exe`)}, subkeys: []*tkey{
+				{name: "Inner", values: []Value{dword("Start", 2)}},
+			}},
+		}},
+		{name: "Old", subkeys: []*tkey{{name: "Gone", values: []Value{sz("Cmd", "whoami.exe")}}}},
+	}}
+	data := newHiveBuilder().build(tree)
+	h := mustParse(t, data)
+	le := binary.LittleEndian
+	bins := data[regfBaseBlockSize:]
+	open := func(path string) *HiveKey {
+		k, err := h.OpenKey(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	// unlinkLast 从父键的子键索引中移除最后一个子键，并将其子树所占单元格合并为一个空闲单元格。
+	unlinkLast := func(parent, child *HiveKey) {
+		le.PutUint32(bins[parent.offset+4+0x14:], parent.subkeyCount-1)
+		le.PutUint16(bins[parent.subkeyList+4+2:], uint16(parent.subkeyCount-1))
+		le.PutUint32(bins[child.offset:], parent.subkeyList-child.offset)
+	}
+	root, sw, run := open(""), open("Software"), open(`Software\Run`)
+	unlinkLast(sw, open(`Software\ZPersist`))
+	old := open("Old")
+	unlinkLast(root, old)
+	// Old的nk已被覆盖，Gone无法再关联到完整路径。
+	copy(bins[old.offset+4:], "\x00\x00")
+
+	offs, err := run.valueOffsets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	le.PutUint32(bins[run.offset+4+0x24:], 1)
+	le.PutUint32(bins[offs[1]:], uint32(-int32(le.Uint32(bins[offs[1]:]))))
+	return mustParse(t, data)
+}
+
+func TestCarve(t *testing.T) {
+	h := deletedHive(t)
+	res := h.Carve()
+
+	var paths []string
+	for _, k := range res.Keys {
+		if !k.Deleted {
+			t.Errorf("%s: Deleted = false", k.Name)
+		}
+		paths = append(paths, k.PartialPath())
+	}
+	want := []string{`Software\ZPersist`, `Software\ZPersist\Inner`, `?\Gone`}
+	if len(paths) != len(want) {
+		t.Fatalf("keys = %q, want %q", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("key %d = %q, want %q", i, paths[i], want[i])
+		}
+	}
+
+	wantValues := map[string]string{"Payload": "ZPersist", "Start": "Inner", "Evil": "", "Cmd": "Gone"}
+	if len(res.Values) != len(wantValues) {
+		t.Errorf("values = %+v", res.Values)
+	}
+	for _, v := range res.Values {
+		owner := ""
+		if v.Key != nil {
+			owner = v.Key.Name
+		}
+		if w, ok := wantValues[v.Name]; !ok || w != owner || !v.Deleted {
+			t.Errorf("value %q: owner %q, deleted %v", v.Name, owner, v.Deleted)
+		}
+	}
+
+	// 已删除键的子键和值同样带有Deleted标志。
+	sub, err := res.Keys[0].SubKeys()
+	if err != nil || len(sub) != 1 || !sub[0].Deleted {
+		t.Errorf("deleted subkeys = %+v, %v", sub, err)
+	}
+	if v, err := res.Keys[0].Value("Payload"); err != nil || !v.Deleted || v.String() != `C:\payload.exe` {
+		t.Errorf("deleted value = %+v, %v", v, err)
+	}
+
+	// 正常遍历看不到已删除的键和值。
+	sw, err := h.OpenKey("Software")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := sw.SubKeys(); len(keys) != 1 || keys[0].Name != "Run" || keys[0].Deleted {
+		t.Errorf("Software subkeys = %+v", keys)
+	}
+	run, _ := sw.SubKey("Run")
+	if values, _ := run.Values(); len(values) != 1 || values[0].Name != "Updater" {
+		t.Errorf("Run values = %+v", values)
+	}
+	if p := run.PartialPath(); p != `Software\Run` {
+		t.Errorf("PartialPath = %q", p)
+	}
+	if res := buildTestHive(t).Carve(); len(res.Keys)+len(res.Values) != 0 {
+		t.Errorf("clean hive carved %+v", res)
+	}
+}
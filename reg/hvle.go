@@ -0,0 +1,265 @@
+package reg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"os"
+	"sort"
+)
+
+const (
+	// logBaseBlockSize 是事务日志开头基本块的大小，HvLE日志项从该偏移开始。
+	logBaseBlockSize = 512
+	// hvleHeaderSize 是HvLE日志项头的大小，其后为脏页引用表。
+	hvleHeaderSize = 0x28
+	// marvinSeed 是注册表计算HvLE哈希时使用的Marvin32种子。
+	marvinSeed = 0x82EF4D887A4E55C5
+	// hbinAlign 是hbin大小和hive数据大小的对齐单位。
+	hbinAlign = 4096
+	// maxHiveDataSize 是hbin数据的最大总大小，单元格索引只有31位。
+	maxHiveDataSize = 0x80000000
+)
+
+// RecoveredPage 是从事务日志回放到hive中的一个脏页。
+type RecoveredPage struct {
+	// Offset 脏页相对第一个hbin的偏移。
+	Offset uint32
+	// Size 脏页大小。
+	Size uint32
+	// Sequence 脏页所属日志项的序列号。
+	Sequence uint32
+	// Log 来源日志在RecoverHive参数中的下标（0为.LOG1）。
+	Log int
+}
+
+// ReplayResult 描述事务日志的回放结果。
+type ReplayResult struct {
+	// Pages 按回放顺序列出的脏页，同一位置可能被较新的日志项多次覆盖。
+	Pages []RecoveredPage
+	// Entries 已回放的日志项数量。
+	Entries int
+	// Sequence 回放后hive基本块的序列号。
+	Sequence uint32
+	// Warnings 被忽略的日志或日志项及原因。
+	Warnings []string
+}
+
+// logEntry 是校验通过的HvLE日志项。
+type logEntry struct {
+	log      int
+	seq      uint32
+	dataSize uint32
+	pages    []RecoveredPage
+	data     [][]byte
+}
+
+// RecoverHive 将HvLE格式事务日志中的脏页回放到hive数据的内存副本。
+// 日志项按序列号排序，从hive次序列号开始连续回放，遇到序列号缺口、签名或哈希错误即停止；
+// 原始数据不会被修改。
+//   data - 主hive文件内容
+//   logs - 事务日志内容，通常依次为.LOG1和.LOG2，可以为空
+//   返回1 - 回放后的hive
+//   返回2 - 回放结果，列出恢复的脏页
+//   返回3 - 主hive基本块无效时的错误，成功时为nil
+func RecoverHive(data []byte, logs ...[]byte) (*Hive, *ReplayResult, error) {
+	hdr, err := parseBaseBlock(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := &ReplayResult{Sequence: hdr.SecondarySeq}
+	var entries []logEntry
+	for i, log := range logs {
+		es, warn := parseLogEntries(i, log)
+		if warn != "" {
+			res.Warnings = append(res.Warnings, warn)
+		}
+		entries = append(entries, es...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+
+	out := append([]byte(nil), data...)
+	var last *logEntry
+	next := hdr.SecondarySeq
+	for i := range entries {
+		e := &entries[i]
+		if e.seq < next {
+			// 已写入hive或在另一个日志中重复的日志项。
+			continue
+		}
+		if e.seq != next {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("log %d: expected sequence %d, got %d, stopping", e.log, next, e.seq))
+			break
+		}
+		if out, err = applyLogEntry(out, e); err != nil {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("log %d: sequence %d: %v, stopping", e.log, e.seq, err))
+			break
+		}
+		res.Pages = append(res.Pages, e.pages...)
+		res.Entries++
+		last = e
+		next++
+	}
+
+	if last != nil {
+		le := binary.LittleEndian
+		res.Sequence = last.seq + 1
+		le.PutUint32(out[4:], res.Sequence)
+		le.PutUint32(out[8:], res.Sequence)
+		le.PutUint32(out[40:], uint32(len(out)-regfBaseBlockSize))
+		le.PutUint32(out[508:], baseBlockChecksum(out))
+	}
+	h, err := ParseHive(out)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, res, nil
+}
+
+// OpenHiveWithLogs 读取hive文件，并回放同目录下的事务日志。
+//   path - hive文件路径
+//   logPaths - 事务日志路径，为空时使用存在的 path.LOG1 与 path.LOG2
+//   返回1 - 回放后的hive
+//   返回2 - 回放结果
+//   返回3 - 读取失败或主hive基本块无效时的错误，成功时为nil
+func OpenHiveWithLogs(path string, logPaths ...string) (*Hive, *ReplayResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read hive: %w", err)
+	}
+	explicit := len(logPaths) > 0
+	if !explicit {
+		logPaths = []string{path + ".LOG1", path + ".LOG2"}
+	}
+	var logs [][]byte
+	for _, p := range logPaths {
+		log, err := os.ReadFile(p)
+		if err != nil {
+			if !explicit && os.IsNotExist(err) {
+				continue
+			}
+			return nil, nil, fmt.Errorf("read log: %w", err)
+		}
+		logs = append(logs, log)
+	}
+	return RecoverHive(data, logs...)
+}
+
+// parseLogEntries 解析日志中连续有效的HvLE日志项，遇到无效项时停止并返回原因。
+func parseLogEntries(index int, log []byte) ([]logEntry, string) {
+	if len(log) < logBaseBlockSize || !bytes.Equal(log[:4], []byte("regf")) {
+		return nil, fmt.Sprintf("log %d: invalid base block", index)
+	}
+	le := binary.LittleEndian
+	var entries []logEntry
+	for p := logBaseBlockSize; p+hvleHeaderSize <= len(log); {
+		if !bytes.Equal(log[p:p+4], []byte("HvLE")) {
+			// 未使用的日志区域为零填充。
+			return entries, ""
+		}
+		size := int(le.Uint32(log[p+4:]))
+		if size < hvleHeaderSize || size%512 != 0 || p+size > len(log) {
+			return entries, fmt.Sprintf("log %d: entry at 0x%X: invalid size %d", index, p, size)
+		}
+		raw := log[p : p+size]
+		if marvin32(marvinSeed, raw[:0x20]) != le.Uint64(raw[0x20:]) ||
+			marvin32(marvinSeed, raw[hvleHeaderSize:]) != le.Uint64(raw[0x18:]) {
+			return entries, fmt.Sprintf("log %d: entry at 0x%X: hash mismatch", index, p)
+		}
+		e := logEntry{log: index, seq: le.Uint32(raw[0x0C:]), dataSize: le.Uint32(raw[0x10:])}
+		if e.dataSize%hbinAlign != 0 || e.dataSize > maxHiveDataSize {
+			return entries, fmt.Sprintf("log %d: entry at 0x%X: invalid hive data size 0x%X", index, p, e.dataSize)
+		}
+		n := int(le.Uint32(raw[0x14:]))
+		data := hvleHeaderSize + 8*n
+		if n < 0 || data > size {
+			return entries, fmt.Sprintf("log %d: entry at 0x%X: %d dirty pages exceed entry", index, p, n)
+		}
+		for i := 0; i < n; i++ {
+			pg := RecoveredPage{
+				Offset:   le.Uint32(raw[hvleHeaderSize+8*i:]),
+				Size:     le.Uint32(raw[hvleHeaderSize+8*i+4:]),
+				Sequence: e.seq,
+				Log:      index,
+			}
+			if pg.Size == 0 || pg.Size%512 != 0 || pg.Offset%512 != 0 {
+				return entries, fmt.Sprintf("log %d: entry at 0x%X: dirty page 0x%X has unaligned size %d", index, p, pg.Offset, pg.Size)
+			}
+			if int64(data)+int64(pg.Size) > int64(size) || uint64(pg.Offset)+uint64(pg.Size) > uint64(e.dataSize) {
+				return entries, fmt.Sprintf("log %d: entry at 0x%X: dirty page 0x%X out of range", index, p, pg.Offset)
+			}
+			e.pages = append(e.pages, pg)
+			e.data = append(e.data, raw[data:data+int(pg.Size)])
+			data += int(pg.Size)
+		}
+		if len(entries) > 0 && e.seq != entries[len(entries)-1].seq+1 {
+			return entries, fmt.Sprintf("log %d: entry at 0x%X: sequence %d is not consecutive", index, p, e.seq)
+		}
+		entries = append(entries, e)
+		p += size
+	}
+	return entries, ""
+}
+
+// applyLogEntry 按日志项记录的hbin总大小截断hive，并写入全部脏页。
+// 日志项头中的大小不可信，hive只增长到最后一个脏页的结尾，超出部分本来就没有数据。
+// 新增的hbin整体都是脏页，因此增长量不会超过日志项携带的页数据；
+// 超出时说明脏页之间留有无数据的空洞，返回错误且不修改hive。
+func applyLogEntry(hive []byte, e *logEntry) ([]byte, error) {
+	size := len(hive)
+	if n := regfBaseBlockSize + int(e.dataSize); n < size {
+		size = n
+	}
+	limit := size
+	for _, pg := range e.pages {
+		limit += int(pg.Size)
+	}
+	for _, pg := range e.pages {
+		if regfBaseBlockSize+int(pg.Offset)+int(pg.Size) > limit {
+			return hive, fmt.Errorf("dirty page 0x%X grows the hive beyond the logged data", pg.Offset)
+		}
+	}
+	hive = hive[:size]
+	for _, pg := range e.pages {
+		if end := regfBaseBlockSize + int(pg.Offset) + int(pg.Size); end > len(hive) {
+			hive = append(hive, make([]byte, end-len(hive))...)
+		}
+	}
+	for i, pg := range e.pages {
+		copy(hive[regfBaseBlockSize+int(pg.Offset):], e.data[i])
+	}
+	return hive, nil
+}
+
+// marvin32 计算Marvin32哈希的64位结果。
+func marvin32(seed uint64, data []byte) uint64 {
+	lo, hi := uint32(seed), uint32(seed>>32)
+	block := func() {
+		hi ^= lo
+		lo = bits.RotateLeft32(lo, 20)
+		lo += hi
+		hi = bits.RotateLeft32(hi, 9)
+		hi ^= lo
+		lo = bits.RotateLeft32(lo, 27)
+		lo += hi
+		hi = bits.RotateLeft32(hi, 19)
+	}
+	for ; len(data) >= 4; data = data[4:] {
+		lo += binary.LittleEndian.Uint32(data)
+		block()
+	}
+	switch len(data) {
+	case 0:
+		lo += 0x80
+	case 1:
+		lo += 0x8000 | uint32(data[0])
+	case 2:
+		lo += 0x800000 | uint32(binary.LittleEndian.Uint16(data))
+	case 3:
+		lo += 0x80000000 | uint32(data[2])<<16 | uint32(binary.LittleEndian.Uint16(data))
+	}
+	block()
+	block()
+	return uint64(hi)<<32 | uint64(lo)
+}
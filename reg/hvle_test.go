@@ -0,0 +1,268 @@
+package reg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// hvleEntry 生成一个HvLE日志项，包含next相对prev发生变化的全部4096字节页。
+func hvleEntry(seq uint32, prev, next []byte) ([]byte, []RecoveredPage) {
+	le := binary.LittleEndian
+	var refs, data []byte
+	var pages []RecoveredPage
+	bins := next[regfBaseBlockSize:]
+	for off := 0; off < len(bins); off += 4096 {
+		page := bins[off : off+4096]
+		if regfBaseBlockSize+off+4096 <= len(prev) && bytes.Equal(page, prev[regfBaseBlockSize+off:regfBaseBlockSize+off+4096]) {
+			continue
+		}
+		refs = le.AppendUint32(refs, uint32(off))
+		refs = le.AppendUint32(refs, 4096)
+		data = append(data, page...)
+		pages = append(pages, RecoveredPage{Offset: uint32(off), Size: 4096, Sequence: seq})
+	}
+	return sealEntry(seq, uint32(len(bins)), len(pages), refs, data), pages
+}
+
+// sealEntry 拼装HvLE日志项头、脏页引用表和页数据，并计算两个哈希。
+func sealEntry(seq, dataSize uint32, n int, refs, data []byte) []byte {
+	le := binary.LittleEndian
+	size := (hvleHeaderSize + len(refs) + len(data) + 511) &^ 511
+	e := make([]byte, size)
+	copy(e, "HvLE")
+	le.PutUint32(e[4:], uint32(size))
+	le.PutUint32(e[0x0C:], seq)
+	le.PutUint32(e[0x10:], dataSize)
+	le.PutUint32(e[0x14:], uint32(n))
+	copy(e[hvleHeaderSize:], refs)
+	copy(e[hvleHeaderSize+len(refs):], data)
+	le.PutUint64(e[0x18:], marvin32(marvinSeed, e[hvleHeaderSize:]))
+	le.PutUint64(e[0x20:], marvin32(marvinSeed, e[:0x20]))
+	return e
+}
+
+// pageEntry 生成只包含给定脏页的HvLE日志项，页内容为零。
+func pageEntry(seq, dataSize uint32, pages ...RecoveredPage) []byte {
+	var refs []byte
+	var size int
+	for _, pg := range pages {
+		refs = binary.LittleEndian.AppendUint32(refs, pg.Offset)
+		refs = binary.LittleEndian.AppendUint32(refs, pg.Size)
+		size += int(pg.Size)
+	}
+	return sealEntry(seq, dataSize, len(pages), refs, make([]byte, size))
+}
+
+// withDataSize 修改日志项头中的hive数据大小并重新计算头哈希。
+func withDataSize(e []byte, size uint32) []byte {
+	e = append([]byte(nil), e...)
+	binary.LittleEndian.PutUint32(e[0x10:], size)
+	binary.LittleEndian.PutUint64(e[0x20:], marvin32(marvinSeed, e[:0x20]))
+	return e
+}
+
+// logFile 将日志项拼接为HvLE格式的事务日志文件。
+func logFile(entries ...[]byte) []byte {
+	log := make([]byte, logBaseBlockSize)
+	copy(log, "regf")
+	for _, e := range entries {
+		log = append(log, e...)
+	}
+	return log
+}
+
+// dirtyHives 返回标记为脏的原始hive以及两次修改后的内容。
+func dirtyHives(t *testing.T) (orig, mod1, mod2 []byte) {
+	t.Helper()
+	orig = newHiveBuilder().build(testTree())
+	mod1 = bytes.Replace(orig, utf16le(`C:\alpha.exe`), utf16le(`C:\evil_.exe`), 1)
+	mod2 = bytes.Replace(mod1, utf16le("kerberos"), utf16le("mimikatz"), 1)
+	if bytes.Equal(orig, mod1) || bytes.Equal(mod1, mod2) {
+		t.Fatal("test values not found in hive")
+	}
+	binary.LittleEndian.PutUint32(orig[4:], 8)
+	binary.LittleEndian.PutUint32(orig[508:], baseBlockChecksum(orig))
+	return orig, mod1, mod2
+}
+
+func checkRecovered(t *testing.T, h *Hive, image, pkgs string) {
+	t.Helper()
+	if !h.Header.ChecksumValid {
+		t.Errorf("header = %+v", h.Header)
+	}
+	k, err := h.OpenKey(`ControlSet001\Services\Alpha`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := k.Value("ImagePath"); v.String() != image {
+		t.Errorf("ImagePath = %q, want %q", v.String(), image)
+	}
+	k, err = h.OpenKey(`ControlSet001\Control\Lsa`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := k.Value("Security Packages"); v.String() != pkgs {
+		t.Errorf("Security Packages = %q, want %q", v.String(), pkgs)
+	}
+}
+
+func TestRecoverHive(t *testing.T) {
+	orig, mod1, mod2 := dirtyHives(t)
+	e7, p7 := hvleEntry(7, orig, mod1)
+	e8, p8 := hvleEntry(8, mod1, mod2)
+
+	h, res, err := RecoverHive(orig, logFile(e7, e8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRecovered(t, h, `C:\evil_.exe`, "mimikatz, msv1_0")
+	if want := append(append([]RecoveredPage(nil), p7...), p8...); !reflect.DeepEqual(res.Pages, want) {
+		t.Errorf("pages = %+v, want %+v", res.Pages, want)
+	}
+	if res.Entries != 2 || res.Sequence != 9 || h.Header.PrimarySeq != 9 || h.Header.Dirty() || len(res.Warnings) != 0 {
+		t.Errorf("result = %+v", res)
+	}
+	if !bytes.Equal(h.data[regfBaseBlockSize:], mod2[regfBaseBlockSize:]) {
+		t.Error("replayed bins differ from modified hive")
+	}
+	if binary.LittleEndian.Uint32(orig[8:]) != 7 || !bytes.Contains(orig, utf16le("kerberos")) {
+		t.Error("input hive modified")
+	}
+
+	// 日志项分布在两个日志中时按序列号回放。
+	h, res, err = RecoverHive(orig, logFile(e8), logFile(e7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRecovered(t, h, `C:\evil_.exe`, "mimikatz, msv1_0")
+	if res.Entries != 2 || res.Pages[0].Log != 1 || res.Pages[len(res.Pages)-1].Log != 0 {
+		t.Errorf("two logs: %+v", res)
+	}
+
+	// 没有日志时原样返回。
+	h, res, err = RecoverHive(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Header.Dirty() || res.Entries != 0 || res.Sequence != 7 {
+		t.Errorf("no logs: header = %+v, result = %+v", h.Header, res)
+	}
+}
+
+func TestRecoverHiveInvalidEntries(t *testing.T) {
+	orig, mod1, mod2 := dirtyHives(t)
+	e6, _ := hvleEntry(6, orig, mod2)
+	e7, _ := hvleEntry(7, orig, mod1)
+	e8, _ := hvleEntry(8, mod1, mod2)
+	e9, _ := hvleEntry(9, mod1, mod2)
+
+	tests := []struct {
+		name  string
+		logs  [][]byte
+		image string
+		pkgs  string
+		n     int
+		warn  string
+	}{
+		{"stale", [][]byte{logFile(e6)}, `C:\alpha.exe`, "kerberos, msv1_0", 0, ""},
+		{"gap in log", [][]byte{logFile(e7, e9)}, `C:\evil_.exe`, "kerberos, msv1_0", 1, "not consecutive"},
+		{"gap across logs", [][]byte{logFile(e7), logFile(e9)}, `C:\evil_.exe`, "kerberos, msv1_0", 1, "expected sequence 8, got 9"},
+		{"missing first", [][]byte{logFile(e8)}, `C:\alpha.exe`, "kerberos, msv1_0", 0, "expected sequence 7, got 8"},
+		{"bad base block", [][]byte{e7}, `C:\alpha.exe`, "kerberos, msv1_0", 0, "invalid base block"},
+		{"duplicate", [][]byte{logFile(e7), logFile(e7, e8)}, `C:\evil_.exe`, "mimikatz, msv1_0", 2, ""},
+		{"oversized", [][]byte{logFile(e7, withDataSize(e8, 0xFFFFF000))}, `C:\evil_.exe`, "kerberos, msv1_0", 1, "invalid hive data size 0xFFFFF000"},
+		{"unaligned", [][]byte{logFile(withDataSize(e7, uint32(len(orig))-regfBaseBlockSize+512))}, `C:\alpha.exe`, "kerberos, msv1_0", 0, "invalid hive data size"},
+		{"empty page", [][]byte{logFile(pageEntry(7, maxHiveDataSize, RecoveredPage{Offset: maxHiveDataSize - 4096}))}, `C:\alpha.exe`, "kerberos, msv1_0", 0, "unaligned size 0"},
+		{"unaligned page", [][]byte{logFile(pageEntry(7, maxHiveDataSize, RecoveredPage{Offset: 4096, Size: 100}))}, `C:\alpha.exe`, "kerberos, msv1_0", 0, "unaligned size 100"},
+		{"sparse growth", [][]byte{logFile(e7, pageEntry(8, maxHiveDataSize, RecoveredPage{Offset: maxHiveDataSize - 4096, Size: 4096}))}, `C:\evil_.exe`, "kerberos, msv1_0", 1, "beyond the logged data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, res, err := RecoverHive(orig, tt.logs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkRecovered(t, h, tt.image, tt.pkgs)
+			if res.Entries != tt.n {
+				t.Errorf("entries = %d, want %d", res.Entries, tt.n)
+			}
+			if got := strings.Join(res.Warnings, "; "); tt.warn == "" && got != "" || !strings.Contains(got, tt.warn) {
+				t.Errorf("warnings = %q, want %q", got, tt.warn)
+			}
+		})
+	}
+
+	// 哈希错误的日志项及其后的日志项不会被回放。
+	bad := append([]byte(nil), e8...)
+	bad[len(bad)-1] ^= 0xFF
+	_, res, err := RecoverHive(orig, logFile(e7, bad))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Entries != 1 || len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "hash mismatch") {
+		t.Errorf("bad hash: %+v", res)
+	}
+
+	// 头中声明的大小只是上限，hive不会超出最后一个脏页增长。
+	h, res, err := RecoverHive(orig, logFile(withDataSize(e7, 0x40000000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Entries != 1 || len(h.data) != len(mod1) || h.Header.DataSize != uint32(len(mod1)-regfBaseBlockSize) {
+		t.Errorf("large data size: %d bytes, header %+v", len(h.data), h.Header)
+	}
+
+	if _, _, err := RecoverHive([]byte("junk"), logFile(e7)); err != ErrHiveSignature {
+		t.Errorf("bad hive err = %v", err)
+	}
+}
+
+func TestOpenHiveWithLogs(t *testing.T) {
+	orig, mod1, mod2 := dirtyHives(t)
+	e7, _ := hvleEntry(7, orig, mod1)
+	e8, _ := hvleEntry(8, mod1, mod2)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "SYSTEM")
+	for name, data := range map[string][]byte{path: orig, path + ".LOG1": logFile(e7, e8)} {
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h, res, err := OpenHiveWithLogs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRecovered(t, h, `C:\evil_.exe`, "mimikatz, msv1_0")
+	if res.Entries != 2 {
+		t.Errorf("entries = %d", res.Entries)
+	}
+	if _, _, err := OpenHiveWithLogs(path, path+".LOG2"); !os.IsNotExist(errors.Unwrap(err)) {
+		t.Errorf("explicit missing log err = %v", err)
+	}
+}
+
+func TestMarvin32(t *testing.T) {
+	const seed = 0x004FB61A001BDBCC
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0x30ED35C100CD3C7D},
+		{"af", 0x48E73FC77D75DDC1},
+		{"e70f", 0xB5F6E1FC485DBFF8},
+		{"37f495", 0xF0B07C789B8CF7E8},
+	}
+	for _, tt := range tests {
+		in, _ := hex.DecodeString(tt.in)
+		if got := marvin32(seed, in); got != tt.want {
+			t.Errorf("marvin32(%s) = %016X, want %016X", tt.in, got, tt.want)
+		}
+	}
+}
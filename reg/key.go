@@ -0,0 +1,111 @@
+package reg
+
+import (
+	"fmt"
+	"time"
+)
+
+// Key 是与存储后端无关的只读注册表键，由本机注册表（OpenLiveKey）、离线hive（Hive.Key）
+// 和内存树（MemKey）实现，使同一段提取逻辑可以在Windows主机、采集的hive文件和测试中运行。
+type Key interface {
+	// Name 返回键名称，根键为后端定义的名称。
+	Name() string
+	// Path 返回键路径：本机注册表为含根键的完整路径，hive与内存树为相对根键的路径。
+	Path() string
+	// LastWrite 返回最后写入时间，后端不支持时为零值。
+	LastWrite() time.Time
+	// OpenSubKey 按反斜杠分隔的相对路径打开子键，不区分大小写；不存在时返回ErrKeyNotFound。
+	OpenSubKey(path string) (Key, error)
+	// SubKeyNames 返回直接子键的名称。
+	SubKeyNames() ([]string, error)
+	// Values 返回全部值。
+	Values() ([]Value, error)
+	// Value 按名称读取值，空名称为默认值；不存在时返回ErrValueNotFound。
+	Value(name string) (Value, error)
+	// Close 释放键占用的资源，hive与内存树的实现为空操作。
+	Close() error
+}
+
+// Walk 先序遍历键及其全部子键，fn返回错误时停止遍历并返回该错误。
+// 无法打开的子键会作为错误返回，子键在遍历时被关闭，fn不应保留其引用。
+//   k - 起始键
+//   fn - 对每个键调用的函数
+//   返回 - fn或后端返回的第一个错误，成功时为nil
+func Walk(k Key, fn func(k Key) error) error {
+	return walk(k, fn, 0)
+}
+
+func walk(k Key, fn func(k Key) error, depth int) error {
+	if depth > maxKeyDepth {
+		return fmt.Errorf("reg: %s: key nested too deep", k.Path())
+	}
+	if err := fn(k); err != nil {
+		return err
+	}
+	names, err := k.SubKeyNames()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		sub, err := k.OpenSubKey(name)
+		if err != nil {
+			return err
+		}
+		err = walk(sub, fn, depth+1)
+		sub.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hiveKey 将HiveKey适配为Key接口。
+type hiveKey struct {
+	k    *HiveKey
+	path string
+}
+
+// Key 按相对根键的路径打开键，返回Key接口形式，空路径为根键。
+//   path - 子键路径，如 ControlSet001\Services
+//   返回1 - 键
+//   返回2 - 子键不存在时为ErrKeyNotFound，hive损坏时为其他错误
+func (h *Hive) Key(path string) (Key, error) {
+	k, err := h.OpenKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return &hiveKey{k: k, path: k.PartialPath()}, nil
+}
+
+func (k *hiveKey) Name() string { return k.k.Name }
+
+func (k *hiveKey) Path() string { return k.path }
+
+func (k *hiveKey) LastWrite() time.Time { return k.k.LastWrite }
+
+func (k *hiveKey) OpenSubKey(path string) (Key, error) {
+	sub, err := k.k.OpenKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return &hiveKey{k: sub, path: sub.PartialPath()}, nil
+}
+
+func (k *hiveKey) SubKeyNames() ([]string, error) {
+	keys, err := k.k.SubKeys()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(keys))
+	for i, sk := range keys {
+		names[i] = sk.Name
+	}
+	return names, nil
+}
+
+func (k *hiveKey) Values() ([]Value, error) { return k.k.Values() }
+
+func (k *hiveKey) Value(name string) (Value, error) { return k.k.Value(name) }
+
+func (k *hiveKey) Close() error { return nil }
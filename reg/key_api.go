@@ -0,0 +1,128 @@
+//go:build windows
+
+package reg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// liveKey 是本机注册表中已打开的键。
+type liveKey struct {
+	k    registry.Key
+	path string
+}
+
+// OpenLiveKey 以只读方式打开本机注册表键，返回Key接口形式，使用完毕后需调用Close。
+//   path - 完整的注册表路径（如 HKLM\Software\Microsoft），也可以只是根键（如 HKLM）
+//   返回1 - 键
+//   返回2 - 键不存在时为ErrKeyNotFound，其他情况为打开失败的错误
+func OpenLiveKey(path string) (Key, error) {
+	rootKey, ok := rootKeyMap[strings.ToUpper(path)]
+	subPath := ""
+	if !ok {
+		var err error
+		if rootKey, subPath, err = parsePath(path); err != nil {
+			return nil, err
+		}
+	}
+	k, err := registry.OpenKey(rootKey, subPath, registry.READ)
+	if err != nil {
+		return nil, openKeyError(path, err)
+	}
+	return &liveKey{k: k, path: path}, nil
+}
+
+func openKeyError(path string, err error) error {
+	if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, path)
+	}
+	return fmt.Errorf("open key failed: %w", err)
+}
+
+func (l *liveKey) Name() string {
+	for i := len(l.path) - 1; i >= 0; i-- {
+		if l.path[i] == '\\' {
+			return l.path[i+1:]
+		}
+	}
+	return l.path
+}
+
+func (l *liveKey) Path() string { return l.path }
+
+func (l *liveKey) LastWrite() time.Time {
+	info, err := l.k.Stat()
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime().UTC()
+}
+
+func (l *liveKey) OpenSubKey(path string) (Key, error) {
+	full := l.path + `\` + path
+	k, err := registry.OpenKey(l.k, path, registry.READ)
+	if err != nil {
+		return nil, openKeyError(full, err)
+	}
+	return &liveKey{k: k, path: full}, nil
+}
+
+func (l *liveKey) SubKeyNames() ([]string, error) {
+	names, err := l.k.ReadSubKeyNames(0)
+	if err != nil {
+		return nil, fmt.Errorf("read subkey names failed: %w", err)
+	}
+	return names, nil
+}
+
+func (l *liveKey) Values() ([]Value, error) {
+	names, err := l.k.ReadValueNames(0)
+	if err != nil {
+		return nil, fmt.Errorf("read value names failed: %w", err)
+	}
+	values := make([]Value, 0, len(names))
+	for _, name := range names {
+		v, err := l.Value(name)
+		if err != nil {
+			// 枚举与读取之间被删除的值。
+			continue
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (l *liveKey) Value(name string) (Value, error) {
+	return readValue(l.k, name)
+}
+
+// readValue 读取值的类型和原始数据。
+func readValue(k registry.Key, name string) (Value, error) {
+	for {
+		size, _, err := k.GetValue(name, nil)
+		if err != nil {
+			if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+				return Value{}, fmt.Errorf("%w: %s", ErrValueNotFound, name)
+			}
+			return Value{}, err
+		}
+		buf := make([]byte, size)
+		n, t, err := k.GetValue(name, buf)
+		if errors.Is(err, registry.ErrShortBuffer) {
+			// 两次读取之间值变大，重新获取大小。
+			continue
+		}
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Name: name, Type: ValueType(t), Data: buf[:n]}, nil
+	}
+}
+
+func (l *liveKey) Close() error { return l.k.Close() }
@@ -0,0 +1,147 @@
+package reg
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// serviceImages 是一段与后端无关的提取逻辑：读取每个服务的ImagePath。
+func serviceImages(system Key) (map[string]string, error) {
+	services, err := system.OpenSubKey(`ControlSet001\Services`)
+	if err != nil {
+		return nil, err
+	}
+	defer services.Close()
+	names, err := services.SubKeyNames()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]string)
+	for _, name := range names {
+		svc, err := services.OpenSubKey(name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := svc.Value("imagepath")
+		svc.Close()
+		if errors.Is(err, ErrValueNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out[name] = v.String()
+	}
+	return out, nil
+}
+
+func TestKeyBackends(t *testing.T) {
+	want := map[string]string{"Alpha": `C:\alpha.exe`, "Beta": `%SystemRoot%\beta.sys`}
+
+	hive, err := buildTestHive(t).Key("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemKey("SYSTEM")
+	mem.CreateKey(`ControlSet001\Services\Gamma`)
+	mem.CreateKey(`ControlSet001\Services\Beta`).SetValue(Value{Name: "ImagePath", Type: REG_EXPAND_SZ, Data: utf16le(`%SystemRoot%\beta.sys` + "\x00")})
+	mem.CreateKey(`controlset001\services\Alpha`).SetValue(sz("ImagePath", `C:\alpha.exe`))
+
+	for name, k := range map[string]Key{"hive": hive, "mem": mem} {
+		got, err := serviceImages(k)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: images = %v, want %v", name, got, want)
+		}
+		sub, err := k.OpenSubKey(`ControlSet001\Services\alpha`)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if sub.Name() != "Alpha" || sub.Path() != `ControlSet001\Services\Alpha` {
+			t.Errorf("%s: name %q, path %q", name, sub.Name(), sub.Path())
+		}
+		if _, err := k.OpenSubKey(`ControlSet001\Missing`); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("%s: missing key err = %v", name, err)
+		}
+	}
+	if lw := hive.LastWrite(); !lw.Equal(testWriteTime) {
+		t.Errorf("hive LastWrite = %v", lw)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	hive, err := buildTestHive(t).Key("ControlSet001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	err = Walk(hive, func(k Key) error {
+		paths = append(paths, k.Path())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`ControlSet001`, `ControlSet001\Services`, `ControlSet001\Services\Alpha`, `ControlSet001\Services\Beta`,
+		`ControlSet001\Services\Gamma`, `ControlSet001\Control`, `ControlSet001\Control\Lsa`,
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("walk = %q, want %q", paths, want)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = Walk(hive, func(k Key) error {
+		if n++; k.Name() == "Beta" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 4 {
+		t.Errorf("Walk stop: err = %v after %d keys", err, n)
+	}
+}
+
+func TestMemKey(t *testing.T) {
+	f, err := ParseRegFile([]byte(sampleRegFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := NewMemKey("")
+	stale := root.CreateKey(`HKEY_CURRENT_USER\Software\Stale\Sub`)
+	run := root.CreateKey(`HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows\CurrentVersion\Run`)
+	run.SetValue(sz("OLD", "x"))
+	root.ImportRegFile(f)
+
+	if _, err := root.OpenSubKey(`HKEY_CURRENT_USER\Software\Stale`); !errors.Is(err, ErrKeyNotFound) || stale == nil {
+		t.Errorf("deleted key err = %v", err)
+	}
+	values, _ := run.Values()
+	if len(values) != 2 || values[0].Name != "Updater" || values[1].Name != "" {
+		t.Errorf("Run values = %+v", values)
+	}
+	if _, err := run.Value("old"); !errors.Is(err, ErrValueNotFound) {
+		t.Errorf("deleted value err = %v", err)
+	}
+	names, _ := root.SubKeyNames()
+	if !reflect.DeepEqual(names, []string{"HKEY_CURRENT_USER", "HKEY_LOCAL_MACHINE"}) {
+		t.Errorf("root subkeys = %q", names)
+	}
+	svc, err := root.OpenSubKey(`HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Services\Evil`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := svc.Value("Start"); err != nil || v.String() != "2 (0x2)" {
+		t.Errorf("Start = %v, %v", v, err)
+	}
+	if root.DeleteKey(`HKEY_LOCAL_MACHINE\Nope`) || !root.DeleteKey(`hkey_local_machine\SYSTEM`) {
+		t.Error("DeleteKey result")
+	}
+	if names, _ := root.CreateKey("HKEY_LOCAL_MACHINE").SubKeyNames(); !reflect.DeepEqual(names, []string{"SOFTWARE"}) {
+		t.Errorf("HKLM subkeys = %q", names)
+	}
+}
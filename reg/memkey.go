@@ -0,0 +1,191 @@
+package reg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MemKey 是内存中的注册表键树，实现Key接口，用于测试或承载从其他来源整理的数据。
+// 子键按名称大写排序，与hive中的子键索引顺序一致；名称比较不区分大小写。
+type MemKey struct {
+	name      string
+	path      string
+	lastWrite time.Time
+	subkeys   []*MemKey
+	values    []Value
+}
+
+// NewMemKey 创建一个空的内存根键，路径为空字符串。
+//   name - 根键名称
+//   返回 - 根键
+func NewMemKey(name string) *MemKey {
+	return &MemKey{name: name}
+}
+
+// Name 返回键名称。
+func (k *MemKey) Name() string { return k.name }
+
+// Path 返回相对根键的路径，根键为空字符串。
+func (k *MemKey) Path() string { return k.path }
+
+// LastWrite 返回通过SetLastWrite设置的最后写入时间。
+func (k *MemKey) LastWrite() time.Time { return k.lastWrite }
+
+// SetLastWrite 设置最后写入时间。
+//   t - 最后写入时间
+func (k *MemKey) SetLastWrite(t time.Time) { k.lastWrite = t }
+
+// Close 为空操作。
+func (k *MemKey) Close() error { return nil }
+
+// CreateKey 按相对路径创建子键，中间的键自动创建，已存在的键直接返回。
+//   path - 反斜杠分隔的相对路径
+//   返回 - 路径最后一级的键
+func (k *MemKey) CreateKey(path string) *MemKey {
+	cur := k
+	for _, part := range strings.Split(path, `\`) {
+		if part == "" {
+			continue
+		}
+		next := cur.child(part)
+		if next == nil {
+			next = &MemKey{name: part, path: part}
+			if cur.path != "" {
+				next.path = cur.path + `\` + part
+			}
+			cur.subkeys = append(cur.subkeys, next)
+			sort.SliceStable(cur.subkeys, func(i, j int) bool {
+				return strings.ToUpper(cur.subkeys[i].name) < strings.ToUpper(cur.subkeys[j].name)
+			})
+		}
+		cur = next
+	}
+	return cur
+}
+
+// DeleteKey 删除相对路径指定的键及其全部子键。
+//   path - 反斜杠分隔的相对路径
+//   返回 - 键存在并被删除时为true
+func (k *MemKey) DeleteKey(path string) bool {
+	i := strings.LastIndex(path, `\`)
+	parent := k
+	if i >= 0 {
+		p, err := k.open(path[:i])
+		if err != nil {
+			return false
+		}
+		parent = p
+	}
+	name := path[i+1:]
+	for j, sk := range parent.subkeys {
+		if strings.EqualFold(sk.name, name) {
+			parent.subkeys = append(parent.subkeys[:j], parent.subkeys[j+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SetValue 写入值，已存在同名值（不区分大小写）时替换。
+//   v - 值
+func (k *MemKey) SetValue(v Value) {
+	for i := range k.values {
+		if strings.EqualFold(k.values[i].Name, v.Name) {
+			k.values[i] = v
+			return
+		}
+	}
+	k.values = append(k.values, v)
+}
+
+// DeleteValue 删除值。
+//   name - 值名称
+//   返回 - 值存在并被删除时为true
+func (k *MemKey) DeleteValue(name string) bool {
+	for i := range k.values {
+		if strings.EqualFold(k.values[i].Name, name) {
+			k.values = append(k.values[:i], k.values[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ImportRegFile 按regedit的语义将.reg文件应用到内存树，键路径（含根键名）作为相对路径。
+//   f - 解析后的.reg文件
+func (k *MemKey) ImportRegFile(f *RegFile) {
+	for _, rk := range f.Keys {
+		if rk.Delete {
+			k.DeleteKey(rk.Path)
+			continue
+		}
+		sub := k.CreateKey(rk.Path)
+		for _, v := range rk.Values {
+			if v.Delete {
+				sub.DeleteValue(v.Name)
+			} else {
+				sub.SetValue(v.Value)
+			}
+		}
+	}
+}
+
+// OpenSubKey 按相对路径打开子键，不区分大小写。
+//   path - 反斜杠分隔的相对路径
+//   返回1 - 子键（*MemKey）
+//   返回2 - 子键不存在时为ErrKeyNotFound
+func (k *MemKey) OpenSubKey(path string) (Key, error) {
+	sub, err := k.open(path)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (k *MemKey) open(path string) (*MemKey, error) {
+	cur := k
+	for _, part := range strings.Split(path, `\`) {
+		if part == "" {
+			continue
+		}
+		if cur = cur.child(part); cur == nil {
+			return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, path)
+		}
+	}
+	return cur, nil
+}
+
+func (k *MemKey) child(name string) *MemKey {
+	for _, sk := range k.subkeys {
+		if strings.EqualFold(sk.name, name) {
+			return sk
+		}
+	}
+	return nil
+}
+
+// SubKeyNames 返回直接子键的名称。
+func (k *MemKey) SubKeyNames() ([]string, error) {
+	names := make([]string, len(k.subkeys))
+	for i, sk := range k.subkeys {
+		names[i] = sk.name
+	}
+	return names, nil
+}
+
+// Values 返回全部值的副本，顺序与写入顺序一致。
+func (k *MemKey) Values() ([]Value, error) {
+	return append([]Value(nil), k.values...), nil
+}
+
+// Value 按名称读取值，不区分大小写。
+func (k *MemKey) Value(name string) (Value, error) {
+	for _, v := range k.values {
+		if strings.EqualFold(v.Name, name) {
+			return v, nil
+		}
+	}
+	return Value{}, fmt.Errorf("%w: %s", ErrValueNotFound, name)
+}
@@ -0,0 +1,520 @@
+package reg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// tkey 描述测试hive中的一个键。
+type tkey struct {
+	name    string
+	class   string
+	list    string // 子键索引类型：lh（默认）、lf、li或ri
+	values  []Value
+	subkeys []*tkey
+}
+
+// hiveBuilder 在单个hbin中按顺序分配单元格，生成测试用的hive文件。
+type hiveBuilder struct {
+	bins  []byte
+	minor uint32
+	sk    uint32
+}
+
+var testWriteTime = time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+func newHiveBuilder() *hiveBuilder {
+	b := &hiveBuilder{bins: make([]byte, 0x20), minor: 5}
+	copy(b.bins, "hbin")
+	return b
+}
+
+// alloc 分配一个已使用的单元格并返回其偏移。
+func (b *hiveBuilder) alloc(data []byte) uint32 {
+	size := (len(data) + 4 + 7) &^ 7
+	off := uint32(len(b.bins))
+	cell := make([]byte, size)
+	binary.LittleEndian.PutUint32(cell, uint32(-int32(size)))
+	copy(cell[4:], data)
+	b.bins = append(b.bins, cell...)
+	return off
+}
+
+func (b *hiveBuilder) put32(off uint32, pos int, v uint32) {
+	binary.LittleEndian.PutUint32(b.bins[int(off)+4+pos:], v)
+}
+
+func utf16le(s string) []byte {
+	var buf bytes.Buffer
+	for _, u := range utf16.Encode([]rune(s)) {
+		binary.Write(&buf, binary.LittleEndian, u)
+	}
+	return buf.Bytes()
+}
+
+func isASCII(s string) bool {
+	for _, r := range s {
+		if r >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func filetime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100) + 116444736000000000
+}
+
+// securityDescriptor 构造所有者为Administrators、DACL允许SYSTEM完全控制与Everyone读取的描述符。
+func securityDescriptor() []byte {
+	sid := func(auth byte, subs ...uint32) []byte {
+		b := []byte{1, byte(len(subs)), 0, 0, 0, 0, 0, auth}
+		for _, s := range subs {
+			b = binary.LittleEndian.AppendUint32(b, s)
+		}
+		return b
+	}
+	owner, group := sid(5, 32, 544), sid(5, 18)
+	ace := func(mask uint32, s []byte) []byte {
+		b := []byte{0, 0x02, 0, 0}
+		binary.LittleEndian.PutUint16(b[2:], uint16(8+len(s)))
+		b = binary.LittleEndian.AppendUint32(b, mask)
+		return append(b, s...)
+	}
+	aces := append(ace(0xF003F, sid(5, 18)), ace(0x20019, sid(1, 0))...)
+	acl := []byte{2, 0, 0, 0, 2, 0, 0, 0}
+	binary.LittleEndian.PutUint16(acl[2:], uint16(8+len(aces)))
+	acl = append(acl, aces...)
+
+	sd := make([]byte, 20)
+	sd[0] = 1
+	binary.LittleEndian.PutUint16(sd[2:], SE_DACL_PRESENT|SE_SELF_RELATIVE)
+	binary.LittleEndian.PutUint32(sd[4:], 20)
+	binary.LittleEndian.PutUint32(sd[8:], uint32(20+len(owner)))
+	binary.LittleEndian.PutUint32(sd[16:], uint32(20+len(owner)+len(group)))
+	sd = append(append(append(sd, owner...), group...), acl...)
+	return sd
+}
+
+func (b *hiveBuilder) security() uint32 {
+	if b.sk == 0 {
+		sd := securityDescriptor()
+		c := make([]byte, 0x14)
+		copy(c, "sk")
+		binary.LittleEndian.PutUint32(c[0x0C:], 1)
+		binary.LittleEndian.PutUint32(c[0x10:], uint32(len(sd)))
+		b.sk = b.alloc(append(c, sd...))
+		// 单个sk单元格的链表指向自身。
+		b.put32(b.sk, 4, b.sk)
+		b.put32(b.sk, 8, b.sk)
+	}
+	return b.sk
+}
+
+// addKey 写入键及其全部子键和值，返回nk单元格偏移。
+func (b *hiveBuilder) addKey(k *tkey, parent uint32, root bool) uint32 {
+	name := []byte(k.name)
+	flags := uint16(0)
+	if isASCII(k.name) {
+		flags |= KeyCompName
+	} else {
+		name = utf16le(k.name)
+	}
+	if root {
+		flags |= KeyHiveEntry | KeyNoDelete
+	}
+	nk := make([]byte, 0x4C, 0x4C+len(name))
+	copy(nk, "nk")
+	le := binary.LittleEndian
+	le.PutUint16(nk[2:], flags)
+	le.PutUint64(nk[4:], filetime(testWriteTime))
+	le.PutUint32(nk[0x10:], parent)
+	le.PutUint32(nk[0x14:], uint32(len(k.subkeys)))
+	le.PutUint32(nk[0x1C:], noCell)
+	le.PutUint32(nk[0x20:], noCell)
+	le.PutUint32(nk[0x24:], uint32(len(k.values)))
+	le.PutUint32(nk[0x28:], noCell)
+	le.PutUint32(nk[0x2C:], b.security())
+	le.PutUint32(nk[0x30:], noCell)
+	le.PutUint16(nk[0x48:], uint16(len(name)))
+	off := b.alloc(append(nk, name...))
+
+	if k.class != "" {
+		class := utf16le(k.class)
+		b.put32(off, 0x30, b.alloc(class))
+		binary.LittleEndian.PutUint16(b.bins[int(off)+4+0x4A:], uint16(len(class)))
+	}
+	if len(k.values) > 0 {
+		list := make([]byte, 4*len(k.values))
+		for i, v := range k.values {
+			le.PutUint32(list[4*i:], b.addValue(v))
+		}
+		b.put32(off, 0x28, b.alloc(list))
+	}
+	if len(k.subkeys) > 0 {
+		var offs []uint32
+		for _, sk := range k.subkeys {
+			offs = append(offs, b.addKey(sk, off, false))
+		}
+		b.put32(off, 0x1C, b.subkeyList(k.list, offs))
+	}
+	return off
+}
+
+func (b *hiveBuilder) subkeyList(kind string, offs []uint32) uint32 {
+	if kind == "" {
+		kind = "lh"
+	}
+	if kind == "ri" {
+		half := (len(offs) + 1) / 2
+		ri := []byte("ri\x02\x00")
+		ri = binary.LittleEndian.AppendUint32(ri, b.subkeyList("li", offs[:half]))
+		ri = binary.LittleEndian.AppendUint32(ri, b.subkeyList("lf", offs[half:]))
+		return b.alloc(ri)
+	}
+	list := []byte(kind + "\x00\x00")
+	binary.LittleEndian.PutUint16(list[2:], uint16(len(offs)))
+	for _, o := range offs {
+		list = binary.LittleEndian.AppendUint32(list, o)
+		if kind != "li" {
+			list = binary.LittleEndian.AppendUint32(list, 0)
+		}
+	}
+	return b.alloc(list)
+}
+
+func (b *hiveBuilder) addValue(v Value) uint32 {
+	name := []byte(v.Name)
+	flags := uint16(1)
+	if !isASCII(v.Name) {
+		name, flags = utf16le(v.Name), 0
+	}
+	vk := make([]byte, 0x14)
+	copy(vk, "vk")
+	le := binary.LittleEndian
+	le.PutUint16(vk[2:], uint16(len(name)))
+	le.PutUint32(vk[4:], uint32(len(v.Data)))
+	le.PutUint32(vk[0x0C:], uint32(v.Type))
+	le.PutUint16(vk[0x10:], flags)
+	switch {
+	case len(v.Data) <= 4:
+		le.PutUint32(vk[4:], uint32(len(v.Data))|0x80000000)
+		copy(vk[8:12], v.Data)
+	case len(v.Data) > bigDataSegmentSize && b.minor >= 4:
+		var segs []byte
+		for p := 0; p < len(v.Data); p += bigDataSegmentSize {
+			end := p + bigDataSegmentSize
+			if end > len(v.Data) {
+				end = len(v.Data)
+			}
+			segs = le.AppendUint32(segs, b.alloc(v.Data[p:end]))
+		}
+		db := []byte("db\x00\x00")
+		le.PutUint16(db[2:], uint16(len(segs)/4))
+		db = le.AppendUint32(db, b.alloc(segs))
+		le.PutUint32(vk[8:], b.alloc(db))
+	default:
+		le.PutUint32(vk[8:], b.alloc(v.Data))
+	}
+	return b.alloc(append(vk, name...))
+}
+
+// build 写入根键并生成完整的hive文件。
+func (b *hiveBuilder) build(root *tkey) []byte {
+	rootOff := b.addKey(root, noCell, true)
+	for len(b.bins)%4096 != 0 {
+		// 剩余空间作为一个空闲单元格。
+		n := 4096 - len(b.bins)%4096
+		free := make([]byte, n)
+		binary.LittleEndian.PutUint32(free, uint32(n))
+		b.bins = append(b.bins, free...)
+	}
+	binary.LittleEndian.PutUint32(b.bins[8:], uint32(len(b.bins)))
+	base := make([]byte, 4096)
+	le := binary.LittleEndian
+	copy(base, "regf")
+	le.PutUint32(base[4:], 7)
+	le.PutUint32(base[8:], 7)
+	le.PutUint64(base[12:], filetime(testWriteTime))
+	le.PutUint32(base[20:], 1)
+	le.PutUint32(base[24:], b.minor)
+	le.PutUint32(base[32:], 1)
+	le.PutUint32(base[36:], rootOff)
+	le.PutUint32(base[40:], uint32(len(b.bins)))
+	le.PutUint32(base[44:], 1)
+	copy(base[48:112], utf16le(`System32\Config\SYSTEM`))
+	le.PutUint32(base[508:], baseBlockChecksum(base))
+	return append(base, b.bins...)
+}
+
+func sz(name, s string) Value {
+	return Value{Name: name, Type: REG_SZ, Data: utf16le(s + "\x00")}
+}
+
+func dword(name string, v uint32) Value {
+	return Value{Name: name, Type: REG_DWORD, Data: binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+// testTree 返回测试hive的键树，模拟SYSTEM hive的一部分。
+func testTree() *tkey {
+	big := bytes.Repeat([]byte("0123456789abcdef"), 1300) // 20800字节，跨两个db分段
+	return &tkey{name: "ROOT", subkeys: []*tkey{
+		{name: "ControlSet001", subkeys: []*tkey{
+			{name: "Services", list: "ri", subkeys: []*tkey{
+				{name: "Alpha", values: []Value{sz("ImagePath", `C:\alpha.exe`), dword("Start", 2)}},
+				{name: "Beta", values: []Value{
+					{Name: "ImagePath", Type: REG_EXPAND_SZ, Data: utf16le(`%SystemRoot%\beta.sys` + "\x00")},
+					dword("Start", 3),
+				}},
+				{name: "Gamma"},
+			}},
+			{name: "Control", class: "CtrlClass", list: "li", subkeys: []*tkey{{name: "Lsa", values: []Value{
+				{Name: "Security Packages", Type: REG_MULTI_SZ, Data: utf16le("kerberos\x00msv1_0\x00\x00")},
+				{Name: "Blob", Type: REG_BINARY, Data: big},
+				{Name: "Epoch", Type: REG_QWORD, Data: binary.LittleEndian.AppendUint64(nil, 0x1122334455667788)},
+			}}}},
+		}},
+		{name: "Select", list: "lf", values: []Value{
+			sz("", "default"),
+			dword("Current", 1),
+			sz("Größe", "unicode name"),
+		}},
+	}}
+}
+
+func buildTestHive(t *testing.T) *Hive {
+	t.Helper()
+	h, err := ParseHive(newHiveBuilder().build(testTree()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestOpenHive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "SYSTEM")
+	if err := os.WriteFile(path, newHiveBuilder().build(testTree()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := OpenHive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := h.Header
+	if hdr.PrimarySeq != 7 || hdr.Dirty() || !hdr.ChecksumValid || hdr.MajorVersion != 1 || hdr.MinorVersion != 5 ||
+		!hdr.LastWritten.Equal(testWriteTime) || hdr.FileName != `System32\Config\SYSTEM` {
+		t.Errorf("header = %+v", hdr)
+	}
+	root, err := h.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Name != "ROOT" || root.SubKeyCount() != 2 || !root.LastWrite.Equal(testWriteTime) {
+		t.Errorf("root = %+v", root)
+	}
+	if p, _ := root.Path(); p != "" {
+		t.Errorf("root path = %q", p)
+	}
+}
+
+func TestHiveKeys(t *testing.T) {
+	h := buildTestHive(t)
+	svc, err := h.OpenKey(`controlset001\SERVICES`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := svc.SubKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, k := range keys {
+		names = append(names, k.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Alpha", "Beta", "Gamma"}) {
+		t.Errorf("ri subkeys = %v", names)
+	}
+	beta, err := svc.SubKey("beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := beta.Path(); err != nil || p != `ControlSet001\Services\Beta` {
+		t.Errorf("Path = %q, %v", p, err)
+	}
+
+	ctrl, err := h.OpenKey(`ControlSet001\Control`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := ctrl.Class(); err != nil || c != "CtrlClass" {
+		t.Errorf("Class = %q, %v", c, err)
+	}
+	if _, err := h.OpenKey(`ControlSet001\Missing\Key`); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("missing key: err = %v", err)
+	}
+	if k, err := h.OpenKey(`\Select\`); err != nil || k.Name != "Select" {
+		t.Errorf("OpenKey with separators = %v, %v", k, err)
+	}
+}
+
+func TestHiveValues(t *testing.T) {
+	h := buildTestHive(t)
+	beta, err := h.OpenKey(`ControlSet001\Services\Beta`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := beta.Value("imagepath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := img.AsString(); err != nil || s != `%SystemRoot%\beta.sys` || img.Type != REG_EXPAND_SZ {
+		t.Errorf("ImagePath = %q (%s), %v", s, img.Type, err)
+	}
+	start, _ := beta.Value("Start")
+	if n, err := start.AsInteger(); err != nil || n != 3 {
+		t.Errorf("Start = %d, %v", n, err)
+	}
+
+	lsa, err := h.OpenKey(`ControlSet001\Control\Lsa`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := lsa.Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 3 {
+		t.Fatalf("Lsa values = %d", len(values))
+	}
+	if ss, err := values[0].AsStrings(); err != nil || !reflect.DeepEqual(ss, []string{"kerberos", "msv1_0"}) {
+		t.Errorf("Security Packages = %q, %v", ss, err)
+	}
+	if want := bytes.Repeat([]byte("0123456789abcdef"), 1300); !bytes.Equal(values[1].Data, want) {
+		t.Errorf("big data = %d bytes", len(values[1].Data))
+	}
+	if n, _ := values[2].AsInteger(); n != 0x1122334455667788 {
+		t.Errorf("QWORD = %#x", n)
+	}
+
+	sel, _ := h.OpenKey("Select")
+	def, err := sel.Value("")
+	if err != nil || def.String() != "default" {
+		t.Errorf("default value = %q, %v", def.String(), err)
+	}
+	if v, err := sel.Value("GRÖßE"); err != nil || v.String() != "unicode name" {
+		t.Errorf("UTF-16 value name = %+v, %v", v, err)
+	}
+	if _, err := sel.Value("Missing"); !errors.Is(err, ErrValueNotFound) {
+		t.Errorf("missing value: err = %v", err)
+	}
+}
+
+func TestHiveSecurityDescriptor(t *testing.T) {
+	h := buildTestHive(t)
+	k, err := h.OpenKey(`ControlSet001\Services\Alpha`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := k.SecurityDescriptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ACE{{Type: 0, Flags: 2, Mask: 0xF003F, SID: "S-1-5-18"}, {Type: 0, Flags: 2, Mask: 0x20019, SID: "S-1-1-0"}}
+	if sd.Owner != "S-1-5-32-544" || sd.Group != "S-1-5-18" || sd.SACL != nil || !reflect.DeepEqual(sd.DACL, want) {
+		t.Errorf("SecurityDescriptor = %+v", sd)
+	}
+	if _, err := ParseSecurityDescriptor(sd.Raw[:30]); err == nil {
+		t.Error("truncated descriptor accepted")
+	}
+}
+
+func TestHiveErrors(t *testing.T) {
+	data := newHiveBuilder().build(testTree())
+	if _, err := ParseHive(data[:100]); !errors.Is(err, ErrHiveSignature) {
+		t.Errorf("short hive: err = %v", err)
+	}
+	bad := append([]byte(nil), data...)
+	copy(bad, "regx")
+	if _, err := ParseHive(bad); !errors.Is(err, ErrHiveSignature) {
+		t.Errorf("bad signature: err = %v", err)
+	}
+
+	// 修改基本块后校验值失效，但仍可读取。
+	bad = append([]byte(nil), data...)
+	bad[8]++
+	h, err := ParseHive(bad)
+	if err != nil || h.Header.ChecksumValid || !h.Header.Dirty() {
+		t.Errorf("modified header = %+v, %v", h.Header, err)
+	}
+
+	// 根键指向非nk单元格。
+	bad = append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(bad[36:], 0x20)
+	var ce *CellError
+	if _, err := mustParse(t, bad).Root(); !errors.As(err, &ce) || !strings.Contains(err.Error(), `expected "nk"`) {
+		t.Errorf("bad root: err = %v", err)
+	}
+	binary.LittleEndian.PutUint32(bad[36:], 0x7FFFFFF0)
+	if _, err := mustParse(t, bad).Root(); !errors.As(err, &ce) {
+		t.Errorf("root out of range: err = %v", err)
+	}
+
+	// 大数据值声明的大小超出db分段所能容纳的范围。
+	bad = append([]byte(nil), data...)
+	vk := bytes.Index(bad, []byte("Blob")) - 0x14
+	if vk < 0 || string(bad[vk:vk+2]) != "vk" {
+		t.Fatal("Blob vk cell not found")
+	}
+	binary.LittleEndian.PutUint32(bad[vk+4:], 0x7FFFFFF0)
+	lsa, err := mustParse(t, bad).OpenKey(`ControlSet001\Control\Lsa`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lsa.Values(); !errors.As(err, &ce) || !strings.Contains(err.Error(), "exceeds 2 segments") {
+		t.Errorf("oversized big data: err = %v", err)
+	}
+
+	// 子键索引指回键自身时形成环。
+	cs, err := mustParse(t, selfLinkedHive(t)).OpenKey("ControlSet001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.SubKeys(); !errors.As(err, &ce) || !strings.Contains(err.Error(), "subkey parent") {
+		t.Errorf("self-linked subkey: err = %v", err)
+	}
+}
+
+// selfLinkedHive 返回ControlSet001的子键索引全部指向其自身的测试hive。
+func selfLinkedHive(t *testing.T) []byte {
+	t.Helper()
+	data := newHiveBuilder().build(testTree())
+	cs, err := mustParse(t, data).OpenKey("ControlSet001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := cs.hive.cell(cs.subkeyList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < int(binary.LittleEndian.Uint16(list[2:])); i++ {
+		binary.LittleEndian.PutUint32(list[4+i*8:], cs.offset)
+	}
+	return data
+}
+
+func mustParse(t *testing.T, data []byte) *Hive {
+	t.Helper()
+	h, err := ParseHive(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
@@ -0,0 +1,383 @@
+package reg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// .reg文件的首行版本标识。
+const (
+	RegFileVersion5 = "Windows Registry Editor Version 5.00"
+	RegFileVersion4 = "REGEDIT4"
+)
+
+// regFileLineWidth 是写出十六进制数据时单行的最大宽度，与regedit一致。
+const regFileLineWidth = 80
+
+// RegFileError 表示.reg文件某一行的语法错误。
+type RegFileError struct {
+	// Line 出错的行号，从1开始；续行时为第一行。
+	Line int
+	// Msg 错误描述。
+	Msg string
+}
+
+func (e *RegFileError) Error() string {
+	return fmt.Sprintf("reg: line %d: %s", e.Line, e.Msg)
+}
+
+// RegFile 是regedit导入导出使用的.reg文本文件。
+type RegFile struct {
+	// Version 首行版本标识，RegFileVersion5或RegFileVersion4；为空时按RegFileVersion5写出。
+	Version string
+	// Keys 按文件顺序排列的键。
+	Keys []RegFileKey
+}
+
+// RegFileKey 是.reg文件中的一个 [键] 段。
+type RegFileKey struct {
+	// Path 含根键的完整路径，如 HKEY_LOCAL_MACHINE\SOFTWARE\Foo。
+	Path string
+	// Delete 为 [-键] 形式，表示递归删除该键。
+	Delete bool
+	// Values 该段中的值。
+	Values []RegFileValue
+}
+
+// RegFileValue 是.reg文件中的一行值。字符串类数据统一转换为UTF-16LE保存，
+// REGEDIT4文件中按ANSI编码的 hex(2)、hex(7) 数据在读写时自动转换。
+type RegFileValue struct {
+	Value
+	// Delete 为 "name"=- 形式，表示删除该值。
+	Delete bool
+}
+
+// ReadRegFile 读取并解析.reg文件。
+//   path - 文件路径
+//   返回1 - 解析结果
+//   返回2 - 读取失败或语法错误时的错误，成功时为nil
+func ReadRegFile(path string) (*RegFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read reg file: %w", err)
+	}
+	return ParseRegFile(data)
+}
+
+// ParseRegFile 解析.reg文件内容，支持UTF-16LE（带BOM）和UTF-8/ANSI编码，
+// 以反斜杠结尾的十六进制数据可跨行书写，以分号开头的行为注释。
+//   data - 文件内容
+//   返回1 - 解析结果
+//   返回2 - 首行不是版本标识或存在语法错误时为*RegFileError，成功时为nil
+func ParseRegFile(data []byte) (*RegFile, error) {
+	lines := strings.Split(decodeRegText(data), "\n")
+	f := &RegFile{}
+	var cur *RegFileKey
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if f.Version == "" {
+			if line != RegFileVersion5 && line != RegFileVersion4 {
+				return nil, &RegFileError{Line: lineNo, Msg: fmt.Sprintf("unknown header %q", line)}
+			}
+			f.Version = line
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, &RegFileError{Line: lineNo, Msg: "unterminated key"}
+			}
+			k := RegFileKey{Path: line[1 : len(line)-1]}
+			if strings.HasPrefix(k.Path, "-") {
+				k.Path, k.Delete = k.Path[1:], true
+			}
+			if k.Path == "" {
+				return nil, &RegFileError{Line: lineNo, Msg: "empty key path"}
+			}
+			f.Keys = append(f.Keys, k)
+			cur = &f.Keys[len(f.Keys)-1]
+			continue
+		}
+		if cur == nil {
+			return nil, &RegFileError{Line: lineNo, Msg: "value outside of key"}
+		}
+		name, rest, err := parseRegName(line)
+		if err != nil {
+			return nil, &RegFileError{Line: lineNo, Msg: err.Error()}
+		}
+		if strings.HasPrefix(rest, "hex") {
+			for strings.HasSuffix(rest, `\`) && i+1 < len(lines) {
+				i++
+				rest = strings.TrimSpace(rest[:len(rest)-1]) + strings.TrimSpace(lines[i])
+			}
+		}
+		v, err := parseRegData(rest, f.Version == RegFileVersion4)
+		if err != nil {
+			return nil, &RegFileError{Line: lineNo, Msg: err.Error()}
+		}
+		v.Name = name
+		cur.Values = append(cur.Values, v)
+	}
+	if f.Version == "" {
+		return nil, &RegFileError{Line: 1, Msg: "missing header"}
+	}
+	return f, nil
+}
+
+// decodeRegText 按BOM解码文件内容并统一换行符。
+func decodeRegText(data []byte) string {
+	var s string
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		s = decodeUTF16Full(data[2:])
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		s = string(data[3:])
+	case utf8.Valid(data):
+		s = string(data)
+	default:
+		// REGEDIT4文件通常为ANSI编码，按Latin-1解码。
+		r := make([]rune, len(data))
+		for i, c := range data {
+			r[i] = rune(c)
+		}
+		s = string(r)
+	}
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+// parseRegName 解析值名称（@ 或带转义的引号字符串），返回名称及等号后的数据部分。
+func parseRegName(line string) (string, string, error) {
+	var name, rest string
+	if strings.HasPrefix(line, "@") {
+		rest = line[1:]
+	} else {
+		var ok bool
+		if name, rest, ok = unquoteReg(line); !ok {
+			return "", "", fmt.Errorf("invalid value name")
+		}
+	}
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(rest, "=") {
+		return "", "", fmt.Errorf("missing '=' after value name")
+	}
+	return name, strings.TrimSpace(rest[1:]), nil
+}
+
+// unquoteReg 解析以引号开头的字符串，处理 \\ 与 \" 转义，返回内容及引号后的剩余部分。
+func unquoteReg(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", "", false
+	}
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			sb.WriteByte(s[i])
+		case c == '"':
+			return sb.String(), s[i+1:], true
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", "", false
+}
+
+// parseRegData 解析等号后的数据：-、"字符串"、dword:、qword:、hex: 或 hex(类型):。
+func parseRegData(s string, ansi bool) (RegFileValue, error) {
+	var v RegFileValue
+	switch {
+	case s == "-":
+		v.Delete = true
+	case strings.HasPrefix(s, `"`):
+		str, rest, ok := unquoteReg(s)
+		if !ok || strings.TrimSpace(rest) != "" {
+			return v, fmt.Errorf("invalid string data")
+		}
+		v.Type, v.Data = REG_SZ, encodeUTF16(str+"\x00")
+	case strings.HasPrefix(s, "dword:"):
+		n, err := strconv.ParseUint(s[6:], 16, 32)
+		if err != nil {
+			return v, fmt.Errorf("invalid dword %q", s[6:])
+		}
+		v.Type, v.Data = REG_DWORD, binary.LittleEndian.AppendUint32(nil, uint32(n))
+	case strings.HasPrefix(s, "qword:"):
+		n, err := strconv.ParseUint(s[6:], 16, 64)
+		if err != nil {
+			return v, fmt.Errorf("invalid qword %q", s[6:])
+		}
+		v.Type, v.Data = REG_QWORD, binary.LittleEndian.AppendUint64(nil, n)
+	case strings.HasPrefix(s, "hex"):
+		v.Type = REG_BINARY
+		rest := s[3:]
+		if strings.HasPrefix(rest, "(") {
+			end := strings.Index(rest, ")")
+			if end < 0 {
+				return v, fmt.Errorf("invalid hex type")
+			}
+			t, err := strconv.ParseUint(rest[1:end], 16, 32)
+			if err != nil {
+				return v, fmt.Errorf("invalid hex type %q", rest[1:end])
+			}
+			v.Type, rest = ValueType(t), rest[end+1:]
+		}
+		if !strings.HasPrefix(rest, ":") {
+			return v, fmt.Errorf("missing ':' after hex")
+		}
+		data := []byte{}
+		for _, f := range strings.Split(rest[1:], ",") {
+			if f = strings.TrimSpace(f); f == "" {
+				continue
+			}
+			b, err := strconv.ParseUint(f, 16, 8)
+			if err != nil {
+				return v, fmt.Errorf("invalid hex byte %q", f)
+			}
+			data = append(data, byte(b))
+		}
+		if ansi && isStringType(v.Type) {
+			data = ansiToUTF16(data)
+		}
+		v.Data = data
+	default:
+		return v, fmt.Errorf("unknown value data %q", s)
+	}
+	return v, nil
+}
+
+// isStringType 报告类型的数据是否为字符串，REGEDIT4文件中以ANSI编码保存。
+func isStringType(t ValueType) bool {
+	return t == REG_SZ || t == REG_EXPAND_SZ || t == REG_MULTI_SZ
+}
+
+// ansiToUTF16 将单字节字符串按Latin-1转换为UTF-16LE。
+func ansiToUTF16(b []byte) []byte {
+	out := make([]byte, 0, 2*len(b))
+	for _, c := range b {
+		out = append(out, c, 0)
+	}
+	return out
+}
+
+// utf16ToANSI 将UTF-16LE字符串转换为单字节，超出Latin-1的字符替换为问号。
+func utf16ToANSI(b []byte) []byte {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	out := make([]byte, 0, len(u))
+	for _, r := range utf16.Decode(u) {
+		if r > 0xFF {
+			r = '?'
+		}
+		out = append(out, byte(r))
+	}
+	return out
+}
+
+// String 返回.reg文件文本，换行为CRLF。
+//   返回 - 文件文本
+func (f *RegFile) String() string {
+	version := f.Version
+	if version == "" {
+		version = RegFileVersion5
+	}
+	ansi := version == RegFileVersion4
+	var sb strings.Builder
+	sb.WriteString(version + "\r\n\r\n")
+	for _, k := range f.Keys {
+		if k.Delete {
+			sb.WriteString("[-" + k.Path + "]\r\n\r\n")
+			continue
+		}
+		sb.WriteString("[" + k.Path + "]\r\n")
+		for _, v := range k.Values {
+			writeRegValue(&sb, v, ansi)
+		}
+		sb.WriteString("\r\n")
+	}
+	return sb.String()
+}
+
+// Encode 按版本写出.reg文件：RegFileVersion5为带BOM的UTF-16LE，与regedit导出的文件相同；
+// RegFileVersion4为Latin-1单字节文本。
+//   w - 输出目标
+//   返回 - 写入失败时的错误，成功时为nil
+func (f *RegFile) Encode(w io.Writer) error {
+	s := f.String()
+	var data []byte
+	if f.Version == RegFileVersion4 {
+		data = utf16ToANSI(encodeUTF16(s))
+	} else {
+		data = append([]byte{0xFF, 0xFE}, encodeUTF16(s)...)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// writeRegValue 写出一行值，字符串与DWORD使用文本形式，其他类型按regedit的格式分行写出十六进制。
+func writeRegValue(sb *strings.Builder, v RegFileValue, ansi bool) {
+	line := "@="
+	if v.Name != "" {
+		line = quoteReg(v.Name) + "="
+	}
+	switch {
+	case v.Delete:
+		sb.WriteString(line + "-\r\n")
+		return
+	case v.Type == REG_SZ && isPlainString(v.Data):
+		sb.WriteString(line + quoteReg(decodeUTF16(v.Data)) + "\r\n")
+		return
+	case v.Type == REG_DWORD && len(v.Data) == 4:
+		sb.WriteString(fmt.Sprintf("%sdword:%08x\r\n", line, binary.LittleEndian.Uint32(v.Data)))
+		return
+	case v.Type == REG_BINARY:
+		line += "hex:"
+	default:
+		line += fmt.Sprintf("hex(%x):", uint32(v.Type))
+	}
+	data := v.Data
+	if ansi && isStringType(v.Type) {
+		data = utf16ToANSI(data)
+	}
+	for i, b := range data {
+		tok := fmt.Sprintf("%02x", b)
+		if i < len(data)-1 {
+			tok += ","
+		}
+		if len(line)+len(tok) > regFileLineWidth-2 {
+			sb.WriteString(line + "\\\r\n")
+			line = "  "
+		}
+		line += tok
+	}
+	sb.WriteString(line + "\r\n")
+}
+
+// isPlainString 报告UTF-16LE数据是否以单个NUL结尾且不含其他NUL，可以写成引号字符串。
+func isPlainString(b []byte) bool {
+	if len(b) < 2 || len(b)%2 != 0 || b[len(b)-2] != 0 || b[len(b)-1] != 0 {
+		return false
+	}
+	for i := 0; i < len(b)-2; i += 2 {
+		if b[i] == 0 && b[i+1] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteReg 为名称或字符串数据加引号并转义反斜杠和引号。
+func quoteReg(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
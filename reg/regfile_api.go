@@ -0,0 +1,154 @@
+//go:build windows
+
+package reg
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+
+	"github.com/kitsch-9527/wcorefx/internal/winapi"
+)
+
+var procRegSetValueEx = winapi.NewProc("Advapi32.dll", "RegSetValueExW", winapi.ConvErrnoReturn)
+
+// ImportRegFile 将.reg文件中的修改写入本机注册表，行为与 regedit /s 一致：
+// 按顺序创建键并写入值，[-键] 递归删除键，"name"=- 删除值，要删除的键或值不存在时忽略。
+//   f - 解析后的.reg文件
+//   返回 - 第一个失败操作的错误，成功时为nil
+func ImportRegFile(f *RegFile) error {
+	for _, k := range f.Keys {
+		rootKey, subPath, err := parsePath(k.Path)
+		if err != nil {
+			return err
+		}
+		if k.Delete {
+			if err := deleteTree(rootKey, subPath); err != nil {
+				return fmt.Errorf("delete key %s failed: %w", k.Path, err)
+			}
+			continue
+		}
+		key, _, err := registry.CreateKey(rootKey, subPath, registry.SET_VALUE)
+		if err != nil {
+			return fmt.Errorf("create key %s failed: %w", k.Path, err)
+		}
+		err = importValues(key, k.Values)
+		key.Close()
+		if err != nil {
+			return fmt.Errorf("import %s: %w", k.Path, err)
+		}
+	}
+	return nil
+}
+
+// ImportRegFilePath 读取.reg文件并导入本机注册表。
+//   path - 文件路径
+//   返回 - 读取、解析或写入失败时的错误，成功时为nil
+func ImportRegFilePath(path string) error {
+	f, err := ReadRegFile(path)
+	if err != nil {
+		return err
+	}
+	return ImportRegFile(f)
+}
+
+// ExportRegFile 将本机注册表键及其全部子键导出为.reg文件，内容与regedit导出的一致。
+//   path - 完整的注册表路径（如 HKLM\Software\MyKey），导出的键路径保持该写法
+//   返回1 - 导出结果，版本为RegFileVersion5
+//   返回2 - 错误信息
+func ExportRegFile(path string) (*RegFile, error) {
+	rootKey, subPath, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &RegFile{Version: RegFileVersion5}
+	if err := exportTree(f, rootKey, subPath, path); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func exportTree(f *RegFile, root registry.Key, subPath, path string) error {
+	k, err := registry.OpenKey(root, subPath, registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return fmt.Errorf("open key %s failed: %w", path, err)
+	}
+	defer k.Close()
+	names, err := k.ReadValueNames(0)
+	if err != nil {
+		return fmt.Errorf("read value names failed: %w", err)
+	}
+	rk := RegFileKey{Path: path}
+	for _, name := range names {
+		v, err := readValue(k, name)
+		if err != nil {
+			continue
+		}
+		rk.Values = append(rk.Values, RegFileValue{Value: v})
+	}
+	f.Keys = append(f.Keys, rk)
+	subs, err := k.ReadSubKeyNames(0)
+	if err != nil {
+		return fmt.Errorf("read subkey names failed: %w", err)
+	}
+	for _, name := range subs {
+		if err := exportTree(f, root, subPath+`\`+name, path+`\`+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func importValues(k registry.Key, values []RegFileValue) error {
+	for _, v := range values {
+		if v.Delete {
+			if err := k.DeleteValue(v.Name); err != nil && !errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+				return fmt.Errorf("delete value %q failed: %w", v.Name, err)
+			}
+			continue
+		}
+		if err := setRawValue(k, v.Name, v.Type, v.Data); err != nil {
+			return fmt.Errorf("set value %q failed: %w", v.Name, err)
+		}
+	}
+	return nil
+}
+
+// setRawValue 按任意类型写入原始数据，registry包只提供了部分类型的写入方法。
+func setRawValue(k registry.Key, name string, t ValueType, data []byte) error {
+	p, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	var buf *byte
+	if len(data) > 0 {
+		buf = &data[0]
+	}
+	return procRegSetValueEx.Call(uintptr(k), uintptr(unsafe.Pointer(p)), 0, uintptr(t),
+		uintptr(unsafe.Pointer(buf)), uintptr(len(data)))
+}
+
+// deleteTree 递归删除键及其全部子键，键不存在时返回nil。
+func deleteTree(root registry.Key, path string) error {
+	k, err := registry.OpenKey(root, path, registry.ENUMERATE_SUB_KEYS)
+	if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	names, err := k.ReadSubKeyNames(0)
+	k.Close()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := deleteTree(root, path+`\`+name); err != nil {
+			return err
+		}
+	}
+	return registry.DeleteKey(root, path)
+}
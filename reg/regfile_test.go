@@ -0,0 +1,192 @@
+package reg
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleRegFile = "Windows Registry Editor Version 5.00\r\n" +
+	"\r\n" +
+	"; 持久化样本\r\n" +
+	"[HKEY_LOCAL_MACHINE\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Run]\r\n" +
+	"\"Updater\"=\"C:\\\\Program Files\\\\upd.exe \\\"-q\\\"\"\r\n" +
+	"@=\"default\"\r\n" +
+	"\"Old\"=-\r\n" +
+	"\r\n" +
+	"[HKEY_LOCAL_MACHINE\\SYSTEM\\CurrentControlSet\\Services\\Evil]\r\n" +
+	"\"Start\"=dword:00000002\r\n" +
+	"\"ImagePath\"=hex(2):25,00,53,00,79,00,73,00,74,00,65,00,6d,00,52,00,6f,00,6f,00,\\\r\n" +
+	"  74,00,25,00,5c,00,65,00,76,00,69,00,6c,00,2e,00,73,00,79,00,73,00,00,00\r\n" +
+	"\"DependOnService\"=hex(7):52,00,70,00,63,00,53,00,73,00,00,00,00,00\r\n" +
+	"\"Epoch\"=hex(b):88,77,66,55,44,33,22,11\r\n" +
+	"\"Stamp\"=qword:1122334455667788\r\n" +
+	"\"Blob\"=hex:de,ad,\\\r\n" +
+	"  be,ef\r\n" +
+	"\"Empty\"=hex(0):\r\n" +
+	"\r\n" +
+	"[-HKEY_CURRENT_USER\\Software\\Stale]\r\n"
+
+func TestParseRegFile(t *testing.T) {
+	f, err := ParseRegFile([]byte(sampleRegFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Version != RegFileVersion5 || len(f.Keys) != 3 {
+		t.Fatalf("file = %+v", f)
+	}
+	run := f.Keys[0]
+	if run.Path != `HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows\CurrentVersion\Run` || run.Delete || len(run.Values) != 3 {
+		t.Errorf("run key = %+v", run)
+	}
+	if v := run.Values[0]; v.Name != "Updater" || v.Type != REG_SZ || v.String() != `C:\Program Files\upd.exe "-q"` {
+		t.Errorf("Updater = %+v (%s)", v, v.String())
+	}
+	if v := run.Values[1]; v.Name != "" || v.String() != "default" {
+		t.Errorf("default = %+v", v)
+	}
+	if v := run.Values[2]; v.Name != "Old" || !v.Delete {
+		t.Errorf("Old = %+v", v)
+	}
+
+	svc := f.Keys[1]
+	want := map[string]string{
+		"Start":           "2 (0x2)",
+		"ImagePath":       `%SystemRoot%\evil.sys`,
+		"DependOnService": "RpcSs",
+		"Epoch":           "1234605616436508552 (0x1122334455667788)",
+		"Stamp":           "1234605616436508552 (0x1122334455667788)",
+		"Blob":            "DEADBEEF",
+		"Empty":           "",
+	}
+	if len(svc.Values) != len(want) {
+		t.Errorf("service values = %+v", svc.Values)
+	}
+	for _, v := range svc.Values {
+		if got := v.String(); got != want[v.Name] {
+			t.Errorf("%s = %q, want %q", v.Name, got, want[v.Name])
+		}
+	}
+	if svc.Values[1].Type != REG_EXPAND_SZ || svc.Values[2].Type != REG_MULTI_SZ || svc.Values[3].Type != REG_QWORD ||
+		svc.Values[6].Type != REG_NONE || svc.Values[6].Data == nil {
+		t.Errorf("service value types = %+v", svc.Values)
+	}
+	if k := f.Keys[2]; k.Path != `HKEY_CURRENT_USER\Software\Stale` || !k.Delete {
+		t.Errorf("delete key = %+v", k)
+	}
+
+	// regedit导出的文件为带BOM的UTF-16LE。
+	var buf bytes.Buffer
+	if err := f.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte{0xFF, 0xFE, 'W', 0}) {
+		t.Errorf("encoded prefix = % x", buf.Bytes()[:4])
+	}
+	utf16File, err := ParseRegFile(append([]byte{0xFF, 0xFE}, encodeUTF16(sampleRegFile)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(utf16File, f) {
+		t.Errorf("UTF-16 parse differs: %+v", utf16File)
+	}
+}
+
+func TestRegFileRoundTrip(t *testing.T) {
+	f, err := ParseRegFile([]byte(sampleRegFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := bytes.Repeat([]byte{0xAB}, 100)
+	f.Keys[1].Values = append(f.Keys[1].Values,
+		RegFileValue{Value: Value{Name: "Long", Type: REG_BINARY, Data: long}},
+		RegFileValue{Value: Value{Name: `Na"me\x`, Type: REG_SZ, Data: encodeUTF16("a\x00b\x00")}},
+	)
+	text := f.String()
+	for _, line := range strings.Split(text, "\r\n") {
+		if len(line) > regFileLineWidth {
+			t.Errorf("line longer than %d: %q", regFileLineWidth, line)
+		}
+	}
+	for _, want := range []string{
+		`"Stamp"=hex(b):88,77,66,55,44,33,22,11`,
+		`"Start"=dword:00000002`,
+		`"Old"=-`,
+		`[-HKEY_CURRENT_USER\Software\Stale]`,
+		`"Na\"me\\x"=hex(1):61,00,00,00,62,00,00,00`,
+	} {
+		if !strings.Contains(text, want+"\r\n") {
+			t.Errorf("output missing %q:\n%s", want, text)
+		}
+	}
+	again, err := ParseRegFile([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again.Keys[0], f.Keys[0]) || !reflect.DeepEqual(again.Keys[2], f.Keys[2]) {
+		t.Errorf("round trip keys differ:\n%+v\n%+v", again.Keys, f.Keys)
+	}
+	for i, v := range again.Keys[1].Values {
+		w := f.Keys[1].Values[i]
+		if v.Name != w.Name || !bytes.Equal(v.Data, w.Data) || v.Type != w.Type {
+			t.Errorf("round trip %s = %+v, want %+v", w.Name, v, w)
+		}
+	}
+}
+
+func TestParseRegFile4(t *testing.T) {
+	// REGEDIT4 的字符串数据为ANSI编码。
+	data := []byte("REGEDIT4\n\n[HKEY_CURRENT_USER\\Software\\Test]\n" +
+		"\"Path\"=hex(2):25,54,45,4d,50,25,5c,e9,00\n" +
+		"\"Name\"=\"caf\xe9\"\n")
+	f, err := ParseRegFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Version != RegFileVersion4 || len(f.Keys) != 1 || len(f.Keys[0].Values) != 2 {
+		t.Fatalf("file = %+v", f)
+	}
+	if v := f.Keys[0].Values[0]; v.String() != `%TEMP%\é` || !bytes.Equal(v.Data[len(v.Data)-2:], []byte{0, 0}) {
+		t.Errorf("Path = %q % x", v.String(), v.Data)
+	}
+	if v := f.Keys[0].Values[1]; v.String() != "café" {
+		t.Errorf("Name = %q", v.String())
+	}
+	var buf bytes.Buffer
+	if err := f.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("\"Path\"=hex(2):25,54,45,4d,50,25,5c,e9,00\r\n\"Name\"=\"caf\xe9\"")) {
+		t.Errorf("REGEDIT4 output:\n%s", buf.Bytes())
+	}
+}
+
+func TestParseRegFileErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		line int
+	}{
+		{"", 1},
+		{"REGEDIT5\n", 1},
+		{"REGEDIT4\n\"a\"=\"b\"\n", 2},
+		{"REGEDIT4\n[HKCU\\X\n", 2},
+		{"REGEDIT4\n[HKCU\\X]\n\"a\"=dword:123456789\n", 3},
+		{"REGEDIT4\n[HKCU\\X]\n\"a\"=hex:zz\n", 3},
+		{"REGEDIT4\n[HKCU\\X]\n\"a\"=hex(7:00\n", 3},
+		{"REGEDIT4\n[HKCU\\X]\n\"a\"=hex:00,\\\n  01,\\\n  0g\n", 3},
+		{"REGEDIT4\n[HKCU\\X]\n\"a=\"b\"\n", 3},
+		{"REGEDIT4\n[HKCU\\X]\n\"a\" \"b\"\n", 3},
+		{"REGEDIT4\n[HKCU\\X]\n\"a\"=\"b\" x\n", 3},
+		{"REGEDIT4\n[HKCU\\X]\n\"a\"=str:b\n", 3},
+		{"REGEDIT4\n[-]\n", 2},
+	}
+	for _, tt := range tests {
+		_, err := ParseRegFile([]byte(tt.text))
+		var re *RegFileError
+		if !errors.As(err, &re) || re.Line != tt.line {
+			t.Errorf("%q: err = %v, want line %d", tt.text, err, tt.line)
+		}
+	}
+}
@@ -11,9 +11,11 @@ import (
 
 // ValueInfo 表示注册表值的信息
 type ValueInfo struct {
-	Name  string // 值名称
-	Type  string // 值类型（如 REG_SZ, REG_DWORD, REG_EXPAND_SZ 等）
-	Value string // 值的字符串表示
+	Name  string     // 值名称
+	Type  string     // 值类型（如 REG_SZ, REG_DWORD, REG_EXPAND_SZ 等）
+	Value string     // 值的字符串表示
+	Data  TypedValue // 按类型解码的数据，解码失败时为nil
+	Raw   []byte     // 原始数据
 }
 
 var rootKeyMap = map[string]registry.Key{
@@ -103,43 +105,12 @@ func EnumValues(p string) ([]ValueInfo, error) {
 
 	values := make([]ValueInfo, 0, len(names))
 	for _, name := range names {
-		vi := ValueInfo{Name: name}
-
-		bufSize, valType, err := k.GetValue(name, nil)
+		v, err := readValue(k, name)
 		if err != nil {
 			continue
 		}
-		vi.Type = typeName(valType)
-
-		switch valType {
-		case registry.SZ, registry.EXPAND_SZ:
-			s, _, err := k.GetStringValue(name)
-			if err == nil {
-				vi.Value = s
-			}
-		case registry.MULTI_SZ:
-			strs, _, err := k.GetStringsValue(name)
-			if err == nil {
-				vi.Value = strings.Join(strs, ", ")
-			}
-		case registry.DWORD, registry.QWORD:
-			n, _, err := k.GetIntegerValue(name)
-			if err == nil {
-				vi.Value = fmt.Sprintf("%d (0x%X)", n, n)
-			}
-		case registry.BINARY:
-			buf := make([]byte, bufSize)
-			n, _, err := k.GetValue(name, buf)
-			if err == nil {
-				vi.Value = fmt.Sprintf("%X", buf[:n])
-			}
-		default:
-			buf := make([]byte, bufSize)
-			n, _, err := k.GetValue(name, buf)
-			if err == nil {
-				vi.Value = string(buf[:n])
-			}
-		}
+		vi := ValueInfo{Name: name, Type: v.Type.String(), Value: v.String(), Raw: v.Data}
+		vi.Data, _ = v.Typed()
 		values = append(values, vi)
 	}
 	return values, nil
@@ -203,6 +174,24 @@ func SetDWORD(path, key string, value uint32) error {
 	return k.SetDWordValue(key, value)
 }
 
+// SetValue 按类型化数据设置注册表值，支持全部值类型。
+//   path  - 完整的注册表路径
+//   key   - 值名称
+//   value - 类型化数据，如 reg.MultiStringValue{"a", "b"}、reg.QWordValue(1)
+//   返回 - 错误信息
+func SetValue(path, key string, value TypedValue) error {
+	rootKey, subPath, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	k, err := registry.OpenKey(rootKey, subPath, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("open key failed: %w", err)
+	}
+	defer k.Close()
+	return setRawValue(k, key, value.Type(), value.Raw())
+}
+
 // CreateKey 创建注册表键。
 //   path - 完整的注册表路径
 //   返回 - 错误信息
@@ -250,29 +239,3 @@ func DeleteValue(path, key string) error {
 	defer k.Close()
 	return k.DeleteValue(key)
 }
-
-// typeName 将注册表值类型转换为字符串表示
-func typeName(t uint32) string {
-	switch t {
-	case registry.NONE:
-		return "REG_NONE"
-	case registry.SZ:
-		return "REG_SZ"
-	case registry.EXPAND_SZ:
-		return "REG_EXPAND_SZ"
-	case registry.BINARY:
-		return "REG_BINARY"
-	case registry.DWORD:
-		return "REG_DWORD"
-	case registry.DWORD_BIG_ENDIAN:
-		return "REG_DWORD_BIG_ENDIAN"
-	case registry.LINK:
-		return "REG_LINK"
-	case registry.MULTI_SZ:
-		return "REG_MULTI_SZ"
-	case registry.QWORD:
-		return "REG_QWORD"
-	default:
-		return fmt.Sprintf("REG_0x%X", t)
-	}
-}
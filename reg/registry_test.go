@@ -3,6 +3,7 @@
 package reg
 
 import (
+	"reflect"
 	"testing"
 
 	"golang.org/x/sys/windows/registry"
@@ -214,3 +215,38 @@ func TestDeleteValue_RoundTrip(t *testing.T) {
 		}
 	}
 }
+
+func TestSetValue_AllTypes(t *testing.T) {
+	testPath := `HKCU\Software\wcorefx_test_typed`
+	defer registry.DeleteKey(registry.CURRENT_USER, `Software\wcorefx_test_typed`)
+
+	if err := CreateKey(testPath); err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	want := map[string]TypedValue{
+		"sz":     StringValue("hello"),
+		"expand": ExpandStringValue(`%TEMP%\x`),
+		"multi":  MultiStringValue{"a", "b"},
+		"dword":  DWordValue(7),
+		"qword":  QWordValue(1 << 40),
+		"binary": BinaryValue{1, 2, 3},
+		"none":   NoneValue{9},
+	}
+	for name, tv := range want {
+		if err := SetValue(testPath, name, tv); err != nil {
+			t.Fatalf("SetValue(%s) error = %v", name, err)
+		}
+	}
+	vals, err := EnumValues(testPath)
+	if err != nil {
+		t.Fatalf("EnumValues() error = %v", err)
+	}
+	if len(vals) != len(want) {
+		t.Fatalf("EnumValues() returned %d values, want %d", len(vals), len(want))
+	}
+	for _, v := range vals {
+		if !reflect.DeepEqual(v.Data, want[v.Name]) {
+			t.Errorf("value %s = %#v, want %#v", v.Name, v.Data, want[v.Name])
+		}
+	}
+}
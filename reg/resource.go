@@ -0,0 +1,381 @@
+package reg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// ResourceType 是硬件资源描述符的类型（CmResourceType*）。
+type ResourceType uint8
+
+const (
+	ResourceNull           ResourceType = 0
+	ResourcePort           ResourceType = 1
+	ResourceInterrupt      ResourceType = 2
+	ResourceMemory         ResourceType = 3
+	ResourceDma            ResourceType = 4
+	ResourceDeviceSpecific ResourceType = 5
+	ResourceBusNumber      ResourceType = 6
+	ResourceMemoryLarge    ResourceType = 7
+	ResourceConfigData     ResourceType = 128
+	ResourceDevicePrivate  ResourceType = 129
+	ResourcePcCardConfig   ResourceType = 130
+	ResourceMfCardConfig   ResourceType = 131
+)
+
+var resourceTypeNames = map[ResourceType]string{
+	ResourceNull: "Null", ResourcePort: "Port", ResourceInterrupt: "Interrupt", ResourceMemory: "Memory",
+	ResourceDma: "Dma", ResourceDeviceSpecific: "DeviceSpecific", ResourceBusNumber: "BusNumber",
+	ResourceMemoryLarge: "MemoryLarge", ResourceConfigData: "ConfigData", ResourceDevicePrivate: "DevicePrivate",
+	ResourcePcCardConfig: "PcCardConfig", ResourceMfCardConfig: "MfCardConfig",
+}
+
+func (t ResourceType) String() string {
+	if s, ok := resourceTypeNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("Type%d", uint8(t))
+}
+
+const (
+	// partialResourceSize 是64位系统上CM_PARTIAL_RESOURCE_DESCRIPTOR的大小（4字节对齐）。
+	partialResourceSize = 20
+	// fullResourceHeaderSize 是CM_FULL_RESOURCE_DESCRIPTOR在部分描述符数组之前的大小。
+	fullResourceHeaderSize = 16
+	// ioResourceSize 是IO_RESOURCE_DESCRIPTOR的大小。
+	ioResourceSize = 32
+	// requirementsHeaderSize 是IO_RESOURCE_REQUIREMENTS_LIST在备选列表之前的大小。
+	requirementsHeaderSize = 32
+)
+
+// MemoryLarge描述符中长度字段的缩放标志。
+const (
+	cmResourceMemoryLarge40 = 0x0200
+	cmResourceMemoryLarge48 = 0x0400
+	cmResourceMemoryLarge64 = 0x0800
+)
+
+// PartialResource 对应CM_PARTIAL_RESOURCE_DESCRIPTOR，联合体按原始字节保存，
+// 通过Range、Interrupt、DMA按类型读取。
+type PartialResource struct {
+	// Type 资源类型。
+	Type ResourceType
+	// ShareDisposition 共享方式。
+	ShareDisposition uint8
+	// Flags 类型相关的标志。
+	Flags uint16
+	// Union 16字节的联合体u。
+	Union [16]byte
+	// Data ResourceDeviceSpecific描述符之后的设备数据，其长度写入联合体的DataSize。
+	Data []byte
+}
+
+// Range 返回端口、内存或总线号资源的起始值和长度。
+//   返回1 - 起始地址或起始总线号
+//   返回2 - 长度，MemoryLarge按Flags换算
+//   返回3 - 资源类型不是范围时为false
+func (r PartialResource) Range() (uint64, uint64, bool) {
+	le := binary.LittleEndian
+	switch r.Type {
+	case ResourcePort, ResourceMemory:
+		return le.Uint64(r.Union[0:]), uint64(le.Uint32(r.Union[8:])), true
+	case ResourceMemoryLarge:
+		n := uint64(le.Uint32(r.Union[8:]))
+		switch {
+		case r.Flags&cmResourceMemoryLarge40 != 0:
+			n <<= 8
+		case r.Flags&cmResourceMemoryLarge48 != 0:
+			n <<= 16
+		case r.Flags&cmResourceMemoryLarge64 != 0:
+			n <<= 32
+		}
+		return le.Uint64(r.Union[0:]), n, true
+	case ResourceBusNumber:
+		return uint64(le.Uint32(r.Union[0:])), uint64(le.Uint32(r.Union[4:])), true
+	}
+	return 0, 0, false
+}
+
+// Interrupt 返回中断资源的级别、向量和处理器亲和性。
+//   返回1 - 中断级别
+//   返回2 - 中断向量
+//   返回3 - 亲和性掩码
+//   返回4 - 资源类型不是中断时为false
+func (r PartialResource) Interrupt() (uint32, uint32, uint64, bool) {
+	if r.Type != ResourceInterrupt {
+		return 0, 0, 0, false
+	}
+	le := binary.LittleEndian
+	return uint32(le.Uint16(r.Union[0:])), le.Uint32(r.Union[4:]), le.Uint64(r.Union[8:]), true
+}
+
+// DMA 返回DMA资源的通道和端口。
+//   返回1 - 通道
+//   返回2 - 端口
+//   返回3 - 资源类型不是DMA时为false
+func (r PartialResource) DMA() (uint32, uint32, bool) {
+	if r.Type != ResourceDma {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint32(r.Union[0:]), binary.LittleEndian.Uint32(r.Union[4:]), true
+}
+
+func (r PartialResource) String() string {
+	if start, n, ok := r.Range(); ok {
+		return fmt.Sprintf("%s 0x%X len 0x%X", r.Type, start, n)
+	}
+	if level, vector, _, ok := r.Interrupt(); ok {
+		return fmt.Sprintf("Interrupt level %d vector %d", level, vector)
+	}
+	if ch, _, ok := r.DMA(); ok {
+		return fmt.Sprintf("Dma channel %d", ch)
+	}
+	if r.Type == ResourceDeviceSpecific {
+		return fmt.Sprintf("DeviceSpecific %d bytes", len(r.Data))
+	}
+	return r.Type.String()
+}
+
+// FullResourceDescriptor 对应CM_FULL_RESOURCE_DESCRIPTOR，是REG_FULL_RESOURCE_DESCRIPTOR值的内容。
+type FullResourceDescriptor struct {
+	// InterfaceType 总线接口类型（INTERFACE_TYPE），如5为PCIBus。
+	InterfaceType int32
+	// BusNumber 总线号。
+	BusNumber uint32
+	// Version 部分资源列表版本。
+	Version uint16
+	// Revision 部分资源列表修订号。
+	Revision uint16
+	// Partial 部分资源描述符。
+	Partial []PartialResource
+}
+
+// Type 返回REG_FULL_RESOURCE_DESCRIPTOR。
+func (d *FullResourceDescriptor) Type() ValueType { return REG_FULL_RESOURCE_DESCRIPTOR }
+
+// Raw 返回编码后的数据。
+func (d *FullResourceDescriptor) Raw() []byte { return d.append(nil) }
+
+func (d *FullResourceDescriptor) String() string {
+	parts := make([]string, len(d.Partial))
+	for i, p := range d.Partial {
+		parts[i] = p.String()
+	}
+	return fmt.Sprintf("interface %d bus %d: %s", d.InterfaceType, d.BusNumber, strings.Join(parts, ", "))
+}
+
+func (d *FullResourceDescriptor) append(b []byte) []byte {
+	le := binary.LittleEndian
+	b = le.AppendUint32(b, uint32(d.InterfaceType))
+	b = le.AppendUint32(b, d.BusNumber)
+	b = le.AppendUint16(b, d.Version)
+	b = le.AppendUint16(b, d.Revision)
+	b = le.AppendUint32(b, uint32(len(d.Partial)))
+	for _, p := range d.Partial {
+		union := p.Union
+		if p.Type == ResourceDeviceSpecific {
+			le.PutUint32(union[0:], uint32(len(p.Data)))
+		}
+		b = append(b, byte(p.Type), p.ShareDisposition)
+		b = le.AppendUint16(b, p.Flags)
+		b = append(b, union[:]...)
+		if p.Type == ResourceDeviceSpecific {
+			b = append(b, p.Data...)
+		}
+	}
+	return b
+}
+
+// parseFullResourceDescriptor 解析一个完整资源描述符，返回其占用的字节数。
+func parseFullResourceDescriptor(b []byte) (*FullResourceDescriptor, int, error) {
+	if len(b) < fullResourceHeaderSize {
+		return nil, 0, fmt.Errorf("full resource descriptor truncated")
+	}
+	le := binary.LittleEndian
+	d := &FullResourceDescriptor{
+		InterfaceType: int32(le.Uint32(b[0:])),
+		BusNumber:     le.Uint32(b[4:]),
+		Version:       le.Uint16(b[8:]),
+		Revision:      le.Uint16(b[10:]),
+	}
+	n := int(le.Uint32(b[12:]))
+	p := fullResourceHeaderSize
+	for i := 0; i < n; i++ {
+		if p+partialResourceSize > len(b) {
+			return nil, 0, fmt.Errorf("partial resource %d truncated", i)
+		}
+		r := PartialResource{Type: ResourceType(b[p]), ShareDisposition: b[p+1], Flags: le.Uint16(b[p+2:])}
+		copy(r.Union[:], b[p+4:p+partialResourceSize])
+		p += partialResourceSize
+		if r.Type == ResourceDeviceSpecific {
+			size := int(le.Uint32(r.Union[0:]))
+			if size > len(b)-p {
+				return nil, 0, fmt.Errorf("partial resource %d: device data size %d exceeds value", i, size)
+			}
+			r.Data = append([]byte{}, b[p:p+size]...)
+			p += size
+		}
+		d.Partial = append(d.Partial, r)
+	}
+	return d, p, nil
+}
+
+// ResourceList 对应CM_RESOURCE_LIST，是REG_RESOURCE_LIST值的内容。
+type ResourceList struct {
+	// Descriptors 完整资源描述符。
+	Descriptors []FullResourceDescriptor
+}
+
+// Type 返回REG_RESOURCE_LIST。
+func (l *ResourceList) Type() ValueType { return REG_RESOURCE_LIST }
+
+// Raw 返回编码后的数据。
+func (l *ResourceList) Raw() []byte {
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(l.Descriptors)))
+	for i := range l.Descriptors {
+		b = l.Descriptors[i].append(b)
+	}
+	return b
+}
+
+func (l *ResourceList) String() string {
+	parts := make([]string, len(l.Descriptors))
+	for i := range l.Descriptors {
+		parts[i] = l.Descriptors[i].String()
+	}
+	return strings.Join(parts, "; ")
+}
+
+func parseResourceList(b []byte) (*ResourceList, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("resource list truncated")
+	}
+	n := int(binary.LittleEndian.Uint32(b))
+	l := &ResourceList{}
+	p := 4
+	for i := 0; i < n; i++ {
+		d, size, err := parseFullResourceDescriptor(b[p:])
+		if err != nil {
+			return nil, fmt.Errorf("descriptor %d: %w", i, err)
+		}
+		l.Descriptors = append(l.Descriptors, *d)
+		p += size
+	}
+	return l, nil
+}
+
+// IoResource 对应IO_RESOURCE_DESCRIPTOR，描述设备可接受的一种资源范围。
+type IoResource struct {
+	// Option 首选、备选等选项标志。
+	Option uint8
+	// Type 资源类型。
+	Type ResourceType
+	// ShareDisposition 共享方式。
+	ShareDisposition uint8
+	// Flags 类型相关的标志。
+	Flags uint16
+	// Union 24字节的联合体u，端口和内存为Length、Alignment、MinimumAddress、MaximumAddress。
+	Union [24]byte
+}
+
+func (r IoResource) String() string {
+	if r.Type == ResourcePort || r.Type == ResourceMemory {
+		le := binary.LittleEndian
+		return fmt.Sprintf("%s 0x%X-0x%X len 0x%X", r.Type, le.Uint64(r.Union[8:]), le.Uint64(r.Union[16:]), le.Uint32(r.Union[0:]))
+	}
+	return r.Type.String()
+}
+
+// ResourceRequirementsList 对应IO_RESOURCE_REQUIREMENTS_LIST，是REG_RESOURCE_REQUIREMENTS_LIST值的内容。
+type ResourceRequirementsList struct {
+	// InterfaceType 总线接口类型。
+	InterfaceType int32
+	// BusNumber 总线号。
+	BusNumber uint32
+	// SlotNumber 插槽号。
+	SlotNumber uint32
+	// Alternatives 备选资源列表，设备可使用其中任意一组。
+	Alternatives []IoResourceList
+}
+
+// IoResourceList 对应IO_RESOURCE_LIST。
+type IoResourceList struct {
+	// Version 版本。
+	Version uint16
+	// Revision 修订号。
+	Revision uint16
+	// Descriptors 资源描述符。
+	Descriptors []IoResource
+}
+
+// Type 返回REG_RESOURCE_REQUIREMENTS_LIST。
+func (l *ResourceRequirementsList) Type() ValueType { return REG_RESOURCE_REQUIREMENTS_LIST }
+
+// Raw 返回编码后的数据，ListSize按内容重新计算，保留字段为0。
+func (l *ResourceRequirementsList) Raw() []byte {
+	le := binary.LittleEndian
+	b := make([]byte, requirementsHeaderSize)
+	le.PutUint32(b[4:], uint32(l.InterfaceType))
+	le.PutUint32(b[8:], l.BusNumber)
+	le.PutUint32(b[12:], l.SlotNumber)
+	le.PutUint32(b[28:], uint32(len(l.Alternatives)))
+	for _, alt := range l.Alternatives {
+		b = le.AppendUint16(b, alt.Version)
+		b = le.AppendUint16(b, alt.Revision)
+		b = le.AppendUint32(b, uint32(len(alt.Descriptors)))
+		for _, r := range alt.Descriptors {
+			b = append(b, r.Option, byte(r.Type), r.ShareDisposition, 0)
+			b = le.AppendUint16(b, r.Flags)
+			b = append(b, 0, 0)
+			b = append(b, r.Union[:]...)
+		}
+	}
+	le.PutUint32(b, uint32(len(b)))
+	return b
+}
+
+func (l *ResourceRequirementsList) String() string {
+	parts := make([]string, len(l.Alternatives))
+	for i, alt := range l.Alternatives {
+		ds := make([]string, len(alt.Descriptors))
+		for j, r := range alt.Descriptors {
+			ds[j] = r.String()
+		}
+		parts[i] = strings.Join(ds, ", ")
+	}
+	return fmt.Sprintf("interface %d bus %d slot %d: %s", l.InterfaceType, l.BusNumber, l.SlotNumber, strings.Join(parts, " | "))
+}
+
+func parseResourceRequirementsList(b []byte) (*ResourceRequirementsList, error) {
+	if len(b) < requirementsHeaderSize {
+		return nil, fmt.Errorf("requirements list truncated")
+	}
+	le := binary.LittleEndian
+	l := &ResourceRequirementsList{
+		InterfaceType: int32(le.Uint32(b[4:])),
+		BusNumber:     le.Uint32(b[8:]),
+		SlotNumber:    le.Uint32(b[12:]),
+	}
+	n := int(le.Uint32(b[28:]))
+	p := requirementsHeaderSize
+	for i := 0; i < n; i++ {
+		if p+8 > len(b) {
+			return nil, fmt.Errorf("alternative list %d truncated", i)
+		}
+		alt := IoResourceList{Version: le.Uint16(b[p:]), Revision: le.Uint16(b[p+2:])}
+		count := int(le.Uint32(b[p+4:]))
+		p += 8
+		if count > (len(b)-p)/ioResourceSize {
+			return nil, fmt.Errorf("alternative list %d: %d descriptors exceed value", i, count)
+		}
+		for j := 0; j < count; j++ {
+			r := IoResource{Option: b[p], Type: ResourceType(b[p+1]), ShareDisposition: b[p+2], Flags: le.Uint16(b[p+4:])}
+			copy(r.Union[:], b[p+8:p+ioResourceSize])
+			alt.Descriptors = append(alt.Descriptors, r)
+			p += ioResourceSize
+		}
+		l.Alternatives = append(l.Alternatives, alt)
+	}
+	return l, nil
+}
@@ -0,0 +1,177 @@
+package reg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 安全描述符控制标志。
+const (
+	SE_DACL_PRESENT  = 0x0004
+	SE_SACL_PRESENT  = 0x0010
+	SE_SELF_RELATIVE = 0x8000
+)
+
+// SecurityDescriptor 是解析后的自相对安全描述符。
+type SecurityDescriptor struct {
+	// Control 控制标志，如SE_DACL_PRESENT。
+	Control uint16
+	// Owner 所有者SID，如 S-1-5-32-544。
+	Owner string
+	// Group 主组SID。
+	Group string
+	// DACL 自主访问控制列表，Control未包含SE_DACL_PRESENT时为nil。
+	DACL []ACE
+	// SACL 系统访问控制列表，Control未包含SE_SACL_PRESENT时为nil。
+	SACL []ACE
+	// Raw 原始描述符数据。
+	Raw []byte
+}
+
+// ACE 是访问控制项。
+type ACE struct {
+	// Type ACE类型：0允许、1拒绝、2审核、0x11强制完整性标签等。
+	Type uint8
+	// Flags 继承等标志。
+	Flags uint8
+	// Mask 访问掩码。
+	Mask uint32
+	// SID 受托者SID，未知ACE类型时为空。
+	SID string
+}
+
+// ParseSecurityDescriptor 解析自相对格式的安全描述符（SECURITY_DESCRIPTOR_RELATIVE）。
+//   b - 描述符数据
+//   返回1 - 安全描述符
+//   返回2 - 数据截断或偏移越界时的错误，成功时为nil
+func ParseSecurityDescriptor(b []byte) (*SecurityDescriptor, error) {
+	if len(b) < 20 {
+		return nil, fmt.Errorf("reg: security descriptor too short: %d bytes", len(b))
+	}
+	le := binary.LittleEndian
+	sd := &SecurityDescriptor{Control: le.Uint16(b[2:]), Raw: append([]byte(nil), b...)}
+	var err error
+	if off := le.Uint32(b[4:]); off != 0 {
+		if sd.Owner, err = sidAt(b, off); err != nil {
+			return nil, fmt.Errorf("reg: owner: %w", err)
+		}
+	}
+	if off := le.Uint32(b[8:]); off != 0 {
+		if sd.Group, err = sidAt(b, off); err != nil {
+			return nil, fmt.Errorf("reg: group: %w", err)
+		}
+	}
+	if off := le.Uint32(b[12:]); off != 0 && sd.Control&SE_SACL_PRESENT != 0 {
+		if sd.SACL, err = parseACL(b, off); err != nil {
+			return nil, fmt.Errorf("reg: sacl: %w", err)
+		}
+	}
+	if off := le.Uint32(b[16:]); off != 0 && sd.Control&SE_DACL_PRESENT != 0 {
+		if sd.DACL, err = parseACL(b, off); err != nil {
+			return nil, fmt.Errorf("reg: dacl: %w", err)
+		}
+	}
+	return sd, nil
+}
+
+func sidAt(b []byte, off uint32) (string, error) {
+	if int64(off) >= int64(len(b)) {
+		return "", fmt.Errorf("sid offset %d out of range", off)
+	}
+	return formatSID(b[off:])
+}
+
+func parseACL(b []byte, off uint32) ([]ACE, error) {
+	if int64(off)+8 > int64(len(b)) {
+		return nil, fmt.Errorf("acl offset %d out of range", off)
+	}
+	le := binary.LittleEndian
+	acl := b[off:]
+	size := int(le.Uint16(acl[2:]))
+	if size < 8 || size > len(acl) {
+		return nil, fmt.Errorf("invalid acl size %d", size)
+	}
+	acl = acl[:size]
+	count := int(le.Uint16(acl[4:]))
+	aces := make([]ACE, 0, count)
+	p := 8
+	for i := 0; i < count; i++ {
+		if p+4 > len(acl) {
+			return nil, fmt.Errorf("ace %d truncated", i)
+		}
+		n := int(le.Uint16(acl[p+2:]))
+		if n < 4 || p+n > len(acl) {
+			return nil, fmt.Errorf("ace %d: invalid size %d", i, n)
+		}
+		ace, err := parseACE(acl[p : p+n])
+		if err != nil {
+			return nil, fmt.Errorf("ace %d: %w", i, err)
+		}
+		aces = append(aces, ace)
+		p += n
+	}
+	return aces, nil
+}
+
+func parseACE(b []byte) (ACE, error) {
+	ace := ACE{Type: b[0], Flags: b[1]}
+	if len(b) < 8 {
+		return ace, nil
+	}
+	ace.Mask = binary.LittleEndian.Uint32(b[4:])
+	sidOff := 8
+	switch ace.Type {
+	case 0x00, 0x01, 0x02, 0x03, 0x09, 0x0A, 0x0D, 0x0E, 0x11, 0x12, 0x13:
+	case 0x05, 0x06, 0x07, 0x08, 0x0B, 0x0C, 0x0F, 0x10:
+		// 对象ACE：标志后可能跟ObjectType与InheritedObjectType两个GUID。
+		if len(b) < 12 {
+			return ace, fmt.Errorf("object ace truncated")
+		}
+		flags := binary.LittleEndian.Uint32(b[8:])
+		sidOff = 12
+		if flags&1 != 0 {
+			sidOff += 16
+		}
+		if flags&2 != 0 {
+			sidOff += 16
+		}
+	default:
+		return ace, nil
+	}
+	if sidOff >= len(b) {
+		return ace, fmt.Errorf("sid offset %d out of range", sidOff)
+	}
+	sid, err := formatSID(b[sidOff:])
+	if err != nil {
+		return ace, err
+	}
+	ace.SID = sid
+	return ace, nil
+}
+
+// formatSID 将二进制SID格式化为 S-1-... 字符串。
+func formatSID(b []byte) (string, error) {
+	if len(b) < 8 {
+		return "", fmt.Errorf("sid too short: %d bytes", len(b))
+	}
+	n := int(b[1])
+	if len(b) < 8+4*n {
+		return "", fmt.Errorf("sid with %d sub-authorities truncated", n)
+	}
+	var auth uint64
+	for _, c := range b[2:8] {
+		auth = auth<<8 | uint64(c)
+	}
+	var sb strings.Builder
+	sb.WriteString("S-")
+	sb.WriteString(strconv.Itoa(int(b[0])))
+	sb.WriteString("-")
+	sb.WriteString(strconv.FormatUint(auth, 10))
+	for i := 0; i < n; i++ {
+		sb.WriteString("-")
+		sb.WriteString(strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b[8+4*i:])), 10))
+	}
+	return sb.String(), nil
+}
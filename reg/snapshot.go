@@ -0,0 +1,404 @@
+package reg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot 是某个注册表子树在某一时刻的完整内容，可以JSON保存并与另一个快照比较。
+type Snapshot struct {
+	// Root 起始键的路径，本机注册表为含根键的完整路径，hive与内存树为相对路径。
+	Root string `json:"root"`
+	// Taken 采集时间。
+	Taken time.Time `json:"taken"`
+	// Keys 先序排列的全部键。
+	Keys []SnapshotKey `json:"keys"`
+	// Errors 无法读取而被跳过的键，如管理员也无权访问的子键。
+	Errors []SnapshotError `json:"errors,omitempty"`
+}
+
+// SnapshotError 是采集快照时被跳过的键及原因。
+type SnapshotError struct {
+	// Path 相对Root的路径。
+	Path string `json:"path"`
+	// Error 错误信息。
+	Error string `json:"error"`
+}
+
+// SnapshotKey 是快照中的一个键。
+type SnapshotKey struct {
+	// Path 相对Root的路径，起始键为空字符串。
+	Path string `json:"path"`
+	// LastWrite 最后写入时间。
+	LastWrite time.Time `json:"last_write"`
+	// Values 全部值。
+	Values []Value `json:"values,omitempty"`
+}
+
+// TakeSnapshot 遍历键及其全部子键生成快照，k可以来自OpenLiveKey、Hive.Key或MemKey。
+// 无法打开或读取的子键被跳过，其路径和错误记录在Snapshot.Errors中，
+// 以便在本机注册表中存在无权访问的子键时仍能得到其余部分的快照；
+// 损坏的hive中被重复列出的键只加入一次，其余出现同样记录在Errors中。
+//   k - 起始键
+//   返回1 - 快照
+//   返回2 - 起始键的值无法读取时的错误，成功时为nil
+func TakeSnapshot(k Key) (*Snapshot, error) {
+	s := &Snapshot{Root: k.Path(), Taken: time.Now().UTC()}
+	values, err := k.Values()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", k.Path(), err)
+	}
+	s.Keys = append(s.Keys, SnapshotKey{LastWrite: k.LastWrite(), Values: values})
+	w := &snapshotWalker{s: s, seen: map[uint32]bool{}}
+	w.visit(k)
+	w.addSubKeys(k, "", 0)
+	return s, nil
+}
+
+// snapshotWalker 是TakeSnapshot的遍历状态。
+type snapshotWalker struct {
+	s *Snapshot
+	// seen 已加入的hive键的nk偏移。损坏的子键索引可以多次列出同一个键，
+	// 逐层重复时遍历次数随深度指数增长，因此每个键只加入一次。
+	seen map[uint32]bool
+}
+
+// visit 记录k已被访问，k是此前访问过的hive键时返回false。
+func (w *snapshotWalker) visit(k Key) bool {
+	hk, ok := k.(*hiveKey)
+	if !ok {
+		return true
+	}
+	if w.seen[hk.k.offset] {
+		return false
+	}
+	w.seen[hk.k.offset] = true
+	return true
+}
+
+// addSubKeys 先序加入k的全部子键，错误记录后继续。
+//   rel - k相对Root的路径
+func (w *snapshotWalker) addSubKeys(k Key, rel string, depth int) {
+	s := w.s
+	if depth >= maxKeyDepth {
+		s.Errors = append(s.Errors, SnapshotError{Path: rel, Error: "key nested too deep"})
+		return
+	}
+	names, err := k.SubKeyNames()
+	if err != nil {
+		s.Errors = append(s.Errors, SnapshotError{Path: rel, Error: err.Error()})
+		return
+	}
+	for _, name := range names {
+		path := joinRoot(rel, name)
+		sub, err := k.OpenSubKey(name)
+		if err != nil {
+			s.Errors = append(s.Errors, SnapshotError{Path: path, Error: err.Error()})
+			continue
+		}
+		if !w.visit(sub) {
+			s.Errors = append(s.Errors, SnapshotError{Path: path, Error: "key listed more than once"})
+			sub.Close()
+			continue
+		}
+		values, err := sub.Values()
+		if err != nil {
+			s.Errors = append(s.Errors, SnapshotError{Path: path, Error: err.Error()})
+		} else {
+			s.Keys = append(s.Keys, SnapshotKey{Path: path, LastWrite: sub.LastWrite(), Values: values})
+			w.addSubKeys(sub, path, depth+1)
+		}
+		sub.Close()
+	}
+}
+
+// LoadSnapshot 读取Save保存的快照文件。
+//   path - 文件路径
+//   返回1 - 快照
+//   返回2 - 读取或解析失败时的错误，成功时为nil
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	s := &Snapshot{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parse snapshot %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save 将快照以JSON格式写入文件。
+//   path - 文件路径
+//   返回 - 写入失败时的错误，成功时为nil
+func (s *Snapshot) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	return nil
+}
+
+// ChangeKind 是差异的类型。
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeRemoved  ChangeKind = "removed"
+	ChangeModified ChangeKind = "modified"
+)
+
+// KeyChange 是一个键的差异，键的值变化单独记录在ValueChange中。
+type KeyChange struct {
+	// Path 相对Root的路径。
+	Path string `json:"path"`
+	// Kind 新增、删除，或最后写入时间改变（modified）。
+	Kind ChangeKind `json:"kind"`
+	// OldLastWrite 旧快照中的最后写入时间，新增的键为零值。
+	OldLastWrite time.Time `json:"old_last_write,omitempty"`
+	// NewLastWrite 新快照中的最后写入时间，删除的键为零值。
+	NewLastWrite time.Time `json:"new_last_write,omitempty"`
+}
+
+// ValueChange 是一个值的差异，新增和删除的键下的全部值也逐个列出。
+type ValueChange struct {
+	// Path 所属键相对Root的路径。
+	Path string `json:"path"`
+	// Name 值名称。
+	Name string `json:"name"`
+	// Kind 新增、删除，或类型、数据改变（modified）。
+	Kind ChangeKind `json:"kind"`
+	// Old 旧值，新增时为nil。
+	Old *Value `json:"old,omitempty"`
+	// New 新值，删除时为nil。
+	New *Value `json:"new,omitempty"`
+}
+
+// Diff 是两个快照之间的结构化差异，键和值均按路径（不区分大小写）排序。
+type Diff struct {
+	// Root 新快照的起始键路径。
+	Root string `json:"root"`
+	// Keys 键的差异。
+	Keys []KeyChange `json:"keys"`
+	// Values 值的差异。
+	Values []ValueChange `json:"values"`
+}
+
+// DiffSnapshots 比较两个快照，键路径和值名称不区分大小写。
+// 任一快照中因错误被跳过的键及其子键不参与比较，避免将无权访问的键报告为新增或删除。
+//   old - 旧快照
+//   new - 新快照
+//   返回 - 从old变为new的差异
+func DiffSnapshots(old, new *Snapshot) *Diff {
+	d := &Diff{Root: new.Root, Keys: []KeyChange{}, Values: []ValueChange{}}
+	skipped := append(append([]SnapshotError(nil), old.Errors...), new.Errors...)
+	oldKeys := snapshotIndex(old, skipped)
+	newKeys := snapshotIndex(new, skipped)
+	for id, nk := range newKeys {
+		ok, found := oldKeys[id]
+		if !found {
+			d.Keys = append(d.Keys, KeyChange{Path: nk.Path, Kind: ChangeAdded, NewLastWrite: nk.LastWrite})
+			d.diffValues(nk.Path, nil, nk.Values)
+			continue
+		}
+		if !ok.LastWrite.Equal(nk.LastWrite) {
+			d.Keys = append(d.Keys, KeyChange{Path: nk.Path, Kind: ChangeModified, OldLastWrite: ok.LastWrite, NewLastWrite: nk.LastWrite})
+		}
+		d.diffValues(nk.Path, ok.Values, nk.Values)
+	}
+	for id, ok := range oldKeys {
+		if _, found := newKeys[id]; !found {
+			d.Keys = append(d.Keys, KeyChange{Path: ok.Path, Kind: ChangeRemoved, OldLastWrite: ok.LastWrite})
+			d.diffValues(ok.Path, ok.Values, nil)
+		}
+	}
+	sort.SliceStable(d.Keys, func(i, j int) bool {
+		return strings.ToUpper(d.Keys[i].Path) < strings.ToUpper(d.Keys[j].Path)
+	})
+	sort.SliceStable(d.Values, func(i, j int) bool {
+		pi, pj := strings.ToUpper(d.Values[i].Path), strings.ToUpper(d.Values[j].Path)
+		if pi != pj {
+			return pi < pj
+		}
+		return strings.ToUpper(d.Values[i].Name) < strings.ToUpper(d.Values[j].Name)
+	})
+	return d
+}
+
+// snapshotIndex 按大写路径索引快照中的键，忽略位于skipped中任一路径之下的键。
+func snapshotIndex(s *Snapshot, skipped []SnapshotError) map[string]*SnapshotKey {
+	m := make(map[string]*SnapshotKey, len(s.Keys))
+	for i := range s.Keys {
+		id := strings.ToUpper(s.Keys[i].Path)
+		if !underSkipped(id, skipped) {
+			m[id] = &s.Keys[i]
+		}
+	}
+	return m
+}
+
+func underSkipped(id string, skipped []SnapshotError) bool {
+	for _, e := range skipped {
+		p := strings.ToUpper(e.Path)
+		switch {
+		case p == "":
+			// 起始键的子键无法枚举，起始键本身的值仍然可以比较。
+			if id != "" {
+				return true
+			}
+		case id == p || strings.HasPrefix(id, p+`\`):
+			return true
+		}
+	}
+	return false
+}
+
+// diffValues 比较同一个键的新旧值列表。
+func (d *Diff) diffValues(path string, old, new []Value) {
+	oldByName := make(map[string]*Value, len(old))
+	for i := range old {
+		oldByName[strings.ToUpper(old[i].Name)] = &old[i]
+	}
+	seen := make(map[string]bool, len(new))
+	for i := range new {
+		nv := &new[i]
+		id := strings.ToUpper(nv.Name)
+		seen[id] = true
+		ov, found := oldByName[id]
+		switch {
+		case !found:
+			d.Values = append(d.Values, ValueChange{Path: path, Name: nv.Name, Kind: ChangeAdded, New: nv})
+		case ov.Type != nv.Type || string(ov.Data) != string(nv.Data):
+			d.Values = append(d.Values, ValueChange{Path: path, Name: nv.Name, Kind: ChangeModified, Old: ov, New: nv})
+		}
+	}
+	for i := range old {
+		if !seen[strings.ToUpper(old[i].Name)] {
+			d.Values = append(d.Values, ValueChange{Path: path, Name: old[i].Name, Kind: ChangeRemoved, Old: &old[i]})
+		}
+	}
+}
+
+// Empty 报告两个快照是否没有差异。
+func (d *Diff) Empty() bool {
+	return len(d.Keys) == 0 && len(d.Values) == 0
+}
+
+// String 返回逐行的文本差异：+ 新增、- 删除、~ 修改，路径包含Root。
+//   返回 - 文本差异，没有差异时为空字符串
+func (d *Diff) String() string {
+	var sb strings.Builder
+	marks := map[ChangeKind]string{ChangeAdded: "+", ChangeRemoved: "-", ChangeModified: "~"}
+	for _, k := range d.Keys {
+		fmt.Fprintf(&sb, "%s key   %s", marks[k.Kind], joinRoot(d.Root, k.Path))
+		if k.Kind == ChangeModified {
+			fmt.Fprintf(&sb, " (last write %s -> %s)", k.OldLastWrite.Format(time.RFC3339), k.NewLastWrite.Format(time.RFC3339))
+		}
+		sb.WriteString("\n")
+	}
+	for _, v := range d.Values {
+		name := v.Name
+		if name == "" {
+			name = "(Default)"
+		}
+		fmt.Fprintf(&sb, "%s value %s\\%s: ", marks[v.Kind], joinRoot(d.Root, v.Path), name)
+		switch v.Kind {
+		case ChangeAdded:
+			fmt.Fprintf(&sb, "%s %s", v.New.Type, displayValue(*v.New))
+		case ChangeRemoved:
+			fmt.Fprintf(&sb, "%s %s", v.Old.Type, displayValue(*v.Old))
+		default:
+			fmt.Fprintf(&sb, "%s %s -> %s %s", v.Old.Type, displayValue(*v.Old), v.New.Type, displayValue(*v.New))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// JSON 返回缩进的JSON差异，值包含类型、原始数据（base64）和显示形式text。
+//   返回1 - JSON字节
+//   返回2 - 编码失败时的错误，成功时为nil
+func (d *Diff) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// RegFile 生成将旧快照变为新快照的.reg补丁：删除的键写为 [-键]（只写最上层），
+// 新增和修改的值写入对应键，删除的值写为 "name"=-。
+//   root - 补丁中使用的根路径，如 HKEY_LOCAL_MACHINE\SOFTWARE；为空时使用Diff.Root
+//   返回 - .reg文件，版本为RegFileVersion5
+func (d *Diff) RegFile(root string) *RegFile {
+	if root == "" {
+		root = d.Root
+	}
+	f := &RegFile{Version: RegFileVersion5}
+	removed := make(map[string]bool)
+	for _, k := range d.Keys {
+		if k.Kind != ChangeRemoved {
+			continue
+		}
+		removed[strings.ToUpper(k.Path)] = true
+		if !removedParent(removed, k.Path) {
+			f.Keys = append(f.Keys, RegFileKey{Path: joinRoot(root, k.Path), Delete: true})
+		}
+	}
+	// 新增的键即使没有值也需要出现在补丁中。
+	index := make(map[string]int)
+	keyFor := func(path string) *RegFileKey {
+		id := strings.ToUpper(path)
+		if i, ok := index[id]; ok {
+			return &f.Keys[i]
+		}
+		f.Keys = append(f.Keys, RegFileKey{Path: joinRoot(root, path)})
+		index[id] = len(f.Keys) - 1
+		return &f.Keys[len(f.Keys)-1]
+	}
+	for _, k := range d.Keys {
+		if k.Kind == ChangeAdded {
+			keyFor(k.Path)
+		}
+	}
+	for _, v := range d.Values {
+		if removed[strings.ToUpper(v.Path)] {
+			continue
+		}
+		rk := keyFor(v.Path)
+		if v.Kind == ChangeRemoved {
+			rk.Values = append(rk.Values, RegFileValue{Value: Value{Name: v.Name}, Delete: true})
+		} else {
+			nv := *v.New
+			nv.Deleted = false
+			rk.Values = append(rk.Values, RegFileValue{Value: nv})
+		}
+	}
+	return f
+}
+
+// removedParent 报告路径的某一级父键是否已被删除。
+func removedParent(removed map[string]bool, path string) bool {
+	id := strings.ToUpper(path)
+	for i := strings.LastIndex(id, `\`); i >= 0; i = strings.LastIndex(id, `\`) {
+		id = id[:i]
+		if removed[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// joinRoot 将相对路径拼接到根路径之后。
+func joinRoot(root, path string) string {
+	switch {
+	case root == "":
+		return path
+	case path == "":
+		return root
+	}
+	return root + `\` + path
+}
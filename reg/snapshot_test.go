@@ -0,0 +1,271 @@
+package reg
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// snapshotTrees 构造变更前后的两棵内存树。
+func snapshotTrees() (old, new *MemKey) {
+	t1 := testWriteTime
+	t2 := testWriteTime.Add(time.Hour)
+
+	old = NewMemKey("")
+	run := old.CreateKey(`Run`)
+	run.SetLastWrite(t1)
+	run.SetValue(sz("Updater", `C:\a.exe`))
+	run.SetValue(dword("Keep", 1))
+	old.CreateKey(`Run\Gone`).SetValue(sz("X", "x"))
+	old.CreateKey(`Run\Gone\Child`).SetValue(dword("Y", 2))
+	old.CreateKey(`Services\Svc`).SetValue(dword("Start", 2))
+
+	new = NewMemKey("")
+	run = new.CreateKey(`Run`)
+	run.SetLastWrite(t2)
+	run.SetValue(sz("Updater", `C:\b.exe`))
+	run.SetValue(dword("keep", 1))
+	run.SetValue(sz("New", `C:\new.exe`))
+	new.CreateKey(`Services\Svc`).SetValue(dword("Start", 2))
+	new.CreateKey(`Services\Svc2`).SetValue(dword("Start", 3))
+	new.CreateKey(`Services\Empty`)
+	return old, new
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	oldKey, newKey := snapshotTrees()
+	old, err := TakeSnapshot(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := TakeSnapshot(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := DiffSnapshots(old, new)
+	var keys []string
+	for _, k := range d.Keys {
+		keys = append(keys, string(k.Kind)+" "+k.Path)
+	}
+	wantKeys := []string{"modified Run", `removed Run\Gone`, `removed Run\Gone\Child`, `added Services\Empty`, `added Services\Svc2`}
+	if !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("keys = %q, want %q", keys, wantKeys)
+	}
+	var values []string
+	for _, v := range d.Values {
+		values = append(values, string(v.Kind)+" "+v.Path+":"+v.Name)
+	}
+	wantValues := []string{"added Run:New", "modified Run:Updater", `removed Run\Gone:X`, `removed Run\Gone\Child:Y`, `added Services\Svc2:Start`}
+	if !reflect.DeepEqual(values, wantValues) {
+		t.Errorf("values = %q, want %q", values, wantValues)
+	}
+	if d.Values[1].Old.String() != `C:\a.exe` || d.Values[1].New.String() != `C:\b.exe` {
+		t.Errorf("modified value = %+v", d.Values[1])
+	}
+
+	text := d.String()
+	for _, line := range []string{
+		`~ key   Run (last write 2024-05-01T12:30:00Z -> 2024-05-01T13:30:00Z)`,
+		`- key   Run\Gone`,
+		`+ value Services\Svc2\Start: REG_DWORD 3 (0x3)`,
+		`~ value Run\Updater: REG_SZ C:\a.exe -> REG_SZ C:\b.exe`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("text diff missing %q:\n%s", line, text)
+		}
+	}
+
+	data, err := d.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Diff
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Values[4].New, d.Values[4].New) || !strings.Contains(string(data), `"text": "3 (0x3)"`) {
+		t.Errorf("JSON = %s", data)
+	}
+
+	if !DiffSnapshots(new, new).Empty() {
+		t.Error("diff of identical snapshots is not empty")
+	}
+}
+
+func TestDiffRegFile(t *testing.T) {
+	oldKey, newKey := snapshotTrees()
+	old, _ := TakeSnapshot(oldKey)
+	new, _ := TakeSnapshot(newKey)
+	patch := DiffSnapshots(old, new).RegFile(`HKEY_CURRENT_USER\Software`)
+
+	var paths []string
+	for _, k := range patch.Keys {
+		p := k.Path
+		if k.Delete {
+			p = "-" + p
+		}
+		paths = append(paths, p)
+	}
+	want := []string{
+		`-HKEY_CURRENT_USER\Software\Run\Gone`, `HKEY_CURRENT_USER\Software\Services\Empty`,
+		`HKEY_CURRENT_USER\Software\Services\Svc2`, `HKEY_CURRENT_USER\Software\Run`,
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("patch keys = %q, want %q", paths, want)
+	}
+
+	// 将补丁应用到旧树上应得到与新树相同的键和值。
+	parsed, err := ParseRegFile([]byte(patch.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := NewMemKey("")
+	root.CreateKey(`HKEY_CURRENT_USER\Software`)
+	root.ImportRegFile(&RegFile{Version: RegFileVersion5, Keys: regFileFromSnapshot(old, `HKEY_CURRENT_USER\Software`)})
+	root.ImportRegFile(parsed)
+	patched, err := root.OpenSubKey(`HKEY_CURRENT_USER\Software`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := TakeSnapshot(patched)
+	for _, c := range DiffSnapshots(new, got).Keys {
+		if c.Kind != ChangeModified {
+			t.Errorf("patched tree: %s %s", c.Kind, c.Path)
+		}
+	}
+	if vs := DiffSnapshots(new, got).Values; len(vs) != 0 {
+		t.Errorf("patched tree values differ: %+v", vs)
+	}
+}
+
+// regFileFromSnapshot 将快照转换为.reg键列表，用于在内存树中重建快照。
+func regFileFromSnapshot(s *Snapshot, root string) []RegFileKey {
+	var keys []RegFileKey
+	for _, k := range s.Keys {
+		rk := RegFileKey{Path: joinRoot(root, k.Path)}
+		for _, v := range k.Values {
+			rk.Values = append(rk.Values, RegFileValue{Value: v})
+		}
+		keys = append(keys, rk)
+	}
+	return keys
+}
+
+func TestSnapshotSaveLoad(t *testing.T) {
+	hive, err := buildTestHive(t).Key("ControlSet001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := TakeSnapshot(hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Root != "ControlSet001" || len(s.Keys) != 7 || s.Keys[0].Path != "" || s.Keys[2].Path != `Services\Alpha` {
+		t.Fatalf("snapshot = %+v", s)
+	}
+
+	path := filepath.Join(t.TempDir(), "snap.json")
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Taken.Equal(s.Taken) || !DiffSnapshots(s, loaded).Empty() {
+		t.Errorf("loaded snapshot differs: %+v", DiffSnapshots(s, loaded))
+	}
+	if _, err := LoadSnapshot(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadSnapshot of missing file succeeded")
+	}
+}
+
+// deniedKey 包装Key，打开指定名称的子键时返回拒绝访问，模拟本机注册表中无权访问的键。
+type deniedKey struct {
+	Key
+	deny string
+}
+
+var errAccessDenied = errors.New("Access is denied.")
+
+func (k deniedKey) OpenSubKey(path string) (Key, error) {
+	if strings.EqualFold(path, k.deny) {
+		return nil, errAccessDenied
+	}
+	sub, err := k.Key.OpenSubKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return deniedKey{Key: sub, deny: k.deny}, nil
+}
+
+func TestTakeSnapshotSkipsUnreadable(t *testing.T) {
+	tree, _ := snapshotTrees()
+	s, err := TakeSnapshot(deniedKey{Key: tree, deny: "Gone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, k := range s.Keys {
+		paths = append(paths, k.Path)
+	}
+	if want := []string{"", "Run", "Services", `Services\Svc`}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("keys = %q, want %q", paths, want)
+	}
+	if want := []SnapshotError{{Path: `Run\Gone`, Error: "Access is denied."}}; !reflect.DeepEqual(s.Errors, want) {
+		t.Errorf("errors = %+v", s.Errors)
+	}
+
+	// 被跳过的子树不会被报告为删除或新增。
+	full, _ := TakeSnapshot(tree)
+	if d := DiffSnapshots(full, s); !d.Empty() {
+		t.Errorf("diff with skipped key:\n%s", d)
+	}
+	if d := DiffSnapshots(s, full); !d.Empty() {
+		t.Errorf("reverse diff with skipped key:\n%s", d)
+	}
+}
+
+func TestTakeSnapshotCorruptIndex(t *testing.T) {
+	// ControlSet001的子键索引两次列出Services。
+	data := newHiveBuilder().build(testTree())
+	h := mustParse(t, data)
+	cs, err := h.OpenKey("ControlSet001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := h.cell(cs.subkeyList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(list[12:16], list[4:8])
+	k, err := h.Key("ControlSet001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := TakeSnapshot(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Keys) != 5 || !reflect.DeepEqual(s.Errors, []SnapshotError{{Path: "Services", Error: "key listed more than once"}}) {
+		t.Errorf("duplicate subkey: %d keys, errors %+v", len(s.Keys), s.Errors)
+	}
+
+	// 子键索引指回键自身时，SubKeys拒绝该索引，遍历正常结束。
+	k, err = mustParse(t, selfLinkedHive(t)).Key("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = TakeSnapshot(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Errors) != 1 || s.Errors[0].Path != "ControlSet001" || !strings.Contains(s.Errors[0].Error, "subkey parent") {
+		t.Errorf("self-linked subkey: errors %+v", s.Errors)
+	}
+}
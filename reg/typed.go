@@ -0,0 +1,168 @@
+package reg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// TypedValue 是按类型解码后的注册表值数据，由Value.Typed返回，也可通过NewValue或SetValue写回。
+//   StringValue（REG_SZ）、ExpandStringValue（REG_EXPAND_SZ）、LinkValue（REG_LINK）、
+//   MultiStringValue（REG_MULTI_SZ）、DWordValue（REG_DWORD）、DWordBigEndianValue（REG_DWORD_BIG_ENDIAN）、
+//   QWordValue（REG_QWORD）、BinaryValue（REG_BINARY）、NoneValue（REG_NONE）、
+//   *ResourceList（REG_RESOURCE_LIST）、*FullResourceDescriptor（REG_FULL_RESOURCE_DESCRIPTOR）、
+//   *ResourceRequirementsList（REG_RESOURCE_REQUIREMENTS_LIST）、UnknownValue（其他类型）
+type TypedValue interface {
+	// Type 返回值类型。
+	Type() ValueType
+	// Raw 返回写入注册表的原始数据，字符串为以NUL结尾的UTF-16LE。
+	Raw() []byte
+	// String 返回便于阅读的表示。
+	String() string
+}
+
+// StringValue 是REG_SZ值。
+type StringValue string
+
+// ExpandStringValue 是REG_EXPAND_SZ值，包含未展开的环境变量引用。
+type ExpandStringValue string
+
+// LinkValue 是REG_LINK值，保存符号链接目标的注册表内核路径，原始数据不含结尾NUL。
+type LinkValue string
+
+// MultiStringValue 是REG_MULTI_SZ值。
+type MultiStringValue []string
+
+// DWordValue 是REG_DWORD值。
+type DWordValue uint32
+
+// DWordBigEndianValue 是REG_DWORD_BIG_ENDIAN值。
+type DWordBigEndianValue uint32
+
+// QWordValue 是REG_QWORD值。
+type QWordValue uint64
+
+// BinaryValue 是REG_BINARY值。
+type BinaryValue []byte
+
+// NoneValue 是REG_NONE值，数据可以不为空。
+type NoneValue []byte
+
+// UnknownValue 是未定义类型的值，原样保留类型和数据。
+type UnknownValue struct {
+	// ValueType 值类型。
+	ValueType ValueType
+	// Data 原始数据。
+	Data []byte
+}
+
+func (v StringValue) Type() ValueType         { return REG_SZ }
+func (v ExpandStringValue) Type() ValueType   { return REG_EXPAND_SZ }
+func (v LinkValue) Type() ValueType           { return REG_LINK }
+func (v MultiStringValue) Type() ValueType    { return REG_MULTI_SZ }
+func (v DWordValue) Type() ValueType          { return REG_DWORD }
+func (v DWordBigEndianValue) Type() ValueType { return REG_DWORD_BIG_ENDIAN }
+func (v QWordValue) Type() ValueType          { return REG_QWORD }
+func (v BinaryValue) Type() ValueType         { return REG_BINARY }
+func (v NoneValue) Type() ValueType           { return REG_NONE }
+func (v UnknownValue) Type() ValueType        { return v.ValueType }
+
+func (v StringValue) Raw() []byte       { return encodeUTF16(string(v) + "\x00") }
+func (v ExpandStringValue) Raw() []byte { return encodeUTF16(string(v) + "\x00") }
+func (v LinkValue) Raw() []byte         { return encodeUTF16(string(v)) }
+func (v MultiStringValue) Raw() []byte {
+	var sb strings.Builder
+	for _, s := range v {
+		sb.WriteString(s + "\x00")
+	}
+	sb.WriteString("\x00")
+	return encodeUTF16(sb.String())
+}
+func (v DWordValue) Raw() []byte { return binary.LittleEndian.AppendUint32(nil, uint32(v)) }
+func (v DWordBigEndianValue) Raw() []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(v))
+}
+func (v QWordValue) Raw() []byte   { return binary.LittleEndian.AppendUint64(nil, uint64(v)) }
+func (v BinaryValue) Raw() []byte  { return append([]byte{}, v...) }
+func (v NoneValue) Raw() []byte    { return append([]byte{}, v...) }
+func (v UnknownValue) Raw() []byte { return append([]byte{}, v.Data...) }
+
+func (v StringValue) String() string         { return string(v) }
+func (v ExpandStringValue) String() string   { return string(v) }
+func (v LinkValue) String() string           { return string(v) }
+func (v MultiStringValue) String() string    { return strings.Join(v, ", ") }
+func (v DWordValue) String() string          { return fmt.Sprintf("%d (0x%X)", uint32(v), uint32(v)) }
+func (v DWordBigEndianValue) String() string { return fmt.Sprintf("%d (0x%X)", uint32(v), uint32(v)) }
+func (v QWordValue) String() string          { return fmt.Sprintf("%d (0x%X)", uint64(v), uint64(v)) }
+func (v BinaryValue) String() string         { return fmt.Sprintf("%X", []byte(v)) }
+func (v NoneValue) String() string           { return fmt.Sprintf("%X", []byte(v)) }
+func (v UnknownValue) String() string        { return fmt.Sprintf("%X", v.Data) }
+
+// NewValue 由类型化数据构造Value。
+//   name - 值名称
+//   tv - 类型化数据
+//   返回 - 类型和原始数据取自tv的值
+func NewValue(name string, tv TypedValue) Value {
+	return Value{Name: name, Type: tv.Type(), Data: tv.Raw()}
+}
+
+// Raw 返回原始数据的副本，用于类型化解码不适用的场景。
+//   返回 - 原始数据
+func (v Value) Raw() []byte {
+	return append([]byte{}, v.Data...)
+}
+
+// Typed 按值类型解码数据，具体类型见TypedValue。
+//   返回1 - 类型化数据
+//   返回2 - 整数长度不足或资源列表结构损坏时的错误，此时仍可通过Raw读取原始数据
+func (v Value) Typed() (TypedValue, error) {
+	switch v.Type {
+	case REG_SZ:
+		return StringValue(decodeUTF16(v.Data)), nil
+	case REG_EXPAND_SZ:
+		return ExpandStringValue(decodeUTF16(v.Data)), nil
+	case REG_LINK:
+		return LinkValue(decodeUTF16(v.Data)), nil
+	case REG_MULTI_SZ:
+		ss, err := v.AsStrings()
+		return MultiStringValue(ss), err
+	case REG_DWORD, REG_DWORD_BIG_ENDIAN:
+		n, err := v.AsInteger()
+		if err != nil {
+			return nil, err
+		}
+		if v.Type == REG_DWORD_BIG_ENDIAN {
+			return DWordBigEndianValue(n), nil
+		}
+		return DWordValue(n), nil
+	case REG_QWORD:
+		n, err := v.AsInteger()
+		if err != nil {
+			return nil, err
+		}
+		return QWordValue(n), nil
+	case REG_BINARY:
+		return BinaryValue(v.Raw()), nil
+	case REG_NONE:
+		return NoneValue(v.Raw()), nil
+	case REG_RESOURCE_LIST:
+		l, err := parseResourceList(v.Data)
+		if err != nil {
+			return nil, fmt.Errorf("reg: %s: %w", v.Name, err)
+		}
+		return l, nil
+	case REG_FULL_RESOURCE_DESCRIPTOR:
+		d, _, err := parseFullResourceDescriptor(v.Data)
+		if err != nil {
+			return nil, fmt.Errorf("reg: %s: %w", v.Name, err)
+		}
+		return d, nil
+	case REG_RESOURCE_REQUIREMENTS_LIST:
+		l, err := parseResourceRequirementsList(v.Data)
+		if err != nil {
+			return nil, fmt.Errorf("reg: %s: %w", v.Name, err)
+		}
+		return l, nil
+	}
+	return UnknownValue{ValueType: v.Type, Data: v.Raw()}, nil
+}
@@ -0,0 +1,155 @@
+package reg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTypedRoundTrip(t *testing.T) {
+	serial := &FullResourceDescriptor{InterfaceType: 1, BusNumber: 0, Version: 1, Revision: 1}
+	port := PartialResource{Type: ResourcePort, ShareDisposition: 1, Flags: 5}
+	binary.LittleEndian.PutUint64(port.Union[0:], 0x3F8)
+	binary.LittleEndian.PutUint32(port.Union[8:], 8)
+	irq := PartialResource{Type: ResourceInterrupt, ShareDisposition: 1}
+	binary.LittleEndian.PutUint16(irq.Union[0:], 4)
+	binary.LittleEndian.PutUint32(irq.Union[4:], 4)
+	binary.LittleEndian.PutUint64(irq.Union[8:], 0xF)
+	dev := PartialResource{Type: ResourceDeviceSpecific, Data: []byte{0x00, 0xC2, 0x01, 0x00}}
+	dev.Union[0] = 4 // DataSize
+	serial.Partial = []PartialResource{port, irq, dev}
+
+	mem := IoResource{Option: 0, Type: ResourceMemory, ShareDisposition: 1}
+	binary.LittleEndian.PutUint32(mem.Union[0:], 0x1000)
+	binary.LittleEndian.PutUint64(mem.Union[8:], 0xFED00000)
+	binary.LittleEndian.PutUint64(mem.Union[16:], 0xFED00FFF)
+	req := &ResourceRequirementsList{InterfaceType: 5, BusNumber: 2, SlotNumber: 3, Alternatives: []IoResourceList{
+		{Version: 1, Revision: 1, Descriptors: []IoResource{mem}},
+		{Version: 1, Revision: 1},
+	}}
+
+	tests := []struct {
+		tv   TypedValue
+		want string
+	}{
+		{StringValue(`C:\x.exe`), `C:\x.exe`},
+		{ExpandStringValue(`%SystemRoot%\x.sys`), `%SystemRoot%\x.sys`},
+		{LinkValue(`\Registry\Machine\System\ControlSet001`), `\Registry\Machine\System\ControlSet001`},
+		{MultiStringValue{"kerberos", "msv1_0"}, "kerberos, msv1_0"},
+		{MultiStringValue{}, ""},
+		{DWordValue(0xFFFFFFFF), "4294967295 (0xFFFFFFFF)"},
+		{DWordBigEndianValue(0x100), "256 (0x100)"},
+		{QWordValue(1 << 40), "1099511627776 (0x10000000000)"},
+		{BinaryValue{0xDE, 0xAD}, "DEAD"},
+		{NoneValue{0x01}, "01"},
+		{NoneValue{}, ""},
+		{&ResourceList{Descriptors: []FullResourceDescriptor{*serial, {InterfaceType: 5, BusNumber: 1}}},
+			"interface 1 bus 0: Port 0x3F8 len 0x8, Interrupt level 4 vector 4, DeviceSpecific 4 bytes; interface 5 bus 1: "},
+		{serial, "interface 1 bus 0: Port 0x3F8 len 0x8, Interrupt level 4 vector 4, DeviceSpecific 4 bytes"},
+		{req, "interface 5 bus 2 slot 3: Memory 0xFED00000-0xFED00FFF len 0x1000 | "},
+		{UnknownValue{ValueType: 0x20, Data: []byte{1, 2}}, "0102"},
+	}
+	for _, tt := range tests {
+		v := NewValue("n", tt.tv)
+		if v.Type != tt.tv.Type() {
+			t.Errorf("%T: type %s", tt.tv, v.Type)
+		}
+		got, err := v.Typed()
+		if err != nil {
+			t.Errorf("%T: %v", tt.tv, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.tv) {
+			t.Errorf("%T: decoded %#v, want %#v", tt.tv, got, tt.tv)
+		}
+		if !bytes.Equal(got.Raw(), v.Data) {
+			t.Errorf("%T: Raw = % x, want % x", tt.tv, got.Raw(), v.Data)
+		}
+		if s := got.String(); s != tt.want {
+			t.Errorf("%T: String = %q, want %q", tt.tv, s, tt.want)
+		}
+	}
+
+	if n := len(req.Raw()); n != requirementsHeaderSize+8+ioResourceSize+8 || binary.LittleEndian.Uint32(req.Raw()) != uint32(n) {
+		t.Errorf("requirements list size = %d", n)
+	}
+	if n := len(serial.Raw()); n != fullResourceHeaderSize+3*partialResourceSize+4 {
+		t.Errorf("full descriptor size = %d", n)
+	}
+}
+
+func TestTypedEncoding(t *testing.T) {
+	if got := StringValue("ab").Raw(); !bytes.Equal(got, []byte{'a', 0, 'b', 0, 0, 0}) {
+		t.Errorf("REG_SZ raw = % x", got)
+	}
+	if got := LinkValue("ab").Raw(); !bytes.Equal(got, []byte{'a', 0, 'b', 0}) {
+		t.Errorf("REG_LINK raw = % x", got)
+	}
+	if got := (MultiStringValue{"a", "b"}).Raw(); !bytes.Equal(got, []byte{'a', 0, 0, 0, 'b', 0, 0, 0, 0, 0}) {
+		t.Errorf("REG_MULTI_SZ raw = % x", got)
+	}
+	if got := DWordBigEndianValue(1).Raw(); !bytes.Equal(got, []byte{0, 0, 0, 1}) {
+		t.Errorf("REG_DWORD_BIG_ENDIAN raw = % x", got)
+	}
+	v := Value{Name: "x", Type: REG_BINARY, Data: []byte{1}}
+	raw := v.Raw()
+	raw[0] = 9
+	if v.Data[0] != 1 {
+		t.Error("Raw returned the underlying slice")
+	}
+}
+
+func TestResourceAccessors(t *testing.T) {
+	large := PartialResource{Type: ResourceMemoryLarge, Flags: cmResourceMemoryLarge48}
+	binary.LittleEndian.PutUint64(large.Union[0:], 0x4000000000)
+	binary.LittleEndian.PutUint32(large.Union[8:], 2)
+	if start, n, ok := large.Range(); !ok || start != 0x4000000000 || n != 2<<16 {
+		t.Errorf("MemoryLarge range = %#x %#x %v", start, n, ok)
+	}
+	bus := PartialResource{Type: ResourceBusNumber}
+	binary.LittleEndian.PutUint32(bus.Union[0:], 1)
+	binary.LittleEndian.PutUint32(bus.Union[4:], 255)
+	if start, n, ok := bus.Range(); !ok || start != 1 || n != 255 {
+		t.Errorf("BusNumber range = %d %d %v", start, n, ok)
+	}
+	dma := PartialResource{Type: ResourceDma}
+	binary.LittleEndian.PutUint32(dma.Union[0:], 2)
+	if ch, _, ok := dma.DMA(); !ok || ch != 2 || dma.String() != "Dma channel 2" {
+		t.Errorf("DMA = %d %v %q", ch, ok, dma.String())
+	}
+	if _, _, _, ok := dma.Interrupt(); ok {
+		t.Error("Interrupt() on DMA resource")
+	}
+	if s := (PartialResource{Type: 200}).String(); s != "Type200" {
+		t.Errorf("unknown resource = %q", s)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	tests := []Value{
+		{Name: "d", Type: REG_DWORD, Data: []byte{1}},
+		{Name: "q", Type: REG_QWORD, Data: []byte{1, 2, 3, 4}},
+		{Name: "rl", Type: REG_RESOURCE_LIST, Data: []byte{1}},
+		{Name: "rl", Type: REG_RESOURCE_LIST, Data: []byte{1, 0, 0, 0, 1, 0, 0, 0}},
+		{Name: "full", Type: REG_FULL_RESOURCE_DESCRIPTOR, Data: append(make([]byte, 12), 1, 0, 0, 0)},
+		{Name: "req", Type: REG_RESOURCE_REQUIREMENTS_LIST, Data: make([]byte, 31)},
+	}
+	for _, v := range tests {
+		if _, err := v.Typed(); err == nil {
+			t.Errorf("%s % x: no error", v.Type, v.Data)
+		} else if !strings.Contains(err.Error(), v.Name) && v.Type > REG_QWORD {
+			t.Errorf("%s: error %q does not name the value", v.Type, err)
+		}
+		if !bytes.Equal(v.Raw(), v.Data) {
+			t.Errorf("%s: Raw differs", v.Type)
+		}
+	}
+
+	// DeviceSpecific的数据长度超出值。
+	d := (&FullResourceDescriptor{Partial: []PartialResource{{Type: ResourceDeviceSpecific, Data: []byte{1, 2}}}}).Raw()
+	if _, err := (Value{Type: REG_FULL_RESOURCE_DESCRIPTOR, Data: d[:len(d)-1]}).Typed(); err == nil {
+		t.Error("truncated device data accepted")
+	}
+}
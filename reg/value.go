@@ -0,0 +1,191 @@
+package reg
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ValueType 是注册表值的数据类型，取值与Windows的REG_*常量一致。
+type ValueType uint32
+
+const (
+	REG_NONE                       ValueType = 0
+	REG_SZ                         ValueType = 1
+	REG_EXPAND_SZ                  ValueType = 2
+	REG_BINARY                     ValueType = 3
+	REG_DWORD                      ValueType = 4
+	REG_DWORD_BIG_ENDIAN           ValueType = 5
+	REG_LINK                       ValueType = 6
+	REG_MULTI_SZ                   ValueType = 7
+	REG_RESOURCE_LIST              ValueType = 8
+	REG_FULL_RESOURCE_DESCRIPTOR   ValueType = 9
+	REG_RESOURCE_REQUIREMENTS_LIST ValueType = 10
+	REG_QWORD                      ValueType = 11
+)
+
+var valueTypeNames = []string{
+	"REG_NONE", "REG_SZ", "REG_EXPAND_SZ", "REG_BINARY", "REG_DWORD", "REG_DWORD_BIG_ENDIAN",
+	"REG_LINK", "REG_MULTI_SZ", "REG_RESOURCE_LIST", "REG_FULL_RESOURCE_DESCRIPTOR",
+	"REG_RESOURCE_REQUIREMENTS_LIST", "REG_QWORD",
+}
+
+func (t ValueType) String() string {
+	if int(t) < len(valueTypeNames) {
+		return valueTypeNames[t]
+	}
+	return fmt.Sprintf("REG_0x%X", uint32(t))
+}
+
+// MarshalText 将类型编码为 REG_SZ 形式的名称，使JSON中的类型便于阅读。
+func (t ValueType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText 解析 REG_SZ 或 REG_0x20 形式的类型名称。
+func (t *ValueType) UnmarshalText(b []byte) error {
+	s := string(b)
+	for i, name := range valueTypeNames {
+		if s == name {
+			*t = ValueType(i)
+			return nil
+		}
+	}
+	if strings.HasPrefix(s, "REG_0x") {
+		if n, err := strconv.ParseUint(s[6:], 16, 32); err == nil {
+			*t = ValueType(n)
+			return nil
+		}
+	}
+	return fmt.Errorf("reg: unknown value type %q", s)
+}
+
+// ErrValueType 表示按不匹配的类型读取注册表值。
+var ErrValueType = errors.New("reg: unexpected value type")
+
+// Value 是一个注册表值：名称、类型及原始数据。
+type Value struct {
+	// Name 值名称，默认值为空字符串。
+	Name string `json:"name"`
+	// Type 数据类型。
+	Type ValueType `json:"type"`
+	// Data 原始数据，字符串为UTF-16LE编码。
+	Data []byte `json:"data"`
+	// Deleted 值位于空闲单元格中，由Carve恢复或属于已删除的键。
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// AsString 读取REG_SZ、REG_EXPAND_SZ或REG_LINK值，去掉结尾的NUL。
+//   返回1 - 字符串
+//   返回2 - 类型不匹配时为ErrValueType，成功时为nil
+func (v Value) AsString() (string, error) {
+	switch v.Type {
+	case REG_SZ, REG_EXPAND_SZ, REG_LINK:
+		return decodeUTF16(v.Data), nil
+	}
+	return "", fmt.Errorf("%w: %s is %s", ErrValueType, v.Name, v.Type)
+}
+
+// AsStrings 读取REG_MULTI_SZ值，忽略结尾的空字符串。
+//   返回1 - 字符串列表
+//   返回2 - 类型不匹配时为ErrValueType，成功时为nil
+func (v Value) AsStrings() ([]string, error) {
+	if v.Type != REG_MULTI_SZ {
+		return nil, fmt.Errorf("%w: %s is %s", ErrValueType, v.Name, v.Type)
+	}
+	s := strings.TrimRight(decodeUTF16Full(v.Data), "\x00")
+	if s == "" {
+		return []string{}, nil
+	}
+	return strings.Split(s, "\x00"), nil
+}
+
+// AsInteger 读取REG_DWORD、REG_DWORD_BIG_ENDIAN或REG_QWORD值。
+//   返回1 - 整数值
+//   返回2 - 类型不匹配或数据长度不足时的错误，成功时为nil
+func (v Value) AsInteger() (uint64, error) {
+	switch v.Type {
+	case REG_DWORD, REG_DWORD_BIG_ENDIAN:
+		if len(v.Data) < 4 {
+			return 0, fmt.Errorf("reg: %s: %s data is %d bytes", v.Name, v.Type, len(v.Data))
+		}
+		if v.Type == REG_DWORD_BIG_ENDIAN {
+			return uint64(binary.BigEndian.Uint32(v.Data)), nil
+		}
+		return uint64(binary.LittleEndian.Uint32(v.Data)), nil
+	case REG_QWORD:
+		if len(v.Data) < 8 {
+			return 0, fmt.Errorf("reg: %s: %s data is %d bytes", v.Name, v.Type, len(v.Data))
+		}
+		return binary.LittleEndian.Uint64(v.Data), nil
+	}
+	return 0, fmt.Errorf("%w: %s is %s", ErrValueType, v.Name, v.Type)
+}
+
+// String 按EnumValues的格式输出值的字符串表示：整数为“十进制 (0x十六进制)”，
+// 多字符串以“, ”连接，二进制为十六进制，数据无法按类型解析时输出十六进制。
+//   返回 - 值的字符串表示
+func (v Value) String() string {
+	switch v.Type {
+	case REG_SZ, REG_EXPAND_SZ, REG_LINK:
+		s, _ := v.AsString()
+		return s
+	case REG_MULTI_SZ:
+		ss, _ := v.AsStrings()
+		return strings.Join(ss, ", ")
+	case REG_DWORD, REG_DWORD_BIG_ENDIAN, REG_QWORD:
+		if n, err := v.AsInteger(); err == nil {
+			return fmt.Sprintf("%d (0x%X)", n, n)
+		}
+	}
+	return fmt.Sprintf("%X", v.Data)
+}
+
+// MarshalJSON 在名称、类型和原始数据（base64）之外输出text字段，内容为值的显示形式。
+func (v Value) MarshalJSON() ([]byte, error) {
+	type plain Value
+	return json.Marshal(struct {
+		plain
+		Text string `json:"text"`
+	}{plain(v), displayValue(v)})
+}
+
+// displayValue 返回值的显示形式，可以类型化解码时使用解码结果。
+func displayValue(v Value) string {
+	if tv, err := v.Typed(); err == nil {
+		return tv.String()
+	}
+	return v.String()
+}
+
+// decodeUTF16 解码UTF-16LE字符串，在第一个NUL处截断。
+func decodeUTF16(b []byte) string {
+	s := decodeUTF16Full(b)
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+// encodeUTF16 将字符串编码为UTF-16LE，不追加NUL。
+func encodeUTF16(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+// decodeUTF16Full 解码全部UTF-16LE数据，奇数长度的最后一个字节被忽略。
+func decodeUTF16Full(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,43 @@
+package reg
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValueAccessors(t *testing.T) {
+	tests := []struct {
+		v    Value
+		want string
+	}{
+		{sz("s", "hello"), "hello"},
+		{Value{Type: REG_MULTI_SZ, Data: utf16le("a\x00b\x00\x00")}, "a, b"},
+		{Value{Type: REG_MULTI_SZ, Data: utf16le("\x00")}, ""},
+		{dword("d", 255), "255 (0xFF)"},
+		{Value{Type: REG_DWORD_BIG_ENDIAN, Data: []byte{0, 0, 1, 0}}, "256 (0x100)"},
+		{Value{Type: REG_BINARY, Data: []byte{0xDE, 0xAD}}, "DEAD"},
+		{Value{Type: REG_DWORD, Data: []byte{1}}, "01"},
+		{Value{Type: ValueType(0x20), Data: []byte{0x41}}, "41"},
+	}
+	for _, tt := range tests {
+		if got := tt.v.String(); got != tt.want {
+			t.Errorf("%s %x: String = %q, want %q", tt.v.Type, tt.v.Data, got, tt.want)
+		}
+	}
+
+	if _, err := dword("Start", 2).AsString(); !errors.Is(err, ErrValueType) {
+		t.Errorf("AsString(DWORD) err = %v", err)
+	}
+	if _, err := sz("Path", "x").AsInteger(); !errors.Is(err, ErrValueType) {
+		t.Errorf("AsInteger(SZ) err = %v", err)
+	}
+	if _, err := sz("Path", "x").AsStrings(); !errors.Is(err, ErrValueType) {
+		t.Errorf("AsStrings(SZ) err = %v", err)
+	}
+	if _, err := (Value{Type: REG_QWORD, Data: []byte{1, 2}}).AsInteger(); err == nil {
+		t.Error("short QWORD accepted")
+	}
+	if s := ValueType(0x20).String(); s != "REG_0x20" {
+		t.Errorf("ValueType(0x20) = %q", s)
+	}
+}
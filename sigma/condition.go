@@ -0,0 +1,232 @@
+package sigma
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/kitsch-9527/wcorefx/evtx"
+)
+
+// condNode 是条件表达式的语法树节点。
+type condNode interface {
+	eval(r *Rule, e *evtx.Event) bool
+}
+
+type (
+	condRef string
+	condNot struct{ x condNode }
+	condAnd []condNode
+	condOr  []condNode
+)
+
+func (c condRef) eval(r *Rule, e *evtx.Event) bool { return r.searches[string(c)].eval(e) }
+func (c condNot) eval(r *Rule, e *evtx.Event) bool { return !c.x.eval(r, e) }
+
+func (c condAnd) eval(r *Rule, e *evtx.Event) bool {
+	for _, x := range c {
+		if !x.eval(r, e) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c condOr) eval(r *Rule, e *evtx.Event) bool {
+	for _, x := range c {
+		if x.eval(r, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// condParser 解析条件表达式：
+//   expr    := and ("or" and)*
+//   and     := unary ("and" unary)*
+//   unary   := "not" unary | "(" expr ")" | ("1"|"all") "of" (pattern|"them") | identifier
+type condParser struct {
+	toks     []string
+	pos      int
+	searches map[string]search
+}
+
+func parseCondition(s string, searches map[string]search) (condNode, error) {
+	if strings.Contains(s, "|") {
+		return nil, errors.New("aggregation expressions not supported")
+	}
+	p := &condParser{toks: tokenizeCondition(s), searches: searches}
+	if len(p.toks) == 0 {
+		return nil, errors.New("empty condition")
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q", p.toks[p.pos])
+	}
+	return n, nil
+}
+
+func tokenizeCondition(s string) []string {
+	var toks []string
+	start := -1
+	for i, c := range s {
+		switch {
+		case c == '(' || c == ')':
+			if start >= 0 {
+				toks = append(toks, s[start:i])
+				start = -1
+			}
+			toks = append(toks, string(c))
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if start >= 0 {
+				toks = append(toks, s[start:i])
+				start = -1
+			}
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if start >= 0 {
+		toks = append(toks, s[start:])
+	}
+	return toks
+}
+
+func (p *condParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *condParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *condParser) parseOr() (condNode, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	nodes := condOr{x}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, y)
+	}
+	if len(nodes) == 1 {
+		return x, nil
+	}
+	return nodes, nil
+}
+
+func (p *condParser) parseAnd() (condNode, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	nodes := condAnd{x}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, y)
+	}
+	if len(nodes) == 1 {
+		return x, nil
+	}
+	return nodes, nil
+}
+
+func (p *condParser) parseUnary() (condNode, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, errors.New("unexpected end of condition")
+	case strings.EqualFold(t, "not"):
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return condNot{x}, nil
+	case t == "(":
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing )")
+		}
+		return x, nil
+	case t == ")":
+		return nil, errors.New("unexpected )")
+	case (t == "1" || strings.EqualFold(t, "all")) && strings.EqualFold(p.peek(), "of"):
+		p.next()
+		names, err := p.expandPattern(p.next())
+		if err != nil {
+			return nil, err
+		}
+		refs := make([]condNode, len(names))
+		for i, name := range names {
+			refs[i] = condRef(name)
+		}
+		if t == "1" {
+			return condOr(refs), nil
+		}
+		return condAnd(refs), nil
+	case isOperator(t):
+		return nil, fmt.Errorf("unexpected %q", t)
+	}
+	if _, ok := p.searches[t]; !ok {
+		return nil, fmt.Errorf("unknown search identifier %q", t)
+	}
+	return condRef(t), nil
+}
+
+// expandPattern 展开 "1 of"/"all of" 的目标：them表示全部不以_开头的检测项，其他按通配符匹配。
+func (p *condParser) expandPattern(pattern string) ([]string, error) {
+	if pattern == "" || isOperator(pattern) || pattern == "(" || pattern == ")" {
+		return nil, fmt.Errorf("expected search pattern after of, got %q", pattern)
+	}
+	var names []string
+	for name := range p.searches {
+		if strings.EqualFold(pattern, "them") {
+			if !strings.HasPrefix(name, "_") {
+				names = append(names, name)
+			}
+			continue
+		}
+		if ok, err := path.Match(pattern, name); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q", pattern)
+		} else if ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("pattern %q matches no search", pattern)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func isOperator(t string) bool {
+	switch strings.ToLower(t) {
+	case "and", "or", "not", "of":
+		return true
+	}
+	return false
+}
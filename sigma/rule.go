@@ -0,0 +1,254 @@
+// Package sigma 提供 Sigma 检测规则的加载与匹配功能，规则在进程内对 evtx.Event 求值，不依赖 Windows API。
+package sigma
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kitsch-9527/wcorefx/evtx"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule 是一条已编译的Sigma规则。
+type Rule struct {
+	// Title 规则标题。
+	Title string `yaml:"title"`
+	// ID 规则的UUID。
+	ID string `yaml:"id"`
+	// Status 规则状态，如 stable、test、experimental。
+	Status string `yaml:"status"`
+	// Description 规则描述。
+	Description string `yaml:"description"`
+	// Author 规则作者。
+	Author string `yaml:"author"`
+	// Level 告警级别，如 low、medium、high、critical。
+	Level string `yaml:"level"`
+	// Tags 标签，如 attack.t1059.001。
+	Tags []string `yaml:"tags"`
+	// References 参考链接。
+	References []string `yaml:"references"`
+	// FalsePositives 已知误报说明。
+	FalsePositives []string `yaml:"falsepositives"`
+	// LogSource 规则适用的日志来源。
+	LogSource LogSource `yaml:"logsource"`
+
+	searches  map[string]search
+	condition condNode
+}
+
+// LogSource 描述规则适用的日志来源。
+type LogSource struct {
+	// Product 产品，如 windows。
+	Product string `yaml:"product"`
+	// Service 服务，如 security、sysmon，已知服务会限制匹配的通道。
+	Service string `yaml:"service"`
+	// Category 类别，如 process_creation，不参与匹配。
+	Category string `yaml:"category"`
+}
+
+// serviceChannels 将logsource.service映射为事件通道。
+var serviceChannels = map[string]string{
+	"security":                  "Security",
+	"system":                    "System",
+	"application":               "Application",
+	"sysmon":                    "Microsoft-Windows-Sysmon/Operational",
+	"powershell":                "Microsoft-Windows-PowerShell/Operational",
+	"powershell-classic":        "Windows PowerShell",
+	"taskscheduler":             "Microsoft-Windows-TaskScheduler/Operational",
+	"wmi":                       "Microsoft-Windows-WMI-Activity/Operational",
+	"windefend":                 "Microsoft-Windows-Windows Defender/Operational",
+	"bits-client":               "Microsoft-Windows-Bits-Client/Operational",
+	"codeintegrity-operational": "Microsoft-Windows-CodeIntegrity/Operational",
+	"firewall-as":               "Microsoft-Windows-Windows Firewall With Advanced Security/Firewall",
+	"dns-server":                "DNS Server",
+	"ntlm":                      "Microsoft-Windows-NTLM/Operational",
+	"applocker":                 "Microsoft-Windows-AppLocker/EXE and DLL",
+}
+
+type ruleYAML struct {
+	Rule      `yaml:",inline"`
+	Action    string    `yaml:"action"`
+	Detection yaml.Node `yaml:"detection"`
+}
+
+// ParseRule 解析并编译单个Sigma规则文档。
+//   data - 规则YAML
+//   返回1 - 编译后的规则
+//   返回2 - YAML格式、检测项或条件表达式错误，成功时为nil
+func ParseRule(data []byte) (*Rule, error) {
+	rules, err := ParseRules(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) != 1 {
+		return nil, fmt.Errorf("expected 1 rule, got %d", len(rules))
+	}
+	return rules[0], nil
+}
+
+// ParseRules 解析以 --- 分隔的多个规则文档，不支持带action的规则集合。
+//   data - 规则YAML
+//   返回1 - 编译后的规则列表
+//   返回2 - 任一文档解析或编译失败时的错误，成功时为nil
+func ParseRules(data []byte) ([]*Rule, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var rules []*Rule
+	for i := 0; ; i++ {
+		var raw ruleYAML
+		err := dec.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return rules, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if raw.Detection.Kind == 0 && raw.Title == "" {
+			continue
+		}
+		if raw.Action != "" {
+			return nil, fmt.Errorf("document %d: rule collection action %q not supported", i, raw.Action)
+		}
+		r := raw.Rule
+		if err := r.compile(&raw.Detection); err != nil {
+			if r.Title != "" {
+				return nil, fmt.Errorf("rule %q: %w", r.Title, err)
+			}
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		rules = append(rules, &r)
+	}
+}
+
+// LoadFile 读取并编译规则文件。
+//   path - .yml/.yaml规则文件路径
+//   返回1 - 文件中的规则
+//   返回2 - 读取或编译失败时的错误，成功时为nil
+func LoadFile(path string) ([]*Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// LoadDir 递归加载目录下所有 .yml/.yaml 规则，按路径排序。
+//   dir - 规则目录
+//   返回1 - 全部规则
+//   返回2 - 遍历目录或任一规则编译失败时的错误，成功时为nil
+func LoadDir(dir string) ([]*Rule, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if !d.IsDir() && (ext == ".yml" || ext == ".yaml") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var rules []*Rule
+	for _, path := range paths {
+		r, err := LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r...)
+	}
+	return rules, nil
+}
+
+// Match 判断事件是否满足规则的日志来源与检测条件。
+//   e - 待匹配的事件
+//   返回 - 命中时为true
+func (r *Rule) Match(e *evtx.Event) bool {
+	if !r.LogSource.matches(e) {
+		return false
+	}
+	return r.condition.eval(r, e)
+}
+
+// Matches 返回命中事件的全部规则。
+//   rules - 规则列表
+//   e - 待匹配的事件
+//   返回 - 命中的规则，顺序与rules一致
+func Matches(rules []*Rule, e *evtx.Event) []*Rule {
+	var out []*Rule
+	for _, r := range rules {
+		if r.Match(e) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func (l LogSource) matches(e *evtx.Event) bool {
+	if l.Product != "" && !strings.EqualFold(l.Product, "windows") {
+		return false
+	}
+	channel, ok := serviceChannels[strings.ToLower(l.Service)]
+	return !ok || strings.EqualFold(e.Channel, channel)
+}
+
+// compile 编译detection节点：除condition外的每个键都是一个检测项。
+func (r *Rule) compile(n *yaml.Node) error {
+	if n.Kind != yaml.MappingNode {
+		return errors.New("detection must be a mapping")
+	}
+	r.searches = map[string]search{}
+	var conditions []string
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i].Value, n.Content[i+1]
+		switch key {
+		case "condition":
+			switch value.Kind {
+			case yaml.ScalarNode:
+				conditions = append(conditions, value.Value)
+			case yaml.SequenceNode:
+				for _, c := range value.Content {
+					conditions = append(conditions, c.Value)
+				}
+			default:
+				return errors.New("condition must be a string or list")
+			}
+		case "timeframe":
+			return errors.New("timeframe not supported")
+		default:
+			s, err := compileSearch(value)
+			if err != nil {
+				return fmt.Errorf("detection %s: %w", key, err)
+			}
+			r.searches[key] = s
+		}
+	}
+	if len(conditions) == 0 {
+		return errors.New("missing condition")
+	}
+	var nodes []condNode
+	for _, c := range conditions {
+		node, err := parseCondition(c, r.searches)
+		if err != nil {
+			return fmt.Errorf("condition %q: %w", c, err)
+		}
+		nodes = append(nodes, node)
+	}
+	r.condition = nodes[0]
+	if len(nodes) > 1 {
+		r.condition = condOr(nodes)
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+package sigma
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/kitsch-9527/wcorefx/evtx"
+	"gopkg.in/yaml.v3"
+)
+
+// search 是detection中的一个检测项：字段映射的列表（任一满足即命中），
+// 或关键字列表（任一关键字出现在事件数据中即命中）。
+type search struct {
+	groups   [][]fieldMatcher
+	keywords []valueMatcher
+}
+
+// fieldMatcher 匹配一个字段，values中任一值命中即可，all为true时要求全部命中。
+type fieldMatcher struct {
+	field  string
+	values []valueMatcher
+	all    bool
+	null   bool
+	exists *bool
+}
+
+// valueMatcher 是一个值编译后的候选正则，任一候选命中即视为该值命中。
+type valueMatcher []*regexp.Regexp
+
+func compileSearch(n *yaml.Node) (search, error) {
+	var s search
+	switch n.Kind {
+	case yaml.MappingNode:
+		g, err := compileGroup(n)
+		if err != nil {
+			return s, err
+		}
+		s.groups = append(s.groups, g)
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			switch item.Kind {
+			case yaml.MappingNode:
+				g, err := compileGroup(item)
+				if err != nil {
+					return s, err
+				}
+				s.groups = append(s.groups, g)
+			case yaml.ScalarNode:
+				m, err := compileValue(item.Value, []string{"contains"})
+				if err != nil {
+					return s, err
+				}
+				s.keywords = append(s.keywords, m)
+			default:
+				return s, fmt.Errorf("line %d: unsupported list item", item.Line)
+			}
+		}
+	default:
+		return s, fmt.Errorf("line %d: search must be a mapping or list", n.Line)
+	}
+	return s, nil
+}
+
+func compileGroup(n *yaml.Node) ([]fieldMatcher, error) {
+	var group []fieldMatcher
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i].Value, n.Content[i+1]
+		parts := strings.Split(key, "|")
+		fm := fieldMatcher{field: parts[0]}
+		var mods []string
+		for _, mod := range parts[1:] {
+			switch mod {
+			case "all":
+				fm.all = true
+			case "exists":
+				b := value.Value == "true"
+				if value.Kind != yaml.ScalarNode || (!b && value.Value != "false") {
+					return nil, fmt.Errorf("line %d: exists expects true or false", value.Line)
+				}
+				fm.exists = &b
+			default:
+				mods = append(mods, mod)
+			}
+		}
+		if fm.exists != nil {
+			group = append(group, fm)
+			continue
+		}
+		var scalars []*yaml.Node
+		switch value.Kind {
+		case yaml.ScalarNode:
+			scalars = []*yaml.Node{value}
+		case yaml.SequenceNode:
+			scalars = value.Content
+		default:
+			return nil, fmt.Errorf("line %d: field %s: value must be a scalar or list", value.Line, fm.field)
+		}
+		for _, v := range scalars {
+			if v.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: field %s: nested value", v.Line, fm.field)
+			}
+			if v.Tag == "!!null" {
+				fm.null = true
+				continue
+			}
+			m, err := compileValue(v.Value, mods)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", key, err)
+			}
+			fm.values = append(fm.values, m)
+		}
+		group = append(group, fm)
+	}
+	return group, nil
+}
+
+// compileValue 按修饰符将一个值编译为候选正则。普通值中的 * 与 ? 为通配符，
+// 可用 \* \? \\ 转义；编码类修饰符（base64、base64offset、wide）的结果按字面量匹配。
+func compileValue(v string, mods []string) (valueMatcher, error) {
+	variants := []string{v}
+	literal := false
+	mode := ""
+	reFlags := ""
+	for _, mod := range mods {
+		switch mod {
+		case "contains", "startswith", "endswith", "re":
+			if mode != "" {
+				return nil, fmt.Errorf("conflicting modifiers %s and %s", mode, mod)
+			}
+			mode = mod
+		case "i", "m", "s":
+			if mode != "re" {
+				return nil, fmt.Errorf("modifier %s requires re", mod)
+			}
+			reFlags += mod
+		case "wide", "utf16le":
+			for i, s := range variants {
+				variants[i] = utf16LE(s)
+			}
+			literal = true
+		case "base64":
+			for i, s := range variants {
+				variants[i] = base64.StdEncoding.EncodeToString([]byte(s))
+			}
+			literal = true
+		case "base64offset":
+			var out []string
+			for _, s := range variants {
+				out = append(out, base64Offsets(s)...)
+			}
+			variants = out
+			literal = true
+		default:
+			return nil, fmt.Errorf("unsupported modifier %q", mod)
+		}
+	}
+
+	var m valueMatcher
+	for _, s := range variants {
+		var expr string
+		if mode == "re" {
+			if reFlags != "" {
+				expr = "(?" + reFlags + ")"
+			}
+			expr += s
+		} else {
+			body := globToRegexp(s, literal)
+			switch mode {
+			case "contains":
+				body = ".*" + body + ".*"
+			case "startswith":
+				body += ".*"
+			case "endswith":
+				body = ".*" + body
+			}
+			expr = "(?is)^" + body + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("value %q: %w", v, err)
+		}
+		m = append(m, re)
+	}
+	return m, nil
+}
+
+// globToRegexp 将Sigma通配符字符串转换为正则表达式主体。
+func globToRegexp(s string, literal bool) string {
+	if literal {
+		return regexp.QuoteMeta(s)
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && (s[i+1] == '*' || s[i+1] == '?' || s[i+1] == '\\'):
+			b.WriteString(regexp.QuoteMeta(s[i+1 : i+2]))
+			i++
+		case c == '*':
+			b.WriteString(".*")
+		case c == '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(s[i : i+1]))
+		}
+	}
+	return b.String()
+}
+
+// base64Offsets 返回值在base64编码流中三种对齐方式下都稳定出现的片段。
+func base64Offsets(s string) []string {
+	start := []int{0, 2, 3}
+	end := []int{0, 3, 2}
+	var out []string
+	for i := 0; i < 3; i++ {
+		enc := base64.StdEncoding.EncodeToString([]byte(strings.Repeat(" ", i) + s))
+		e := len(enc) - end[(len(s)+i)%3]
+		if start[i] < e {
+			out = append(out, enc[start[i]:e])
+		}
+	}
+	return out
+}
+
+func utf16LE(s string) string {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 0, 2*len(u))
+	for _, c := range u {
+		b = append(b, byte(c), byte(c>>8))
+	}
+	return string(b)
+}
+
+func (m valueMatcher) match(s string) bool {
+	for _, re := range m {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s search) eval(e *evtx.Event) bool {
+	for _, kw := range s.keywords {
+		for _, v := range eventText(e) {
+			if kw.match(v) {
+				return true
+			}
+		}
+	}
+	for _, g := range s.groups {
+		matched := true
+		for _, fm := range g {
+			if !fm.eval(e) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (fm fieldMatcher) eval(e *evtx.Event) bool {
+	values, found := fieldValues(e, fm.field)
+	if fm.exists != nil {
+		return found == *fm.exists
+	}
+	if fm.null && (!found || (len(values) == 1 && values[0] == "")) {
+		return true
+	}
+	if !found || len(fm.values) == 0 {
+		return false
+	}
+	matchAny := func(m valueMatcher) bool {
+		for _, v := range values {
+			if m.match(v) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, m := range fm.values {
+		hit := matchAny(m)
+		if fm.all && !hit {
+			return false
+		}
+		if !fm.all && hit {
+			return true
+		}
+	}
+	return fm.all
+}
+
+// fieldValues 按名称取事件字段值：先精确匹配EventData/UserData，再匹配System字段
+// （EventID、Channel、Provider_Name等），最后不区分大小写地匹配EventData/UserData。
+func fieldValues(e *evtx.Event, name string) ([]string, bool) {
+	pairs := append(append([]evtx.KeyValue(nil), e.EventData.Pairs...), e.UserData.Pairs...)
+	var out []string
+	for _, kv := range pairs {
+		if kv.Key == name {
+			out = append(out, kv.Value)
+		}
+	}
+	if len(out) > 0 {
+		return out, true
+	}
+	if v, ok := systemField(e, name); ok {
+		return []string{v}, true
+	}
+	for _, kv := range pairs {
+		if strings.EqualFold(kv.Key, name) {
+			out = append(out, kv.Value)
+		}
+	}
+	return out, len(out) > 0
+}
+
+func systemField(e *evtx.Event, name string) (string, bool) {
+	switch name {
+	case "EventID":
+		return strconv.FormatUint(uint64(e.EventIdentifier.ID), 10), true
+	case "Channel":
+		return e.Channel, true
+	case "Computer":
+		return e.Computer, true
+	case "Provider_Name", "Provider":
+		return e.Provider.Name, true
+	case "Provider_Guid":
+		return e.Provider.GUID, e.Provider.GUID != ""
+	case "EventRecordID":
+		return strconv.FormatUint(e.RecordID, 10), true
+	case "Level":
+		return strconv.Itoa(int(e.LevelRaw)), true
+	case "Task":
+		return strconv.Itoa(int(e.TaskRaw)), true
+	case "Opcode":
+		if e.OpcodeRaw == nil {
+			return "", false
+		}
+		return strconv.Itoa(int(*e.OpcodeRaw)), true
+	case "Keywords":
+		return "0x" + strconv.FormatUint(uint64(e.KeywordsRaw), 16), true
+	case "Version":
+		return strconv.Itoa(int(e.Version)), true
+	case "ProcessID":
+		return strconv.FormatUint(uint64(e.Execution.ProcessID), 10), true
+	case "ThreadID":
+		return strconv.FormatUint(uint64(e.Execution.ThreadID), 10), true
+	case "UserID":
+		return e.User.Identifier, e.User.Identifier != ""
+	}
+	return "", false
+}
+
+// eventText 返回关键字检索的文本：全部EventData/UserData值及渲染后的消息。
+func eventText(e *evtx.Event) []string {
+	out := make([]string, 0, len(e.EventData.Pairs)+len(e.UserData.Pairs)+1)
+	for _, kv := range e.EventData.Pairs {
+		out = append(out, kv.Value)
+	}
+	for _, kv := range e.UserData.Pairs {
+		out = append(out, kv.Value)
+	}
+	if e.Message != "" {
+		out = append(out, e.Message)
+	}
+	return out
+}
@@ -0,0 +1,225 @@
+package sigma
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kitsch-9527/wcorefx/evtx"
+)
+
+// loadEvent 读取testdata/events下的事件XML。
+func loadEvent(t *testing.T, name string) *evtx.Event {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "events", name+".xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := evtx.UnmarshalXML(data)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return &e
+}
+
+func ruleIDs(rules []*Rule) []string {
+	ids := []string{}
+	for _, r := range rules {
+		ids = append(ids, r.ID[len(r.ID)-4:])
+	}
+	return ids
+}
+
+func TestLoadDirAndMatch(t *testing.T) {
+	rules, err := LoadDir(filepath.Join("testdata", "rules"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 8 {
+		t.Fatalf("LoadDir = %d rules, want 8", len(rules))
+	}
+	tests := []struct {
+		event string
+		want  []string
+	}{
+		{"security_4624", []string{"0008", "0001"}},
+		{"security_4624_local", []string{"0008"}},
+		{"security_1102", []string{"0006"}},
+		{"sysmon_1_office", []string{"0004", "0002", "0003"}},
+		{"sysmon_1_b64", []string{"0004", "0005"}},
+	}
+	for _, tt := range tests {
+		got := ruleIDs(Matches(rules, loadEvent(t, tt.event)))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: matched %v, want %v", tt.event, got, tt.want)
+		}
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	r, err := LoadFile(filepath.Join("testdata", "rules", "keywords_mimikatz.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := loadEvent(t, "sysmon_1_b64")
+	if r[0].Match(e) {
+		t.Error("keywords matched clean event")
+	}
+	e.EventData.Pairs = append(e.EventData.Pairs, evtx.KeyValue{Key: "CommandLine", Value: `x.exe "sekurlsa::logonpasswords" exit`})
+	if !r[0].Match(e) {
+		t.Error("keywords did not match sekurlsa::*")
+	}
+	e.EventData.Pairs = nil
+	e.Message = "Process started: MimiKatz.exe"
+	if !r[0].Match(e) {
+		t.Error("keywords did not match message")
+	}
+}
+
+func TestConditions(t *testing.T) {
+	e := loadEvent(t, "security_4624")
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{"a", true},
+		{"not a", false},
+		{"a and b", false},
+		{"a or b", true},
+		{"not (a and b)", true},
+		{"a and not b and not c", true},
+		{"1 of x*", true},
+		{"all of x*", false},
+		{"all of them", false},
+		{"1 of them", true},
+		{"b or c or x1", true},
+		{"(a or b) and (c or x1)", true},
+		{"not not a", true},
+	}
+	for _, tt := range tests {
+		doc := `
+title: cond
+detection:
+  a:
+    EventID: 4624
+  b:
+    EventID: 4625
+  c:
+    TargetUserName: bob
+  x1:
+    TargetUserName: ALICE
+  x2:
+    IpAddress: 10.*
+  condition: ` + tt.cond + "\n"
+		r, err := ParseRule([]byte(doc))
+		if err != nil {
+			t.Errorf("%s: %v", tt.cond, err)
+			continue
+		}
+		if got := r.Match(e); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.cond, got, tt.want)
+		}
+	}
+}
+
+func TestFieldModifiers(t *testing.T) {
+	e := loadEvent(t, "sysmon_1_office")
+	tests := []struct {
+		field string
+		want  bool
+	}{
+		{`Image: 'c:\windows\system32\windowspowershell\v1.0\powershell.exe'`, true},
+		{`Image: '*\powershell.exe'`, true},
+		{`Image: '*\power?hell.exe'`, true},
+		{`Image: 'powershell.exe'`, false},
+		{`Image|startswith: 'C:\Windows\'`, true},
+		{`Image|endswith: '\pwsh.exe'`, false},
+		{`CommandLine|contains|all: ['-nop', '-enc', 'mimikatz']`, false},
+		{`CommandLine|re: '-W Hidden'`, true},
+		{`CommandLine|re: '-w hidden'`, false},
+		{`CommandLine|re|i: '-w hidden'`, true},
+		{`IntegrityLevel: [High, System]`, false},
+		{`User|endswith: '\alice'`, true},
+		{`EventID: [1, 3]`, true},
+		{`Channel: 'microsoft-windows-sysmon/operational'`, true},
+		{`UserID: S-1-5-18`, true},
+		{`Missing: null`, true},
+		{`Image: null`, false},
+		{`Missing|exists: false`, true},
+		{`Image: 'C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe\*'`, false},
+		{`CommandLine|base64|contains: 'abc'`, false},
+		{`ParentImage|contains: 'Office16\\WINWORD'`, true},
+	}
+	for _, tt := range tests {
+		doc := "title: mod\ndetection:\n  sel:\n    " + tt.field + "\n  condition: sel\n"
+		r, err := ParseRule([]byte(doc))
+		if err != nil {
+			t.Errorf("%s: %v", tt.field, err)
+			continue
+		}
+		if got := r.Match(e); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestLogSource(t *testing.T) {
+	e := loadEvent(t, "sysmon_1_office")
+	for _, tt := range []struct {
+		logsource string
+		want      bool
+	}{
+		{"product: windows\n  service: sysmon", true},
+		{"product: windows\n  service: security", false},
+		{"product: linux", false},
+		{"product: windows\n  category: process_creation", true},
+		{"service: some-custom-service", true},
+	} {
+		doc := "title: ls\nlogsource:\n  " + tt.logsource + "\ndetection:\n  sel:\n    EventID: 1\n  condition: sel\n"
+		r, err := ParseRule([]byte(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Match(e); got != tt.want {
+			t.Errorf("logsource %q = %v, want %v", tt.logsource, got, tt.want)
+		}
+	}
+}
+
+func TestBase64Offsets(t *testing.T) {
+	got := base64Offsets("/bin/sh")
+	want := []string{"L2Jpbi9za", "9iaW4vc2", "vYmluL3No"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("base64Offsets = %v, want %v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		detection string
+		err       string
+	}{
+		{"sel:\n    Image|windash: x\n  condition: sel", "unsupported modifier"},
+		{"sel:\n    Image: x\n  condition: sel and other", "unknown search identifier"},
+		{"sel:\n    Image: x\n  condition: sel | count() > 5", "aggregation"},
+		{"sel:\n    Image: x\n  timeframe: 5m\n  condition: sel", "timeframe"},
+		{"sel:\n    Image: x", "missing condition"},
+		{"sel:\n    Image: x\n  condition: 1 of foo*", "matches no search"},
+		{"sel:\n    Image: x\n  condition: (sel", "missing )"},
+		{"sel:\n    Image: x\n  condition: sel sel", "unexpected"},
+		{"sel:\n    Image|contains|startswith: x\n  condition: sel", "conflicting modifiers"},
+		{"sel:\n    Image|re: '('\n  condition: sel", "missing closing"},
+		{"sel: 5\n  condition: sel", "mapping or list"},
+	}
+	for _, tt := range tests {
+		_, err := ParseRule([]byte("title: bad\ndetection:\n  " + tt.detection + "\n"))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: err = %v, want %q", tt.detection, err, tt.err)
+		}
+	}
+	if _, err := ParseRules([]byte("action: global\ntitle: x\n")); err == nil {
+		t.Error("action document accepted")
+	}
+}
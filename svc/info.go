@@ -0,0 +1,14 @@
+// Package svc 提供 Windows 服务枚举和信息查询功能。
+package svc
+
+// ServiceInfo 表示 Windows 服务信息。
+type ServiceInfo struct {
+	Name        string
+	DisplayName string
+	Status      string
+	PID         uint32
+	StartType   string
+	Account     string
+	// ImagePath 服务的命令行（含参数），来自服务配置的 BinaryPathName
+	ImagePath string
+}
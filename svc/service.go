@@ -1,6 +1,5 @@
 //go:build windows
 
-// Package svc 提供 Windows 服务枚举和信息查询功能。
 package svc
 
 import (
@@ -35,16 +34,6 @@ const (
 	serviceQueryStatus = 0x00004
 )
 
-// ServiceInfo 表示 Windows 服务信息。
-type ServiceInfo struct {
-	Name        string
-	DisplayName string
-	Status      string
-	PID         uint32
-	StartType   string
-	Account     string
-}
-
 // statusString 将服务状态常量转换为可读字符串。
 func statusString(s uint32) string {
 	switch s {
@@ -133,6 +122,7 @@ func List() ([]ServiceInfo, error) {
 			config, cerr := queryConfig(h)
 			if cerr == nil {
 				si.StartType = startTypeString(config.StartType)
+				si.ImagePath = windows.UTF16PtrToString(config.BinaryPathName)
 				if config.ServiceStartName != nil {
 					si.Account = windows.UTF16PtrToString(config.ServiceStartName)
 				}
@@ -197,6 +187,7 @@ func Config(name string) (ServiceInfo, error) {
 	si := ServiceInfo{
 		Name:      name,
 		StartType: startTypeString(config.StartType),
+		ImagePath: windows.UTF16PtrToString(config.BinaryPathName),
 	}
 	if config.ServiceStartName != nil {
 		si.Account = windows.UTF16PtrToString(config.ServiceStartName)
@@ -1,5 +1,3 @@
-//go:build windows
-
 // Package task provides Windows Scheduled Task enumeration.
 package task
 
@@ -11,8 +9,6 @@ import (
 	"path/filepath"
 	"strings"
 	"unicode/utf16"
-
-	"golang.org/x/sys/windows"
 )
 
 // TaskInfo 表示计划任务信息
@@ -61,26 +57,6 @@ type taskXML struct {
 	} `xml:"Principals"`
 }
 
-// taskDir 返回系统任务目录
-func taskDir() (string, error) {
-	winDir, err := windows.GetWindowsDirectory()
-	if err != nil {
-		return "", fmt.Errorf("GetWindowsDirectory failed: %w", err)
-	}
-	return winDir + "\\System32\\Tasks", nil
-}
-
-// List 枚举所有计划任务
-//   返回 - 计划任务信息列表
-//   返回 - 错误信息
-func List() ([]TaskInfo, error) {
-	dir, err := taskDir()
-	if err != nil {
-		return nil, err
-	}
-	return ListFrom(dir)
-}
-
 // ListFrom 枚举指定目录下的所有计划任务
 //   dir - 任务文件目录路径
 //   返回 - 计划任务信息列表
@@ -123,7 +99,8 @@ func normalizeName(root, path string) string {
 	if err != nil {
 		return path
 	}
-	return "\\" + rel
+	// 在非Windows系统上分析采集的任务目录时同样使用反斜杠
+	return "\\" + strings.ReplaceAll(filepath.ToSlash(rel), "/", "\\")
 }
 
 // ParseXML 解析任务XML内容并返回任务信息
@@ -0,0 +1,29 @@
+//go:build windows
+
+package task
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// taskDir 返回系统任务目录
+func taskDir() (string, error) {
+	winDir, err := windows.GetWindowsDirectory()
+	if err != nil {
+		return "", fmt.Errorf("GetWindowsDirectory failed: %w", err)
+	}
+	return winDir + "\\System32\\Tasks", nil
+}
+
+// List 枚举所有计划任务
+//   返回 - 计划任务信息列表
+//   返回 - 错误信息
+func List() ([]TaskInfo, error) {
+	dir, err := taskDir()
+	if err != nil {
+		return nil, err
+	}
+	return ListFrom(dir)
+}